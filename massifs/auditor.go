@@ -0,0 +1,280 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+type AuditFailureReason string
+
+const (
+	// AuditMassifUnreadable the massif could not be read
+	AuditMassifUnreadable AuditFailureReason = "massif-unreadable"
+	// AuditMassifStart the massif start header does not follow on from the previous massif
+	AuditMassifStart AuditFailureReason = "massif-start"
+	// AuditPeakStack an ancestor peak does not match the previous massif
+	AuditPeakStack AuditFailureReason = "peak-stack"
+	// AuditNodeHash an interior node does not match the hash of its children
+	AuditNodeHash AuditFailureReason = "node-hash"
+	// AuditTrieHeader the trie header does not match the trie keys of the massif
+	AuditTrieHeader AuditFailureReason = "trie-header"
+	// AuditSealMissing the seal for the massif could not be read. The head
+	// massif is not required to have a seal, see AuditReport.UnsealedSize
+	AuditSealMissing AuditFailureReason = "seal-missing"
+	// AuditSealVerify the seal signature, or its state, does not verify against the massif
+	AuditSealVerify AuditFailureReason = "seal-verify"
+	// AuditSealConsistency the seal is not consistent with the seal of the previous massif
+	AuditSealConsistency AuditFailureReason = "seal-consistency"
+)
+
+// AuditFailure describes a single failed check
+type AuditFailure struct {
+	MassifIndex uint32
+	// MMRIndex is the node the failure concerns. Where the failure is not
+	// specific to a node, it is the first index of the massif.
+	MMRIndex uint64
+	Reason   AuditFailureReason
+	Detail   string
+}
+
+// AuditReport is the result of auditing a complete tenant log
+type AuditReport struct {
+	TenantIdentity string
+	// MassifCount is the number of massifs audited
+	MassifCount uint32
+	// SealedState is the state from the last seal which verified
+	SealedState *MMRState
+	// MMRSize is the size of the log audited
+	MMRSize uint64
+	// UnsealedSize is the number of nodes after the state of the last seal
+	// which verified. A live log normally has nodes which are not yet sealed,
+	// and its head massif may have no seal, neither is a failure.
+	UnsealedSize uint64
+	Failures     []AuditFailure
+}
+
+// OK returns true if all the checks passed
+func (r *AuditReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+// AuditMassifReader is satisfied by MassifReader and LocalReader
+type AuditMassifReader interface {
+	MassifGetter
+	GetHeadMassif(
+		ctx context.Context, tenantIdentity string,
+		opts ...ReaderOption,
+	) (MassifContext, error)
+}
+
+// Auditor verifies every massif, and every seal, of a tenant log.
+//
+// Where GetVerifiedContext checks a single massif against its seal, the
+// auditor checks the whole log: each massif must follow on from the previous,
+// including its ancestor peak stack, every interior node is re-computed from
+// its children, and each seal must be consistent with the previous seal.
+// Failures are collected into a report rather than ending the audit, so that
+// all the damage to a log can be assessed at once.
+type Auditor struct {
+	log     logger.Logger
+	massifs AuditMassifReader
+	opts    []ReaderOption
+}
+
+// NewAuditor creates an auditor reading from a remote or local log. The
+// options are provided to every read and seal verification, and must include
+// a seal getter and a CBOR codec. WithTrustedSealerPub should be provided to
+// ensure the seals were created by the expected key.
+func NewAuditor(log logger.Logger, massifs AuditMassifReader, opts ...ReaderOption) Auditor {
+	return Auditor{
+		log:     log,
+		massifs: massifs,
+		opts:    opts,
+	}
+}
+
+// Audit checks every massif from 0 to the head of the tenant log. An error is
+// returned only if the audit could not be carried out, failed checks are
+// recorded in the report.
+func (a *Auditor) Audit(ctx context.Context, tenantIdentity string) (*AuditReport, error) {
+
+	options, err := checkedVerifiedContextOptions(ReaderOptions{}, a.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := a.massifs.GetHeadMassif(ctx, tenantIdentity, a.opts...)
+	if err != nil {
+		return nil, err
+	}
+	massifHeight := head.Start.MassifHeight
+
+	report := &AuditReport{TenantIdentity: tenantIdentity}
+	store := NewMultiMassifStore(ctx, a.massifs, tenantIdentity, massifHeight, 0, a.opts...)
+
+	var prev *MassifContext
+	for massifIndex := uint32(0); massifIndex <= head.Start.MassifIndex; massifIndex++ {
+
+		report.MassifCount++
+		firstIndex := mmr.MMRIndex(options.logConfig.massifFirstLeaf(massifHeight, massifIndex))
+		fail := func(mmrIndex uint64, reason AuditFailureReason, format string, args ...any) {
+			report.Failures = append(report.Failures, AuditFailure{
+				MassifIndex: massifIndex, MMRIndex: mmrIndex, Reason: reason, Detail: fmt.Sprintf(format, args...),
+			})
+		}
+
+		mc, err := a.massifs.GetMassif(ctx, tenantIdentity, uint64(massifIndex), a.opts...)
+		if err != nil {
+			fail(firstIndex, AuditMassifUnreadable, "%v", err)
+			prev = nil
+			continue
+		}
+
+		if mc.Start.MassifIndex != massifIndex ||
+			mc.Start.MassifHeight != options.logConfig.massifHeight(massifHeight, massifIndex) ||
+			mc.Start.FirstIndex != firstIndex || (prev != nil && prev.RangeCount() != firstIndex) {
+			fail(firstIndex, AuditMassifStart,
+				"massif %d, height %d, first index %d", mc.Start.MassifIndex, mc.Start.MassifHeight, mc.Start.FirstIndex)
+		}
+
+		if prev != nil {
+			a.auditPeakStack(prev, &mc, fail)
+		}
+		a.auditNodes(&mc, fail)
+		a.auditTrieHeader(&mc, fail)
+
+		prev = &mc
+
+		if _, _, err = options.sealGetter.GetSignedRoot(ctx, tenantIdentity, massifIndex, a.opts...); err != nil {
+			// The head massif of a live log may not be sealed yet
+			if massifIndex != head.Start.MassifIndex || !IsBlobNotFound(err) {
+				fail(firstIndex, AuditSealMissing, "%v", err)
+			}
+			continue
+		}
+		verified, err := mc.verifyContext(ctx, options)
+		if err != nil {
+			fail(firstIndex, AuditSealVerify, "%v", err)
+			continue
+		}
+
+		state := verified.MMRState
+		if report.SealedState != nil {
+			if _, err = store.CheckConsistency(*report.SealedState, state); err != nil {
+				fail(firstIndex, AuditSealConsistency,
+					"MMR(%d) to MMR(%d): %v", report.SealedState.MMRSize, state.MMRSize, err)
+				continue
+			}
+		}
+		report.SealedState = &state
+	}
+
+	report.MMRSize = head.RangeCount()
+	report.UnsealedSize = report.MMRSize
+	if report.SealedState != nil && report.SealedState.MMRSize <= report.MMRSize {
+		report.UnsealedSize -= report.SealedState.MMRSize
+	}
+	return report, nil
+}
+
+// auditPeakStack checks the ancestor peak stack of the massif is the stack
+// carried forward from the previous massif.
+func (a *Auditor) auditPeakStack(
+	prev *MassifContext, mc *MassifContext,
+	fail func(uint64, AuditFailureReason, string, ...any),
+) {
+	expected, err := prev.NextPeakStack()
+	if err != nil {
+		fail(mc.Start.FirstIndex, AuditPeakStack, "%v", err)
+		return
+	}
+	stored, err := mc.GetAncestorPeakStack()
+	if err != nil {
+		fail(mc.Start.FirstIndex, AuditPeakStack, "%v", err)
+		return
+	}
+	if len(expected) != len(stored) {
+		fail(mc.Start.FirstIndex, AuditPeakStack, "%d peaks expected, %d stored",
+			len(expected)/ValueBytes, len(stored)/ValueBytes)
+		return
+	}
+
+	// The stack map records the mmr index of each stack entry
+	stackIndices := make(map[int]uint64, len(mc.peakStackMap))
+	for mmrIndex, stackIndex := range mc.peakStackMap {
+		stackIndices[stackIndex] = mmrIndex
+	}
+	for i := 0; i < len(stored)/ValueBytes; i++ {
+		if bytes.Equal(stored[i*ValueBytes:(i+1)*ValueBytes], expected[i*ValueBytes:(i+1)*ValueBytes]) {
+			continue
+		}
+		mmrIndex, ok := stackIndices[i]
+		if !ok {
+			mmrIndex = mc.Start.FirstIndex
+		}
+		fail(mmrIndex, AuditPeakStack, "peak stack entry %d", i)
+	}
+}
+
+// auditNodes re-computes every interior node in the massif from its children
+func (a *Auditor) auditNodes(mc *MassifContext, fail func(uint64, AuditFailureReason, string, ...any)) {
+
+	hasher := mc.Hasher()
+	for i := mc.Start.FirstIndex; i < mc.RangeCount(); i++ {
+		height := mmr.IndexHeight(i)
+		if height == 0 {
+			continue
+		}
+		expected, err := interiorNodeHash(mc, hasher, i, height)
+		if err != nil {
+			fail(i, AuditNodeHash, "%v", err)
+			continue
+		}
+		value, err := mc.Get(i)
+		if err != nil {
+			fail(i, AuditNodeHash, "%v", err)
+			continue
+		}
+		if !bytes.Equal(value, expected) {
+			fail(i, AuditNodeHash, "height %d", height)
+		}
+	}
+}
+
+// interiorNodeHash computes the value of the interior node at i, of the
+// provided height, from its children. See mmr.AddHashedLeaf
+func interiorNodeHash(store NodeGetter, hasher hash.Hash, i uint64, height uint64) ([]byte, error) {
+	left, err := store.Get(i - (2 << (height - 1)))
+	if err != nil {
+		return nil, err
+	}
+	right, err := store.Get(i - 1)
+	if err != nil {
+		return nil, err
+	}
+	return mmr.HashPosPair64(hasher, i+1, left, right), nil
+}
+
+// auditTrieHeader checks the trie header, if set, is the trie root for the
+// massif. The header is all zeros until the massif is complete, and for
+// massifs written before the trie header was introduced.
+func (a *Auditor) auditTrieHeader(mc *MassifContext, fail func(uint64, AuditFailureReason, string, ...any)) {
+
+	header := mc.GetTrieHeader()
+	if bytes.Equal(header, make([]byte, len(header))) {
+		return
+	}
+	root, err := mc.TrieRoot(mc.RangeCount())
+	if err != nil {
+		fail(mc.Start.FirstIndex, AuditTrieHeader, "%v", err)
+		return
+	}
+	if !bytes.Equal(header, root) {
+		fail(mc.Start.FirstIndex, AuditTrieHeader, "the trie header is not the root of the massif trie keys")
+	}
+}
@@ -0,0 +1,127 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditor checks a correct log passes the audit, and that corrupted
+// nodes, peak stacks and seals are reported against the appropriate massif.
+func TestAuditor(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log, massifs := newSealedTestLog(t, tenant, massifHeight, testLeafEntries(0, 10))
+	store, codec := log.store, log.codec
+	reader := NewMassifReader(nil, store)
+
+	sealReader := log.sealReader()
+	auditor := NewAuditor(nil, &reader, WithSealGetter(&sealReader), WithCBORCodec(codec))
+
+	report, err := auditor.Audit(ctx, tenant)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%v", report.Failures)
+	assert.Equal(t, uint32(3), report.MassifCount)
+	require.NotNil(t, report.SealedState)
+	assert.Equal(t, massifs[2].RangeCount(), report.SealedState.MMRSize)
+	assert.Equal(t, uint64(0), report.UnsealedSize)
+
+	// Corrupt the interior node 9 of massif 1 and the single ancestor peak of massif 2
+	corrupt := func(mc MassifContext, offset uint64) {
+		data := append([]byte(nil), mc.Data...)
+		data[offset] ^= 0xff
+		_, err := store.Put(ctx, mc.BlobPath, data)
+		require.NoError(t, err)
+	}
+	corrupt(massifs[1], massifs[1].LogStart()+(9-massifs[1].Start.FirstIndex)*LogEntryBytes)
+	corrupt(massifs[2], massifs[2].PeakStackStart())
+
+	report, err = auditor.Audit(ctx, tenant)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+
+	var reasons []AuditFailureReason
+	for _, f := range report.Failures {
+		reasons = append(reasons, f.Reason)
+		switch f.Reason {
+		case AuditNodeHash:
+			assert.Equal(t, uint32(1), f.MassifIndex)
+			assert.Contains(t, []uint64{9, 13}, f.MMRIndex)
+		case AuditPeakStack:
+			assert.Equal(t, uint32(2), f.MassifIndex)
+			assert.Equal(t, uint64(14), f.MMRIndex)
+		}
+	}
+	assert.Contains(t, reasons, AuditNodeHash)
+	assert.Contains(t, reasons, AuditPeakStack)
+	assert.Contains(t, reasons, AuditSealVerify)
+
+	// A log which does not exist can not be audited
+	_, err = auditor.Audit(ctx, "tenant/unknown")
+	assert.Error(t, err)
+}
+
+// TestAuditor_UnsealedHead checks the nodes of a live log which are not yet
+// sealed, including a head massif without a seal, are not failures.
+func TestAuditor_UnsealedHead(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log, massifs := newSealedTestLog(t, tenant, massifHeight, testLeafEntries(0, 10))
+	store, codec := log.store, log.codec
+	reader := NewMassifReader(nil, store)
+	sealedSize := massifs[2].RangeCount()
+
+	sealReader := log.sealReader()
+	auditor := NewAuditor(nil, &reader, WithSealGetter(&sealReader), WithCBORCodec(codec))
+
+	// Leaf 10 is added to the sealed head massif, then leaves 11 and 12 start
+	// massif 3, which has no seal
+	for _, count := range []uint64{1, 2} {
+		log.addLeaves(t, testLeafEntries(10, count))
+		head, err := reader.GetHeadMassif(ctx, tenant)
+		require.NoError(t, err)
+
+		report, err := auditor.Audit(ctx, tenant)
+		require.NoError(t, err)
+		assert.True(t, report.OK(), "%v", report.Failures)
+		assert.Equal(t, head.Start.MassifIndex+1, report.MassifCount)
+		require.NotNil(t, report.SealedState)
+		assert.Equal(t, sealedSize, report.SealedState.MMRSize)
+		assert.Equal(t, head.RangeCount(), report.MMRSize)
+		assert.Equal(t, head.RangeCount()-sealedSize, report.UnsealedSize)
+	}
+
+	// A missing seal before the head is still a failure
+	auditor = NewAuditor(nil, &reader, WithSealGetter(missingSealGetter{SealGetter: &sealReader, missing: 1}),
+		WithCBORCodec(codec))
+	report, err := auditor.Audit(ctx, tenant)
+	require.NoError(t, err)
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, AuditSealMissing, report.Failures[0].Reason)
+	assert.Equal(t, uint32(1), report.Failures[0].MassifIndex)
+}
+
+// missingSealGetter reports the seal of one massif as not found
+type missingSealGetter struct {
+	SealGetter
+	missing uint32
+}
+
+func (g missingSealGetter) GetSignedRoot(
+	ctx context.Context, tenantIdentity string, massifIndex uint32, opts ...ReaderOption,
+) (*cose.CoseSign1Message, MMRState, error) {
+	if massifIndex == g.missing {
+		return nil, MMRState{}, ErrBlobNotFound
+	}
+	return g.SealGetter.GetSignedRoot(ctx, tenantIdentity, massifIndex, opts...)
+}
@@ -94,6 +94,10 @@ func IsRateLimiting(err error) (time.Duration, bool) {
 	if err == nil {
 		return 0, false
 	}
+	var rlerr *RateLimitError
+	if errors.As(err, &rlerr) {
+		return rlerr.RetryAfter, true
+	}
 	rerr, ok := AsResponseError(err)
 	if !ok {
 		return 0, false
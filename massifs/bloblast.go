@@ -3,8 +3,6 @@ package massifs
 import (
 	"context"
 	"errors"
-
-	"github.com/datatrails/go-datatrails-common/azblob"
 )
 
 var (
@@ -15,18 +13,18 @@ var (
 // And the total number of blobs under the path.
 func LastPrefixedBlob(
 	ctx context.Context, store LogBlobReader, blobPrefixPath string,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (LogBlobContext, uint64, error) {
 
 	bc := LogBlobContext{}
 
 	var foundCount uint64
 
-	opts = append([]azblob.Option{azblob.WithListPrefix(blobPrefixPath)}, opts...)
+	opts = append([]ObjectOption{WithListPrefix(blobPrefixPath)}, opts...)
 
-	var marker azblob.ListMarker
+	var marker string
 	for {
-		r, err := store.List(ctx, append(opts, azblob.WithListMarker(marker))...)
+		r, err := store.List(ctx, append(opts, WithListMarker(marker))...)
 		if err != nil {
 			return bc, foundCount, err
 		}
@@ -38,15 +36,13 @@ func LastPrefixedBlob(
 
 		// we want the _last_ listed, so we just keep over-writing
 		i := r.Items[len(r.Items)-1]
-		bc.ETag = *i.Properties.Etag
-		bc.LastModified = *i.Properties.LastModified
-		if i.Properties.ContentLength != nil {
-			bc.ContentLength = *i.Properties.ContentLength
-		}
-		bc.BlobPath = *i.Name
+		bc.ETag = i.ETag
+		bc.LastModified = i.LastModified
+		bc.ContentLength = i.ContentLength
+		bc.BlobPath = i.Path
 		marker = r.Marker
-		if marker == nil || *marker == "" {
-			bc.Tags = listResponseTags(i.BlobTags)
+		if marker == "" {
+			bc.Tags = i.Tags
 			break
 		}
 	}
@@ -57,14 +53,14 @@ func LastPrefixedBlob(
 // FirstPrefixedBlob returns the first blob found under the prefix path
 func FirstPrefixedBlob(
 	ctx context.Context, store LogBlobReader, blobPrefixPath string,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (LogBlobContext, error) {
 
 	bc := LogBlobContext{}
 
-	opts = append([]azblob.Option{
-		azblob.WithListPrefix(blobPrefixPath),
-		azblob.WithListMaxResults(1),
+	opts = append([]ObjectOption{
+		WithListPrefix(blobPrefixPath),
+		WithListMaxResults(1),
 	}, opts...)
 
 	r, err := store.List(ctx, opts...)
@@ -76,13 +72,11 @@ func FirstPrefixedBlob(
 	}
 
 	i := r.Items[0]
-	bc.ETag = *i.Properties.Etag
-	bc.LastModified = *i.Properties.LastModified
-	if i.Properties.ContentLength != nil {
-		bc.ContentLength = *i.Properties.ContentLength
-	}
-	bc.BlobPath = *i.Name
-	bc.Tags = listResponseTags(r.Items[0].BlobTags)
+	bc.ETag = i.ETag
+	bc.LastModified = i.LastModified
+	bc.ContentLength = i.ContentLength
+	bc.BlobPath = i.Path
+	bc.Tags = i.Tags
 
 	return bc, nil
 }
@@ -96,18 +90,18 @@ func PrefixedBlobLastN(
 	store LogBlobReader,
 	blobPrefixPath string,
 	n int,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) ([]LogBlobContext, uint64, error) {
 
-	opts = append([]azblob.Option{azblob.WithListPrefix(blobPrefixPath)}, opts...)
+	opts = append([]ObjectOption{WithListPrefix(blobPrefixPath)}, opts...)
 
 	tail := make([]LogBlobContext, n)
 
 	var foundCount uint64
 
-	var marker azblob.ListMarker
+	var marker string
 	for {
-		r, err := store.List(ctx, append(opts, azblob.WithListMarker(marker))...)
+		r, err := store.List(ctx, append(opts, WithListMarker(marker))...)
 		if err != nil {
 			return tail, foundCount, err
 		}
@@ -133,17 +127,15 @@ func PrefixedBlobLastN(
 			// stale is also the count of items we are taking from items.
 
 			it := r.Items[len(r.Items)-stale+i]
-			tail[n-stale+i].ETag = *it.Properties.Etag
-			tail[n-stale+i].LastModified = *it.Properties.LastModified
-			if it.Properties.ContentLength != nil {
-				tail[n-stale+i].ContentLength = *it.Properties.ContentLength
-			}
-			tail[n-stale+i].BlobPath = *it.Name
-			tail[n-stale+i].Tags = listResponseTags(it.BlobTags)
+			tail[n-stale+i].ETag = it.ETag
+			tail[n-stale+i].LastModified = it.LastModified
+			tail[n-stale+i].ContentLength = it.ContentLength
+			tail[n-stale+i].BlobPath = it.Path
+			tail[n-stale+i].Tags = it.Tags
 		}
 
 		marker = r.Marker
-		if marker == nil || *marker == "" {
+		if marker == "" {
 			break
 		}
 	}
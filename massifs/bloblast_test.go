@@ -6,8 +6,6 @@ import (
 	"testing"
 	"time"
 
-	azStorageBlob "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -196,19 +194,19 @@ type mockLastNBlobStore struct {
 	callCount int
 }
 
-func (s *mockLastNBlobStore) Reader(
+func (s *mockLastNBlobStore) Get(
 	ctx context.Context,
-	identity string,
-	opts ...azblob.Option,
-) (*azblob.ReaderResponse, error) {
+	path string,
+	opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-func (s *mockLastNBlobStore) List(ctx context.Context, opts ...azblob.Option) (*azblob.ListerResponse, error) {
+func (s *mockLastNBlobStore) List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
 	s.callCount += 1
 	if s.callCount == len(s.series)+1 {
 		// returning an empty response is the terminator, but we must only do so once
-		return &azblob.ListerResponse{}, nil
+		return &ObjectListResponse{}, nil
 	}
 	if s.callCount > len(s.series)+1 {
 		return nil, fmt.Errorf("no more test data")
@@ -216,26 +214,24 @@ func (s *mockLastNBlobStore) List(ctx context.Context, opts ...azblob.Option) (*
 
 	blobs := s.series[s.callCount-1]
 
-	items := make([]*azStorageBlob.BlobItemInternal, len(blobs))
+	items := make([]ObjectInfo, len(blobs))
 	for i := range blobs {
-		items[i] = &azStorageBlob.BlobItemInternal{
-			Name:       blobs[i].Name,
-			Properties: &azStorageBlob.BlobPropertiesInternal{},
+		items[i] = ObjectInfo{
+			Path:         *blobs[i].Name,
+			ETag:         *blobs[i].ETag,
+			LastModified: *blobs[i].LastModfified,
 		}
-		items[i].Properties.Etag = blobs[i].ETag
-		items[i].Properties.LastModified = blobs[i].LastModfified
 	}
 
 	// Tech debt: This isn't representative of how blob listing works, because it needs to honour
 	// paging correctly. We could just mock this using a generated one. This is too much logic to have
 	// in a stub.
-	someMarker := "somemarker"
-	return &azblob.ListerResponse{
-		Marker: &someMarker,
+	return &ObjectListResponse{
+		Marker: "somemarker",
 		Items:  items,
 	}, nil
 }
 
-func (s *mockLastNBlobStore) FilteredList(ctx context.Context, tagsFilter string, opts ...azblob.Option) (*azblob.FilterResponse, error) {
+func (s *mockLastNBlobStore) FilteredList(ctx context.Context, tagsFilter string, opts ...ObjectOption) (*ObjectListResponse, error) {
 	return nil, fmt.Errorf("not implemented")
 }
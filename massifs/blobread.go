@@ -3,39 +3,55 @@ package massifs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
-
-	"github.com/datatrails/go-datatrails-common/azblob"
 )
 
-// BlobRead reads the blob of the given store.
+// BlobRead reads the blob of the given store. A blob shorter than its reported
+// content length is an error, io.ErrUnexpectedEOF, rather than a shorter blob.
+// If the length is not known, it is negative, the blob is read to the end.
 func BlobRead(
 	ctx context.Context, blobPath string, store LogBlobReader,
-	opts ...azblob.Option) (*azblob.ReaderResponse, []byte, error) {
+	opts ...ObjectOption) (*ObjectReadResponse, []byte, error) {
 
-	rr, err := store.Reader(ctx, blobPath, opts...)
+	rr, err := store.Get(ctx, blobPath, opts...)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer rr.Reader.Close()
+
+	if rr.ContentLength < 0 {
+		data, err := io.ReadAll(rr.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		rr.Reader = nil
+		rr.ContentLength = int64(len(data))
+		return rr, data, nil
+	}
 
 	data := make([]byte, rr.ContentLength)
 	read := int64(0)
 	for read < rr.ContentLength {
 		n, err := rr.Reader.Read(data[read:])
-		if err != nil && !errors.Is(err, io.EOF) {
+		read += int64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
 			return nil, nil, err
 		}
-		read += int64(n)
+	}
+	if read < rr.ContentLength {
+		return nil, nil, fmt.Errorf(
+			"%w: read %d of %d bytes from %s", io.ErrUnexpectedEOF, read, rr.ContentLength, blobPath)
 	}
 
 	// The reader is now definitely exhausted for the purpose it was created. To
-	// avoid odd effects, or accidental misuse we nill it out. And we do so regardless of error.
+	// avoid odd effects, or accidental misuse we nill it out. It is closed
+	// by the deferred call regardless.
 
 	rr.Reader = nil // The caller has no use for this
 
-	// If we read less. truncate the buffer
-	if read < int64(len(data)) {
-		data = data[0:read]
-	}
 	return rr, data, nil
 }
@@ -0,0 +1,66 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReadStore returns a single blob, reported with the content length of
+// the store rather than the length of the data.
+type fakeReadStore struct {
+	LogBlobReader
+	data          []byte
+	contentLength int64
+}
+
+func (s fakeReadStore) Get(ctx context.Context, path string, opts ...ObjectOption) (*ObjectReadResponse, error) {
+	return &ObjectReadResponse{
+		ObjectInfo: ObjectInfo{Path: path, ContentLength: s.contentLength},
+		// The reader returns a byte at a time, as network readers may
+		Reader: io.NopCloser(io.LimitReader(&oneByteReader{r: bytes.NewReader(s.data)}, int64(len(s.data)))),
+	}, nil
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(p[:1])
+}
+
+func TestBlobRead(t *testing.T) {
+	ctx := t.Context()
+	data := []byte("massif data")
+
+	tests := []struct {
+		name          string
+		contentLength int64
+		wantErr       error
+	}{
+		{name: "known length", contentLength: int64(len(data))},
+		{name: "unknown length", contentLength: -1},
+		{name: "short read", contentLength: int64(len(data)) + 1, wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, got, err := BlobRead(ctx, "blob", fakeReadStore{data: data, contentLength: tt.contentLength})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, data, got)
+			assert.Equal(t, int64(len(data)), rr.ContentLength)
+			assert.Nil(t, rr.Reader)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package massifs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/veraison/go-cose"
+)
+
+// The seals and the receipts carry the public key of the sealer as the CWT
+// confirmation claim (cnf). The common package only supports ECDSA keys, and
+// encodes them with a non standard key type, see commoncose.NewCNFClaim. ECDSA
+// keys are encoded as before, so that seals remain verifiable by existing
+// verifiers. Other keys are encoded as RFC 9053 COSE_Keys.
+//
+// The signature algorithms are those of go-cose, which does not yet register
+// the ML-DSA algorithms, so post-quantum keys can not be used for sealing.
+
+const (
+	// CWT claim keys, RFC 8392
+	cwtClaimIssuer  = int64(1)
+	cwtClaimSubject = int64(2)
+	// COSE_Key OKP curve identifier, RFC 9053
+	coseKeyCurveEd25519 = int64(6)
+)
+
+var (
+	ErrSealKeyTypeUnsupported = errors.New("the sealing key type is not supported")
+	ErrSealKeyMalformed       = errors.New("the sealing key in the cnf claim is malformed")
+)
+
+// NewCNFClaim returns the CWT claims, including the cnf claim for the public
+// key, for the protected header of a seal or receipt. ECDSA, Ed25519 and RSA
+// keys are supported.
+func NewCNFClaim(
+	issuer string, subject string, kid string, alg cose.Algorithm, pub crypto.PublicKey,
+) (map[int64]any, error) {
+
+	var coseKey map[int64]any
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		return commoncose.NewCNFClaim(issuer, subject, kid, alg, *key), nil
+	case ed25519.PublicKey:
+		coseKey = map[int64]any{
+			commoncose.KeyTypeLabel: commoncose.KeyTypeOKP,
+			commoncose.ECCurveLabel: coseKeyCurveEd25519,
+			commoncose.ECXLabel:     []byte(key),
+		}
+	case *rsa.PublicKey:
+		coseKey = map[int64]any{
+			commoncose.KeyTypeLabel: commoncose.KeyTypeRSA,
+			commoncose.RSANLabel:    key.N.Bytes(),
+			commoncose.RSAELabel:    big.NewInt(int64(key.E)).Bytes(),
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrSealKeyTypeUnsupported, pub)
+	}
+	coseKey[commoncose.KeyIDLabel] = kid
+	coseKey[commoncose.AlgorithmLabel] = alg
+
+	return map[int64]any{
+		cwtClaimIssuer:  issuer,
+		cwtClaimSubject: subject,
+		commoncose.CNFLabel: map[int64]any{
+			commoncose.CoseKeyLabel: coseKey,
+		},
+	}, nil
+}
+
+// cnfKeyProvider provides a public key decoded from a cnf claim
+type cnfKeyProvider struct {
+	key crypto.PublicKey
+	alg cose.Algorithm
+}
+
+func (p *cnfKeyProvider) PublicKey() (crypto.PublicKey, cose.Algorithm, error) {
+	return p.key, p.alg, nil
+}
+
+// NewCNFPublicKeyProvider returns a provider of the public key in the cnf
+// claim of the message. It supports the keys encoded by NewCNFClaim, and is
+// otherwise the same as commoncose.NewCWTPublicKeyProvider.
+func NewCNFPublicKeyProvider(msg *commoncose.CoseSign1Message) (publicKeyProvider, error) {
+
+	coseKey, ok := cnfCoseKey(msg)
+	if !ok {
+		return commoncose.NewCWTPublicKeyProvider(msg), nil
+	}
+	kty, ok := coseKey[int64(commoncose.KeyTypeLabel)].(int64)
+	if !ok || (kty != commoncose.KeyTypeOKP && kty != commoncose.KeyTypeRSA) {
+		// The legacy ECDSA encoding, or a key the common package can report
+		// an error for.
+		return commoncose.NewCWTPublicKeyProvider(msg), nil
+	}
+
+	alg, err := msg.Headers.Protected.Algorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.PublicKey
+	switch kty {
+	case commoncose.KeyTypeOKP:
+		crv, _ := coseKey[int64(commoncose.ECCurveLabel)].(int64)
+		x, _ := coseKey[int64(commoncose.ECXLabel)].([]byte)
+		if crv != coseKeyCurveEd25519 {
+			return nil, fmt.Errorf("%w: OKP curve %d", ErrSealKeyTypeUnsupported, crv)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: Ed25519 key size %d", ErrSealKeyMalformed, len(x))
+		}
+		key = ed25519.PublicKey(x)
+	case commoncose.KeyTypeRSA:
+		n, _ := coseKey[int64(commoncose.RSANLabel)].([]byte)
+		e, _ := coseKey[int64(commoncose.RSAELabel)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: RSA modulus or exponent", ErrSealKeyMalformed)
+		}
+		key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	return &cnfKeyProvider{key: key, alg: alg}, nil
+}
+
+// cwtSubject returns the subject claim from the CWT claims of the message, if
+// there is one. For seals, the subject is the massif blob path.
+func cwtSubject(msg *commoncose.CoseSign1Message) (string, bool) {
+	claims, ok := msg.Headers.Protected[commoncose.HeaderLabelCWTClaims].(map[any]any)
+	if !ok {
+		return "", false
+	}
+	subject, ok := claims[cwtClaimSubject].(string)
+	return subject, ok
+}
+
+// cnfCoseKey returns the COSE_Key from the cnf claim of the message, if there
+// is one.
+func cnfCoseKey(msg *commoncose.CoseSign1Message) (map[any]any, bool) {
+	claims, ok := msg.Headers.Protected[commoncose.HeaderLabelCWTClaims].(map[any]any)
+	if !ok {
+		return nil, false
+	}
+	cnf, ok := claims[commoncose.CNFLabel].(map[any]any)
+	if !ok {
+		return nil, false
+	}
+	coseKey, ok := cnf[commoncose.CoseKeyLabel].(map[any]any)
+	return coseKey, ok
+}
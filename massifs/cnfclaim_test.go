@@ -0,0 +1,94 @@
+package massifs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// TestSealKeyTypes checks logs can be sealed with each of the supported key
+// types, and that both the seals and the receipts verify.
+func TestSealKeyTypes(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+
+	ecKey := TestGenerateECKey(t, elliptic.P256())
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey := TestGenerateECKey(t, elliptic.P256())
+
+	tests := []struct {
+		name string
+		alg  cose.Algorithm
+		key  crypto.Signer
+	}{
+		{name: "ES256", alg: cose.AlgorithmES256, key: &ecKey},
+		{name: "Ed25519", alg: cose.AlgorithmEd25519, key: edKey},
+		{name: "PS256", alg: cose.AlgorithmPS256, key: rsaKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 3)).store
+
+			signer := NewTestSignerContextForKey(t, "test.issuer", tt.alg, tt.key)
+			sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, signer.RootSignerCodec)
+			_, err := sealer.SealTenant(ctx, tenant)
+			require.NoError(t, err)
+
+			reader := NewMassifReader(nil, store)
+			sealReader := NewSignedRootReader(nil, store, signer.RootSignerCodec)
+			opts := []ReaderOption{WithSealGetter(&sealReader), WithCBORCodec(signer.RootSignerCodec)}
+			verified, err := reader.GetVerifiedContext(ctx, tenant, 0, opts...)
+			require.NoError(t, err)
+
+			// The key on the seal is the key it was signed with
+			provider, err := NewCNFPublicKeyProvider(&verified.Sign1Message)
+			require.NoError(t, err)
+			sealKey, alg, err := provider.PublicKey()
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, alg)
+			assert.True(t, tt.key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(sealKey))
+
+			_, err = reader.GetVerifiedContext(ctx, tenant, 0, append(opts, WithTrustedSealerPub(tt.key.Public()))...)
+			require.NoError(t, err)
+			_, err = reader.GetVerifiedContext(ctx, tenant, 0, append(opts, WithTrustedSealerPub(&otherKey.PublicKey))...)
+			assert.ErrorIs(t, err, ErrRemoteSealKeyMatchFailed)
+
+			receipt, err := NewReceipt(
+				ctx, massifHeight, tenant, mmr.MMRIndex(1), testVerifiedContextGetter{verified: verified})
+			require.NoError(t, err)
+			data, err := receipt.MarshalCBOR()
+			require.NoError(t, err)
+			receipt, err = commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(CheckpointDecOptions()))
+			require.NoError(t, err)
+			leaf, err := verified.Get(mmr.MMRIndex(1))
+			require.NoError(t, err)
+			ok, _, err := VerifySignedInclusionReceipt(ctx, receipt, leaf)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestNewCNFClaim_Unsupported(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewCNFClaim("issuer", "subject", "kid", cose.AlgorithmES256, key.PublicKey)
+	assert.ErrorIs(t, err, ErrSealKeyTypeUnsupported)
+}
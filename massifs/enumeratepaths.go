@@ -2,12 +2,9 @@ package massifs
 
 import (
 	"context"
-
-	azStorageBlob "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
-	"github.com/datatrails/go-datatrails-common/azblob"
 )
 
-type VisitFilterResponse func(ctx context.Context, store LogBlobReader, it *azStorageBlob.FilterBlobItem) (bool, error)
+type VisitFilterResponse func(ctx context.Context, store LogBlobReader, it ObjectInfo) (bool, error)
 
 // FilterBlobs selects blobs using the provided filter expression
 // and application of the provided visitor (which may be nil)
@@ -21,11 +18,11 @@ func FilterBlobs(
 	ctx context.Context, store LogBlobReader,
 	tagsFilter string,
 	visit VisitFilterResponse,
-	marker azblob.ListMarker,
-	opts ...azblob.Option,
-) ([]*azStorageBlob.FilterBlobItem, azblob.ListMarker, error) {
+	marker string,
+	opts ...ObjectOption,
+) ([]ObjectInfo, string, error) {
 
-	opts = append(opts, []azblob.Option{azblob.WithListMarker(marker)}...)
+	opts = append(opts, WithListMarker(marker))
 	r, err := store.FilteredList(ctx, tagsFilter, opts...)
 	if err != nil {
 		// It is important to return the same marker in the event of an error.
@@ -34,7 +31,7 @@ func FilterBlobs(
 		return nil, marker, err
 	}
 
-	var newFound []*azStorageBlob.FilterBlobItem
+	var newFound []ObjectInfo
 
 	// If there is no visitor, just return all the found items
 	if visit == nil {
@@ -72,11 +69,11 @@ func EnumerateIdentifiedPaths(
 	ctx context.Context, store LogBlobReader, blobPrefixPath string,
 	parseID ParseIdentifyingSegment,
 	found map[string]any,
-	marker azblob.ListMarker,
-	opts ...azblob.Option,
-) ([]string, azblob.ListMarker, error) {
+	marker string,
+	opts ...ObjectOption,
+) ([]string, string, error) {
 
-	opts = append(opts, []azblob.Option{azblob.WithListPrefix(blobPrefixPath), azblob.WithListMarker(marker)}...)
+	opts = append(opts, WithListPrefix(blobPrefixPath), WithListMarker(marker))
 
 	var newFound []string
 
@@ -89,12 +86,12 @@ func EnumerateIdentifiedPaths(
 	}
 
 	for i := range r.Items {
-		id, err := parseID(*r.Items[i].Name)
+		id, err := parseID(r.Items[i].Path)
 		if err != nil {
 			// This is a situation where the paths to the blobs are invalid.
 			// Crashing out is the only reasonable response. So we don't
 			// preserve the marker.
-			return nil, nil, err
+			return nil, "", err
 		}
 		if _, ok := found[id]; ok {
 			continue
@@ -6,8 +6,6 @@ import (
 	"strings"
 	"testing"
 
-	azStorageBlob "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/logger"
 	"github.com/datatrails/go-datatrails-merklelog/mmrtesting"
 	"github.com/google/uuid"
@@ -67,7 +65,7 @@ func TestEnumerateTenants(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			var newUUIDs []string
-			var marker azblob.ListMarker
+			var marker string
 			var err error
 
 			store := newReaderForBatches(&g, tt.args.batches)
@@ -116,47 +114,47 @@ func newReaderForBatches(
 
 // batchMixedTenants creates a batched list blob response with blob items for
 // the specified number of tenants present
-func batchMixedTenant(g *mmrtesting.TestGenerator, base, responseItemCount, mixCount int) *azblob.ListerResponse {
+func batchMixedTenant(g *mmrtesting.TestGenerator, base, responseItemCount, mixCount int) *ObjectListResponse {
 
 	require.Less(g.T, mixCount, responseItemCount)
 	stripeSize := responseItemCount/mixCount + 1
 
 	tenantID := g.NewRandomUUIDString(g.T)
-	var items []*azStorageBlob.BlobItemInternal
+	var items []ObjectInfo
 	for i := range responseItemCount {
 		name := fmtTenantBlobPath(tenantID, fmt.Sprintf("%d", base+i))
-		items = append(items, &azStorageBlob.BlobItemInternal{
-			Name: &name,
+		items = append(items, ObjectInfo{
+			Path: name,
 		})
 		if (i+1)%stripeSize == 0 {
 			tenantID = g.NewRandomUUIDString(g.T)
 		}
 	}
-	return &azblob.ListerResponse{
+	return &ObjectListResponse{
 		Items: items,
 		// Caller can setup Marker as required.
 	}
 }
 
 // batchSameTenant creates a batched list blob response where all items share the same tenant
-func batchSameTenant(g *mmrtesting.TestGenerator, base, responseItemCount int) *azblob.ListerResponse {
+func batchSameTenant(g *mmrtesting.TestGenerator, base, responseItemCount int) *ObjectListResponse {
 
 	tenantID := g.NewRandomUUIDString(g.T)
-	var items []*azStorageBlob.BlobItemInternal
+	var items []ObjectInfo
 	for i := range responseItemCount {
 		name := fmtTenantBlobPath(tenantID, fmt.Sprintf("%d", base+i))
-		items = append(items, &azStorageBlob.BlobItemInternal{
-			Name: &name,
+		items = append(items, ObjectInfo{
+			Path: name,
 		})
 	}
-	return &azblob.ListerResponse{
+	return &ObjectListResponse{
 		Items: items,
 		// Caller can setup Marker as required.
 	}
 }
 
 type testEnumTenantsReader struct {
-	batches   []*azblob.ListerResponse
+	batches   []*ObjectListResponse
 	nextBatch int
 }
 
@@ -164,16 +162,16 @@ func (r *testEnumTenantsReader) NextBatch() {
 	r.nextBatch += 1
 }
 
-func (r testEnumTenantsReader) Reader(
+func (r testEnumTenantsReader) Get(
 	ctx context.Context,
-	identity string,
-	opts ...azblob.Option,
-) (*azblob.ReaderResponse, error) {
+	path string,
+	opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
 	return nil, fmt.Errorf("this unit test suite only needs the List implementation")
 }
 
 func (r testEnumTenantsReader) List(
-	ctx context.Context, opts ...azblob.Option) (*azblob.ListerResponse, error) {
+	ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
 
 	if r.nextBatch >= len(r.batches) {
 		return nil, fmt.Errorf("ran out of test batches")
@@ -185,25 +183,15 @@ func (r testEnumTenantsReader) List(
 }
 
 func (r testEnumTenantsReader) FilteredList(
-	ctx context.Context, tagsFilter string, opts ...azblob.Option) (*azblob.FilterResponse, error) {
+	ctx context.Context, tagsFilter string, opts ...ObjectOption) (*ObjectListResponse, error) {
 
 	if r.nextBatch >= len(r.batches) {
 		return nil, fmt.Errorf("ran out of test batches")
 	}
 	// note: because the List implementation interface has a by value receiver,
 	// we can't increment nextBatch here
-	// batch := r.batches[r.nextBatch]
-	items := make([]*azStorageBlob.FilterBlobItem, 0, len(r.batches[r.nextBatch].Items))
-	for _, it := range r.batches[r.nextBatch].Items {
-		filterItem := &azStorageBlob.FilterBlobItem{
-			// ignore container name for now
-			Name: it.Name,
-			Tags: it.BlobTags,
-		}
-		items = append(items, filterItem)
-	}
-	batch := &azblob.FilterResponse{
-		Items: items,
+	batch := &ObjectListResponse{
+		Items: r.batches[r.nextBatch].Items,
 		// Caller can setup Marker as required.
 	}
 
@@ -0,0 +1,157 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// epochSimulation drives a log across a commitment epoch boundary. Leaves are
+// added one per simulated millisecond. Like a service whose id generator
+// reports snowflakeid.ErrEpochExhausted, the simulation replaces the writer
+// with one configured for the new epoch when the clock crosses into it.
+type epochSimulation struct {
+	t            *testing.T
+	store        *MemObjectStore
+	tenant       string
+	massifHeight uint8
+	now          time.Time
+	epoch        uint8
+	w            *LogWriter
+	leaves       []LeafEntry
+	epochs       []uint8
+}
+
+func newEpochSimulation(t *testing.T, tenant string, massifHeight uint8, start time.Time) *epochSimulation {
+	return &epochSimulation{
+		t: t, store: NewMemObjectStore(), tenant: tenant, massifHeight: massifHeight, now: start,
+	}
+}
+
+// addLeaves adds count leaves, returning the epoch of each
+func (s *epochSimulation) addLeaves(ctx context.Context, count int) {
+	for _, leaf := range testLeafEntries(uint64(len(s.leaves)), uint64(count)) {
+		id, epoch := IDTimestampFromTime(s.now)
+		if s.w == nil || epoch != s.epoch {
+			s.epoch = epoch
+			s.w = NewLogWriter(NewMassifCommitter(
+				MassifCommitterConfig{CommitmentEpoch: uint32(epoch)}, nil, s.store), s.tenant, s.massifHeight)
+		}
+		leaf.IDTimestamp = id
+		_, err := s.w.AddLeaves(ctx, []LeafEntry{leaf})
+		require.NoError(s.t, err)
+		s.leaves = append(s.leaves, leaf)
+		s.epochs = append(s.epochs, epoch)
+		s.now = s.now.Add(time.Millisecond)
+	}
+}
+
+// TestEpochRollover checks a log which crosses into a new commitment epoch
+// part way through a massif can be written, found by its lastid tags, and
+// verified against seals attesting to the epoch.
+func TestEpochRollover(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	// 4 leaves per massif, the epoch changes at leaf 6, in massif 1
+	sim := newEpochSimulation(t, tenant, 3, IDTimestampTime(0, 2).Add(-6*time.Millisecond))
+	sim.addLeaves(ctx, 10)
+	require.Equal(t, uint8(1), sim.epochs[5])
+	require.Equal(t, uint8(2), sim.epochs[6])
+	// The id timestamps restart in the new epoch
+	require.Less(t, sim.leaves[6].IDTimestamp, sim.leaves[5].IDTimestamp)
+
+	reader := NewMassifReader(nil, sim.store, WithReadBlobOption(WithGetTags()))
+	var prevTag string
+	for massifIndex, wantEpoch := range []uint32{1, 2, 2} {
+		mc, err := reader.GetMassif(ctx, tenant, uint64(massifIndex))
+		require.NoError(t, err)
+		assert.Equal(t, wantEpoch, mc.Start.CommitmentEpoch)
+
+		// The massif lastid tags, and so the watcher filters, sort by time
+		// across the epoch boundary
+		tag := IDTimestampToHex(mc.Start.LastID, uint8(mc.Start.CommitmentEpoch))
+		assert.Equal(t, tag, mc.Tags[TagKeyLastID])
+		assert.Greater(t, tag, prevTag)
+		prevTag = tag
+	}
+	since := IDTimestampToHex(sim.leaves[5].IDTimestamp, 1)
+	r, err := sim.store.FilteredList(ctx, fmt.Sprintf(`"lastid">'%s'`, since))
+	require.NoError(t, err)
+	assert.Len(t, r.Items, 2)
+
+	// The writer can not go back to the earlier epoch
+	w := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, sim.store), tenant, 3)
+	_, err = w.AddLeaves(ctx, testLeafEntries(10, 1))
+	assert.ErrorIs(t, err, ErrCommitmentEpochRegressed)
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := NewTestSignerContext(t, "test.issuer")
+	sealReader := NewSignedRootReader(nil, sim.store, codec)
+	seal := func(mc MassifContext, mmrSize uint64, id uint64, epoch uint32) {
+		peaks, err := mmr.PeakHashes(&mc, mmrSize-1)
+		require.NoError(t, err)
+		sealed, err := signer.SealedState(tenant, uint64(mc.Start.MassifIndex), MMRState{
+			Version: int(MMRStateVersion2), MMRSize: mmrSize, Peaks: peaks, Timestamp: 1234,
+			IDTimestamp: id, CommitmentEpoch: epoch})
+		require.NoError(t, err)
+		data, err := sealed.Sign1Message.MarshalCBOR()
+		require.NoError(t, err)
+		_, err = sim.store.Put(ctx, TenantMassifSignedRootPath(tenant, mc.Start.MassifIndex), data)
+		require.NoError(t, err)
+	}
+
+	// Massif 1 holds leaves 4 to 7, the seal for the first two attests to the
+	// earlier epoch, and is consistent with the massif as it is now
+	mc, err := reader.GetMassif(ctx, tenant, 1)
+	require.NoError(t, err)
+	seal(mc, mmr.FirstMMRSize(mmr.MMRIndex(5)), sim.leaves[5].IDTimestamp, 1)
+	vc, err := reader.GetVerifiedContext(ctx, tenant, 1, WithSealGetter(&sealReader), WithCBORCodec(codec))
+	require.NoError(t, err)
+	earlier := vc.MMRState
+
+	// A seal of the whole massif must attest to the last leaf and its epoch
+	seal(mc, mc.RangeCount(), sim.leaves[7].IDTimestamp, 1)
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, WithSealGetter(&sealReader), WithCBORCodec(codec))
+	assert.ErrorIs(t, err, ErrSealIDTimestampMismatch)
+
+	seal(mc, mc.RangeCount(), sim.leaves[7].IDTimestamp, 2)
+	_, err = reader.GetVerifiedContext(
+		ctx, tenant, 1, WithSealGetter(&sealReader), WithCBORCodec(codec), WithTrustedBaseState(earlier))
+	require.NoError(t, err)
+
+	// A trusted state from the earlier epoch is before any state in the new
+	// epoch, despite the larger id timestamp, but not the reverse.
+	later, err := reader.GetVerifiedContext(ctx, tenant, 1, WithSealGetter(&sealReader), WithCBORCodec(codec))
+	require.NoError(t, err)
+	seal(mc, mmr.FirstMMRSize(mmr.MMRIndex(5)), sim.leaves[5].IDTimestamp, 1)
+	base := later.MMRState
+	base.MMRSize = earlier.MMRSize
+	_, err = reader.GetVerifiedContext(
+		ctx, tenant, 1, WithSealGetter(&sealReader), WithCBORCodec(codec), WithTrustedBaseState(base))
+	assert.ErrorIs(t, err, ErrSealIDTimestampMismatch)
+}
+
+func TestCompareIDTimestamps(t *testing.T) {
+	assert.Equal(t, 0, CompareIDTimestamps(5, 1, 5, 1))
+	assert.Equal(t, -1, CompareIDTimestamps(4, 1, 5, 1))
+	assert.Equal(t, 1, CompareIDTimestamps(6, 1, 5, 1))
+	assert.Equal(t, -1, CompareIDTimestamps(6, 1, 5, 2))
+	assert.Equal(t, 1, CompareIDTimestamps(5, 2, 6, 1))
+
+	// The last millisecond of an epoch is the first of the next
+	id, epoch := IDTimestampFromTime(IDTimestampTime(0, 2))
+	assert.Equal(t, uint64(0), id)
+	assert.Equal(t, uint8(2), epoch)
+	id, epoch = IDTimestampFromTime(IDTimestampTime(0, 2).Add(-time.Millisecond))
+	assert.Equal(t, uint8(1), epoch)
+	assert.Equal(t, IDTimestampTime(0, 2).Add(-time.Millisecond), IDTimestampTime(id, epoch))
+}
@@ -0,0 +1,82 @@
+package massifs
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	ErrHashAlgUnsupported = errors.New("the hash algorithm is not supported")
+	ErrHashAlgMismatch    = errors.New("the hash algorithm does not match the log")
+)
+
+// HashAlg identifies the hash algorithm used to construct a log. It is a log
+// configuration parameter, recorded in the MassifStart of every massif and
+// attested to by the seals.
+//
+// Only algorithms producing ValueBytes digests are supported, wider algorithms
+// such as SHA-384 need a new log format, see the README. The zero value is
+// SHA-256, which is the algorithm for all logs created before the parameter
+// was introduced.
+type HashAlg uint8
+
+const (
+	HashAlgSHA256 HashAlg = iota
+	HashAlgSHA3_256
+	HashAlgSHA512_256
+	HashAlgMax
+)
+
+// Valid returns true if the algorithm is supported
+func (a HashAlg) Valid() bool {
+	return a < HashAlgMax
+}
+
+// New returns a new hasher for the algorithm, or nil if the algorithm is not
+// supported. Callers which have not obtained the algorithm from a decoded
+// MassifStart, which checks it, should check Valid first.
+func (a HashAlg) New() hash.Hash {
+	switch a {
+	case HashAlgSHA256:
+		return sha256.New()
+	case HashAlgSHA3_256:
+		return sha3.New256()
+	case HashAlgSHA512_256:
+		return sha512.New512_256()
+	}
+	return nil
+}
+
+// Size returns the size of the digests of the algorithm, or 0 if the
+// algorithm is not supported. It is ValueBytes for all supported algorithms.
+func (a HashAlg) Size() int {
+	h := a.New()
+	if h == nil {
+		return 0
+	}
+	return h.Size()
+}
+
+func (a HashAlg) String() string {
+	switch a {
+	case HashAlgSHA256:
+		return "SHA-256"
+	case HashAlgSHA3_256:
+		return "SHA3-256"
+	case HashAlgSHA512_256:
+		return "SHA-512/256"
+	}
+	return fmt.Sprintf("HashAlg(%d)", uint8(a))
+}
+
+// checkHashAlg returns an error if the algorithm is not supported
+func checkHashAlg(a HashAlg) error {
+	if !a.Valid() {
+		return fmt.Errorf("%w: %v", ErrHashAlgUnsupported, a)
+	}
+	return nil
+}
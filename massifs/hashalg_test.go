@@ -0,0 +1,147 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSealGetter struct {
+	sealed *SealedState
+}
+
+func (g testSealGetter) GetSignedRoot(
+	ctx context.Context, tenantIdentity string, massifIndex uint32, opts ...ReaderOption,
+) (*cose.CoseSign1Message, MMRState, error) {
+	return &g.sealed.Sign1Message, g.sealed.MMRState, nil
+}
+
+func TestMassifStartHashAlg(t *testing.T) {
+
+	start := NewMassifStart(12, 1, 3, 2, 7)
+	start.HashAlg = HashAlgSHA3_256
+	data, err := start.MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded MassifStart
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, HashAlgSHA3_256, decoded.HashAlg)
+	assert.Equal(t, start.MassifIndex, decoded.MassifIndex)
+
+	// Massifs created before the hash algorithm was recorded are SHA-256
+	data = EncodeMassifStart(12, 1, 3, 2, 7)
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, HashAlgSHA256, decoded.HashAlg)
+
+	data[MassifStartKeyHashAlgFirstByte] = byte(HashAlgMax)
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data), ErrHashAlgUnsupported)
+
+	start.HashAlg = HashAlgMax
+	_, err = start.MarshalBinary()
+	assert.ErrorIs(t, err, ErrHashAlgUnsupported)
+}
+
+// TestHashAlgLog checks logs are built, sealed and proven using the hash
+// algorithm configured for the log.
+func TestHashAlgLog(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 8
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := NewTestSignerContext(t, "test.issuer")
+
+	for _, hashAlg := range []HashAlg{HashAlgSHA256, HashAlgSHA3_256, HashAlgSHA512_256} {
+		t.Run(hashAlg.String(), func(t *testing.T) {
+
+			store := NewMemObjectStore()
+			committer := NewMassifCommitter(MassifCommitterConfig{HashAlg: hashAlg}, nil, store)
+			w := NewLogWriter(committer, tenant, massifHeight)
+			_, err := w.AddLeaves(ctx, testLeafEntries(0, 11))
+			require.NoError(t, err)
+
+			reader := NewMassifReader(nil, store)
+			mc, err := reader.GetMassif(ctx, tenant, 0)
+			require.NoError(t, err)
+			assert.Equal(t, hashAlg, mc.Start.HashAlg)
+
+			// The interior nodes, and the trie keys, use the algorithm
+			leaves := testLeafEntries(0, 2)
+			n2, err := mc.Get(2)
+			require.NoError(t, err)
+			assert.Equal(t, mmr.HashPosPair64(hashAlg.New(), 3, leaves[0].Value, leaves[1].Value), n2)
+			trieKey, err := mc.GetTrieKey(0)
+			require.NoError(t, err)
+			assert.Equal(t, NewTrieKeyWithHasher(
+				hashAlg.New(), KeyTypeApplicationContent, leaves[0].LogID, leaves[0].AppID), trieKey)
+
+			peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+			require.NoError(t, err)
+			state := MMRState{
+				Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks,
+				Timestamp: 1234, HashAlg: hashAlg,
+			}
+			sealed, err := signer.SealedState(tenant, 0, state)
+			require.NoError(t, err)
+
+			verified, err := mc.VerifyContext(
+				ctx, WithSealGetter(testSealGetter{sealed: sealed}), WithCBORCodec(codec))
+			require.NoError(t, err)
+
+			// Receipts carry the algorithm in the signed protected header
+			receipt, err := NewReceipt(
+				ctx, massifHeight, tenant, mmr.MMRIndex(9), testVerifiedContextGetter{verified: verified})
+			require.NoError(t, err)
+			data, err := receipt.MarshalCBOR()
+			require.NoError(t, err)
+			receipt, err = cose.NewCoseSign1MessageFromCBOR(data, cose.WithDecOptions(CheckpointDecOptions()))
+			require.NoError(t, err)
+
+			receiptAlg, err := ReceiptHashAlg(receipt)
+			require.NoError(t, err)
+			assert.Equal(t, hashAlg, receiptAlg)
+
+			leaf, err := mc.Get(mmr.MMRIndex(9))
+			require.NoError(t, err)
+			ok, _, err := VerifySignedInclusionReceipt(ctx, receipt, leaf)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			// The seal must attest to the algorithm of the massif
+			if hashAlg == HashAlgSHA256 {
+				return
+			}
+			state.HashAlg = HashAlgSHA256
+			sealed, err = signer.SealedState(tenant, 0, state)
+			require.NoError(t, err)
+			_, err = mc.VerifyContext(
+				ctx, WithSealGetter(testSealGetter{sealed: sealed}), WithCBORCodec(codec))
+			assert.ErrorIs(t, err, ErrHashAlgMismatch)
+		})
+	}
+}
+
+// TestHashAlgSize checks the supported algorithms all produce ValueBytes
+// wide digests, and that seals are only made for peaks of that width.
+func TestHashAlgSize(t *testing.T) {
+	for a := range HashAlgMax {
+		assert.Equal(t, ValueBytes, a.Size(), a.String())
+	}
+	assert.Equal(t, 0, HashAlgMax.Size())
+
+	signer := NewTestSignerContext(t, "test.issuer")
+	state := MMRState{
+		Version: int(MMRStateVersion2), MMRSize: 1, Peaks: [][]byte{make([]byte, 48)}, Timestamp: 1234}
+	_, err := signer.SealedState("tenant/1", 0, state)
+	assert.ErrorIs(t, err, ErrNodeSize)
+
+	state.Peaks = [][]byte{make([]byte, ValueBytes)}
+	state.HashAlg = HashAlgMax
+	_, err = signer.SealedState("tenant/1", 0, state)
+	assert.ErrorIs(t, err, ErrHashAlgUnsupported)
+}
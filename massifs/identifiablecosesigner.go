@@ -2,6 +2,7 @@ package massifs
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 
 	"github.com/veraison/go-cose"
@@ -10,10 +11,40 @@ import (
 // IdentifiableCoseSigner represents a Cose1 signer that has additional methods to provide
 // sufficient information to verify the signed product (an identifier for the signing key and the
 // public key.)
+//
+// The public keys may be of any type supported for sealing, see NewCNFClaim.
 type IdentifiableCoseSigner interface {
+	cose.Signer
+	PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error)
+	LatestPublicKey() (crypto.PublicKey, error)
+	KeyIdentifier() string
+	KeyLocation() string
+}
+
+// ECDSACoseSigner is an IdentifiableCoseSigner whose keys are always ECDSA,
+// as was required before other key types were supported.
+type ECDSACoseSigner interface {
 	cose.Signer
 	PublicKey(ctx context.Context, kid string) (*ecdsa.PublicKey, error)
 	LatestPublicKey() (*ecdsa.PublicKey, error)
 	KeyIdentifier() string
 	KeyLocation() string
 }
+
+// NewECDSAIdentifiableCoseSigner adapts an ECDSA only signer to
+// IdentifiableCoseSigner.
+func NewECDSAIdentifiableCoseSigner(signer ECDSACoseSigner) IdentifiableCoseSigner {
+	return ecdsaIdentifiableCoseSigner{ECDSACoseSigner: signer}
+}
+
+type ecdsaIdentifiableCoseSigner struct {
+	ECDSACoseSigner
+}
+
+func (s ecdsaIdentifiableCoseSigner) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	return s.ECDSACoseSigner.PublicKey(ctx, kid)
+}
+
+func (s ecdsaIdentifiableCoseSigner) LatestPublicKey() (crypto.PublicKey, error) {
+	return s.ECDSACoseSigner.LatestPublicKey()
+}
@@ -65,19 +65,42 @@ func IDTimeFromUnixTime(seconds int64, ms int) (uint64, uint8) {
 		ms = 999
 	}
 
-	unixMS := uint64(seconds * 1000)
+	unixMS := uint64(seconds*1000) + uint64(ms)
 
-	// The epoch is taken as the floor of seconds over our epoch duration.
-	// The rounding here is safe for a few hundred years.
+	// The epoch is taken as the floor of the milliseconds over our epoch
+	// duration. The rounding here is safe for a few hundred years.
 	epoch := uint8(unixMS / uint64(snowflakeid.EpochMS(1)))
 
-	unixMS += uint64(ms)
 	unixMS -= uint64(snowflakeid.EpochMS(epoch))
 
 	msBits := unixMS << snowflakeid.TimeShift
 	return msBits, epoch
 }
 
+// IDTimestampTime returns the time of the id timestamp in the provided epoch
+func IDTimestampTime(id uint64, epoch uint8) time.Time {
+	return snowflakeid.IDTime(id, snowflakeid.EpochTimeUTC(epoch))
+}
+
+// CompareIDTimestamps orders id timestamps which may be from different
+// epochs. The id timestamps of a log restart from zero in each new epoch, so
+// they can only be compared directly when their epochs are the same.
+//
+// Returns -1, 0 or +1 as a is before, the same as, or after b.
+func CompareIDTimestamps(a uint64, aEpoch uint8, b uint64, bEpoch uint8) int {
+	switch {
+	case aEpoch < bEpoch:
+		return -1
+	case aEpoch > bEpoch:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
 // SplitIDTimestampHex accepts a hex encoded, and epoch prefixed, id timestamp string
 // Returns:
 //
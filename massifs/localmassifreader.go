@@ -10,6 +10,7 @@ import (
 
 	"github.com/datatrails/go-datatrails-common/cose"
 	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
 )
 
 var (
@@ -60,14 +61,17 @@ type LocalReader struct {
 	log logger.Logger
 	// cache of previously read material, this is typically shared with a LocalSealReader instance
 	cache DirCache
+	// trieIndexes retains the trie indices used by FindLeafByAppID
+	trieIndexes *trieIndexCache
 }
 
 func NewLocalReader(
 	log logger.Logger, cache DirCache,
 ) (LocalReader, error) {
 	r := LocalReader{
-		log:   log,
-		cache: cache,
+		log:         log,
+		cache:       cache,
+		trieIndexes: newTrieIndexCache(),
 	}
 	return r, nil
 }
@@ -114,18 +118,34 @@ func (r *LocalReader) EnsureReplicaDirs(tenantIdentity string) error {
 		return fmt.Errorf("replica dir must be configured on the local reader")
 	}
 
-	massifsDir := filepath.Dir(r.GetMassifLocalPath(tenantIdentity, 0))
-	sealsDir := filepath.Dir(r.GetSealLocalPath(tenantIdentity, 0))
+	// The directories for every instance of the log are created, the first
+	// massif of each instance identifies it
+	firstMassifs := []uint32{0}
+	if cfg := r.instanceConfig(); cfg != nil {
+		firstMassifs = firstMassifs[:0]
+		for _, inst := range cfg.Instances {
+			firstMassifs = append(firstMassifs, inst.FirstMassifIndex)
+		}
+	}
+	for _, massifIndex := range firstMassifs {
+		massifsDir := filepath.Dir(r.GetMassifLocalPath(tenantIdentity, massifIndex))
+		sealsDir := filepath.Dir(r.GetSealLocalPath(tenantIdentity, massifIndex))
 
-	err := os.MkdirAll(massifsDir, os.FileMode(0755))
-	if err != nil {
-		return fmt.Errorf("%w: %s", ErrFailedToCreateReplicaDir, massifsDir)
+		err := os.MkdirAll(massifsDir, os.FileMode(0755))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrFailedToCreateReplicaDir, massifsDir)
 
+		}
+		err = os.MkdirAll(sealsDir, os.FileMode(0755))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrFailedToCreateReplicaDir, sealsDir)
+
+		}
 	}
-	err = os.MkdirAll(sealsDir, os.FileMode(0755))
+	trieIndexDir := filepath.Dir(r.GetTrieIndexLocalPath(tenantIdentity, 0))
+	err := os.MkdirAll(trieIndexDir, os.FileMode(0755))
 	if err != nil {
-		return fmt.Errorf("%w: %s", ErrFailedToCreateReplicaDir, sealsDir)
-
+		return fmt.Errorf("%w: %s", ErrFailedToCreateReplicaDir, trieIndexDir)
 	}
 	return nil
 }
@@ -253,7 +273,7 @@ func (r *LocalReader) GetMassif(
 
 	var mc *MassifContext
 
-	dirEntry, err := r.resolveMassifDirEntry(tenantIdentityOrLocalPath)
+	dirEntry, err := r.resolveInstanceMassifDirEntry(tenantIdentityOrLocalPath, uint32(massifIndex))
 	if err != nil {
 		return MassifContext{}, err
 	}
@@ -276,7 +296,7 @@ func (r *LocalReader) GetSeal(
 	opts ...ReaderOption,
 ) (SealedState, error) {
 
-	dirEntry, err := r.resolveSealDirEntry(tenantIdentityOrLocalPath)
+	dirEntry, err := r.resolveInstanceSealDirEntry(tenantIdentityOrLocalPath, uint32(massifIndex))
 	if err != nil {
 		return SealedState{}, err
 	}
@@ -301,6 +321,25 @@ func (r *LocalReader) GetSignedRoot(
 	return &sealedState.Sign1Message, sealedState.MMRState, nil
 }
 
+// GetConsistencyProof satisfies the ConsistencyProofGetter interface. An
+// error satisfying errors.Is(err, ErrLogFileConsistencyProofNotFound) is
+// returned if the seal has no proof in the replica.
+func (r *LocalReader) GetConsistencyProof(
+	ctx context.Context, tenantIdentityOrLocalPath string, massifIndex uint32,
+	opts ...ReaderOption,
+) (mmr.ConsistencyProof, error) {
+
+	dirEntry, err := r.resolveInstanceSealDirEntry(tenantIdentityOrLocalPath, massifIndex)
+	if err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	cp, err := dirEntry.GetConsistencyProof(r.cache, uint64(massifIndex))
+	if err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	return *cp, nil
+}
+
 // GetHeadMassif reads the most recent massif in the log identified by the tenant identity
 func (r *LocalReader) GetHeadMassif(
 	ctx context.Context, tenantIdentityOrLocalPath string,
@@ -309,7 +348,7 @@ func (r *LocalReader) GetHeadMassif(
 
 	var mc *MassifContext
 
-	dirEntry, err := r.resolveMassifDirEntry(tenantIdentityOrLocalPath)
+	dirEntry, err := r.resolveHeadMassifDirEntry(tenantIdentityOrLocalPath)
 	if err != nil {
 		return MassifContext{}, err
 	}
@@ -363,6 +402,73 @@ func (r *LocalReader) resolveMassifDirEntry(tenantIdentityOrLocalPath string) (D
 	return dirEntry, nil
 }
 
+// instanceConfig returns the log config if the log instances are to be
+// located in the replica, and nil otherwise.
+func (r *LocalReader) instanceConfig() *LogConfig {
+	if !r.InReplicaMode() {
+		return nil
+	}
+	return r.cache.Options().logConfig
+}
+
+// resolveInstanceMassifDirEntry resolves the directory entry holding the
+// massif, which depends on the log instance if a log config is provided.
+func (r *LocalReader) resolveInstanceMassifDirEntry(
+	tenantIdentityOrLocalPath string, massifIndex uint32,
+) (DirCacheEntry, error) {
+	if r.instanceConfig() == nil || !isTenantIdLike(tenantIdentityOrLocalPath) {
+		return r.resolveMassifDirEntry(tenantIdentityOrLocalPath)
+	}
+	directory := filepath.Dir(r.GetMassifLocalPath(tenantIdentityOrLocalPath, massifIndex))
+	if _, err := r.cache.ResolveMassifDir(tenantIdentityOrLocalPath); err != nil {
+		return nil, err
+	}
+	return r.cache.ReadMassifDirEntry(directory)
+}
+
+// resolveInstanceSealDirEntry resolves the directory entry holding the seal,
+// see resolveInstanceMassifDirEntry
+func (r *LocalReader) resolveInstanceSealDirEntry(
+	tenantIdentityOrLocalPath string, massifIndex uint32,
+) (*LogDirCacheEntry, error) {
+	if r.instanceConfig() == nil || !isTenantIdLike(tenantIdentityOrLocalPath) {
+		return r.resolveSealDirEntry(tenantIdentityOrLocalPath)
+	}
+	directory := filepath.Dir(r.GetSealLocalPath(tenantIdentityOrLocalPath, massifIndex))
+	if _, err := r.cache.ResolveSealDir(tenantIdentityOrLocalPath); err != nil {
+		return nil, err
+	}
+	dirEntry, err := r.cache.ReadSealDirEntry(directory)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntry.(*LogDirCacheEntry), nil
+}
+
+// resolveHeadMassifDirEntry resolves the directory entry holding the head
+// massif. If a log config is provided, this is the last instance with any
+// massifs in the replica.
+func (r *LocalReader) resolveHeadMassifDirEntry(tenantIdentityOrLocalPath string) (DirCacheEntry, error) {
+	cfg := r.instanceConfig()
+	if cfg == nil || !isTenantIdLike(tenantIdentityOrLocalPath) {
+		return r.resolveMassifDirEntry(tenantIdentityOrLocalPath)
+	}
+	for i := len(cfg.Instances) - 1; i > 0; i-- {
+		directory := filepath.Dir(r.GetMassifLocalPath(tenantIdentityOrLocalPath, cfg.Instances[i].FirstMassifIndex))
+		if fi, err := pathInfo(directory); err != nil || !fi.IsDir() {
+			continue
+		}
+		dirEntry, err := r.cache.ReadMassifDirEntry(directory)
+		if err != nil {
+			return nil, err
+		}
+		if info := dirEntry.GetInfo(); info.FirstMassifIndex <= info.HeadMassifIndex {
+			return dirEntry, nil
+		}
+	}
+	return r.resolveMassifDirEntry(tenantIdentityOrLocalPath)
+}
+
 func (r *LocalReader) resolveSealDirEntry(tenantIdentityOrLocalPath string) (*LogDirCacheEntry, error) {
 
 	directory, err := r.cache.ResolveSealDir(tenantIdentityOrLocalPath)
@@ -381,12 +487,192 @@ func (r *LocalReader) resolveSealDirEntry(tenantIdentityOrLocalPath string) (*Lo
 // GetMassifLocalPath returns the local path for the massif identified by the
 // tenant identity and massif index
 func (r *LocalReader) GetMassifLocalPath(tenantIdentity string, massifIndex uint32) string {
-	return filepath.Join(r.GetReplicaDir(), ReplicaRelativeMassifPath(tenantIdentity, massifIndex))
+	return filepath.Join(r.GetReplicaDir(), ReplicaRelativeMassifInstancePath(
+		tenantIdentity, r.cache.Options().logConfig.instanceNumber(massifIndex), massifIndex))
 }
 
 // GetSealLocalPath returns the local path for the seal identified by the tenant identity and massif index
 func (r *LocalReader) GetSealLocalPath(tenantIdentity string, massifIndex uint32) string {
-	return filepath.Join(r.GetReplicaDir(), ReplicaRelativeSealPath(tenantIdentity, massifIndex))
+	return filepath.Join(r.GetReplicaDir(), ReplicaRelativeSealInstancePath(
+		tenantIdentity, r.cache.Options().logConfig.instanceNumber(massifIndex), massifIndex))
+}
+
+// GetTrieIndexLocalPath returns the local path for the trie index of the
+// massif identified by the tenant identity and massif index
+func (r *LocalReader) GetTrieIndexLocalPath(tenantIdentity string, massifIndex uint32) string {
+	return filepath.Join(r.GetReplicaDir(), ReplicaRelativeTrieIndexPath(tenantIdentity, massifIndex))
+}
+
+// FindLeafByAppID returns the mmr index and idtimestamp of the first leaf
+// added to the log for the provided log and application id.
+//
+// In replica mode, the trie indices written by WriteTrieIndex are used if
+// present. Otherwise, or if the massif has grown since, the index is built (or
+// extended) in memory and retained by the reader. ErrTrieKeyNotFound is
+// returned if there is no such leaf.
+func (r *LocalReader) FindLeafByAppID(
+	ctx context.Context, tenantIdentityOrLocalPath string, logId []byte, appId []byte,
+	opts ...ReaderOption,
+) (uint64, uint64, error) {
+
+	dirEntry, err := r.resolveHeadMassifDirEntry(tenantIdentityOrLocalPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	info := dirEntry.GetInfo()
+	if r.instanceConfig() != nil {
+		// The massifs of earlier instances are in other directories
+		info.FirstMassifIndex = 0
+	}
+
+	for massifIndex := info.FirstMassifIndex; massifIndex <= info.HeadMassifIndex; massifIndex++ {
+
+		ti, err := r.getTrieIndex(ctx, tenantIdentityOrLocalPath, massifIndex, opts...)
+		if err != nil {
+			return 0, 0, err
+		}
+		if mmrIndex, idTimestamp, ok := ti.FindAppID(logId, appId); ok {
+			return mmrIndex, idTimestamp, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: %s", ErrTrieKeyNotFound, tenantIdentityOrLocalPath)
+}
+
+// WriteTrieIndex writes the trie index for the identified massif to the local
+// replica, replacing any existing index. It is the callers responsibility to
+// ensure that the writeOpener opens the file in *truncate* mode if it already
+// exists.
+func (r *LocalReader) WriteTrieIndex(
+	ctx context.Context, tenantIdentity string, massifIndex uint32,
+	writeOpener WriteAppendOpener,
+	opts ...ReaderOption,
+) error {
+	if !r.InReplicaMode() {
+		return fmt.Errorf("replica dir must be configured on the local reader")
+	}
+
+	ti, err := r.getTrieIndex(ctx, tenantIdentity, massifIndex, opts...)
+	if err != nil {
+		return err
+	}
+	data, err := ti.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeAll(writeOpener.Create, r.GetTrieIndexLocalPath(tenantIdentity, massifIndex), data)
+}
+
+// getTrieIndex returns the trie index for the massif, up to date with the
+// current massif content. The massif is only read if the cached, or persisted,
+// index does not cover all of its leaves.
+func (r *LocalReader) getTrieIndex(
+	ctx context.Context, tenantIdentityOrLocalPath string, massifIndex uint32,
+	opts ...ReaderOption,
+) (*TrieIndex, error) {
+
+	if r.trieIndexes == nil {
+		r.trieIndexes = newTrieIndexCache()
+	}
+
+	key := TenantMassifTrieIndexPath(tenantIdentityOrLocalPath, massifIndex)
+	ti := r.trieIndexes.get(key)
+	if ti == nil && r.InReplicaMode() {
+		if ti = r.readTrieIndex(r.GetTrieIndexLocalPath(tenantIdentityOrLocalPath, massifIndex)); ti != nil {
+			r.trieIndexes.put(key, ti)
+		}
+	}
+	if ti != nil && r.trieIndexCoversMassif(tenantIdentityOrLocalPath, massifIndex, ti) {
+		return ti, nil
+	}
+
+	mc, err := r.GetMassif(ctx, tenantIdentityOrLocalPath, uint64(massifIndex), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return r.trieIndexes.update(key, &mc)
+}
+
+// trieIndexCoversMassif returns true if the index is for the massif, covers all
+// of its leaves, and has the same trie key for the last of them. Only the
+// massif start, which is cached by the directory scan, the size of the massif
+// file and the one trie key are read. False is returned if the massif is
+// already cached, or if anything can't be read, so that the index is checked
+// against the complete massif instead.
+func (r *LocalReader) trieIndexCoversMassif(
+	tenantIdentityOrLocalPath string, massifIndex uint32, ti *TrieIndex,
+) bool {
+
+	dirEntry, err := r.resolveInstanceMassifDirEntry(tenantIdentityOrLocalPath, massifIndex)
+	if err != nil {
+		return false
+	}
+	d, ok := dirEntry.(*LogDirCacheEntry)
+	if !ok {
+		return false
+	}
+	logfile, ok := d.MassifPaths[uint64(massifIndex)]
+	if !ok || d.Massifs[logfile] != nil {
+		return false
+	}
+	mc := MassifContext{Start: d.MassifStarts[logfile]}
+	if err = r.cache.Options().logConfig.fixupMassifStart(&mc.Start); err != nil {
+		return false
+	}
+	if ti.checkStart(mc.Start) != nil {
+		return false
+	}
+
+	fi, err := pathInfo(logfile)
+	if err != nil || uint64(fi.Size()) < mc.LogStart() {
+		return false
+	}
+	count := (uint64(fi.Size()) - mc.LogStart()) / LogEntryBytes
+	leafCount := mmr.LeafCount(mc.Start.FirstIndex+count) - mmr.LeafCount(mc.Start.FirstIndex)
+	if leafCount != ti.LeafCount {
+		return false
+	}
+	if leafCount == 0 {
+		return true
+	}
+
+	f, err := r.cache.GetOpener().Open(logfile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if _, err = io.CopyN(io.Discard, f, int64(TrieEntryOffset(mc.IndexStart(), leafCount-1))); err != nil {
+		return false
+	}
+	trieKey := make([]byte, TrieKeyBytes)
+	if _, err = io.ReadFull(f, trieKey); err != nil {
+		return false
+	}
+	return ti.matchesLastTrieKey(trieKey)
+}
+
+// readTrieIndex reads a previously written trie index. The index can always be
+// re-created from the massif, so nil is returned if it can't be read for any
+// reason.
+func (r *LocalReader) readTrieIndex(filename string) *TrieIndex {
+
+	f, err := r.cache.GetOpener().Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	ti := &TrieIndex{}
+	if err = ti.UnmarshalBinary(data); err != nil {
+		if r.log != nil {
+			r.log.Infof("ignoring trie index %s: %v", filename, err)
+		}
+		return nil
+	}
+	return ti
 }
 
 // GetLazyContext is an optimization for remote massif readers
@@ -408,13 +694,20 @@ func copyCachedMassif(cached *MassifContext) MassifContext {
 
 type WriteOpener func(name string) (io.WriteCloser, error)
 
-func writeAll(wo WriteOpener, filename string, data []byte) error {
+// writeAll writes the data to the named file. The file is closed before
+// returning, and an error closing it is returned with any error writing it, as
+// writers may only complete the write when closed, see AtomicFileWriteOpener.
+func writeAll(wo WriteOpener, filename string, data []byte) (err error) {
 	f, err := wo(filename)
 	if err != nil {
 		return err
 
 	}
-	defer f.Close()
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
 
 	n, err := f.Write(data)
 	if err != nil {
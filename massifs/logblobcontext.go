@@ -4,8 +4,6 @@ import (
 	"context"
 	"maps"
 	"time"
-
-	"github.com/datatrails/go-datatrails-common/azblob"
 )
 
 // LogBlobContext provides a common context for reading & writing log blobs
@@ -38,24 +36,18 @@ func (lc *LogBlobContext) CopyTags() map[string]string {
 // The various metadata fields are populated from the blob store response
 // On return, the Data member containes the blob contents
 func (lc *LogBlobContext) ReadData(
-	ctx context.Context, store LogBlobReader, opts ...azblob.Option) error {
+	ctx context.Context, store LogBlobReader, opts ...ObjectOption) error {
 
 	var err error
-	var rr *azblob.ReaderResponse
+	var rr *ObjectReadResponse
 
 	rr, lc.Data, err = BlobRead(ctx, lc.BlobPath, store, opts...)
 	if err != nil {
 		return err
 	}
 	lc.Tags = rr.Tags
-
-	if rr.ETag != nil {
-		lc.ETag = *rr.ETag
-	}
-
-	if rr.LastModified != nil {
-		lc.LastModified = *rr.LastModified
-	}
+	lc.ETag = rr.ETag
+	lc.LastModified = rr.LastModified
 
 	lc.LastRead = time.Now()
 	lc.ContentLength = rr.ContentLength
@@ -0,0 +1,225 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+/**
+ * Log instances
+ *
+ * The massif height of a log can't be changed in place. Instead a new log
+ * instance is started, from a particular leaf, with the new height. The
+ * massifs of each instance are stored under their own path (see
+ * TenantMassifInstancePrefix), but the MMR is continuous: the first massif of
+ * a new instance carries forward the ancestor peak stack of the last massif
+ * of the previous instance, and massif indices continue from the previous
+ * instance. Proofs for any leaf verify in the same way regardless of the
+ * instance holding it.
+ *
+ * The leaf a new instance starts from must complete a massif of the previous
+ * instance, and must also be a whole number of massifs at the new height. This
+ * ensures the ancestor peak stack is the same for both heights.
+ *
+ * Because the massif start header records only the height and index of the
+ * massif, the first index of a massif in a later instance can't be derived
+ * from the header alone. Readers provided with the log configuration, see
+ * WithLogConfig, correct it when the massif is read.
+ */
+
+var (
+	ErrLogConfigInvalid  = errors.New("the log instance configuration is invalid")
+	ErrLogConfigMismatch = errors.New("the massif does not match the log instance configuration")
+)
+
+// LogInstance records the leaf from which a massif height applies
+type LogInstance struct {
+	Instance     uint32 `cbor:"1,keyasint"`
+	FirstLeaf    uint64 `cbor:"2,keyasint"`
+	MassifHeight uint8  `cbor:"3,keyasint"`
+	// FirstMassifIndex is the index of the first massif in the instance
+	FirstMassifIndex uint32 `cbor:"4,keyasint"`
+}
+
+// LogConfig records the instances of a log, in order. The first instance
+// always starts from leaf 0.
+type LogConfig struct {
+	Instances []LogInstance `cbor:"1,keyasint"`
+}
+
+// NewLogConfig returns the configuration for a log with a single instance
+func NewLogConfig(massifHeight uint8) LogConfig {
+	return LogConfig{Instances: []LogInstance{{Instance: LogInstanceN, MassifHeight: massifHeight}}}
+}
+
+// AddInstance starts a new instance, with the provided massif height, from
+// firstLeaf.
+func (c *LogConfig) AddInstance(firstLeaf uint64, massifHeight uint8) error {
+
+	if len(c.Instances) == 0 {
+		return fmt.Errorf("%w: there is no initial instance", ErrLogConfigInvalid)
+	}
+	prev := c.Instances[len(c.Instances)-1]
+	if massifHeight == 0 || massifHeight > 64 {
+		return fmt.Errorf("%w: massif height %d", ErrLogConfigInvalid, massifHeight)
+	}
+	if firstLeaf <= prev.FirstLeaf {
+		return fmt.Errorf(
+			"%w: instance leaf %d does not follow leaf %d", ErrLogConfigInvalid, firstLeaf, prev.FirstLeaf)
+	}
+	if !isMassifBoundary(prev.MassifHeight, firstLeaf) || !isMassifBoundary(massifHeight, firstLeaf) {
+		return fmt.Errorf(
+			"%w: leaf %d is not a massif boundary for heights %d and %d",
+			ErrLogConfigInvalid, firstLeaf, prev.MassifHeight, massifHeight)
+	}
+	c.Instances = append(c.Instances, LogInstance{
+		Instance:         prev.Instance + 1,
+		FirstLeaf:        firstLeaf,
+		MassifHeight:     massifHeight,
+		FirstMassifIndex: prev.FirstMassifIndex + uint32((firstLeaf-prev.FirstLeaf)>>(prev.MassifHeight-1)),
+	})
+	return nil
+}
+
+// Validate checks the configuration could have been created by AddInstance,
+// which is necessary for configurations read from storage.
+func (c LogConfig) Validate() error {
+	if len(c.Instances) == 0 {
+		return fmt.Errorf("%w: there are no instances", ErrLogConfigInvalid)
+	}
+	first := c.Instances[0]
+	if first.FirstLeaf != 0 || first.FirstMassifIndex != 0 || first.MassifHeight == 0 || first.MassifHeight > 64 {
+		return fmt.Errorf("%w: the first instance must start at leaf 0", ErrLogConfigInvalid)
+	}
+	check := LogConfig{Instances: []LogInstance{first}}
+	for _, inst := range c.Instances[1:] {
+		if err := check.AddInstance(inst.FirstLeaf, inst.MassifHeight); err != nil {
+			return err
+		}
+		if check.Instances[len(check.Instances)-1] != inst {
+			return fmt.Errorf("%w: instance %d", ErrLogConfigInvalid, inst.Instance)
+		}
+	}
+	return nil
+}
+
+// InstanceForMassif returns the instance holding the massif
+func (c LogConfig) InstanceForMassif(massifIndex uint32) LogInstance {
+	for i := len(c.Instances) - 1; i > 0; i-- {
+		if massifIndex >= c.Instances[i].FirstMassifIndex {
+			return c.Instances[i]
+		}
+	}
+	return c.Instances[0]
+}
+
+// InstanceForMMRIndex returns the instance holding the node at mmrIndex
+func (c LogConfig) InstanceForMMRIndex(mmrIndex uint64) LogInstance {
+	// Interior nodes are always stored with the leaf whose addition created them
+	leafIndex := mmr.LeafCount(mmrIndex+1) - 1
+	for i := len(c.Instances) - 1; i > 0; i-- {
+		if leafIndex >= c.Instances[i].FirstLeaf {
+			return c.Instances[i]
+		}
+	}
+	return c.Instances[0]
+}
+
+// MassifIndexFromMMRIndex returns the index of the massif holding the node
+func (c LogConfig) MassifIndexFromMMRIndex(mmrIndex uint64) uint32 {
+	inst := c.InstanceForMMRIndex(mmrIndex)
+	leafIndex := mmr.LeafCount(mmrIndex+1) - 1
+	return inst.FirstMassifIndex + uint32((leafIndex-inst.FirstLeaf)>>(inst.MassifHeight-1))
+}
+
+// MassifFirstLeaf returns the leaf index of the first leaf in the massif
+func (c LogConfig) MassifFirstLeaf(massifIndex uint32) uint64 {
+	inst := c.InstanceForMassif(massifIndex)
+	return inst.FirstLeaf + uint64(massifIndex-inst.FirstMassifIndex)<<(inst.MassifHeight-1)
+}
+
+// FixupMassifStart sets the first index, and the peak stack length, of a
+// decoded massif start according to the instance holding the massif. The
+// massif height must match the instance.
+func (c LogConfig) FixupMassifStart(ms *MassifStart) error {
+	inst := c.InstanceForMassif(ms.MassifIndex)
+	if inst.MassifHeight != ms.MassifHeight {
+		return fmt.Errorf(
+			"%w: massif %d has height %d, instance %d has height %d",
+			ErrLogConfigMismatch, ms.MassifIndex, ms.MassifHeight, inst.Instance, inst.MassifHeight)
+	}
+	firstLeaf := c.MassifFirstLeaf(ms.MassifIndex)
+	ms.FirstIndex = mmr.MMRIndex(firstLeaf)
+	// Massifs start on a massif boundary for all instances, so the ancestor
+	// peak stack is all the peaks of the preceding MMR
+	ms.PeakStackLen = uint64(bits.OnesCount64(firstLeaf))
+	return nil
+}
+
+// The unexported methods accept a nil configuration, which is a log with a
+// single instance whose height is provided by the caller.
+
+func (c *LogConfig) massifBlobPath(tenantIdentity string, massifIndex uint32) string {
+	return TenantMassifInstanceBlobPath(tenantIdentity, c.instanceNumber(massifIndex), uint64(massifIndex))
+}
+
+func (c *LogConfig) sealBlobPath(tenantIdentity string, massifIndex uint32) string {
+	return TenantMassifInstanceSignedRootPath(tenantIdentity, c.instanceNumber(massifIndex), massifIndex)
+}
+
+func (c *LogConfig) consistencyProofBlobPath(tenantIdentity string, massifIndex uint32) string {
+	return TenantMassifInstanceConsistencyProofPath(tenantIdentity, c.instanceNumber(massifIndex), massifIndex)
+}
+
+func (c *LogConfig) replicaMassifPath(tenantIdentity string, massifIndex uint32) string {
+	return ReplicaRelativeMassifInstancePath(tenantIdentity, c.instanceNumber(massifIndex), massifIndex)
+}
+
+func (c *LogConfig) replicaSealPath(tenantIdentity string, massifIndex uint32) string {
+	return ReplicaRelativeSealInstancePath(tenantIdentity, c.instanceNumber(massifIndex), massifIndex)
+}
+
+func (c *LogConfig) instanceNumber(massifIndex uint32) uint32 {
+	if c == nil {
+		return LogInstanceN
+	}
+	return c.InstanceForMassif(massifIndex).Instance
+}
+
+func (c *LogConfig) fixupMassifStart(ms *MassifStart) error {
+	if c == nil {
+		return nil
+	}
+	return c.FixupMassifStart(ms)
+}
+
+func (c *LogConfig) massifIndexFromMMRIndex(massifHeight uint8, mmrIndex uint64) uint64 {
+	if c == nil {
+		return MassifIndexFromMMRIndex(massifHeight, mmrIndex)
+	}
+	return uint64(c.MassifIndexFromMMRIndex(mmrIndex))
+}
+
+// massifFirstLeaf returns the first leaf of the massif, see massifHeight
+func (c *LogConfig) massifFirstLeaf(massifHeight uint8, massifIndex uint32) uint64 {
+	if c == nil {
+		return uint64(massifIndex) << (massifHeight - 1)
+	}
+	return c.MassifFirstLeaf(massifIndex)
+}
+
+// massifHeight returns the height of the massif, which is the provided height
+// for a log with a single instance
+func (c *LogConfig) massifHeight(massifHeight uint8, massifIndex uint32) uint8 {
+	if c == nil {
+		return massifHeight
+	}
+	return c.InstanceForMassif(massifIndex).MassifHeight
+}
+
+func isMassifBoundary(massifHeight uint8, leafIndex uint64) bool {
+	return leafIndex&(uint64(1)<<(massifHeight-1)-1) == 0
+}
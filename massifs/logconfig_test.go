@@ -0,0 +1,266 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogConfig_AddInstance(t *testing.T) {
+	tests := []struct {
+		name         string
+		firstLeaf    uint64
+		massifHeight uint8
+		wantErr      bool
+		wantMassif   uint32
+	}{
+		{name: "larger massifs", firstLeaf: 8, massifHeight: 4, wantMassif: 2},
+		{name: "smaller massifs", firstLeaf: 4, massifHeight: 2, wantMassif: 1},
+		{name: "not a boundary for the new height", firstLeaf: 4, massifHeight: 4, wantErr: true},
+		{name: "not a boundary for the previous height", firstLeaf: 6, massifHeight: 2, wantErr: true},
+		{name: "first leaf", firstLeaf: 0, massifHeight: 3, wantErr: true},
+		{name: "zero height", firstLeaf: 8, massifHeight: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewLogConfig(3)
+			err := cfg.AddInstance(tt.firstLeaf, tt.massifHeight)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrLogConfigInvalid)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, cfg.Validate())
+			inst := cfg.Instances[1]
+			assert.Equal(t, uint32(1), inst.Instance)
+			assert.Equal(t, tt.wantMassif, inst.FirstMassifIndex)
+			assert.Equal(t, inst, cfg.InstanceForMassif(tt.wantMassif))
+			assert.Equal(t, cfg.Instances[0], cfg.InstanceForMassif(tt.wantMassif-1))
+			assert.Equal(t, tt.wantMassif, cfg.MassifIndexFromMMRIndex(mmr.MMRIndex(tt.firstLeaf)))
+			assert.Equal(t, tt.wantMassif-1, cfg.MassifIndexFromMMRIndex(mmr.MMRIndex(tt.firstLeaf)-1))
+		})
+	}
+
+	cfg := NewLogConfig(3)
+	require.NoError(t, cfg.AddInstance(8, 4))
+	cfg.Instances[1].FirstMassifIndex++
+	assert.ErrorIs(t, cfg.Validate(), ErrLogConfigInvalid)
+}
+
+// TestLogConfig_Instances checks a log which changes massif height part way
+// through can be read, verified and proven across the instance boundary.
+func TestLogConfig_Instances(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	leafCount := uint64(11)
+	leaves := testLeafEntries(0, leafCount)
+
+	// 2 leaves per massif for massifs 0 and 1, then 4 leaves per massif from
+	// leaf 4, which is massif 2
+	cfg := NewLogConfig(2)
+	require.NoError(t, cfg.AddInstance(4, 3))
+
+	store := NewMemObjectStore()
+	w := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{LogConfig: &cfg}, nil, store), tenant, 2)
+	_, err := w.AddLeaves(ctx, leaves[:5])
+	require.NoError(t, err)
+	// Re-read the log from storage part way through the new instance
+	w.Reset()
+	_, err = w.AddLeaves(ctx, leaves[5:])
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, TenantMassifInstanceBlobPath(tenant, 1, 2))
+	require.NoError(t, err)
+	_, err = store.Get(ctx, TenantMassifBlobPath(tenant, 2))
+	require.Error(t, err)
+
+	// The MMR does not depend on how it is divided into massifs
+	uniform := NewMemObjectStore()
+	w = NewLogWriter(NewMassifCommitter(MassifCommitterConfig{}, nil, uniform), tenant, 2)
+	_, err = w.AddLeaves(ctx, leaves)
+	require.NoError(t, err)
+	uniformReader := NewMassifReader(nil, uniform)
+	uniformHead, err := uniformReader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+
+	reader := NewMassifReader(nil, store, WithLogConfig(cfg))
+	head, err := reader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), head.Start.MassifIndex)
+	assert.Equal(t, uint8(3), head.Start.MassifHeight)
+	mmrSize := head.RangeCount()
+	require.Equal(t, uniformHead.RangeCount(), mmrSize)
+
+	peaks, err := mmr.PeakHashes(&head, mmrSize-1)
+	require.NoError(t, err)
+	uniformPeaks, err := mmr.PeakHashes(&uniformHead, mmrSize-1)
+	require.NoError(t, err)
+	assert.Equal(t, uniformPeaks, peaks)
+
+	// Seal every massif, and verify each against its seal
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := NewTestSignerContext(t, "test.issuer")
+	for massifIndex := range head.Start.MassifIndex + 1 {
+		mc, err := reader.GetMassif(ctx, tenant, uint64(massifIndex))
+		require.NoError(t, err)
+		assert.Equal(t, mmr.MMRIndex(cfg.MassifFirstLeaf(massifIndex)), mc.Start.FirstIndex)
+		peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		sealed, err := signer.SealedState(tenant, uint64(massifIndex), MMRState{
+			Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks, Timestamp: 1234})
+		require.NoError(t, err)
+		data, err := sealed.Sign1Message.MarshalCBOR()
+		require.NoError(t, err)
+		_, err = store.Put(ctx, cfg.sealBlobPath(tenant, massifIndex), data)
+		require.NoError(t, err)
+	}
+	sealReader := NewSignedRootReader(nil, store, codec)
+	for massifIndex := range uint64(head.Start.MassifIndex + 1) {
+		_, err := reader.GetVerifiedContext(
+			ctx, tenant, massifIndex, WithSealGetter(&sealReader), WithCBORCodec(codec))
+		require.NoError(t, err)
+	}
+
+	// Every leaf is provable against the head, including those in the
+	// previous instance
+	s := NewMultiMassifStore(ctx, &reader, tenant, 0, 0, WithLogConfig(cfg))
+	for iLeaf := range leafCount {
+		mmrIndex := mmr.MMRIndex(iLeaf)
+		proof, err := mmr.InclusionProof(s, mmrSize-1, mmrIndex)
+		require.NoError(t, err)
+		ok, err := mmr.VerifyInclusion(&head, sha256.New(), mmrSize, leaves[iLeaf].Value, mmrIndex, proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	// The local reader stitches the instances together in a replica
+	replicaDir := t.TempDir()
+	for massifIndex := range head.Start.MassifIndex + 1 {
+		for _, blobPath := range []string{cfg.massifBlobPath(tenant, massifIndex), cfg.sealBlobPath(tenant, massifIndex)} {
+			_, data, err := BlobRead(ctx, blobPath, store)
+			require.NoError(t, err)
+			filePath := filepath.Join(replicaDir, strings.TrimPrefix(blobPath, V1MMRPrefix+"/"))
+			require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+			require.NoError(t, os.WriteFile(filePath, data, 0644))
+		}
+	}
+	cache, err := NewLogDirCache(nil, testOSOpener{},
+		WithDirCacheReplicaDir(replicaDir),
+		WithDirCacheMassifLister(testOSDirLister{}),
+		WithDirCacheSealLister(testOSDirLister{}),
+		WithReaderOption(WithCBORCodec(codec)),
+		WithReaderOption(WithLogConfig(cfg)),
+	)
+	require.NoError(t, err)
+	localReader, err := NewLocalReader(nil, cache)
+	require.NoError(t, err)
+
+	localHead, err := localReader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	assert.Equal(t, head.Start, localHead.Start)
+	for massifIndex := range uint64(head.Start.MassifIndex + 1) {
+		_, err := localReader.GetVerifiedContext(ctx, tenant, massifIndex, WithSealGetter(&localReader))
+		require.NoError(t, err)
+	}
+
+	// Receipts are built from the massif holding the leaf, on either side of
+	// the instance boundary, by both the remote and local builders. The height
+	// provided is that of the first instance, the log config locates the
+	// massifs after it.
+	remote, err := NewReceiptBuilder(nil, store, 2, WithLogConfig(cfg))
+	require.NoError(t, err)
+	local, err := NewLocalReceiptBuilder(nil, localReader, 2)
+	require.NoError(t, err)
+	for _, iLeaf := range []uint64{3, 4, 10} {
+		mmrIndex := mmr.MMRIndex(iLeaf)
+		for _, builder := range []ReceiptBuilder{remote, local} {
+			receipt, err := builder.BuildReceipt(ctx, tenant, mmrIndex)
+			require.NoError(t, err)
+			data, err := receipt.MarshalCBOR()
+			require.NoError(t, err)
+			receipt, err = commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(CheckpointDecOptions()))
+			require.NoError(t, err)
+			ok, _, err := VerifySignedInclusionReceipt(ctx, receipt, leaves[iLeaf].Value)
+			require.NoError(t, err)
+			assert.True(t, ok, "leaf %d", iLeaf)
+		}
+	}
+	_, err = remote.BuildBatchReceipt(ctx, tenant, []uint64{mmr.MMRIndex(3), mmr.MMRIndex(4)})
+	assert.ErrorIs(t, err, ErrBatchReceiptMassif)
+}
+
+// TestLogConfig_Snapshot checks a log with more than one instance can be
+// audited, and exported to, and imported from, a snapshot.
+func TestLogConfig_Snapshot(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	cfg := NewLogConfig(2)
+	require.NoError(t, cfg.AddInstance(4, 3))
+
+	store := NewMemObjectStore()
+	w := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{LogConfig: &cfg}, nil, store), tenant, 2)
+	signer := NewTestSignerContext(t, "test.issuer")
+	codec := signer.RootSignerCodec
+	sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, codec, WithLogConfig(cfg))
+	for _, leaves := range [][2]uint64{{0, 3}, {3, 4}, {7, 4}} {
+		_, err := w.AddLeaves(ctx, testLeafEntries(leaves[0], leaves[1]))
+		require.NoError(t, err)
+		_, err = sealer.SealTenant(ctx, tenant)
+		require.NoError(t, err)
+	}
+
+	reader := NewMassifReader(nil, store, WithLogConfig(cfg))
+	sealReader := NewSignedRootReader(nil, store, codec)
+	auditor := NewAuditor(nil, &reader, WithSealGetter(&sealReader), WithCBORCodec(codec), WithLogConfig(cfg))
+	report, err := auditor.Audit(ctx, tenant)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%v", report.Failures)
+
+	var archive bytes.Buffer
+	manifest, err := ExportSnapshot(
+		ctx, &archive, &reader, tenant, WithSealGetter(&sealReader), WithCBORCodec(codec), WithLogConfig(cfg))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, manifest.LogConfig)
+	assert.Equal(t, uint32(4), manifest.MassifCount)
+
+	newLocalReader := func(opts ...DirCacheOption) LocalReader {
+		cache, err := NewLogDirCache(nil, testOSOpener{}, append([]DirCacheOption{
+			WithDirCacheReplicaDir(t.TempDir()),
+			WithDirCacheMassifLister(testOSDirLister{}),
+			WithDirCacheSealLister(testOSDirLister{}),
+			WithReaderOption(WithCBORCodec(codec)),
+		}, opts...)...)
+		require.NoError(t, err)
+		localReader, err := NewLocalReader(nil, cache)
+		require.NoError(t, err)
+		return localReader
+	}
+
+	// The local reader must locate the massifs as the manifest does
+	localReader := newLocalReader()
+	_, err = ImportSnapshot(
+		ctx, bytes.NewReader(archive.Bytes()), &localReader, AtomicFileWriteOpener{}, WithCBORCodec(codec))
+	assert.ErrorIs(t, err, ErrSnapshotManifestMismatch)
+
+	localReader = newLocalReader(WithReaderOption(WithLogConfig(cfg)))
+	_, err = ImportSnapshot(
+		ctx, bytes.NewReader(archive.Bytes()), &localReader, AtomicFileWriteOpener{}, WithCBORCodec(codec))
+	require.NoError(t, err)
+	for massifIndex := range uint64(manifest.MassifCount) {
+		_, err := localReader.GetVerifiedContext(ctx, tenant, massifIndex, WithSealGetter(&localReader))
+		require.NoError(t, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
 )
 
 var (
@@ -21,6 +22,7 @@ var (
 	ErrLogFileDuplicateMassifIndices        = errors.New("log files with the same massif index found in a single directory")
 	ErrLogFileMassifNotFound                = errors.New("a log file corresponding to the massif index was not found")
 	ErrLogFileSealNotFound                  = errors.New("a log seal corresponding to the massif index was not found")
+	ErrLogFileConsistencyProofNotFound      = errors.New("a consistency proof for the log seal corresponding to the massif index was not found")
 	ErrMassifDirListerNotProvided           = errors.New("the reader option providing a massif directory lister was not provided")
 	ErrSealDirListerNotProvided             = errors.New("the reader option providing a massif seal directory lister was not provided")
 	ErrAddSealExists                        = errors.New("attempt to add a sealed stated entry that already exists")
@@ -161,6 +163,9 @@ type LogDirCacheEntry struct {
 	Seals            map[string]*SealedState
 	MassifPaths      map[uint64]string
 	SealPaths        map[uint64]string
+	// ConsistencyProofs are keyed by the file name of the seal they are
+	// stored with
+	ConsistencyProofs map[string]*mmr.ConsistencyProof
 }
 
 func NewLogDirCacheEntry(directory string) *LogDirCacheEntry {
@@ -173,6 +178,8 @@ func NewLogDirCacheEntry(directory string) *LogDirCacheEntry {
 		Seals:            make(map[string]*SealedState),
 		MassifPaths:      make(map[uint64]string),
 		SealPaths:        make(map[uint64]string),
+
+		ConsistencyProofs: make(map[string]*mmr.ConsistencyProof),
 	}
 }
 
@@ -270,6 +277,8 @@ func (c *LogDirCache) ReplaceSeal(sealFilename string, massifIndex uint32, seale
 	}
 
 	dirEntry.Seals[sealFilename] = sealedState
+	// Any proof read previously was for the replaced seal
+	delete(dirEntry.ConsistencyProofs, sealFilename)
 	return nil
 }
 
@@ -311,6 +320,12 @@ func (c *LogDirCache) FindSealFiles(directory string) error {
 
 	for _, filepath := range entries {
 
+		// The consistency proofs are stored alongside the seals, they are
+		// read on demand by GetConsistencyProof
+		if strings.HasSuffix(filepath, V1MMRExtSep+V1MMRSealCPROOF) {
+			continue
+		}
+
 		_, err := dirEntry.ReadSeal(c, filepath)
 		if err != nil {
 			return err
@@ -379,6 +394,18 @@ func (c *LogDirCache) ReadSeal(directory string, massifIndex uint64) (*SealedSta
 	return dirEntry.GetSeal(c, massifIndex)
 }
 
+// ReadConsistencyProof reads the consistency proof stored with the seal of the
+// massif, identified by its index, from the provided directory. See
+// LogDirCacheEntry.GetConsistencyProof
+func (c *LogDirCache) ReadConsistencyProof(directory string, massifIndex uint64) (*mmr.ConsistencyProof, error) {
+
+	dirEntry, err := c.ReadSealDirEntry(directory)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntry.(*LogDirCacheEntry).GetConsistencyProof(c, massifIndex)
+}
+
 // isTenantIdLike returns true if the the provided string starts with "tenant/" and contains only a single "/"
 func isTenantIdLike(tenantIdentityOrLocalPath string) bool {
 	return strings.HasPrefix(tenantIdentityOrLocalPath, "tenant/") && strings.Count(tenantIdentityOrLocalPath, "/") == 1
@@ -488,6 +515,9 @@ func (d *LogDirCacheEntry) ReadMassif(c DirCache, massifIndex uint64) (*MassifCo
 	if err != nil {
 		return nil, err
 	}
+	if err = c.Options().logConfig.fixupMassifStart(&cached.Start); err != nil {
+		return nil, err
+	}
 
 	if !c.Options().noGetRootSupport {
 		if err = cached.CreatePeakStackMap(); err != nil {
@@ -545,12 +575,51 @@ func (d *LogDirCacheEntry) ReadSeal(c DirCache, fileName string) (*SealedState,
 	cached.Sign1Message = *cachedMessage
 
 	d.Seals[fileName] = cached
-	massifIndex := MassifIndexFromMMRIndex(c.Options().massifHeight, unverifiedState.MMRSize-1)
+	massifIndex := c.Options().logConfig.massifIndexFromMMRIndex(c.Options().massifHeight, unverifiedState.MMRSize-1)
 	d.SealPaths[massifIndex] = fileName
 
 	return cached, nil
 }
 
+// GetConsistencyProof reads and caches the consistency proof stored with the
+// seal of the massif. The proof file has the name of the seal file, with the
+// cproof extension in place of the seal extension.
+func (d *LogDirCacheEntry) GetConsistencyProof(c DirCache, massifIndex uint64) (*mmr.ConsistencyProof, error) {
+
+	sealFileName, ok := d.SealPaths[massifIndex]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrLogFileSealNotFound, massifIndex)
+	}
+	if cached, ok := d.ConsistencyProofs[sealFileName]; ok {
+		return cached, nil
+	}
+
+	fileName := strings.TrimSuffix(sealFileName, V1MMRSealSignedRootExt) + V1MMRSealCPROOF
+	reader, err := c.Open(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %d", ErrLogFileConsistencyProofNotFound, massifIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := DecodeConsistencyProof(*c.Options().codec, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ConsistencyProofs == nil {
+		d.ConsistencyProofs = make(map[string]*mmr.ConsistencyProof)
+	}
+	d.ConsistencyProofs[sealFileName] = &cp
+	return &cp, nil
+}
+
 func (d *LogDirCacheEntry) ReadMassifStart(dirCache DirCache, logfile string) (MassifStart, error) {
 
 	if ms, ok := d.MassifStarts[logfile]; ok {
@@ -606,9 +675,11 @@ func (d *LogDirCacheEntry) setMassifStart(opts DirCacheOptions, logfile string,
 	// note: we could require the epoch to be 1, but that would interfere with testing
 	// same for the massifHeight
 
-	// If the options require a specific massif height check the height we got from the header.
-	if opts.massifHeight != 0 && ms.MassifHeight != opts.massifHeight {
-		return fmt.Errorf("%w: header=%d, expected=%d", ErrLogFileMassifHeightHeader, ms.MassifHeight, opts.massifHeight)
+	// If the options require a specific massif height check the height we got
+	// from the header. The log config, if provided, determines the height.
+	expectedHeight := opts.logConfig.massifHeight(opts.massifHeight, ms.MassifIndex)
+	if expectedHeight != 0 && ms.MassifHeight != expectedHeight {
+		return fmt.Errorf("%w: header=%d, expected=%d", ErrLogFileMassifHeightHeader, ms.MassifHeight, expectedHeight)
 	}
 
 	// Note: If we have a mix of tenant massifs in the same directory we leave
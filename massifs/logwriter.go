@@ -0,0 +1,150 @@
+package massifs
+
+import (
+	"context"
+	"time"
+)
+
+// LogWriter appends leaves to a tenant's log, rolling over to a new massif
+// blob whenever the current one is filled.
+//
+// Every call to AddLeaves is committed before it returns. Each massif which is
+// completed by the call is committed, in order, followed by the massif which
+// is left current. The current massif context, and its etag, is retained
+// between calls so the log is only read from storage when the writer is first
+// used, or after a failed commit.
+//
+// Typically there should be a single writer for a tenant's log. If another
+// writer commits to the log, the etag check in CommitContext fails with
+// ErrObjectConditionNotMet and the writer re-reads the log on its next use.
+//
+// A LogWriter is not safe for concurrent use.
+type LogWriter struct {
+	Committer      *MassifCommitter
+	TenantIdentity string
+	MassifHeight   uint8
+
+	// mc is the last committed state of the current massif. It is nil until
+	// the log is first read and after any failure.
+	mc *MassifContext
+}
+
+func NewLogWriter(committer *MassifCommitter, tenantIdentity string, massifHeight uint8) *LogWriter {
+	return &LogWriter{
+		Committer:      committer,
+		TenantIdentity: tenantIdentity,
+		MassifHeight:   massifHeight,
+	}
+}
+
+// AddLeaves adds the leaves to the log, in order, and commits them.
+//
+// Returns the mmr index of each leaf. On error, the returned indices are those
+// of the leaves which were committed before the error occurred. The leaves
+// which follow them were not added, and the writer re-reads the log on the
+// next call.
+func (w *LogWriter) AddLeaves(ctx context.Context, leaves []LeafEntry) ([]uint64, error) {
+
+	mmrIndices := make([]uint64, 0, len(leaves))
+
+	for len(leaves) > 0 {
+
+		mc, err := w.currentContext(ctx)
+		if err != nil {
+			return mmrIndices, err
+		}
+		// The leaves are in the configured epoch, which may be later than
+		// the epoch of the log so far.
+		if err = mc.advanceCommitmentEpoch(w.Committer.Cfg.CommitmentEpoch); err != nil {
+			w.mc = nil
+			return mmrIndices, err
+		}
+
+		// Bound the size of the batch so that at most one massif is completed
+		// before it is committed, regardless of the number of leaves. The
+		// height is taken from the massif as it can change between log
+		// instances.
+		leavesPerMassif := uint64(1) << (mc.Start.MassifHeight - 1)
+		n := min(leavesPerMassif-mc.MassifLeafCount(), uint64(len(leaves)))
+
+		indices, completed, err := mc.AddHashedLeaves(mc.Hasher(), leaves[:n])
+		if err != nil {
+			w.mc = nil
+			return mmrIndices, err
+		}
+
+		for _, full := range completed {
+			if _, err = w.Committer.CommitContext(ctx, full); err != nil {
+				w.mc = nil
+				return mmrIndices, err
+			}
+		}
+		if err = w.commitCurrent(ctx, mc); err != nil {
+			w.mc = nil
+			return mmrIndices, err
+		}
+
+		mmrIndices = append(mmrIndices, indices...)
+		leaves = leaves[n:]
+	}
+
+	return mmrIndices, nil
+}
+
+// AddHashedLeaf adds a single leaf to the log and commits it. See AddLeaves
+func (w *LogWriter) AddHashedLeaf(
+	ctx context.Context,
+	idTimestamp uint64, extraBytes []byte, logId []byte, appId []byte, value []byte,
+) (uint64, error) {
+
+	mmrIndices, err := w.AddLeaves(ctx, []LeafEntry{{
+		IDTimestamp: idTimestamp, ExtraBytes: extraBytes, LogID: logId, AppID: appId, Value: value,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return mmrIndices[0], nil
+}
+
+// Reset discards the retained massif context, forcing the log to be re-read
+// on the next call to AddLeaves
+func (w *LogWriter) Reset() {
+	w.mc = nil
+}
+
+// currentContext returns the context for the massif which has room for the
+// next leaf, reading it from storage if necessary.
+func (w *LogWriter) currentContext(ctx context.Context) (*MassifContext, error) {
+	if w.mc != nil {
+		return w.mc, nil
+	}
+	mc, err := w.Committer.GetCurrentContext(ctx, w.TenantIdentity, w.MassifHeight)
+	if err != nil {
+		return nil, err
+	}
+	w.mc = &mc
+	return w.mc, nil
+}
+
+// commitCurrent commits the current massif and retains it, with the new etag,
+// for the next call. If the massif is full, the retained context is advanced
+// to the next massif, exactly as GetCurrentContext would.
+func (w *LogWriter) commitCurrent(ctx context.Context, mc *MassifContext) error {
+
+	wr, err := w.Committer.CommitContext(ctx, *mc)
+	if err != nil {
+		return err
+	}
+	mc.Creating = false
+	mc.ETag = wr.ETag
+	mc.LastModified = wr.LastModified
+	mc.LastRead = time.Now()
+
+	if mc.RangeCount() > mc.LastLeafMMRIndex() {
+		if _, err = mc.spillMassif(); err != nil {
+			return err
+		}
+	}
+	w.mc = mc
+	return nil
+}
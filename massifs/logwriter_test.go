@@ -0,0 +1,88 @@
+package massifs
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLogWriter_AddLeaves checks the writer produces the same log as adding
+// the leaves one at a time with the committer directly.
+func TestLogWriter_AddLeaves(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+	leaves := testLeafEntries(0, 23)
+
+	want := NewMemObjectStore()
+	committer := NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, want)
+	for _, leaf := range leaves {
+		mc, err := committer.GetCurrentContext(ctx, tenant, massifHeight)
+		require.NoError(t, err)
+		_, err = mc.AddHashedLeaf(sha256.New(), leaf.IDTimestamp, leaf.ExtraBytes, leaf.LogID, leaf.AppID, leaf.Value)
+		require.NoError(t, err)
+		_, err = committer.CommitContext(ctx, mc)
+		require.NoError(t, err)
+	}
+
+	got := NewMemObjectStore()
+	w := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, got), tenant, massifHeight)
+
+	var mmrIndices []uint64
+	start := 0
+	for _, n := range []int{1, 0, 3, 10, 2, 7} {
+		indices, err := w.AddLeaves(ctx, leaves[start:start+n])
+		require.NoError(t, err)
+		mmrIndices = append(mmrIndices, indices...)
+		start += n
+	}
+	require.Equal(t, len(leaves), start)
+
+	require.Len(t, mmrIndices, len(leaves))
+	for i, mmrIndex := range mmrIndices {
+		assert.Equal(t, mmr.MMRIndex(uint64(i)), mmrIndex)
+	}
+
+	wantList, err := want.List(ctx, WithListTags())
+	require.NoError(t, err)
+	gotList, err := got.List(ctx, WithListTags())
+	require.NoError(t, err)
+	require.Equal(t, len(wantList.Items), len(gotList.Items))
+	for i := range wantList.Items {
+		assert.Equal(t, wantList.Items[i].Path, gotList.Items[i].Path)
+		assert.Equal(t, wantList.Items[i].Tags, gotList.Items[i].Tags)
+		_, wantData := readObject(t, want, wantList.Items[i].Path)
+		_, gotData := readObject(t, got, gotList.Items[i].Path)
+		assert.Equal(t, wantData, gotData, wantList.Items[i].Path)
+	}
+}
+
+// TestLogWriter_Conflict checks a writer whose view of the log is stale fails
+// the commit, and recovers by re-reading the log.
+func TestLogWriter_Conflict(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	store := NewMemObjectStore()
+	leaves := testLeafEntries(0, 4)
+
+	w1 := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{}, nil, store), tenant, 3)
+	w2 := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{}, nil, store), tenant, 3)
+
+	_, err := w1.AddLeaves(ctx, leaves[:1])
+	require.NoError(t, err)
+	_, err = w2.AddLeaves(ctx, leaves[1:2])
+	require.NoError(t, err)
+
+	// w1 still has the context from before w2 committed
+	indices, err := w1.AddLeaves(ctx, leaves[2:3])
+	assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+	assert.Empty(t, indices)
+
+	mmrIndex, err := w1.AddHashedLeaf(
+		ctx, leaves[2].IDTimestamp, leaves[2].ExtraBytes, leaves[2].LogID, leaves[2].AppID, leaves[2].Value)
+	require.NoError(t, err)
+	assert.Equal(t, mmr.MMRIndex(2), mmrIndex)
+}
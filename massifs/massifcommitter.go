@@ -6,21 +6,30 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/logger"
 )
 
 type MassifCommitter struct {
 	Cfg   MassifCommitterConfig
 	Log   logger.Logger
-	Store massifStore
+	Store ObjectStore
 }
 
 type MassifCommitterConfig struct {
+	// CommitmentEpoch is the epoch of the id timestamps of the leaves added to
+	// the log, see snowflakeid.Config. It can be increased for an existing
+	// log when the id generator moves to a new epoch, but never decreased.
 	CommitmentEpoch uint32
+	// HashAlg is the hash algorithm for a new log. It is ignored for existing
+	// logs, which always use the algorithm recorded in their massifs.
+	HashAlg HashAlg
+	// LogConfig, if set, provides the massif height and blob paths for logs
+	// with more than one instance. It takes precedence over the massif height
+	// provided to GetCurrentContext. See LogConfig
+	LogConfig *LogConfig
 }
 
-func NewMassifCommitter(cfg MassifCommitterConfig, log logger.Logger, store massifStore) *MassifCommitter {
+func NewMassifCommitter(cfg MassifCommitterConfig, log logger.Logger, store ObjectStore) *MassifCommitter {
 	c := &MassifCommitter{
 		Cfg:   cfg,
 		Log:   log,
@@ -29,7 +38,7 @@ func NewMassifCommitter(cfg MassifCommitterConfig, log logger.Logger, store mass
 	return c
 }
 
-func (c *MassifCommitter) CommitContext(ctx context.Context, mc MassifContext) (*azblob.WriteResponse, error) {
+func (c *MassifCommitter) CommitContext(ctx context.Context, mc MassifContext) (*ObjectWriteResponse, error) {
 
 	var err error
 
@@ -39,10 +48,10 @@ func (c *MassifCommitter) CommitContext(ctx context.Context, mc MassifContext) (
 	// ledger). So if we ever break the append only rule, it will be evident
 	// (and not good).
 
-	opts := []azblob.Option{azblob.WithTags(mc.Tags)}
+	opts := []ObjectOption{WithPutTags(mc.Tags)}
 	// CRITICAL: we _must_ use the etag to gaurd against racy updates. It will be absent only when crating the blob
 	if mc.ETag != "" {
-		opts = append(opts, azblob.WithEtagMatch(mc.ETag))
+		opts = append(opts, WithETagMatch(mc.ETag))
 	} else {
 		if mc.Creating == false {
 			return nil, errors.New("etag is required when updating any blob")
@@ -52,12 +61,16 @@ func (c *MassifCommitter) CommitContext(ctx context.Context, mc MassifContext) (
 	// blob. so we don't racily overwrite a new blob
 	if mc.Creating {
 		// The way to spell 'fail without modifying if the blob exists' is to require that no blob matches *any* etag.
-		opts = append(opts, azblob.WithEtagNoneMatch("*"))
+		opts = append(opts, WithETagNoneMatch(ETagAny))
 	}
 
-	wr, err := c.Store.Put(ctx, mc.BlobPath, azblob.NewBytesReaderCloser(mc.Data),
-		opts...,
-	)
+	// The trie header commits to the trie keys of all the leaves in the
+	// massif, it is written when the massif is completed
+	if err = mc.setCompleteTrieHeader(); err != nil {
+		return nil, err
+	}
+
+	wr, err := c.Store.Put(ctx, mc.BlobPath, mc.Data, opts...)
 	if err != nil {
 		return wr, err
 	}
@@ -74,7 +87,9 @@ func (c *MassifCommitter) createFirstMassifContext(
 
 	// XXX: TODO: we _could_ just roll an id so that we never need to deal with
 	// the zero case. for the first blob that is entirely benign.
+	massifHeight = c.Cfg.LogConfig.massifHeight(massifHeight, 0)
 	start := NewMassifStart(0, c.Cfg.CommitmentEpoch, massifHeight, 0, 0)
+	start.HashAlg = c.Cfg.HashAlg
 
 	// the zero values, or those explicitly set above are correct
 	data, err := start.MarshalBinary()
@@ -90,7 +105,8 @@ func (c *MassifCommitter) createFirstMassifContext(
 			Tags:     map[string]string{},
 		},
 		// epoch, massifIndex and firstIndex are zero and prev root is 32 bytes of zero
-		Start: start,
+		Start:     start,
+		logConfig: c.Cfg.LogConfig,
 	}
 	// We pre-allocate and zero-fill the index, see the commentary in StartNextMassif
 	mc.Data = append(data, mc.InitIndexData()...)
@@ -129,9 +145,9 @@ func (c *MassifCommitter) GetCurrentContext(
 	// If we are creating, we need to read the bytes from the previous blob to
 	// be able to make the first mmr entry from the root of the last massif.
 
-	var rr *azblob.ReaderResponse
+	var rr *ObjectReadResponse
 	rr, mc.Data, err = c.cachedBlobRead(
-		ctx, mc.BlobPath, azblob.WithEtagMatch(mc.ETag), azblob.WithGetTags())
+		ctx, mc.BlobPath, WithETagMatch(mc.ETag), WithGetTags())
 	if err != nil {
 		return mc, err
 	}
@@ -142,6 +158,10 @@ func (c *MassifCommitter) GetCurrentContext(
 	if err != nil {
 		return mc, err
 	}
+	if err = c.Cfg.LogConfig.fixupMassifStart(&mc.Start); err != nil {
+		return mc, err
+	}
+	mc.logConfig = c.Cfg.LogConfig
 
 	mc.Tags = rr.Tags
 
@@ -166,7 +186,7 @@ func (c *MassifCommitter) GetCurrentContext(
 
 	// The current first & last is initialized from what we read
 
-	mc.LastModified = *rr.LastModified
+	mc.LastModified = rr.LastModified
 	mc.LastRead = time.Now()
 
 	// If the blob has space for more nodes, the context is ready and we have
@@ -187,7 +207,7 @@ func (c *MassifCommitter) GetCurrentContext(
 	mc.LastModified = time.UnixMilli(0)
 	mc.LastRead = time.UnixMilli(0)
 
-	mc.BlobPath = TenantMassifBlobPath(tenantIdentity, massifCount)
+	mc.BlobPath = c.Cfg.LogConfig.massifBlobPath(tenantIdentity, mc.Start.MassifIndex+1)
 
 	// re-create Start for the new blob
 
@@ -196,7 +216,9 @@ func (c *MassifCommitter) GetCurrentContext(
 
 // GetLastMassif finds the most recently created massif blob for the tenant and
 // returns its id. A massif's id is just 1+ its zero based index in the tenants
-// list of mmr blobs. A return value of 0 means no blobs exist for the tenant
+// list of mmr blobs. A return value of 0 means no blobs exist for the tenant.
+// For logs with more than one instance, the id counts the massifs of all
+// instances.
 func (c *MassifCommitter) GetLastMassif(
 	ctx context.Context, tenantIdentity string) (MassifContext, uint64, error) {
 
@@ -204,10 +226,10 @@ func (c *MassifCommitter) GetLastMassif(
 		TenantIdentity: tenantIdentity,
 	}
 
-	blobPrefixPath := TenantMassifPrefix(tenantIdentity)
-
-	bc, massifCount, err := LastPrefixedBlob(
-		ctx, c.Store, blobPrefixPath)
+	bc, massifCount, err := lastInstanceBlob(
+		ctx, c.Store, c.Cfg.LogConfig, func(instance uint32) string {
+			return TenantMassifInstancePrefix(tenantIdentity, instance)
+		})
 	if err != nil {
 		return mc, massifCount, err
 	}
@@ -219,10 +241,10 @@ func (c *MassifCommitter) GetLastMassif(
 }
 
 // cachedBlobRead reads the blob with potential caching and returns the
-// underlying azblob response as the most consistent way to propagate the blob
+// underlying store response as the most consistent way to propagate the blob
 // metadata to the caller. Note that on return, regardless of error the reader
 // is nil as it has been completely exhausted or otherwise disposed of.
 func (c *MassifCommitter) cachedBlobRead(
-	ctx context.Context, blobPath string, opts ...azblob.Option) (*azblob.ReaderResponse, []byte, error) {
+	ctx context.Context, blobPath string, opts ...ObjectOption) (*ObjectReadResponse, []byte, error) {
 	return BlobRead(ctx, blobPath, c.Store, opts...)
 }
@@ -24,7 +24,7 @@ func TestMassifCommitter_firstMassif(t *testing.T) {
 	c := &MassifCommitter{
 		Log: tc.GetLog(),
 		// cfg:         tt.fields.cfg,
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 
@@ -52,7 +52,7 @@ func TestMassifCommitter_massifFirstContext(t *testing.T) {
 	c := &MassifCommitter{
 		Log: tc.GetLog(),
 		// cfg:         tt.fields.cfg,
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 	var mc MassifContext
@@ -74,7 +74,7 @@ func TestMassifCommitter_massifAddFirst(t *testing.T) {
 
 	c := &MassifCommitter{
 		Log:   tc.GetLog(),
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 
@@ -108,7 +108,7 @@ func TestMassifCommitter_massifExtend(t *testing.T) {
 	MassifHeight := uint8(3)
 	c := &MassifCommitter{
 		Log:   tc.GetLog(),
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 
@@ -150,7 +150,7 @@ func TestMassifCommitter_massifComplete(t *testing.T) {
 	MassifHeight := uint8(3)
 	c := &MassifCommitter{
 		Log:   tc.GetLog(),
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 
@@ -196,7 +196,7 @@ func TestMassifCommitter_massifoverfilsafe(t *testing.T) {
 	MassifHeight := uint8(3)
 	c := &MassifCommitter{
 		Log:   tc.GetLog(),
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead:    mustNewLastReadCache(t, 1024),
 	}
 
@@ -243,7 +243,7 @@ func TestMassifCommitter_threemassifs(t *testing.T) {
 	MassifHeight := uint8(3)
 	c := &MassifCommitter{
 		Log:   tc.GetLog(),
-		Store: tc.GetStorer(),
+		Store: NewAzBlobObjectStore(tc.GetStorer()),
 		// lastRead: mustNewLastReadCache(t, 1024),
 	}
 
@@ -1,7 +1,6 @@
 package massifs
 
 import (
-	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -24,6 +23,7 @@ var (
 	ErrMissingPrevBlobLastID    = errors.New("expected snowflake id carry from previous blob not available")
 	ErrIndexNotInMassif         = errors.New("mmr index not in the massif")
 	ErrStateRootMissing         = errors.New("the root field of a state struct was nil when it should have been provided")
+	ErrCommitmentEpochRegressed = errors.New("the commitment epoch is before the epoch of the massif")
 )
 
 // MassifContext enables appending to the log
@@ -94,6 +94,10 @@ type MassifContext struct {
 	nextAncestor int
 
 	peakStackMap map[uint64]int
+
+	// logConfig, when set, provides the path and height of the next massif for
+	// logs with more than one instance. See LogConfig
+	logConfig *LogConfig
 }
 
 func (mc *MassifContext) CopyPeakStack() map[uint64]int {
@@ -129,14 +133,21 @@ func (mc *MassifContext) StartNextMassif() error {
 		return err
 	}
 
+	// The next massif may be the first of a new log instance with a different
+	// height. The first index, and the peak stack, are not affected because
+	// instances always start on a massif boundary for both heights.
+	nextHeight := mc.logConfig.massifHeight(mc.Start.MassifHeight, mc.Start.MassifIndex+1)
+
 	nextStart := NewMassifStart(
 		// last id from *previous* blob is the initial value for this new blob.
 		mc.Start.LastID,
-		mc.Start.CommitmentEpoch, mc.Start.MassifHeight,
+		mc.Start.CommitmentEpoch, nextHeight,
 		// Note: at this point mc.Start and mc.Data refer to the *previous*
 		// massif blob, so we can use it to compute the first index of the new
 		// blob we are about to create.
 		mc.Start.MassifIndex+1, mc.RangeCount())
+	// The hash algorithm is a property of the log, not the massif
+	nextStart.HashAlg = mc.Start.HashAlg
 	SetFirstIndex(nextStart.FirstIndex, mc.Tags)
 	nextData, err := nextStart.MarshalBinary()
 	if err != nil {
@@ -153,7 +164,7 @@ func (mc *MassifContext) StartNextMassif() error {
 	// greater than 256k, it will get placed in higher throughput storage from
 	// the start.  See
 	// https://learn.microsoft.com/en-us/azure/storage/blobs/storage-performance-checklist#partitioning
-	nextData = append(nextData, mc.InitIndexData()...)
+	nextData = append(nextData, MassifContext{Start: nextStart}.InitIndexData()...)
 
 	// PeakStackLen is _not_ marshaled into the header, we can always compute it when needed
 	nextStart.PeakStackLen = uint64(len(nextPeakStack) / ValueBytes)
@@ -193,12 +204,17 @@ func (mc MassifContext) NextPeakStack() ([]byte, error) {
 		}
 	}
 
-	pop := mmr.SpurHeightLeaf(uint64(mc.Start.MassifIndex))
+	// The number of ancestors to pop depends on the position of the massif in
+	// the MMR, counted in massifs of its own height. For logs with a single
+	// instance this is just the massif index.
+	pop := mmr.SpurHeightLeaf(mmr.LeafCount(mc.Start.FirstIndex) >> (mc.Start.MassifHeight - 1))
 
 	// do the stack pop, the append happens naturally when the last leaf is added
 	// due to our always collecting it from the end of the log (via GetPeakStack
-	// above)
-	peakStack = peakStack[:(stackLen-pop)*ValueBytes]
+	// above). The capacity is clipped so that the push below can not write
+	// into the log data which follows the stack in mc.Data
+	n := (stackLen - pop) * ValueBytes
+	peakStack = peakStack[:n:n]
 
 	// Now we have popped the ancestors we are done with, we can push the last
 	// value from the previous massif.
@@ -387,7 +403,7 @@ func (mc *MassifContext) AddHashedLeaf(
 		return 0, ErrLogValueBadSize
 	}
 
-	trieKey := NewTrieKey(KeyTypeApplicationContent, logId, appId)
+	trieKey := NewTrieKeyWithHasher(mc.Hasher(), KeyTypeApplicationContent, logId, appId)
 	if len(trieKey) != TrieKeyBytes {
 		return 0, ErrIndexEntryBadSize
 	}
@@ -459,7 +475,7 @@ func (mc *MassifContext) CheckConsistency(
 	}
 
 	ok, peaksB, err := mmr.CheckConsistency(
-		mc, sha256.New(), baseState.MMRSize, mmrSizeCurrent, baseState.Peaks)
+		mc, mc.Hasher(), baseState.MMRSize, mmrSizeCurrent, baseState.Peaks)
 	if err != nil {
 		return nil,
 			fmt.Errorf("%w: proof verification error: err=%s, tenant=%s, massif=%d",
@@ -484,6 +500,28 @@ func (mc *MassifContext) setLastIdTimestamp(idTimestamp uint64) {
 	binary.BigEndian.PutUint64(mc.Data[MassifStartKeyLastIDFirstByte:MassifStartKeyLastIDEnd], idTimestamp)
 }
 
+// advanceCommitmentEpoch sets the commitment epoch of the massif for the
+// leaves about to be added. The massif header records the epoch of its last
+// id timestamp, so this must only be called immediately before adding leaves
+// whose id timestamps are in the provided epoch. When a log crosses into a new
+// epoch, the massif at the transition holds id timestamps from both epochs.
+// The id timestamps of the earlier epoch are before the first id timestamp
+// that is numerically smaller than its predecessor.
+func (mc *MassifContext) advanceCommitmentEpoch(epoch uint32) error {
+	if epoch < mc.Start.CommitmentEpoch {
+		return fmt.Errorf(
+			"%w: epoch %d, massif %d has epoch %d",
+			ErrCommitmentEpochRegressed, epoch, mc.Start.MassifIndex, mc.Start.CommitmentEpoch)
+	}
+	if epoch == mc.Start.CommitmentEpoch {
+		return nil
+	}
+	mc.Start.CommitmentEpoch = epoch
+	// Note: write through to the data, as for setLastIdTimestamp
+	binary.BigEndian.PutUint32(mc.Data[MassifStartKeyEpochFirstByte:MassifStartKeyEpochEnd], epoch)
+	return nil
+}
+
 func (mc *MassifContext) setLastIDTimestampTag(id uint64) {
 	mc.Tags[TagKeyLastID] = IDTimestampToHex(id, uint8(mc.Start.CommitmentEpoch))
 }
@@ -569,6 +607,11 @@ func (mc MassifContext) MassifLeafCount() uint64 {
 	return count - mmr.LeafCount(mc.Start.FirstIndex)
 }
 
+// Hasher returns a new hasher for the hash algorithm of the log
+func (mc MassifContext) Hasher() hash.Hash {
+	return mc.Start.HashAlg.New()
+}
+
 // TODO: deprecate/remove the use of these methods
 func (mc MassifContext) FixedHeaderEnd() uint64 {
 	return FixedHeaderEnd()
@@ -0,0 +1,120 @@
+package massifs
+
+import (
+	"hash"
+	"time"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+// LeafEntry provides the details of a single leaf for AddHashedLeaves. The
+// fields correspond to the arguments of AddHashedLeaf.
+type LeafEntry struct {
+	IDTimestamp uint64
+	ExtraBytes  []byte
+	LogID       []byte
+	AppID       []byte
+	Value       []byte
+}
+
+// AddHashedLeaves adds a batch of leaves to the log and trie.
+//
+// The result is identical to calling AddHashedLeaf for each entry, but the
+// interior nodes are back filled in a single pass (see mmr.AddHashedLeaves)
+// and the header and lastid tag are updated once per massif.
+//
+// If the massif becomes full part way through the batch, the full massif is
+// returned in completed and the receiver is advanced to the next massif, just
+// as GetCurrentContext would for a full massif. The completed contexts must be
+// committed, in order, before the receiver is committed. If the receiver is
+// already full when called, it is the first completed context.
+//
+// Returns the mmr index of each leaf. On error, the receiver and any completed
+// contexts should be discarded entirely (not written back to storage).
+func (mc *MassifContext) AddHashedLeaves(
+	hasher hash.Hash, leaves []LeafEntry,
+) ([]uint64, []MassifContext, error) {
+
+	trieKeys := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		if len(leaf.Value) != ValueBytes {
+			return nil, nil, ErrLogValueBadSize
+		}
+		trieKeys[i] = NewTrieKeyWithHasher(mc.Hasher(), KeyTypeApplicationContent, leaf.LogID, leaf.AppID)
+		if len(trieKeys[i]) != TrieKeyBytes {
+			return nil, nil, ErrIndexEntryBadSize
+		}
+	}
+
+	var completed []MassifContext
+	mmrIndices := make([]uint64, 0, len(leaves))
+
+	for len(leaves) > 0 {
+
+		iLast := mc.LastLeafMMRIndex()
+		if mc.RangeCount() > iLast {
+			full, err := mc.spillMassif()
+			if err != nil {
+				return nil, nil, err
+			}
+			completed = append(completed, full)
+			continue
+		}
+
+		// The number of leaves which fit in the current massif
+		capacity := mmr.LeafIndex(iLast) + 1 - mmr.LeafCount(mc.RangeCount())
+		n := min(capacity, uint64(len(leaves)))
+
+		// If the batch includes the last leaf, initialize the index into the
+		// peak stack. Only the interior nodes added for the last leaf reference
+		// the ancestor peaks, see AddHashedLeaf.
+		if n == capacity {
+			mc.nextAncestor = int(mc.Start.PeakStackLen) - 1
+		}
+
+		nextLeafIndex := mc.MassifLeafCount()
+		values := make([][]byte, n)
+		for i := range n {
+			leaf := leaves[i]
+			SetTrieEntry(mc.Data, mc.IndexStart(), nextLeafIndex+i, leaf.IDTimestamp, leaf.ExtraBytes, trieKeys[i])
+			values[i] = leaf.Value
+		}
+
+		indices, _, err := mmr.AddHashedLeaves(mc, hasher, values)
+		if err != nil {
+			return nil, nil, err
+		}
+		mmrIndices = append(mmrIndices, indices...)
+
+		lastID := leaves[n-1].IDTimestamp
+		mc.setLastIdTimestamp(lastID)
+		mc.setLastIDTimestampTag(lastID)
+
+		leaves = leaves[n:]
+		trieKeys = trieKeys[n:]
+	}
+
+	return mmrIndices, completed, nil
+}
+
+// spillMassif returns a copy of the current, full, massif and re-initializes
+// the receiver as the next massif.
+func (mc *MassifContext) spillMassif() (MassifContext, error) {
+
+	full := *mc
+	// StartNextMassif updates the tags for the new massif, so the full massif
+	// needs its own copy.
+	full.Tags = mc.CopyTags()
+
+	mc.Creating = true
+	mc.ETag = ""
+	mc.LastModified = time.UnixMilli(0)
+	mc.LastRead = time.UnixMilli(0)
+	mc.peakStackMap = nil
+	mc.BlobPath = mc.logConfig.massifBlobPath(mc.TenantIdentity, mc.Start.MassifIndex+1)
+
+	if err := mc.StartNextMassif(); err != nil {
+		return MassifContext{}, err
+	}
+	return full, nil
+}
@@ -0,0 +1,105 @@
+package massifs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLeafEntries(base, count uint64) []LeafEntry {
+	leaves := make([]LeafEntry, count)
+	for i := range count {
+		value := sha256.Sum256(binary.BigEndian.AppendUint64(nil, base+i))
+		leaves[i] = LeafEntry{
+			IDTimestamp: (base + i + 1) << 24,
+			ExtraBytes:  []byte{byte(i)},
+			LogID:       []byte("log"),
+			AppID:       []byte(fmt.Sprintf("app-%d", base+i)),
+			Value:       value[:],
+		}
+	}
+	return leaves
+}
+
+// TestMassifContext_AddHashedLeaves checks that adding leaves in batches
+// produces exactly the same massif blobs and tags as adding them one at a
+// time, including when a batch spills over into new massifs.
+func TestMassifContext_AddHashedLeaves(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+	leafCount := uint64(21)
+	leaves := testLeafEntries(0, leafCount)
+
+	// The reference log is built one leaf at a time
+	want := NewMemObjectStore()
+	committer := NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, want)
+	for i, leaf := range leaves {
+		mc, err := committer.GetCurrentContext(ctx, tenant, massifHeight)
+		require.NoError(t, err)
+		size, err := mc.AddHashedLeaf(sha256.New(), leaf.IDTimestamp, leaf.ExtraBytes, leaf.LogID, leaf.AppID, leaf.Value)
+		require.NoError(t, err)
+		require.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(uint64(i))), size)
+		_, err = committer.CommitContext(ctx, mc)
+		require.NoError(t, err)
+	}
+
+	for _, batchSize := range []uint64{1, 3, 4, 5, 9, leafCount} {
+		t.Run(fmt.Sprintf("batch %d", batchSize), func(t *testing.T) {
+			got := NewMemObjectStore()
+			committer := NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, got)
+
+			var mmrIndices []uint64
+			for start := uint64(0); start < leafCount; start += batchSize {
+				mc, err := committer.GetCurrentContext(ctx, tenant, massifHeight)
+				require.NoError(t, err)
+
+				indices, completed, err := mc.AddHashedLeaves(sha256.New(), leaves[start:min(start+batchSize, leafCount)])
+				require.NoError(t, err)
+				mmrIndices = append(mmrIndices, indices...)
+
+				for _, full := range completed {
+					_, err = committer.CommitContext(ctx, full)
+					require.NoError(t, err)
+				}
+				_, err = committer.CommitContext(ctx, mc)
+				require.NoError(t, err)
+			}
+
+			for i, mmrIndex := range mmrIndices {
+				assert.Equal(t, mmr.MMRIndex(uint64(i)), mmrIndex)
+			}
+
+			wantList, err := want.List(ctx, WithListTags())
+			require.NoError(t, err)
+			gotList, err := got.List(ctx, WithListTags())
+			require.NoError(t, err)
+			require.Equal(t, len(wantList.Items), len(gotList.Items))
+			for i := range wantList.Items {
+				assert.Equal(t, wantList.Items[i].Path, gotList.Items[i].Path)
+				assert.Equal(t, wantList.Items[i].Tags, gotList.Items[i].Tags)
+
+				_, wantData := readObject(t, want, wantList.Items[i].Path)
+				_, gotData := readObject(t, got, gotList.Items[i].Path)
+				assert.Equal(t, wantData, gotData, wantList.Items[i].Path)
+			}
+		})
+	}
+}
+
+func TestMassifContext_AddHashedLeaves_BadValue(t *testing.T) {
+	committer := NewMassifCommitter(MassifCommitterConfig{}, nil, NewMemObjectStore())
+	mc, err := committer.GetCurrentContext(t.Context(), "tenant/1", 3)
+	require.NoError(t, err)
+
+	leaves := testLeafEntries(0, 2)
+	leaves[1].Value = leaves[1].Value[:16]
+	_, _, err = mc.AddHashedLeaves(sha256.New(), leaves)
+	assert.ErrorIs(t, err, ErrLogValueBadSize)
+	assert.Equal(t, uint64(0), mc.RangeCount())
+}
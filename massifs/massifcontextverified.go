@@ -1,9 +1,9 @@
 package massifs
 
 import (
+	"bytes"
 	"context"
 	"crypto"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 
@@ -30,6 +30,7 @@ var (
 	ErrRemoteSealKeyMatchFailed   = errors.New("the provided public key did not match the remote sealing key")
 	ErrTenantIdUnknown            = errors.New("the method requires that the tenant ientity is known on the context")
 	ErrTenantIdInconsistent       = errors.New("the tenant identity on the context does not match the tenant identity provided")
+	ErrSealIDTimestampMismatch    = errors.New("the seal id timestamp or commitment epoch is inconsistent with the massif")
 )
 
 // VerifiedContext describes a verified massif context
@@ -59,6 +60,12 @@ type VerifiedContext struct {
 	// verification purposes, this will be the single bagged root of the mmr up to the
 	// end of the data.  Otherwise, it will be the accumulator peaks.
 	ConsistentRoots [][]byte
+
+	// ConsistencyProof is the proof stored with the seal, from the state of
+	// the seal which preceded it to MMRState. It is nil if the seal getter
+	// does not support ConsistencyProofGetter, or the sealer did not store a
+	// proof.
+	ConsistencyProof *mmr.ConsistencyProof
 }
 
 // checkedVerifiedContextOptions checks the options provided satisfy the common requirements of the reader methods
@@ -159,7 +166,13 @@ func (mc *MassifContext) verifyContext(
 
 	// This checks that any un-committed data is consistent with the latest seal available for the massif
 
-	msg, state, err := options.sealGetter.GetSignedRoot(ctx, mc.TenantIdentity, mc.Start.MassifIndex)
+	// The log config, if any, is forwarded so the seal of a massif in a later
+	// log instance can be located.
+	var sealOpts []ReaderOption
+	if options.logConfig != nil {
+		sealOpts = append(sealOpts, WithLogConfig(*options.logConfig))
+	}
+	msg, state, err := options.sealGetter.GetSignedRoot(ctx, mc.TenantIdentity, mc.Start.MassifIndex, sealOpts...)
 	if err != nil {
 		if IsBlobNotFound(err) {
 			return nil, fmt.Errorf(
@@ -172,13 +185,27 @@ func (mc *MassifContext) verifyContext(
 	if state.MMRSize > mc.RangeCount() {
 		return nil, fmt.Errorf("%w: MMR size %d < %d", ErrStateSizeExceedsData, mc.RangeCount(), state.MMRSize)
 	}
+	if err = mc.checkSealIDTimestamp(state, options); err != nil {
+		return nil, err
+	}
+
+	cp, err := mc.getSealConsistencyProof(ctx, state, options, sealOpts...)
+	if err != nil {
+		return nil, err
+	}
 
 	switch state.Version {
 	case int(MMRStateVersion1):
 		fallthrough
 	case int(MMRStateVersion2):
-		return mc.verifyContextV1V2(msg, state, options)
+		return mc.verifyContextV1V2(msg, state, cp, options)
 	case int(MMRStateVersion0):
+		// Version 0 seals don't attest to the peaks, which witnesses
+		// countersign.
+		if options.requiredWitnesses > 0 {
+			return nil, fmt.Errorf("%w: version 0 seal for massif %d for tenant %s",
+				ErrWitnessQuorum, mc.Start.MassifIndex, mc.TenantIdentity)
+		}
 		return mc.verifyContextV0(msg, state, options)
 	}
 	return nil, fmt.Errorf("unsupported MMR state version %d", state.Version)
@@ -186,7 +213,7 @@ func (mc *MassifContext) verifyContext(
 }
 
 func (mc *MassifContext) verifyContextV1V2(
-	msg *cose.CoseSign1Message, state MMRState, options ReaderOptions,
+	msg *cose.CoseSign1Message, state MMRState, cp *mmr.ConsistencyProof, options ReaderOptions,
 ) (*VerifiedContext, error) {
 	var ok bool
 	var err error
@@ -198,6 +225,13 @@ func (mc *MassifContext) verifyContextV1V2(
 		return nil, fmt.Errorf("unsupported MMR state version %d", state.Version)
 	}
 
+	// The seal attests to the hash algorithm, the massif header does not.
+	if state.HashAlg != mc.Start.HashAlg {
+		return nil, fmt.Errorf(
+			"%w: seal %v, massif %v, massif %d for tenant %s", ErrHashAlgMismatch,
+			state.HashAlg, mc.Start.HashAlg, mc.Start.MassifIndex, mc.TenantIdentity)
+	}
+
 	// get the peaks from the local store, we are checking the store against the
 	// latest additions. as we verify the signature below, any changes to the
 	// store will be caught.
@@ -206,7 +240,7 @@ func (mc *MassifContext) verifyContextV1V2(
 		return nil, err
 	}
 
-	pubKeyProvider, err := mc.sealPublicKeyProvider(msg, options)
+	pubKeyProvider, err := mc.sealPublicKeyProvider(msg, state, options)
 	if err != nil {
 		return nil, err
 	}
@@ -224,9 +258,32 @@ func (mc *MassifContext) verifyContextV1V2(
 			ErrSealVerifyFailed, mc.Start.MassifIndex, mc.TenantIdentity, err)
 	}
 
+	// The witnesses countersign the state including the peaks, so their
+	// cosignatures are checked against the peaks read from the log.
+	if options.requiredWitnesses > 0 {
+		err = VerifyWitnessCosignatures(
+			*options.codec, msg, mc.TenantIdentity, state, options.requiredWitnesses, options.witnessKeys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: massif %d", err, mc.Start.MassifIndex)
+		}
+	}
+
+	// The trie root is covered by the seal signature, so it only remains to
+	// check it against the trie keys read from the store.
+	if len(state.TrieRoot) != 0 {
+		trieRoot, err := mc.TrieRoot(state.MMRSize)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(trieRoot, state.TrieRoot) {
+			return nil, fmt.Errorf(
+				"%w: massif %d for tenant %s", ErrTrieRootMismatch, mc.Start.MassifIndex, mc.TenantIdentity)
+		}
+	}
+
 	// This verifies the peaks read from mmrSizeA are consistent with mmrSizeB.
 	ok, peaksB, err = mmr.CheckConsistency(
-		mc, sha256.New(), state.MMRSize, mc.RangeCount(), state.Peaks)
+		mc, mc.Hasher(), state.MMRSize, mc.RangeCount(), state.Peaks)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"%w: error verifying accumulator state from massif %d for tenant %s",
@@ -249,50 +306,162 @@ func (mc *MassifContext) verifyContextV1V2(
 			return nil, fmt.Errorf("unsupported MMR state version 0 (you should promote to v1 on demand using mmr.PeakHashes)")
 		}
 
-		ok, _, err = mmr.CheckConsistency(
-			mc, sha256.New(),
-			options.trustedBaseState.MMRSize,
-			mc.RangeCount(),
-			options.trustedBaseState.Peaks)
-		if err != nil {
-			return nil, err
-		}
-		if !ok {
-			return nil, fmt.Errorf(
-				"%w: the accumulator produced for the trusted base state doesn't match the root produced for the seal state fetched from the log",
-				mmr.ErrConsistencyCheck)
+		// If the seal was made directly after the trusted state, the proof
+		// stored with the seal shows they are consistent. The trusted state
+		// may be for an earlier massif, and the proof avoids the need for its
+		// data. The state is consistent with the massif data, checked above.
+		if cp != nil && cp.MMRSizeA == options.trustedBaseState.MMRSize {
+			if err = VerifyStateConsistency(*cp, *options.trustedBaseState, state); err != nil {
+				return nil, err
+			}
+		} else {
+			ok, _, err = mmr.CheckConsistency(
+				mc, mc.Hasher(),
+				options.trustedBaseState.MMRSize,
+				mc.RangeCount(),
+				options.trustedBaseState.Peaks)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf(
+					"%w: the accumulator produced for the trusted base state doesn't match the root produced for the seal state fetched from the log",
+					mmr.ErrConsistencyCheck)
+			}
 		}
 	}
 
 	return &VerifiedContext{
-		MassifContext:   *mc,
-		Sign1Message:    *msg,
-		MMRState:        state,
-		ConsistentRoots: peaksB,
+		MassifContext:    *mc,
+		Sign1Message:     *msg,
+		MMRState:         state,
+		ConsistentRoots:  peaksB,
+		ConsistencyProof: cp,
 	}, nil
 }
 
+// getSealConsistencyProof returns the consistency proof stored with the seal
+// for the massif, if the seal getter supports reading it. Nil is returned if
+// there is no proof, or if the proof is not for the state of the seal. The
+// seal is written before its proof, so a proof for an earlier state of the
+// seal can be found if the sealer was interrupted.
+func (mc *MassifContext) getSealConsistencyProof(
+	ctx context.Context, state MMRState, options ReaderOptions, opts ...ReaderOption,
+) (*mmr.ConsistencyProof, error) {
+
+	getter, ok := options.sealGetter.(ConsistencyProofGetter)
+	if !ok {
+		return nil, nil
+	}
+	cp, err := getter.GetConsistencyProof(ctx, mc.TenantIdentity, mc.Start.MassifIndex, opts...)
+	if IsBlobNotFound(err) || errors.Is(err, ErrLogFileConsistencyProofNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cp.MMRSizeB != state.MMRSize {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+// checkSealIDTimestamp checks the id timestamp and commitment epoch of the
+// seal state are consistent with the massif, and are not before those of the
+// trusted base state. Logs may cross into a new commitment epoch, after which
+// the id timestamps restart from zero, so the epoch must be considered
+// whenever id timestamps are compared. Sealers which do not record the id
+// timestamp are tolerated, in which case there is nothing to check.
+func (mc *MassifContext) checkSealIDTimestamp(state MMRState, options ReaderOptions) error {
+	if state.IDTimestamp == 0 {
+		return nil
+	}
+	// The massif records the epoch of its last id timestamp, the epoch of the
+	// log never decreases.
+	if state.CommitmentEpoch > mc.Start.CommitmentEpoch {
+		return fmt.Errorf(
+			"%w: seal epoch %d, massif %d has epoch %d for tenant %s", ErrSealIDTimestampMismatch,
+			state.CommitmentEpoch, mc.Start.MassifIndex, mc.Start.CommitmentEpoch, mc.TenantIdentity)
+	}
+	// If the seal covers the whole massif, it must attest to its last leaf
+	if state.MMRSize == mc.RangeCount() &&
+		(state.IDTimestamp != mc.Start.LastID || state.CommitmentEpoch != mc.Start.CommitmentEpoch) {
+		return fmt.Errorf(
+			"%w: seal %s, massif %d has %s for tenant %s", ErrSealIDTimestampMismatch,
+			IDTimestampToHex(state.IDTimestamp, uint8(state.CommitmentEpoch)), mc.Start.MassifIndex,
+			IDTimestampToHex(mc.Start.LastID, uint8(mc.Start.CommitmentEpoch)), mc.TenantIdentity)
+	}
+	base := options.trustedBaseState
+	if base == nil || base.IDTimestamp == 0 || base.MMRSize > state.MMRSize {
+		return nil
+	}
+	if CompareIDTimestamps(
+		state.IDTimestamp, uint8(state.CommitmentEpoch), base.IDTimestamp, uint8(base.CommitmentEpoch)) < 0 {
+		return fmt.Errorf(
+			"%w: seal %s is before the trusted state %s for tenant %s", ErrSealIDTimestampMismatch,
+			IDTimestampToHex(state.IDTimestamp, uint8(state.CommitmentEpoch)),
+			IDTimestampToHex(base.IDTimestamp, uint8(base.CommitmentEpoch)), mc.TenantIdentity)
+	}
+	return nil
+}
+
 func (mc *MassifContext) sealPublicKeyProvider(
-	msg *cose.CoseSign1Message, options ReaderOptions,
-) (*cose.CWTPublicKeyProvider, error) {
+	msg *cose.CoseSign1Message, state MMRState, options ReaderOptions,
+) (publicKeyProvider, error) {
 
-	var err error
+	pubKeyProvider, err := sealPublicKeyProvider(msg, options.trustedSealerPubKey)
+	if err != nil || options.trustedKeyring == nil {
+		return pubKeyProvider, err
+	}
+
+	// The keyring is verified for a single tenant
+	if options.trustedKeyring.TenantIdentity != mc.TenantIdentity {
+		return nil, fmt.Errorf(
+			"%w: the keyring is for tenant %s, not %s", ErrRemoteSealKeyMatchFailed,
+			options.trustedKeyring.TenantIdentity, mc.TenantIdentity)
+	}
+
+	// The key must be the one valid for the size of the sealed state, so that
+	// seals made before a key rotation verify against the earlier key.
+	sealKey, err := options.trustedKeyring.KeyFor(state.MMRSize)
+	if err != nil {
+		return nil, err
+	}
+	remotePub, _, err := pubKeyProvider.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(sealKey.PublicKey, remotePub) {
+		return nil, fmt.Errorf(
+			"%w: key %s is valid for MMR(%d), massif %d for tenant %s", ErrRemoteSealKeyMatchFailed,
+			sealKey.Kid, state.MMRSize, mc.Start.MassifIndex, mc.TenantIdentity)
+	}
+	return pubKeyProvider, nil
+}
+
+// sealPublicKeyProvider returns the provider of the public key on the seal,
+// which must match the trusted key, if one is provided.
+func sealPublicKeyProvider(
+	msg *cose.CoseSign1Message, trustedSealerPubKey crypto.PublicKey,
+) (publicKeyProvider, error) {
 
 	// NOTICE: The verification uses the public key that is provided on the
 	// message.  If the caller wants to ensure the massif is signed by the
 	// expected key then they must obtain a copy of the public key from a source
 	// they trust and supply it as an option.
-	pubKeyProvider := cose.NewCWTPublicKeyProvider(msg)
-	if options.trustedSealerPubKey == nil {
+	pubKeyProvider, err := NewCNFPublicKeyProvider(msg)
+	if err != nil {
+		return nil, err
+	}
+	if trustedSealerPubKey == nil {
 		return pubKeyProvider, nil
 	}
 
-	var remotePub crypto.PublicKey
-	remotePub, _, err = pubKeyProvider.PublicKey()
+	remotePub, _, err := pubKeyProvider.PublicKey()
 	if err != nil {
 		return nil, err
 	}
-	if !options.trustedSealerPubKey.Equal(remotePub) {
+	if !publicKeysEqual(trustedSealerPubKey, remotePub) {
 		return nil, ErrRemoteSealKeyMatchFailed
 	}
 	return pubKeyProvider, nil
@@ -1,7 +1,6 @@
 package massifs
 
 import (
-	"crypto/sha256"
 	"fmt"
 
 	"github.com/datatrails/go-datatrails-common/cose"
@@ -26,12 +25,12 @@ func (mc *MassifContext) verifyContextV0(
 		return nil, fmt.Errorf("%w: MMR size %d < %d", ErrStateSizeExceedsData, mc.RangeCount(), state.MMRSize)
 	}
 
-	state.LegacySealRoot, err = mmr.GetRoot(state.MMRSize, mc, sha256.New())
+	state.LegacySealRoot, err = mmr.GetRoot(state.MMRSize, mc, mc.Hasher())
 	if err != nil {
 		return nil, err
 	}
 
-	pubKeyProvider, err := mc.sealPublicKeyProvider(msg, options)
+	pubKeyProvider, err := mc.sealPublicKeyProvider(msg, state, options)
 	if err != nil {
 		return nil, err
 	}
@@ -45,14 +44,14 @@ func (mc *MassifContext) verifyContextV0(
 			ErrSealVerifyFailed, mc.Start.MassifIndex, mc.TenantIdentity, err)
 	}
 	cp, err := mmr.IndexConsistencyProofBagged(
-		state.MMRSize, mc.RangeCount(), mc, sha256.New())
+		state.MMRSize, mc.RangeCount(), mc, mc.Hasher())
 	if err != nil {
 		return nil, fmt.Errorf(
 			"%w: error creating bagged consistency proof from %d for massif %d, for tenant %s",
 			err, state.MMRSize, mc.Start.MassifIndex, mc.TenantIdentity)
 	}
 
-	ok, rootB, err = mmr.CheckConsistencyBagged(mc, sha256.New(), cp, state.LegacySealRoot)
+	ok, rootB, err = mmr.CheckConsistencyBagged(mc, mc.Hasher(), cp, state.LegacySealRoot)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"%w: error verifying bagged consistency proof from %d for massif %d, for tenant %s",
@@ -71,14 +70,14 @@ func (mc *MassifContext) verifyContextV0(
 	if options.trustedBaseState != nil {
 
 		cp, err := mmr.IndexConsistencyProofBagged(
-			state.MMRSize, mc.RangeCount(), mc, sha256.New())
+			state.MMRSize, mc.RangeCount(), mc, mc.Hasher())
 		if err != nil {
 			return nil, fmt.Errorf(
 				"%w: error checking consistency with trusted base state from %d for tenant %s",
 				err, options.trustedBaseState.MMRSize, mc.TenantIdentity)
 		}
 
-		ok, _, err = mmr.CheckConsistencyBagged(mc, sha256.New(), cp, options.trustedBaseState.LegacySealRoot)
+		ok, _, err = mmr.CheckConsistencyBagged(mc, mc.Hasher(), cp, options.trustedBaseState.LegacySealRoot)
 		if err != nil {
 			return nil, err
 		}
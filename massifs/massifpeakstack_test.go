@@ -522,7 +522,7 @@ func TestPeakStack_Height4Massif2to3Size63(t *testing.T) {
 	require.Nil(t, err)
 
 	// this fails
-	massifReader := NewMassifReader(tc.Log, tc.GetStorer())
+	massifReader := NewMassifReader(tc.Log, NewAzBlobObjectReader(tc.GetStorer()))
 	mc3, err := massifReader.GetMassif(ctx, tenantIdentity, 3)
 	require.NoError(t, err)
 
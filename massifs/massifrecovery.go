@@ -0,0 +1,279 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+// Recovery of a massif from its trie entries.
+//
+// The trie entries retain, in the clear, the idtimestamp of every leaf (see
+// TrieEntryOffset). Given access to the application pre-images, typically
+// from a database backup, the leaves can be re-created in order and all the
+// interior nodes re-computed. Comparing the result with the stored massif
+// identifies every node which has been lost or corrupted.
+
+var (
+	ErrRecoveryPreImageGetterNotProvided = errors.New("a leaf pre-image getter is required for recovery")
+	ErrRecoveryLeafHasherNotProvided     = errors.New("a leaf hasher is required for recovery")
+	ErrRecoveryMassifHeader              = errors.New("the massif does not have the header data required for recovery")
+	ErrRecoveryPeakStackBadSize          = errors.New("the ancestor peak stack size does not match the massif")
+)
+
+// LeafPreImage is the application data a leaf was created from
+type LeafPreImage struct {
+	LogID []byte
+	AppID []byte
+	// Content is the data hashed by the LeafHasher to produce the leaf value
+	Content []byte
+}
+
+// LeafPreImageGetter returns the pre-image of the leaf added with idTimestamp
+type LeafPreImageGetter func(ctx context.Context, idTimestamp uint64) (LeafPreImage, error)
+
+// LeafHasher returns the leaf value for the pre-image. The hasher is for the
+// hash algorithm of the log, and has been reset.
+type LeafHasher func(hasher hash.Hash, idTimestamp uint64, preImage LeafPreImage) ([]byte, error)
+
+type RecoveryConfig struct {
+	GetPreImage LeafPreImageGetter
+	HashLeaf    LeafHasher
+
+	// AncestorPeakStack replaces the peak stack stored in the massif when it
+	// is set. When recovering a sequence of massifs, it should be the
+	// NextPeakStack of the recovered preceding massif.
+	AncestorPeakStack []byte
+
+	// MMRSize, if set, is the size of the log the massif is recovered to,
+	// typically the size of the state in its seal. The leaves of the massif
+	// within it are recovered even if the stored log data is truncated.
+	MMRSize uint64
+}
+
+// NodeDivergence describes a node whose stored value does not match the
+// recovered value.
+type NodeDivergence struct {
+	MMRIndex uint64
+	// Stored is nil if the node is missing from the stored massif
+	Stored []byte
+	// Recovered is nil if the stored massif has nodes which were not recovered
+	Recovered []byte
+}
+
+// TrieKeyDivergence describes a trie entry whose stored key does not match
+// the key re-created from the leaf pre-image.
+type TrieKeyDivergence struct {
+	MMRIndex uint64
+	Stored   []byte
+	// Recovered is nil if the stored trie entry has no idtimestamp, so the
+	// leaf pre-image could not be found.
+	Recovered []byte
+}
+
+// MassifRecovery is the result of recovering a massif
+type MassifRecovery struct {
+	// Recovered is the massif re-created from the trie entries and the leaf
+	// pre-images. It can be committed in place of the stored massif.
+	Recovered MassifContext
+
+	Nodes    []NodeDivergence
+	TrieKeys []TrieKeyDivergence
+	// PeakStackDiverged is true if the configured ancestor peak stack did not
+	// match the stored stack.
+	PeakStackDiverged bool
+}
+
+// Diverged returns true if the stored massif differs in any way from the
+// recovered massif.
+func (r *MassifRecovery) Diverged() bool {
+	return len(r.Nodes) != 0 || len(r.TrieKeys) != 0 || r.PeakStackDiverged
+}
+
+// RecoverMassif re-creates the stored massif from its trie entries.
+//
+// A leaf is recovered for each trie entry, in order, using the pre-image
+// returned for its idtimestamp. All interior nodes are re-computed from the
+// recovered leaves and the ancestor peak stack. Only the massif start header,
+// the trie entries and (if not configured) the ancestor peak stack are read
+// from the stored massif. So massifs whose log data is corrupt or truncated
+// can be recovered.
+//
+// The leaves recovered are those in the stored log data, those within the
+// configured MMRSize, and those up to the last trie entry with an
+// idtimestamp. A trie entry without an idtimestamp, amongst those leaves, is
+// reported as a TrieKeyDivergence. Its leaf is taken from the stored log data,
+// if it is present, and recovery carries on. Otherwise no later leaf can be
+// recovered.
+func RecoverMassif(
+	ctx context.Context, stored *MassifContext, cfg RecoveryConfig,
+) (*MassifRecovery, error) {
+
+	if cfg.GetPreImage == nil {
+		return nil, ErrRecoveryPreImageGetterNotProvided
+	}
+	if cfg.HashLeaf == nil {
+		return nil, ErrRecoveryLeafHasherNotProvided
+	}
+
+	var err error
+	result := &MassifRecovery{}
+
+	if uint64(len(stored.Data)) < stored.LogStart() {
+		return nil, fmt.Errorf(
+			"%w: massif %d has %d bytes", ErrRecoveryMassifHeader, stored.Start.MassifIndex, len(stored.Data))
+	}
+	storedStack := stored.Data[stored.PeakStackStart():stored.LogStart()]
+
+	peakStack := storedStack
+	if cfg.AncestorPeakStack != nil {
+		if len(cfg.AncestorPeakStack) != len(storedStack) {
+			return nil, fmt.Errorf(
+				"%w: %d bytes, massif %d requires %d",
+				ErrRecoveryPeakStackBadSize, len(cfg.AncestorPeakStack), stored.Start.MassifIndex, len(storedStack))
+		}
+		peakStack = cfg.AncestorPeakStack
+		result.PeakStackDiverged = !bytes.Equal(peakStack, storedStack)
+	}
+
+	// The recovered massif starts from the stored start header, and an empty
+	// trie. The last id is over written as each leaf is added.
+	rc := MassifContext{
+		TenantIdentity: stored.TenantIdentity,
+		LogBlobContext: LogBlobContext{
+			BlobPath: stored.BlobPath,
+			Tags:     map[string]string{},
+		},
+		Start: stored.Start,
+	}
+	if rc.Data, err = rc.Start.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	rc.Data = append(rc.Data, rc.InitIndexData()...)
+	rc.Data = append(rc.Data, peakStack...)
+	if err = rc.CreatePeakStackMap(); err != nil {
+		return nil, err
+	}
+	SetFirstIndex(rc.Start.FirstIndex, rc.Tags)
+
+	hasher := rc.Hasher()
+	indexStart := stored.IndexStart()
+	firstLeaf := mmr.LeafCount(stored.Start.FirstIndex)
+	storedEnd := stored.Start.FirstIndex + (uint64(len(stored.Data))-stored.LogStart())/LogEntryBytes
+	leafCount := recoveryLeafCount(stored, cfg.MMRSize, storedEnd)
+
+	for i := range leafCount {
+
+		idTimestamp := binary.BigEndian.Uint64(GetIdtimestamp(stored.Data, indexStart, i))
+		if idTimestamp == 0 {
+			leafIndex := mmr.MMRIndex(firstLeaf + i)
+			storedKey := GetTrieKey(stored.Data, indexStart, i)
+			result.TrieKeys = append(result.TrieKeys, TrieKeyDivergence{
+				MMRIndex: leafIndex,
+				Stored:   bytes.Clone(storedKey),
+			})
+			if leafIndex >= storedEnd {
+				break
+			}
+			err = rc.addStoredLeaf(hasher, stored, i, leafIndex)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		preImage, err := cfg.GetPreImage(ctx, idTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%w: pre-image for leaf %d, idtimestamp %d", err, firstLeaf+i, idTimestamp)
+		}
+		hasher.Reset()
+		value, err := cfg.HashLeaf(hasher, idTimestamp, preImage)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = rc.AddHashedLeaf(
+			hasher, idTimestamp, GetExtraBytes(stored.Data, indexStart, i), preImage.LogID, preImage.AppID, value)
+		if err != nil {
+			return nil, err
+		}
+
+		storedKey := GetTrieKey(stored.Data, indexStart, i)
+		recoveredKey := GetTrieKey(rc.Data, rc.IndexStart(), i)
+		if !bytes.Equal(storedKey, recoveredKey) {
+			result.TrieKeys = append(result.TrieKeys, TrieKeyDivergence{
+				MMRIndex:  mmr.MMRIndex(firstLeaf + i),
+				Stored:    bytes.Clone(storedKey),
+				Recovered: bytes.Clone(recoveredKey),
+			})
+		}
+	}
+	if err = rc.setCompleteTrieHeader(); err != nil {
+		return nil, err
+	}
+
+	// Compare every node in either massif
+	end := max(storedEnd, rc.RangeCount())
+	for i := stored.Start.FirstIndex; i < end; i++ {
+		var storedValue, recoveredValue []byte
+		if i < storedEnd {
+			storedValue = IndexedLogValue(stored.Data[stored.LogStart():], i-stored.Start.FirstIndex)
+		}
+		if i < rc.RangeCount() {
+			recoveredValue = IndexedLogValue(rc.Data[rc.LogStart():], i-rc.Start.FirstIndex)
+		}
+		if bytes.Equal(storedValue, recoveredValue) {
+			continue
+		}
+		result.Nodes = append(result.Nodes, NodeDivergence{
+			MMRIndex:  i,
+			Stored:    bytes.Clone(storedValue),
+			Recovered: bytes.Clone(recoveredValue),
+		})
+	}
+
+	result.Recovered = rc
+	return result, nil
+}
+
+// recoveryLeafCount returns the number of leaves of the massif to recover, see
+// RecoverMassif.
+func recoveryLeafCount(stored *MassifContext, mmrSize uint64, storedEnd uint64) uint64 {
+
+	capacity := uint64(1) << (stored.Start.MassifHeight - 1)
+	firstLeaf := mmr.LeafCount(stored.Start.FirstIndex)
+	end := max(mmrSize, storedEnd)
+
+	var leafCount uint64
+	for i := range capacity {
+		if mmr.MMRIndex(firstLeaf+i) < end {
+			leafCount = i + 1
+		}
+		if binary.BigEndian.Uint64(GetIdtimestamp(stored.Data, stored.IndexStart(), i)) != 0 {
+			leafCount = i + 1
+		}
+	}
+	return leafCount
+}
+
+// addStoredLeaf adds the stored leaf value, and trie entry, of a leaf which
+// can't be recovered from its pre-image. The last id of the massif is not
+// changed, as the trie entry has no idtimestamp.
+func (mc *MassifContext) addStoredLeaf(hasher hash.Hash, stored *MassifContext, i uint64, leafIndex uint64) error {
+
+	lastID := mc.Start.LastID
+	extraBytes := GetExtraBytes(stored.Data, stored.IndexStart(), i)
+	value := IndexedLogValue(stored.Data[stored.LogStart():], leafIndex-stored.Start.FirstIndex)
+	if _, err := mc.AddHashedLeaf(hasher, 0, extraBytes, nil, nil, bytes.Clone(value)); err != nil {
+		return err
+	}
+	SetTrieEntry(mc.Data, mc.IndexStart(), i, 0, extraBytes, GetTrieKey(stored.Data, stored.IndexStart(), i))
+	mc.setLastIdTimestamp(lastID)
+	mc.setLastIDTimestampTag(lastID)
+	return nil
+}
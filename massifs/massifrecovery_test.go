@@ -0,0 +1,127 @@
+package massifs
+
+import (
+	"context"
+	"encoding/binary"
+	"hash"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecoverMassif checks a log is recovered exactly from its trie entries,
+// and that lost and corrupted nodes are reported.
+func TestRecoverMassif(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	leaves := testLeafEntries(0, 10)
+	log := newTestLog(t, tenant, massifHeight, leaves)
+
+	// The pre-image of each test leaf is its number, the leaf value is its hash
+	preImages := map[uint64]LeafPreImage{}
+	for i, leaf := range leaves {
+		preImages[leaf.IDTimestamp] = LeafPreImage{
+			LogID: leaf.LogID, AppID: leaf.AppID, Content: binary.BigEndian.AppendUint64(nil, uint64(i)),
+		}
+	}
+	cfg := RecoveryConfig{
+		GetPreImage: func(ctx context.Context, idTimestamp uint64) (LeafPreImage, error) {
+			return preImages[idTimestamp], nil
+		},
+		HashLeaf: func(hasher hash.Hash, idTimestamp uint64, preImage LeafPreImage) ([]byte, error) {
+			hasher.Write(preImage.Content)
+			return hasher.Sum(nil), nil
+		},
+	}
+
+	reader := NewMassifReader(nil, log.store)
+	var massifs []MassifContext
+	for massifIndex := range uint64(3) {
+		mc, err := reader.GetMassif(ctx, tenant, massifIndex)
+		require.NoError(t, err)
+		massifs = append(massifs, mc)
+
+		recovery, err := RecoverMassif(ctx, &mc, cfg)
+		require.NoError(t, err)
+		assert.False(t, recovery.Diverged())
+		assert.Equal(t, mc.Data, recovery.Recovered.Data)
+
+		// Chain the recovered peak stack to the next massif
+		cfg.AncestorPeakStack = nil
+		if massifIndex < 2 {
+			cfg.AncestorPeakStack, err = recovery.Recovered.NextPeakStack()
+			require.NoError(t, err)
+		}
+	}
+
+	// Corrupt the stored value of a leaf, leaving its stored parent intact, and
+	// the trie key of another leaf
+	mc := massifs[1]
+	mc.Data = append([]byte(nil), mc.Data...)
+	leafIndex := mmr.MMRIndex(4)
+	copy(IndexedLogValue(mc.Data[mc.LogStart():], leafIndex-mc.Start.FirstIndex), make([]byte, ValueBytes))
+	copy(GetTrieKey(mc.Data, mc.IndexStart(), 2), make([]byte, TrieKeyBytes))
+
+	stack, err := massifs[0].NextPeakStack()
+	require.NoError(t, err)
+	recovery, err := RecoverMassif(ctx, &mc, RecoveryConfig{
+		GetPreImage: cfg.GetPreImage, HashLeaf: cfg.HashLeaf, AncestorPeakStack: stack,
+	})
+	require.NoError(t, err)
+	require.True(t, recovery.Diverged())
+	assert.Equal(t, massifs[1].Data, recovery.Recovered.Data)
+	require.Len(t, recovery.TrieKeys, 1)
+	assert.Equal(t, mmr.MMRIndex(6), recovery.TrieKeys[0].MMRIndex)
+	// Only the leaf diverges, the stored interior nodes match those recovered
+	require.Len(t, recovery.Nodes, 1)
+	assert.Equal(t, leafIndex, recovery.Nodes[0].MMRIndex)
+	assert.Equal(t, make([]byte, ValueBytes), recovery.Nodes[0].Stored)
+
+	// A truncated massif is recovered in full, the missing nodes are reported
+	mc = massifs[2]
+	mc.Data = mc.Data[:len(mc.Data)-2*LogEntryBytes]
+	recovery, err = RecoverMassif(ctx, &mc, RecoveryConfig{GetPreImage: cfg.GetPreImage, HashLeaf: cfg.HashLeaf})
+	require.NoError(t, err)
+	assert.Equal(t, massifs[2].Data, recovery.Recovered.Data)
+	require.Len(t, recovery.Nodes, 2)
+	for _, node := range recovery.Nodes {
+		assert.Nil(t, node.Stored)
+		assert.NotNil(t, node.Recovered)
+	}
+
+	// A zeroed idtimestamp is reported, and the stored leaf is carried over so
+	// the later leaves are still recovered
+	mc = massifs[1]
+	mc.Data = append([]byte(nil), mc.Data...)
+	copy(GetIdtimestamp(mc.Data, mc.IndexStart(), 1), make([]byte, 8))
+	recovery, err = RecoverMassif(ctx, &mc, RecoveryConfig{
+		GetPreImage: cfg.GetPreImage, HashLeaf: cfg.HashLeaf, AncestorPeakStack: stack,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mc.Data, recovery.Recovered.Data)
+	assert.Empty(t, recovery.Nodes)
+	require.Len(t, recovery.TrieKeys, 1)
+	assert.Equal(t, mmr.MMRIndex(5), recovery.TrieKeys[0].MMRIndex)
+	assert.Nil(t, recovery.TrieKeys[0].Recovered)
+
+	// Leaves within the sealed size are accounted for even if both the log
+	// data and the idtimestamp of the last are missing
+	mc = massifs[2]
+	mc.Data = append([]byte(nil), mc.Data[:len(mc.Data)-2*LogEntryBytes]...)
+	copy(GetIdtimestamp(mc.Data, mc.IndexStart(), 1), make([]byte, 8))
+	recovery, err = RecoverMassif(ctx, &mc, RecoveryConfig{
+		GetPreImage: cfg.GetPreImage, HashLeaf: cfg.HashLeaf, MMRSize: massifs[2].RangeCount(),
+	})
+	require.NoError(t, err)
+	require.Len(t, recovery.TrieKeys, 1)
+	assert.Equal(t, mmr.MMRIndex(9), recovery.TrieKeys[0].MMRIndex)
+	assert.Nil(t, recovery.TrieKeys[0].Recovered)
+	assert.Empty(t, recovery.Nodes)
+
+	_, err = RecoverMassif(ctx, &mc, RecoveryConfig{HashLeaf: cfg.HashLeaf})
+	assert.ErrorIs(t, err, ErrRecoveryPreImageGetterNotProvided)
+}
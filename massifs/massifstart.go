@@ -46,9 +46,9 @@ const (
 
 	// MassifStart layout
 	//
-	// .         | reserved | idtimestamp| reserved |  version | epoch  |massif height| massif i |
-	// .         | 0        | 8        15|          |  21 - 22 | 23   26|27         27| 28 -  31 |
-	// bytes     | 1        |     8      |          |      2   |    4   |      1      |     4    |
+	// .         | reserved | idtimestamp| reserved | hash alg |  version | epoch  |massif height| massif i |
+	// .         | 0        | 8        15|          |    20    |  21 - 22 | 23   26|27         27| 28 -  31 |
+	// bytes     | 1        |     8      |          |     1    |      2   |    4   |      1      |     4    |
 	//
 	// Note this layout produces a sequentially valued key. The value is always
 	// considered as a big endian large integer. Lexical ordering is defined
@@ -60,7 +60,10 @@ const (
 	MassifStartKeyLastIDFirstByte = 8
 	MassifStartKeyLastIDSize      = 8 // 64 bits
 	MassifStartKeyLastIDEnd       = MassifStartKeyLastIDFirstByte + MassifStartKeyLastIDSize
-	// gap 16 - 21
+	// gap 16 - 19
+	MassifStartKeyHashAlgFirstByte = 20
+	MassifStartKeyHashAlgSize      = 1 // 8 bit
+	MassifStartKeyHashAlgEnd       = MassifStartKeyHashAlgFirstByte + MassifStartKeyHashAlgSize
 	MassifStartKeyVersionFirstByte = 21
 	MassifStartKeyVersionSize      = 2 // 16 bit
 	MassifStartKeyVersionEnd       = MassifStartKeyVersionFirstByte + MassifStartKeyVersionSize
@@ -99,6 +102,7 @@ type MassifStart struct {
 	MassifHeight    uint8
 	DataEpoch       uint8
 	Version         uint16
+	HashAlg         HashAlg
 	CommitmentEpoch uint32
 	MassifIndex     uint32
 	FirstIndex      uint64
@@ -144,7 +148,12 @@ func MassifFirstLeaf(massifHeight uint8, massifIndex uint32) uint64 {
 }
 
 func (ms MassifStart) MarshalBinary() ([]byte, error) {
-	return EncodeMassifStart(ms.LastID, ms.Version, ms.CommitmentEpoch, ms.MassifHeight, ms.MassifIndex), nil
+	if err := checkHashAlg(ms.HashAlg); err != nil {
+		return nil, err
+	}
+	start := EncodeMassifStart(ms.LastID, ms.Version, ms.CommitmentEpoch, ms.MassifHeight, ms.MassifIndex)
+	start[MassifStartKeyHashAlgFirstByte] = byte(ms.HashAlg)
+	return start, nil
 }
 
 func (ms *MassifStart) UnmarshalBinary(b []byte) error {
@@ -152,7 +161,8 @@ func (ms *MassifStart) UnmarshalBinary(b []byte) error {
 }
 
 // EncodeMassifStart encodes the massif details in the prescribed massif header
-// record format
+// record format. The hash algorithm is left as zero (SHA-256), see
+// MassifStart.MarshalBinary
 //
 // .         | <reserved>|lastid |<reserved>|   version| epoch  |massif height| massif i |
 // .         |           | 8-16  |          |  21 - 22 | 23   26|27         27| 28 -  31 |
@@ -176,6 +186,10 @@ func DecodeMassifStart(ms *MassifStart, start []byte) error {
 
 	ms.Reserved = binary.BigEndian.Uint64(start[0:MassifStartKeyLastIDFirstByte])
 	ms.LastID = binary.BigEndian.Uint64(start[MassifStartKeyLastIDFirstByte:MassifStartKeyLastIDEnd])
+	ms.HashAlg = HashAlg(start[MassifStartKeyHashAlgFirstByte])
+	if err := checkHashAlg(ms.HashAlg); err != nil {
+		return err
+	}
 	ms.Version = binary.BigEndian.Uint16(start[MassifStartKeyVersionFirstByte:MassifStartKeyVersionEnd])
 	ms.CommitmentEpoch = binary.BigEndian.Uint32(start[MassifStartKeyEpochFirstByte:MassifStartKeyEpochEnd])
 	ms.MassifHeight = start[MassifStartKeyMassifHeightFirstByte]
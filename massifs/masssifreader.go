@@ -3,8 +3,8 @@ package massifs
 import (
 	"context"
 	"errors"
+	"fmt"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/logger"
 )
 
@@ -17,6 +17,8 @@ type MassifReader struct {
 	log   logger.Logger
 	store LogBlobReader
 	opts  ReaderOptions
+	// trieIndexes retains the trie indices built by FindLeafByAppID
+	trieIndexes *trieIndexCache
 }
 
 func NewMassifReader(
@@ -24,8 +26,9 @@ func NewMassifReader(
 	opts ...ReaderOption,
 ) MassifReader {
 	r := MassifReader{
-		log:   log,
-		store: store,
+		log:         log,
+		store:       store,
+		trieIndexes: newTrieIndexCache(),
 	}
 	for _, o := range opts {
 		o(&r.opts)
@@ -47,17 +50,17 @@ func (mr *MassifReader) GetMassif(
 	mc := MassifContext{
 		TenantIdentity: tenantIdentity,
 		LogBlobContext: LogBlobContext{
-			BlobPath: TenantMassifBlobPath(tenantIdentity, massifIndex),
+			BlobPath: options.logConfig.massifBlobPath(tenantIdentity, uint32(massifIndex)),
 		},
 	}
-	if err = mr.readAndPrepareContext(ctx, &mc, options.remoteReadOpts...); err != nil {
+	if err = mr.readAndPrepareContext(ctx, &mc, options); err != nil {
 		return MassifContext{}, err
 	}
 	return mc, nil
 }
 
-func (mr *MassifReader) readAndPrepareContext(ctx context.Context, mc *MassifContext, opts ...azblob.Option) error {
-	err := mc.ReadData(ctx, mr.store, opts...)
+func (mr *MassifReader) readAndPrepareContext(ctx context.Context, mc *MassifContext, options ReaderOptions) error {
+	err := mc.ReadData(ctx, mr.store, options.remoteReadOpts...)
 	if err != nil {
 		return err
 	}
@@ -66,6 +69,9 @@ func (mr *MassifReader) readAndPrepareContext(ctx context.Context, mc *MassifCon
 	if err != nil {
 		return err
 	}
+	if err = options.logConfig.fixupMassifStart(&mc.Start); err != nil {
+		return err
+	}
 	if !mr.opts.noGetRootSupport {
 		if err = mc.CreatePeakStackMap(); err != nil {
 			return err
@@ -85,20 +91,21 @@ func (mr *MassifReader) GetHeadMassif(
 	}
 
 	var err error
-	blobPrefixPath := TenantMassifPrefix(tenantIdentity)
-
 	mc := MassifContext{
 		TenantIdentity: tenantIdentity,
 	}
 	var massifCount uint64
-	mc.LogBlobContext, massifCount, err = LastPrefixedBlob(ctx, mr.store, blobPrefixPath, options.remoteListOpts...)
+	mc.LogBlobContext, massifCount, err = lastInstanceBlob(
+		ctx, mr.store, options.logConfig, func(instance uint32) string {
+			return TenantMassifInstancePrefix(tenantIdentity, instance)
+		}, options.remoteListOpts...)
 	if err != nil {
 		return MassifContext{}, err
 	}
 	if massifCount == 0 {
 		return MassifContext{}, ErrMassifNotFound
 	}
-	if err = mr.readAndPrepareContext(ctx, &mc, options.remoteReadOpts...); err != nil {
+	if err = mr.readAndPrepareContext(ctx, &mc, options); err != nil {
 		return MassifContext{}, err
 	}
 
@@ -126,7 +133,10 @@ func (mr *MassifReader) GetLazyContext(
 	case FirstBlob:
 		logBlobContext, err = FirstPrefixedBlob(ctx, mr.store, blobPrefixPath, options.remoteListOpts...)
 	case LastBlob:
-		logBlobContext, massifIndex, err = LastPrefixedBlob(ctx, mr.store, blobPrefixPath, options.remoteListOpts...)
+		logBlobContext, massifIndex, err = lastInstanceBlob(
+			ctx, mr.store, options.logConfig, func(instance uint32) string {
+				return TenantMassifInstancePrefix(tenantIdentity, instance)
+			}, options.remoteListOpts...)
 	}
 	if err != nil {
 		return LogBlobContext{}, 0, err
@@ -154,9 +164,79 @@ func (mr *MassifReader) GetFirstMassif(
 	if err != nil {
 		return MassifContext{}, err
 	}
-	if err = mr.readAndPrepareContext(ctx, &mc, options.remoteReadOpts...); err != nil {
+	if err = mr.readAndPrepareContext(ctx, &mc, options); err != nil {
 		return MassifContext{}, err
 	}
 
 	return mc, nil
 }
+
+// FindLeafByAppID returns the mmr index and idtimestamp of the first leaf
+// added to the tenant log for the provided log and application id.
+//
+// A trie index is built for each massif the first time it is searched, and
+// retained by the reader. Massifs which were full when their index was built
+// are not read again, and only the leaves added since are indexed for the
+// others. ErrTrieKeyNotFound is returned if there is no such leaf.
+func (mr *MassifReader) FindLeafByAppID(
+	ctx context.Context, tenantIdentity string, logId []byte, appId []byte,
+	opts ...ReaderOption,
+) (uint64, uint64, error) {
+
+	if mr.trieIndexes == nil {
+		mr.trieIndexes = newTrieIndexCache()
+	}
+
+	options := NewReaderOptions(mr.opts, opts...)
+	head, err := mr.GetHeadMassif(ctx, tenantIdentity, opts...)
+	if err != nil {
+		return 0, 0, err
+	}
+	for massifIndex := uint32(0); massifIndex <= head.Start.MassifIndex; massifIndex++ {
+
+		key := TenantMassifTrieIndexPath(tenantIdentity, massifIndex)
+		ti := mr.trieIndexes.get(key)
+
+		massifHeight := options.logConfig.massifHeight(head.Start.MassifHeight, massifIndex)
+		if ti == nil || ti.LeafCount < uint64(1)<<(massifHeight-1) {
+			mc := head
+			if massifIndex != head.Start.MassifIndex {
+				mc, err = mr.GetMassif(ctx, tenantIdentity, uint64(massifIndex), opts...)
+				if err != nil {
+					return 0, 0, err
+				}
+			}
+			if ti, err = mr.trieIndexes.update(key, &mc); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		if mmrIndex, idTimestamp, ok := ti.FindAppID(logId, appId); ok {
+			return mmrIndex, idTimestamp, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: %s", ErrTrieKeyNotFound, tenantIdentity)
+}
+
+// lastInstanceBlob returns the last blob, and the logical count of blobs, for
+// the last instance of the log which has any blobs under the prefix returned
+// by instancePrefix. Without a log config, only LogInstanceN is considered.
+func lastInstanceBlob(
+	ctx context.Context, store LogBlobReader, cfg *LogConfig, instancePrefix func(instance uint32) string,
+	opts ...ObjectOption,
+) (LogBlobContext, uint64, error) {
+	if cfg == nil {
+		return LastPrefixedBlob(ctx, store, instancePrefix(LogInstanceN), opts...)
+	}
+	for i := len(cfg.Instances) - 1; i >= 0; i-- {
+		inst := cfg.Instances[i]
+		bc, count, err := LastPrefixedBlob(ctx, store, instancePrefix(inst.Instance), opts...)
+		if err != nil {
+			return LogBlobContext{}, 0, err
+		}
+		if count != 0 {
+			return bc, uint64(inst.FirstMassifIndex) + count, nil
+		}
+	}
+	return LogBlobContext{}, 0, nil
+}
@@ -3,10 +3,8 @@ package massifs
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"fmt"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
 	"github.com/fxamacker/cbor/v2"
 
@@ -23,15 +21,20 @@ type MMRiverInclusionProof struct {
 }
 
 type MMRiverConsistencyProof struct {
-	TreeSize1        uint64   `cbor:"1,keyasint"`
-	TreeSize2        uint64   `cbor:"2,keyasint"`
-	ConsistencyPaths [][]byte `cbor:"3,keyasint"`
-	RightPeaks       [][]byte `cbor:"4,keyasint"`
+	TreeSize1 uint64 `cbor:"1,keyasint"`
+	TreeSize2 uint64 `cbor:"2,keyasint"`
+	// ConsistencyPaths has an inclusion path, in MMR(TreeSize2), for each peak
+	// of MMR(TreeSize1)
+	ConsistencyPaths [][][]byte `cbor:"3,keyasint"`
+	RightPeaks       [][]byte   `cbor:"4,keyasint"`
 }
 
 type MMRiverVerifiableProofs struct {
 	InclusionProofs   []MMRiverInclusionProof   `cbor:"-1,keyasint,omitempty"`
 	ConsistencyProofs []MMRiverConsistencyProof `cbor:"-2,keyasint,omitempty"`
+	// MultiInclusionProof is a compact alternative to InclusionProofs, see
+	// NewBatchReceipt
+	MultiInclusionProof *MMRiverMultiInclusionProof `cbor:"-65933,keyasint,omitempty"`
 }
 
 // MMRiverInclusionProofHeader provides for encoding, and defered decoding, of
@@ -45,7 +48,8 @@ type MMRiverVerifiableProofsHeader struct {
 // Signature verification failure is not an error, but the returned root will be nil and the result will be false.
 // All other unexpected issues are returned as errors, with a false result and nil root.
 // Note that MMRIVER receipts allow for multiple inclusion proofs to be attached to the receipt.
-// This function returns true only if ALL receipts verify
+// This function returns true only if ALL receipts verify. A compact multi-proof,
+// see NewBatchReceipt, is expanded to the individual proofs before verification.
 //
 // The candidates array provides the *candidate* values. Once verified, we can call them node values (or leaves),
 // Note that any node value in the log may be proven by a receipt, not just leaves.
@@ -71,6 +75,12 @@ func VerifySignedInclusionReceipts(
 		return false, nil, fmt.Errorf("MMRIVER receipt proofs malformed")
 	}
 	verifiableProofs := header.VerifiableProofs
+	if len(verifiableProofs.InclusionProofs) == 0 && verifiableProofs.MultiInclusionProof != nil {
+		verifiableProofs.InclusionProofs, err = verifiableProofs.MultiInclusionProof.InclusionProofs()
+		if err != nil {
+			return false, nil, err
+		}
+	}
 	if len(verifiableProofs.InclusionProofs) == 0 {
 		return false, nil, fmt.Errorf("MMRIVER receipt inclusion proofs not present")
 	}
@@ -80,25 +90,35 @@ func VerifySignedInclusionReceipts(
 		return false, nil, fmt.Errorf("MMRIVER receipt more candidates than proofs")
 	}
 
+	hashAlg, err := ReceiptHashAlg(receipt)
+	if err != nil {
+		return false, nil, err
+	}
+
 	var proof MMRiverInclusionProof
 
 	proof = verifiableProofs.InclusionProofs[0]
 	receipt.Payload = mmr.IncludedRoot(
-		sha256.New(),
+		hashAlg.New(),
 		proof.Index, candidates[0],
 		proof.InclusionPath)
 
-	err = receipt.VerifyWithCWTPublicKey(nil)
+	pubKeyProvider, err := NewCNFPublicKeyProvider(receipt)
+	if err != nil {
+		return false, nil, err
+	}
+	err = receipt.VerifyWithProvider(pubKeyProvider, nil)
 	if err != nil {
 		return false, nil, fmt.Errorf(
 			"MMRIVER receipt VERIFY FAILED for: mmrIndex %d, candidate %d, err %v", proof.Index, 0, err)
 	}
-	// verify the first proof then just compare the produced roots
+	// verify the first proof then just compare the produced roots. There may
+	// be fewer candidates than proofs, the proofs without one are not checked.
 
-	for i := 1; i < len(verifiableProofs.InclusionProofs); i++ {
+	for i := 1; i < len(candidates); i++ {
 
 		proof = verifiableProofs.InclusionProofs[i]
-		proven := mmr.IncludedRoot(sha256.New(), proof.Index, candidates[i], proof.InclusionPath)
+		proven := mmr.IncludedRoot(hashAlg.New(), proof.Index, candidates[i], proof.InclusionPath)
 		if bytes.Compare(receipt.Payload, proven) != 0 {
 			return false, nil, fmt.Errorf(
 				"MMRIVER receipt VERIFY FAILED for: mmrIndex %d, candidate %d, err %v", proof.Index, i, err)
@@ -107,6 +127,32 @@ func VerifySignedInclusionReceipts(
 	return true, receipt.Payload, nil
 }
 
+// ReceiptHashAlg returns the hash algorithm of the log, as signed in the
+// protected header of a receipt. Receipts for SHA-256 logs omit it.
+func ReceiptHashAlg(receipt *commoncose.CoseSign1Message) (HashAlg, error) {
+
+	value, ok := receipt.Headers.Protected[ReceiptHashAlgLabel]
+	if !ok {
+		return HashAlgSHA256, nil
+	}
+
+	// Depending on how the receipt was decoded, the value may be signed or
+	// unsigned.
+	var v int64
+	switch value := value.(type) {
+	case int64:
+		v = value
+	case uint64:
+		v = int64(min(value, uint64(HashAlgMax)))
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrHashAlgUnsupported, value)
+	}
+	if v < 0 || v >= int64(HashAlgMax) {
+		return 0, fmt.Errorf("%w: %d", ErrHashAlgUnsupported, v)
+	}
+	return HashAlg(v), nil
+}
+
 // VerifySignedInclusionReceipt verifies a reciept comprised of a single inclusion proof
 // If there are 0 or more than 1 candidates, the result will be false and an error will be returned
 func VerifySignedInclusionReceipt(
@@ -132,23 +178,27 @@ type verifiedContextGetter interface {
 	) (*VerifiedContext, error)
 }
 
-// NewReceipt returns a COSE receipt for the given tenantIdentity and mmrIndex
+// NewReceipt returns a COSE receipt for the given tenantIdentity and mmrIndex.
+// If the opts include WithLogConfig, massifHeight is ignored and the massif is
+// located using the log instances. The opts are also provided to the getter.
 func NewReceipt(
 	ctx context.Context,
 	massifHeight uint8,
 	tenantIdentity string, mmrIndex uint64,
 	getter verifiedContextGetter,
+	opts ...ReaderOption,
 ) (*commoncose.CoseSign1Message, error) {
 
-	massifIndex := uint32(MassifIndexFromMMRIndex(massifHeight, mmrIndex))
+	options := NewReaderOptions(ReaderOptions{}, opts...)
+	massifIndex := uint32(options.logConfig.massifIndexFromMMRIndex(massifHeight, mmrIndex))
 
-	verified, err := getter.GetVerifiedContext(ctx, tenantIdentity, uint64(massifIndex))
+	verified, err := getter.GetVerifiedContext(ctx, tenantIdentity, uint64(massifIndex), opts...)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"%w: failed to get verified context %d for %s", err, massifIndex, tenantIdentity)
 	}
 
-	msg, state := verified.Sign1Message, verified.MMRState
+	state := verified.MMRState
 
 	proof, err := mmr.InclusionProof(&verified.MassifContext, state.MMRSize-1, mmrIndex)
 	if err != nil {
@@ -159,6 +209,28 @@ func NewReceipt(
 
 	peakIndex := mmr.PeakIndex(mmr.LeafCount(state.MMRSize), len(proof))
 
+	signed, err := signedPeakReceipt(&verified.Sign1Message, peakIndex)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: for %d in MMR(%d), tenant %s", err, mmrIndex, state.MMRSize, tenantIdentity)
+	}
+
+	verifiableProofs := MMRiverVerifiableProofs{
+		InclusionProofs: []MMRiverInclusionProof{{
+			Index:         mmrIndex,
+			InclusionPath: proof}},
+	}
+
+	signed.Headers.Unprotected[VDSCoseReceiptProofsTag] = verifiableProofs
+
+	return signed, nil
+}
+
+// signedPeakReceipt returns an independent copy of the pre-signed receipt for
+// the peak at peakIndex in the accumulator signed by seal. The unprotected
+// headers are cleared, ready for the caller to attach proofs.
+func signedPeakReceipt(seal *commoncose.CoseSign1Message, peakIndex int) (*commoncose.CoseSign1Message, error) {
+
 	// NOTE: The old-accumulator compatibility property, from
 	// https://eprint.iacr.org/2015/718.pdf, along with the COSE protected &
 	// unprotected buckets, is why we can just pre sign the receipts.
@@ -166,14 +238,12 @@ func NewReceipt(
 	// it does not matter which accumulator state the receipt is signed against.
 
 	var peaksHeader MMRStateReceipts
-	err = cbor.Unmarshal(msg.Headers.RawUnprotected, &peaksHeader)
+	err := cbor.Unmarshal(seal.Headers.RawUnprotected, &peaksHeader)
 	if err != nil {
-		return nil, fmt.Errorf(
-			"%w: failed decoding peaks header: for tenant %s, seal %d", err, tenantIdentity, massifIndex)
+		return nil, fmt.Errorf("%w: failed decoding peaks header", err)
 	}
 	if peakIndex >= len(peaksHeader.PeakReceipts) {
-		return nil, fmt.Errorf(
-			"%w: peaks header containes to few peak receipts: for tenant %s, seal %d", err, tenantIdentity, massifIndex)
+		return nil, fmt.Errorf("peaks header contains to few peak receipts")
 	}
 
 	// This is an array of marshaled COSE_Sign1's
@@ -181,58 +251,112 @@ func NewReceipt(
 	signed, err := commoncose.NewCoseSign1MessageFromCBOR(
 		receiptMsg, commoncose.WithDecOptions(CheckpointDecOptions()))
 	if err != nil {
-		return nil, fmt.Errorf(
-			"%w: failed to decode pre-signed receipt for: %d in MMR(%d)",
-			err, mmrIndex, state.MMRSize)
+		return nil, fmt.Errorf("%w: failed to decode pre-signed receipt", err)
 	}
 
 	// signed.Headers.RawProtected = nil
 	signed.Headers.RawUnprotected = nil
 
-	verifiableProofs := MMRiverVerifiableProofs{
-		InclusionProofs: []MMRiverInclusionProof{{
-			Index:         mmrIndex,
-			InclusionPath: proof}},
-	}
-
-	signed.Headers.Unprotected[VDSCoseReceiptProofsTag] = verifiableProofs
-
 	return signed, nil
 }
 
 type ReceiptBuilder struct {
 	log          logger.Logger
-	massifReader MassifReader
+	getter       verifiedContextGetter
 	cborCodec    commoncbor.CBORCodec
 	massifHeight uint8
+	opts         []ReaderOption
 }
 
 // newReceiptBuilder creates a new receiptBuilder configured with all the necessary readers and information required to build a receipt
 // Note that errors are logged assuming the calling context is retrieving a receipt,
-// and that all returned errors are StatusErrors that can be returned to the client or nil
-func NewReceiptBuilder(log logger.Logger, reader azblob.Reader, massifHeight uint8) (ReceiptBuilder, error) {
+// and that all returned errors are StatusErrors that can be returned to the client or nil.
+// The opts are provided to the massif reader, and when building the receipts,
+// see NewReceipt.
+func NewReceiptBuilder(
+	log logger.Logger, reader LogBlobReader, massifHeight uint8, opts ...ReaderOption,
+) (ReceiptBuilder, error) {
 
 	var err error
 
 	b := ReceiptBuilder{
 		log:          log,
 		massifHeight: massifHeight,
+		opts:         opts,
 	}
 
 	if b.cborCodec, err = NewRootSignerCodec(); err != nil {
 		return ReceiptBuilder{}, err
 	}
 	b.massifHeight = massifHeight
-	b.massifReader = NewMassifReader(log, reader)
 	sealReader := NewSignedRootReader(log, reader, b.cborCodec)
-	b.massifReader = NewMassifReader(log, reader, WithSealGetter(&sealReader))
+	massifReader := NewMassifReader(
+		log, reader, append([]ReaderOption{WithSealGetter(&sealReader), WithCBORCodec(b.cborCodec)}, opts...)...)
+	b.getter = &massifReader
+
+	return b, nil
+}
+
+// NewLocalReceiptBuilder creates a receiptBuilder which reads the massifs and
+// seals from a local replica. No remote access is required, and the receipts
+// are identical to those built from the remote log.
+//
+// Unless the reader is configured with a seal getter, the seals are read
+// from the replica by the reader. The reader's cache must be configured with a
+// CBOR codec capable of decoding the seals, see NewRootSignerCodec. The log
+// config of the reader's cache, if any, locates the massifs.
+func NewLocalReceiptBuilder(log logger.Logger, reader LocalReader, massifHeight uint8) (ReceiptBuilder, error) {
+
+	var err error
+
+	b := ReceiptBuilder{
+		log:          log,
+		massifHeight: massifHeight,
+	}
+	if cfg := reader.cache.Options().logConfig; cfg != nil {
+		b.opts = []ReaderOption{WithLogConfig(*cfg)}
+	}
+
+	if b.cborCodec, err = NewRootSignerCodec(); err != nil {
+		return ReceiptBuilder{}, err
+	}
+	b.getter = &localVerifiedContextGetter{reader: &reader, codec: b.cborCodec}
 
 	return b, nil
 }
 
+// localVerifiedContextGetter defaults the seal getter for a LocalReader to the
+// reader itself, so that the seals come from the same replica as the massifs.
+type localVerifiedContextGetter struct {
+	reader *LocalReader
+	codec  commoncbor.CBORCodec
+}
+
+func (g *localVerifiedContextGetter) GetVerifiedContext(
+	ctx context.Context, tenantIdentity string, massifIndex uint64,
+	opts ...ReaderOption,
+) (*VerifiedContext, error) {
+
+	options := g.reader.cache.Options()
+	if options.codec == nil {
+		opts = append([]ReaderOption{WithCBORCodec(g.codec)}, opts...)
+	}
+	if options.sealGetter == nil {
+		opts = append([]ReaderOption{WithSealGetter(g.reader)}, opts...)
+	}
+	return g.reader.GetVerifiedContext(ctx, tenantIdentity, massifIndex, opts...)
+}
+
 func (b *ReceiptBuilder) BuildReceipt(
 	ctx context.Context, tenantIdentity string, mmrIndex uint64,
 ) (*commoncose.CoseSign1Message, error) {
 
-	return NewReceipt(ctx, b.massifHeight, tenantIdentity, mmrIndex, &b.massifReader)
+	return NewReceipt(ctx, b.massifHeight, tenantIdentity, mmrIndex, b.getter, b.opts...)
+}
+
+func (b *ReceiptBuilder) BuildBatchReceipt(
+	ctx context.Context, tenantIdentity string, mmrIndices []uint64,
+) (*commoncose.CoseSign1Message, error) {
+
+	return NewBatchReceipt(ctx, b.massifHeight, tenantIdentity, mmrIndices, b.getter, b.opts...)
 }
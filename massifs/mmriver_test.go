@@ -0,0 +1,116 @@
+package massifs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOSOpener struct{}
+
+func (testOSOpener) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+type testOSDirLister struct{}
+
+func (testOSDirLister) ListFiles(directory string) ([]string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(directory, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// TestLocalReceiptBuilder checks that receipts built from a local replica
+// are the same as those built from the remote log.
+func TestLocalReceiptBuilder(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+
+	log, massifs := newSealedTestLog(t, tenant, massifHeight, testLeafEntries(0, 11))
+	store, codec := log.store, log.codec
+
+	replicaDir := t.TempDir()
+	writeReplica := func(relativePath string, data []byte) {
+		filePath := filepath.Join(replicaDir, relativePath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, data, 0644))
+	}
+
+	// Replicate both the massif and the seal
+	for massifIndex, mc := range massifs {
+		_, sealBytes, err := BlobRead(ctx, TenantMassifSignedRootPath(tenant, uint32(massifIndex)), store)
+		require.NoError(t, err)
+		writeReplica(ReplicaRelativeMassifPath(tenant, uint32(massifIndex)), mc.Data)
+		writeReplica(ReplicaRelativeSealPath(tenant, uint32(massifIndex)), sealBytes)
+	}
+
+	remote, err := NewReceiptBuilder(nil, store, massifHeight)
+	require.NoError(t, err)
+
+	cache, err := NewLogDirCache(nil, testOSOpener{},
+		WithDirCacheReplicaDir(replicaDir),
+		WithDirCacheMassifLister(testOSDirLister{}),
+		WithDirCacheSealLister(testOSDirLister{}),
+		WithReaderOption(WithCBORCodec(codec)),
+		WithReaderOption(WithMassifHeight(massifHeight)),
+	)
+	require.NoError(t, err)
+	localReader, err := NewLocalReader(nil, cache)
+	require.NoError(t, err)
+	local, err := NewLocalReceiptBuilder(nil, localReader, massifHeight)
+	require.NoError(t, err)
+
+	// Receipts are compared and verified in their transported form
+	decode := func(receipt *commoncose.CoseSign1Message) *commoncose.CoseSign1Message {
+		data, err := receipt.MarshalCBOR()
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+			data, commoncose.WithDecOptions(CheckpointDecOptions()))
+		require.NoError(t, err)
+		return decoded
+	}
+	proofsOf := func(receipt *commoncose.CoseSign1Message) MMRiverVerifiableProofs {
+		var header MMRiverVerifiableProofsHeader
+		require.NoError(t, cbor.Unmarshal(receipt.Headers.RawUnprotected, &header))
+		return header.VerifiableProofs
+	}
+
+	for _, leafIndex := range []uint64{0, 5, 8, 10} {
+		mmrIndex := mmr.MMRIndex(leafIndex)
+
+		localReceipt, err := local.BuildReceipt(ctx, tenant, mmrIndex)
+		require.NoError(t, err)
+		remoteReceipt, err := remote.BuildReceipt(ctx, tenant, mmrIndex)
+		require.NoError(t, err)
+		localReceipt, remoteReceipt = decode(localReceipt), decode(remoteReceipt)
+
+		assert.Equal(t, remoteReceipt.Headers.RawProtected, localReceipt.Headers.RawProtected)
+		assert.Equal(t, remoteReceipt.Signature, localReceipt.Signature)
+		assert.Equal(t, proofsOf(remoteReceipt), proofsOf(localReceipt))
+
+		massifIndex := MassifIndexFromMMRIndex(massifHeight, mmrIndex)
+		mc, err := localReader.GetMassif(ctx, tenant, massifIndex)
+		require.NoError(t, err)
+		leaf, err := mc.Get(mmrIndex)
+		require.NoError(t, err)
+		ok, _, err := VerifySignedInclusionReceipt(ctx, localReceipt, leaf)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
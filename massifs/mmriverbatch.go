@@ -0,0 +1,217 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+var (
+	ErrBatchReceiptEmpty    = errors.New("at least one mmr index is required for a batch receipt")
+	ErrBatchReceiptMassif   = errors.New("all mmr indices in a batch receipt must be in the same massif")
+	ErrBatchReceiptPeak     = errors.New("all mmr indices in a batch receipt must be committed by the same peak")
+	ErrMultiProofMalformed  = errors.New("the MMRIVER multi-proof is malformed")
+	ErrMultiProofIndexRange = errors.New("an index in the MMRIVER multi-proof is outside the tree size")
+)
+
+// MMRiverMultiInclusionProof proves the inclusion of many nodes under a single
+// accumulator peak.
+//
+// Rather than carrying a full path for each index, the path nodes are
+// collected into a single deduplicated list. The path for each index is
+// determined entirely by the index and TreeSize, so the verifier can
+// reconstruct the individual proofs, see InclusionProofs.
+type MMRiverMultiInclusionProof struct {
+	// TreeSize is the size of the MMR the paths were generated against
+	TreeSize uint64   `cbor:"1,keyasint"`
+	Indices  []uint64 `cbor:"2,keyasint"`
+	// Nodes are the distinct path nodes of all the indices, in ascending mmr
+	// index order.
+	Nodes [][]byte `cbor:"3,keyasint"`
+}
+
+// NewMultiInclusionProof creates a multi-proof for the provided indices in
+// MMR(mmrSize). The indices are not required to be committed by the same
+// peak, but the receipts built from the proof are only useful if they are.
+func NewMultiInclusionProof(
+	store NodeGetter, mmrSize uint64, mmrIndices []uint64,
+) (MMRiverMultiInclusionProof, error) {
+
+	proof := MMRiverMultiInclusionProof{
+		TreeSize: mmrSize,
+		Indices:  slices.Clone(mmrIndices),
+	}
+
+	nodeIndices, _, err := multiProofNodeIndices(mmrSize, mmrIndices)
+	if err != nil {
+		return MMRiverMultiInclusionProof{}, err
+	}
+
+	for _, i := range nodeIndices {
+		value, err := store.Get(i)
+		if err != nil {
+			return MMRiverMultiInclusionProof{}, err
+		}
+		proof.Nodes = append(proof.Nodes, value)
+	}
+	return proof, nil
+}
+
+// InclusionProofs reconstructs the individual inclusion proofs, in the order
+// of Indices.
+func (p *MMRiverMultiInclusionProof) InclusionProofs() ([]MMRiverInclusionProof, error) {
+
+	nodeIndices, paths, err := multiProofNodeIndices(p.TreeSize, p.Indices)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeIndices) != len(p.Nodes) {
+		return nil, fmt.Errorf(
+			"%w: %d path nodes required, %d provided", ErrMultiProofMalformed, len(nodeIndices), len(p.Nodes))
+	}
+
+	values := make(map[uint64][]byte, len(nodeIndices))
+	for j, i := range nodeIndices {
+		values[i] = p.Nodes[j]
+	}
+
+	proofs := make([]MMRiverInclusionProof, len(p.Indices))
+	for j, i := range p.Indices {
+		proofs[j].Index = i
+		for _, sibling := range paths[j] {
+			proofs[j].InclusionPath = append(proofs[j].InclusionPath, values[sibling])
+		}
+	}
+	return proofs, nil
+}
+
+// packMultiInclusionProof creates a multi-proof from the complete inclusion
+// proofs, in MMR(mmrSize), of each of its indices.
+func packMultiInclusionProof(
+	mmrSize uint64, proofs []MMRiverInclusionProof,
+) (MMRiverMultiInclusionProof, error) {
+
+	proof := MMRiverMultiInclusionProof{TreeSize: mmrSize}
+	for _, p := range proofs {
+		proof.Indices = append(proof.Indices, p.Index)
+	}
+
+	nodeIndices, paths, err := multiProofNodeIndices(mmrSize, proof.Indices)
+	if err != nil {
+		return MMRiverMultiInclusionProof{}, err
+	}
+
+	values := make(map[uint64][]byte, len(nodeIndices))
+	for j, path := range paths {
+		if len(path) != len(proofs[j].InclusionPath) {
+			return MMRiverMultiInclusionProof{}, fmt.Errorf(
+				"%w: the path for %d is incomplete in MMR(%d)", ErrMultiProofMalformed, proofs[j].Index, mmrSize)
+		}
+		for k, i := range path {
+			values[i] = proofs[j].InclusionPath[k]
+		}
+	}
+	for _, i := range nodeIndices {
+		proof.Nodes = append(proof.Nodes, values[i])
+	}
+	return proof, nil
+}
+
+// multiProofNodeIndices returns the distinct, ascending, path node indices for
+// the provided mmrIndices, and the path indices for each of mmrIndices.
+func multiProofNodeIndices(mmrSize uint64, mmrIndices []uint64) ([]uint64, [][]uint64, error) {
+
+	var nodeIndices []uint64
+	paths := make([][]uint64, len(mmrIndices))
+
+	for j, i := range mmrIndices {
+		if mmrSize == 0 || i >= mmrSize {
+			return nil, nil, fmt.Errorf("%w: %d in MMR(%d)", ErrMultiProofIndexRange, i, mmrSize)
+		}
+		path, err := mmr.InclusionProofPath(mmrSize-1, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths[j] = path
+		nodeIndices = append(nodeIndices, path...)
+	}
+	slices.Sort(nodeIndices)
+	return slices.Compact(nodeIndices), paths, nil
+}
+
+// NewBatchReceipt returns a single COSE receipt proving all of the provided
+// mmrIndices for tenantIdentity.
+//
+// All indices must be in the same massif, and must be committed by the same
+// peak of the sealed accumulator for that massif. The receipt is the
+// pre-signed receipt for that peak with an MMRIVER multi-proof attached.
+// Sibling nodes shared between the paths are included only once.
+// VerifySignedInclusionReceipts verifies the result, the candidates are
+// provided in the same order as mmrIndices. The opts are as for NewReceipt.
+func NewBatchReceipt(
+	ctx context.Context,
+	massifHeight uint8,
+	tenantIdentity string, mmrIndices []uint64,
+	getter verifiedContextGetter,
+	opts ...ReaderOption,
+) (*commoncose.CoseSign1Message, error) {
+
+	if len(mmrIndices) == 0 {
+		return nil, ErrBatchReceiptEmpty
+	}
+
+	options := NewReaderOptions(ReaderOptions{}, opts...)
+	massifIndex := options.logConfig.massifIndexFromMMRIndex(massifHeight, mmrIndices[0])
+	for _, i := range mmrIndices[1:] {
+		if options.logConfig.massifIndexFromMMRIndex(massifHeight, i) != massifIndex {
+			return nil, fmt.Errorf(
+				"%w: %d is not in massif %d", ErrBatchReceiptMassif, i, massifIndex)
+		}
+	}
+
+	verified, err := getter.GetVerifiedContext(ctx, tenantIdentity, massifIndex, opts...)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: failed to get verified context %d for %s", err, massifIndex, tenantIdentity)
+	}
+	state := verified.MMRState
+
+	// The peak is identified by the height of the node plus the length of its
+	// path, which must be the same for every index.
+	leafCount := mmr.LeafCount(state.MMRSize)
+	_, paths, err := multiProofNodeIndices(state.MMRSize, mmrIndices)
+	if err != nil {
+		return nil, err
+	}
+	peakIndex := -1
+	for j, i := range mmrIndices {
+		p := mmr.PeakIndex(leafCount, int(mmr.IndexHeight(i))+len(paths[j]))
+		if peakIndex != -1 && p != peakIndex {
+			return nil, fmt.Errorf(
+				"%w: %d and %d in MMR(%d)", ErrBatchReceiptPeak, mmrIndices[0], i, state.MMRSize)
+		}
+		peakIndex = p
+	}
+
+	proof, err := NewMultiInclusionProof(&verified.MassifContext, state.MMRSize, mmrIndices)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to generate multi-proof in MMR(%d), %w", state.MMRSize, err)
+	}
+
+	signed, err := signedPeakReceipt(&verified.Sign1Message, peakIndex)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: in MMR(%d), tenant %s", err, state.MMRSize, tenantIdentity)
+	}
+
+	signed.Headers.Unprotected[VDSCoseReceiptProofsTag] = MMRiverVerifiableProofs{
+		MultiInclusionProof: &proof,
+	}
+
+	return signed, nil
+}
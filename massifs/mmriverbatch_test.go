@@ -0,0 +1,136 @@
+package massifs
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testVerifiedContextGetter struct {
+	verified *VerifiedContext
+}
+
+func (g testVerifiedContextGetter) GetVerifiedContext(
+	ctx context.Context, tenantIdentity string, massifIndex uint64, opts ...ReaderOption,
+) (*VerifiedContext, error) {
+	return g.verified, nil
+}
+
+// TestMMRiverMultiInclusionProofLabel checks the label is the tag the
+// multi-proof is encoded with.
+func TestMMRiverMultiInclusionProofLabel(t *testing.T) {
+	field, ok := reflect.TypeFor[MMRiverVerifiableProofs]().FieldByName("MultiInclusionProof")
+	require.True(t, ok)
+	label, _, _ := strings.Cut(field.Tag.Get("cbor"), ",")
+	assert.Equal(t, strconv.FormatInt(MMRiverMultiInclusionProofLabel, 10), label)
+}
+
+func TestBatchReceipt(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 8
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 21))
+	reader := NewMassifReader(nil, log.store)
+	mc, err := reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+
+	peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	state := MMRState{
+		Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks, Timestamp: 1234}
+
+	signer := log.signer
+	sealed, err := signer.SealedState(tenant, 0, state)
+	require.NoError(t, err)
+	getter := testVerifiedContextGetter{verified: &VerifiedContext{
+		MassifContext: mc,
+		Sign1Message:  sealed.Sign1Message,
+		MMRState:      sealed.MMRState,
+	}}
+
+	// The first 16 leaves, and the interior nodes above them, are committed
+	// by the first peak.
+	indices := []uint64{
+		mmr.MMRIndex(0), mmr.MMRIndex(1), mmr.MMRIndex(2), mmr.MMRIndex(7), mmr.MMRIndex(15), 2, 13}
+
+	receipt, err := NewBatchReceipt(ctx, massifHeight, tenant, indices, getter)
+	require.NoError(t, err)
+
+	data, err := receipt.MarshalCBOR()
+	require.NoError(t, err)
+	decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+		data, commoncose.WithDecOptions(CheckpointDecOptions()))
+	require.NoError(t, err)
+
+	var header MMRiverVerifiableProofsHeader
+	require.NoError(t, cbor.Unmarshal(decoded.Headers.RawUnprotected, &header))
+	multi := header.VerifiableProofs.MultiInclusionProof
+	require.NotNil(t, multi)
+
+	// The multi-proof is carried under its private range label
+	var labels map[int64]cbor.RawMessage
+	var raw struct {
+		VerifiableProofs cbor.RawMessage `cbor:"396,keyasint"`
+	}
+	require.NoError(t, cbor.Unmarshal(decoded.Headers.RawUnprotected, &raw))
+	require.NoError(t, cbor.Unmarshal(raw.VerifiableProofs, &labels))
+	assert.Contains(t, labels, MMRiverMultiInclusionProofLabel)
+
+	// The shared path nodes are present only once
+	var pathLen int
+	proofs, err := multi.InclusionProofs()
+	require.NoError(t, err)
+	for j, proof := range proofs {
+		expect, err := mmr.InclusionProof(&mc, state.MMRSize-1, indices[j])
+		require.NoError(t, err)
+		assert.Equal(t, expect, proof.InclusionPath)
+		pathLen += len(proof.InclusionPath)
+	}
+	assert.Less(t, len(multi.Nodes), pathLen)
+
+	candidates := make([][]byte, len(indices))
+	for j, i := range indices {
+		candidates[j], err = mc.Get(i)
+		require.NoError(t, err)
+	}
+	ok, root, err := VerifySignedInclusionReceipts(ctx, decoded, candidates)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, peaks[0], root)
+
+	// Fewer candidates than proofs, the leading candidates are checked
+	ok, root, err = VerifySignedInclusionReceipts(ctx, decoded, candidates[:3])
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, peaks[0], root)
+	ok, _, err = VerifySignedInclusionReceipts(ctx, decoded, [][]byte{candidates[0], candidates[4]})
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	// A candidate which is not in the log
+	candidates[3] = candidates[4]
+	ok, _, err = VerifySignedInclusionReceipts(ctx, decoded, candidates)
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	// Leaf 16 is committed by the second peak
+	_, err = NewBatchReceipt(ctx, massifHeight, tenant, []uint64{0, mmr.MMRIndex(16)}, getter)
+	assert.ErrorIs(t, err, ErrBatchReceiptPeak)
+
+	_, err = NewBatchReceipt(ctx, 2, tenant, []uint64{0, mmr.MMRIndex(16)}, getter)
+	assert.ErrorIs(t, err, ErrBatchReceiptMassif)
+
+	// A multi-proof with a missing node
+	multi.Nodes = multi.Nodes[1:]
+	_, err = multi.InclusionProofs()
+	assert.ErrorIs(t, err, ErrMultiProofMalformed)
+}
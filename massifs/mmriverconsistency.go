@@ -0,0 +1,196 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// NodeGetter provides the node values of a log. MassifContext provides the
+// nodes of a single massif, MultiMassifStore provides all nodes.
+type NodeGetter interface {
+	Get(i uint64) ([]byte, error)
+}
+
+// NewConsistencyReceipt returns a COSE receipt proving that the log described
+// by fromState is contained in the log sealed by toSeal.
+//
+// The receipt is the seal for the later state, with the peak receipts
+// replaced by an MMRIVER consistency proof. The consistency paths prove each
+// peak of fromState in MMR(toSeal.MMRState.MMRSize), and the right peaks are
+// the peaks of the later state that are not reached by those paths. Together
+// they are sufficient for a holder of fromState to reproduce the peaks signed
+// by the seal, see VerifySignedConsistencyReceipt. Only fromState.MMRSize is
+// used; the peaks are read from the store.
+//
+// The store must be able to provide the nodes of the log up to the size of
+// the later state, typically a MultiMassifStore.
+func NewConsistencyReceipt(
+	fromState MMRState, toSeal *SealedState, store NodeGetter,
+) (*commoncose.CoseSign1Message, error) {
+
+	toState := toSeal.MMRState
+	if err := checkHashAlg(toState.HashAlg); err != nil {
+		return nil, err
+	}
+	if fromState.MMRSize == 0 || fromState.MMRSize > toState.MMRSize {
+		return nil, fmt.Errorf(
+			"%w: %d > %d", ErrStateSizeOrder, fromState.MMRSize, toState.MMRSize)
+	}
+
+	cp, err := mmr.IndexConsistencyProof(store, fromState.MMRSize-1, toState.MMRSize-1)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: %d -> %d: %w", ErrGeneratingConsistencyProof, fromState.MMRSize, toState.MMRSize, err)
+	}
+
+	peaksA, err := mmr.PeakHashes(store, fromState.MMRSize-1)
+	if err != nil {
+		return nil, err
+	}
+	peaksB, err := mmr.PeakHashes(store, toState.MMRSize-1)
+	if err != nil {
+		return nil, err
+	}
+
+	// The verifier recovers a prefix of the later accumulator from the
+	// earlier peaks, the right peaks are the remainder.
+	proven, err := mmr.ConsistentRoots(toState.HashAlg.New(), fromState.MMRSize-1, peaksA, cp.Path)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: %d -> %d: %w", ErrGeneratingConsistencyProof, fromState.MMRSize, toState.MMRSize, err)
+	}
+	if len(proven) > len(peaksB) {
+		return nil, fmt.Errorf(
+			"%w: %d -> %d: more proven roots than peaks",
+			ErrGeneratingConsistencyProof, fromState.MMRSize, toState.MMRSize)
+	}
+
+	// Take an independent copy of the seal, and re-create the detached form
+	// of its payload in case the peaks have been restored for verification.
+	data, err := toSeal.Sign1Message.MarshalCBOR()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := commoncose.NewCoseSign1MessageFromCBOR(
+		data, commoncose.WithDecOptions(CheckpointDecOptions()))
+	if err != nil {
+		return nil, err
+	}
+	codec, err := NewRootSignerCodec()
+	if err != nil {
+		return nil, err
+	}
+	toState.Peaks = nil
+	toState.LegacySealRoot = nil
+	if signed.Payload, err = codec.MarshalCBOR(toState); err != nil {
+		return nil, err
+	}
+
+	// The peak receipts are only useful for inclusion proofs, so they are
+	// replaced rather than extended.
+	signed.Headers.RawUnprotected = nil
+	signed.Headers.Unprotected = cose.UnprotectedHeader{
+		VDSCoseReceiptProofsTag: MMRiverVerifiableProofs{
+			ConsistencyProofs: []MMRiverConsistencyProof{{
+				TreeSize1:        cp.MMRSizeA,
+				TreeSize2:        cp.MMRSizeB,
+				ConsistencyPaths: cp.Path,
+				RightPeaks:       peaksB[len(proven):],
+			}},
+		},
+	}
+
+	return signed, nil
+}
+
+// VerifySignedConsistencyReceipt verifies a signed COSE receipt, encoded
+// according to the MMRIVER VDS, which proves the log described by the trusted
+// fromState is contained in the log state signed by the receipt.
+//
+// The peaks of the later state are recovered from the peaks of fromState and
+// the consistency proof, and the signature is then verified over the later
+// state. This requires no access to the log. On success, the later state is
+// returned, including its peaks, and may be used as the fromState for
+// subsequent checks.
+func VerifySignedConsistencyReceipt(
+	ctx context.Context,
+	receipt *commoncose.CoseSign1Message,
+	fromState MMRState,
+) (bool, MMRState, error) {
+
+	if fromState.Peaks == nil {
+		return false, MMRState{}, ErrStateRootMissing
+	}
+
+	var header MMRiverVerifiableProofsHeader
+	err := cbor.Unmarshal(receipt.Headers.RawUnprotected, &header)
+	if err != nil {
+		return false, MMRState{}, fmt.Errorf("MMRIVER receipt proofs malformed")
+	}
+	if len(header.VerifiableProofs.ConsistencyProofs) == 0 {
+		return false, MMRState{}, fmt.Errorf("MMRIVER receipt consistency proofs not present")
+	}
+	proof := header.VerifiableProofs.ConsistencyProofs[0]
+
+	if proof.TreeSize1 != fromState.MMRSize {
+		return false, MMRState{}, fmt.Errorf(
+			"%w: the proof is from size %d, not the trusted size %d",
+			ErrConsistencyProofCheck, proof.TreeSize1, fromState.MMRSize)
+	}
+
+	codec, err := NewRootSignerCodec()
+	if err != nil {
+		return false, MMRState{}, err
+	}
+	var toState MMRState
+	if err = codec.UnmarshalInto(receipt.Payload, &toState); err != nil {
+		return false, MMRState{}, err
+	}
+	if proof.TreeSize2 != toState.MMRSize || proof.TreeSize1 > proof.TreeSize2 {
+		return false, MMRState{}, fmt.Errorf(
+			"%w: the proof is to size %d, the signed state has size %d",
+			ErrConsistencyProofCheck, proof.TreeSize2, toState.MMRSize)
+	}
+	if toState.HashAlg != fromState.HashAlg {
+		return false, MMRState{}, fmt.Errorf(
+			"%w: %v -> %v", ErrHashAlgMismatch, fromState.HashAlg, toState.HashAlg)
+	}
+	if err = checkHashAlg(toState.HashAlg); err != nil {
+		return false, MMRState{}, err
+	}
+
+	proven, err := mmr.ConsistentRoots(
+		toState.HashAlg.New(), proof.TreeSize1-1, fromState.Peaks, proof.ConsistencyPaths)
+	if err != nil {
+		return false, MMRState{}, fmt.Errorf("%w: %w", ErrConsistencyProofCheck, err)
+	}
+
+	peaks := append(proven, proof.RightPeaks...)
+	if len(peaks) != len(mmr.Peaks(proof.TreeSize2-1)) {
+		return false, MMRState{}, fmt.Errorf(
+			"%w: %d peaks recovered, MMR(%d) has %d",
+			ErrConsistencyProofCheck, len(peaks), proof.TreeSize2, len(mmr.Peaks(proof.TreeSize2-1)))
+	}
+	toState.Peaks = peaks
+
+	if receipt.Payload, err = codec.MarshalCBOR(toState); err != nil {
+		return false, MMRState{}, err
+	}
+	pubKeyProvider, err := NewCNFPublicKeyProvider(receipt)
+	if err != nil {
+		return false, MMRState{}, err
+	}
+	err = receipt.VerifyWithProvider(pubKeyProvider, nil)
+	if err != nil {
+		return false, MMRState{}, fmt.Errorf(
+			"%w: MMRIVER consistency receipt %d -> %d: %v",
+			ErrSealVerifyFailed, proof.TreeSize1, proof.TreeSize2, err)
+	}
+
+	return true, toState, nil
+}
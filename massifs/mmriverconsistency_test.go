@@ -0,0 +1,83 @@
+package massifs
+
+import (
+	"bytes"
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistencyReceipt(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 27))
+	reader := NewMassifReader(nil, log.store)
+	s := NewMultiMassifStore(ctx, &reader, tenant, massifHeight, 0)
+	head, err := reader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+
+	stateAt := func(mmrSize uint64) MMRState {
+		peaks, err := mmr.PeakHashes(s, mmrSize-1)
+		require.NoError(t, err)
+		return MMRState{Version: int(MMRStateVersion2), MMRSize: mmrSize, Peaks: peaks, Timestamp: 1234}
+	}
+
+	signer := log.signer
+	toState := stateAt(head.RangeCount())
+	toSeal, err := signer.SealedState(tenant, uint64(head.Start.MassifIndex), toState)
+	require.NoError(t, err)
+
+	for _, fromLeaves := range []uint64{1, 3, 4, 9, 20, 27} {
+		fromState := stateAt(mmr.FirstMMRSize(mmr.MMRIndex(fromLeaves - 1)))
+
+		receipt, err := NewConsistencyReceipt(fromState, toSeal, s)
+		require.NoError(t, err)
+
+		// The receipt is verified in its transported form
+		data, err := receipt.MarshalCBOR()
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+			data, commoncose.WithDecOptions(CheckpointDecOptions()))
+		require.NoError(t, err)
+
+		ok, verified, err := VerifySignedConsistencyReceipt(ctx, decoded, fromState)
+		require.NoError(t, err, "from %d", fromState.MMRSize)
+		assert.True(t, ok)
+		assert.Equal(t, toState.MMRSize, verified.MMRSize)
+		assert.Equal(t, toState.Peaks, verified.Peaks)
+	}
+
+	fromState := stateAt(mmr.FirstMMRSize(mmr.MMRIndex(10)))
+	receipt, err := NewConsistencyReceipt(fromState, toSeal, s)
+	require.NoError(t, err)
+	data, err := receipt.MarshalCBOR()
+	require.NoError(t, err)
+
+	verify := func(from MMRState) error {
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+			data, commoncose.WithDecOptions(CheckpointDecOptions()))
+		require.NoError(t, err)
+		ok, _, err := VerifySignedConsistencyReceipt(ctx, decoded, from)
+		assert.False(t, ok)
+		return err
+	}
+
+	// A from state which is not in the log
+	forked := fromState
+	forked.Peaks = append([][]byte{}, fromState.Peaks...)
+	forked.Peaks[0] = bytes.Repeat([]byte{1}, 32)
+	// Depending on the peak, the recovered accumulator either has the wrong
+	// shape or the wrong values
+	assert.Error(t, verify(forked))
+
+	// A from state for a different size
+	assert.ErrorIs(t, verify(stateAt(mmr.FirstMMRSize(mmr.MMRIndex(11)))), ErrConsistencyProofCheck)
+
+	_, err = NewConsistencyReceipt(toState, &SealedState{MMRState: fromState}, s)
+	assert.ErrorIs(t, err, ErrStateSizeOrder)
+}
@@ -0,0 +1,134 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrRefreshSealTooOld = errors.New("the seal does not commit the peak proven by the receipt")
+)
+
+// RefreshReceipt upgrades an MMRIVER inclusion receipt, proving nodes against
+// an older accumulator peak, to a receipt against the peak which commits the
+// same nodes in the state signed by newerSeal.
+//
+// Because the accumulator peak proven by the old receipt is included in every
+// later state of the log, the refreshed path is the old path extended by the
+// inclusion path of the old peak (see mmr.InclusionProofLocalExtend). The
+// extension is computed once for each distinct old peak, so the cost is log(n)
+// regardless of how many nodes the receipt proves. The
+// result is attached to the pre-signed receipt for the new peak, taken from
+// newerSeal. The newer seal must be for a log of the same hash algorithm as
+// the receipt.
+//
+// The old receipt must be in its transported form, as the proofs are read
+// from the encoded unprotected headers. A receipt carrying a multi-proof is
+// refreshed to a multi-proof. The old receipt is not verified, but a receipt
+// whose paths are not valid will not verify after being refreshed.
+func RefreshReceipt(
+	oldReceipt *commoncose.CoseSign1Message, newerSeal *SealedState, store NodeGetter,
+) (*commoncose.CoseSign1Message, error) {
+
+	var header MMRiverVerifiableProofsHeader
+	err := cbor.Unmarshal(oldReceipt.Headers.RawUnprotected, &header)
+	if err != nil {
+		return nil, fmt.Errorf("MMRIVER receipt proofs malformed")
+	}
+	proofs := header.VerifiableProofs.InclusionProofs
+	multi := header.VerifiableProofs.MultiInclusionProof
+	if len(proofs) == 0 && multi != nil {
+		if proofs, err = multi.InclusionProofs(); err != nil {
+			return nil, err
+		}
+	}
+	if len(proofs) == 0 {
+		return nil, fmt.Errorf("MMRIVER receipt inclusion proofs not present")
+	}
+
+	hashAlg, err := ReceiptHashAlg(oldReceipt)
+	if err != nil {
+		return nil, err
+	}
+	if hashAlg != newerSeal.MMRState.HashAlg {
+		return nil, fmt.Errorf(
+			"%w: receipt %v, seal %v", ErrHashAlgMismatch, hashAlg, newerSeal.MMRState.HashAlg)
+	}
+
+	mmrSize := newerSeal.MMRState.MMRSize
+	leafCount := mmr.LeafCount(mmrSize)
+
+	peakIndex := -1
+	extensions := map[uint64][][]byte{}
+	refreshed := make([]MMRiverInclusionProof, len(proofs))
+	for j, proof := range proofs {
+
+		oldPeak := mmr.IncludedRootIndex(proof.Index, len(proof.InclusionPath))
+		if oldPeak >= mmrSize {
+			return nil, fmt.Errorf(
+				"%w: peak %d for %d is not in MMR(%d)", ErrRefreshSealTooOld, oldPeak, proof.Index, mmrSize)
+		}
+		extension, ok := extensions[oldPeak]
+		if !ok {
+			if extension, err = extendFromPeak(store, oldPeak, mmrSize); err != nil {
+				return nil, fmt.Errorf(
+					"failed to extend the proof for %d from peak %d in MMR(%d): %w",
+					proof.Index, oldPeak, mmrSize, err)
+			}
+			extensions[oldPeak] = extension
+		}
+
+		path := append(append([][]byte{}, proof.InclusionPath...), extension...)
+		refreshed[j] = MMRiverInclusionProof{Index: proof.Index, InclusionPath: path}
+
+		// All the proofs in a receipt lead to the same peak
+		p := mmr.PeakIndex(leafCount, int(mmr.IndexHeight(proof.Index))+len(path))
+		if peakIndex != -1 && p != peakIndex {
+			return nil, fmt.Errorf(
+				"%w: %d and %d in MMR(%d)", ErrBatchReceiptPeak, proofs[0].Index, proof.Index, mmrSize)
+		}
+		peakIndex = p
+	}
+
+	signed, err := signedPeakReceipt(&newerSeal.Sign1Message, peakIndex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: in MMR(%d)", err, mmrSize)
+	}
+
+	verifiableProofs := MMRiverVerifiableProofs{InclusionProofs: refreshed}
+	if multi != nil && len(header.VerifiableProofs.InclusionProofs) == 0 {
+		packed, err := packMultiInclusionProof(mmrSize, refreshed)
+		if err != nil {
+			return nil, err
+		}
+		verifiableProofs = MMRiverVerifiableProofs{MultiInclusionProof: &packed}
+	}
+	signed.Headers.Unprotected[VDSCoseReceiptProofsTag] = verifiableProofs
+
+	return signed, nil
+}
+
+// extendFromPeak returns the inclusion path, in MMR(mmrSize), of a node which
+// was a peak of an earlier state. The node is the last node of MMR(peak+1), so
+// it is a peak of that state, and the extension is the part of a path which is
+// only in MMR(mmrSize). The local extension is computed from a leaf, the first
+// leaf committed by the peak.
+func extendFromPeak(store NodeGetter, peak uint64, mmrSize uint64) ([][]byte, error) {
+	if peak+1 == mmrSize {
+		return nil, nil
+	}
+	leaf := peak + 2 - (2 << mmr.IndexHeight(peak))
+	local, err := mmr.InclusionProofLocalExtend(peak+1, mmrSize, store, leaf)
+	if err != nil {
+		return nil, err
+	}
+	if local.PeakIndexB == peak {
+		// The peak is still a peak
+		return nil, nil
+	}
+	return local.Path[local.HeightA:], nil
+}
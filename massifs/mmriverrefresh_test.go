@@ -0,0 +1,153 @@
+package massifs
+
+import (
+	"testing"
+
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshReceipt(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 8
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 27))
+	reader := NewMassifReader(nil, log.store)
+	mc, err := reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+
+	signer := log.signer
+	sealAt := func(leafCount uint64) *SealedState {
+		mmrSize := mmr.FirstMMRSize(mmr.MMRIndex(leafCount - 1))
+		peaks, err := mmr.PeakHashes(&mc, mmrSize-1)
+		require.NoError(t, err)
+		sealed, err := signer.SealedState(tenant, 0, MMRState{
+			Version: int(MMRStateVersion2), MMRSize: mmrSize, Peaks: peaks, Timestamp: 1234})
+		require.NoError(t, err)
+		return sealed
+	}
+	getterFor := func(sealed *SealedState) testVerifiedContextGetter {
+		return testVerifiedContextGetter{verified: &VerifiedContext{
+			MassifContext: mc, Sign1Message: sealed.Sign1Message, MMRState: sealed.MMRState}}
+	}
+	decode := func(receipt *commoncose.CoseSign1Message) *commoncose.CoseSign1Message {
+		data, err := receipt.MarshalCBOR()
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+			data, commoncose.WithDecOptions(CheckpointDecOptions()))
+		require.NoError(t, err)
+		return decoded
+	}
+	leafValue := func(leafIndex uint64) []byte {
+		value, err := mc.Get(mmr.MMRIndex(leafIndex))
+		require.NoError(t, err)
+		return value
+	}
+
+	oldSeal := sealAt(12)
+	newSeal := sealAt(27)
+
+	// Leaf 3 is committed by peak 14 in MMR(22), which is still a peak
+	for _, tt := range []struct {
+		leafIndex uint64
+		old, new  *SealedState
+	}{
+		{leafIndex: 0, old: oldSeal, new: newSeal},
+		{leafIndex: 7, old: oldSeal, new: newSeal},
+		{leafIndex: 9, old: oldSeal, new: newSeal},
+		{leafIndex: 10, old: oldSeal, new: newSeal},
+		{leafIndex: 3, old: sealAt(8), new: oldSeal},
+	} {
+		leafIndex, newSeal := tt.leafIndex, tt.new
+		mmrIndex := mmr.MMRIndex(leafIndex)
+		old, err := NewReceipt(ctx, massifHeight, tenant, mmrIndex, getterFor(tt.old))
+		require.NoError(t, err)
+
+		receipt, err := RefreshReceipt(decode(old), newSeal, &mc)
+		require.NoError(t, err)
+		receipt = decode(receipt)
+
+		ok, root, err := VerifySignedInclusionReceipt(ctx, receipt, leafValue(leafIndex))
+		require.NoError(t, err, "leaf %d", leafIndex)
+		assert.True(t, ok)
+
+		// The refreshed receipt is the receipt that would be issued against
+		// the newer seal.
+		expect, err := NewReceipt(ctx, massifHeight, tenant, mmrIndex, getterFor(newSeal))
+		require.NoError(t, err)
+		expect = decode(expect)
+		ok, expectRoot, err := VerifySignedInclusionReceipt(ctx, expect, leafValue(leafIndex))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, expectRoot, root)
+		assert.Equal(t, expect.Headers.RawUnprotected, receipt.Headers.RawUnprotected)
+	}
+
+	// A batch receipt is refreshed to a batch receipt
+	leaves := []uint64{8, 9, 11}
+	var candidates [][]byte
+	var mmrIndices []uint64
+	for _, leafIndex := range leaves {
+		mmrIndices = append(mmrIndices, mmr.MMRIndex(leafIndex))
+		candidates = append(candidates, leafValue(leafIndex))
+	}
+	old, err := NewBatchReceipt(ctx, massifHeight, tenant, mmrIndices, getterFor(oldSeal))
+	require.NoError(t, err)
+	counting := &countingNodeGetter{NodeGetter: &mc}
+	receipt, err := RefreshReceipt(decode(old), newSeal, counting)
+	require.NoError(t, err)
+	receipt = decode(receipt)
+
+	var header MMRiverVerifiableProofsHeader
+	require.NoError(t, cbor.Unmarshal(receipt.Headers.RawUnprotected, &header))
+	require.NotNil(t, header.VerifiableProofs.MultiInclusionProof)
+	assert.Equal(t, newSeal.MMRState.MMRSize, header.VerifiableProofs.MultiInclusionProof.TreeSize)
+
+	// The proofs share the old peak, so its extension is computed once, from a
+	// leaf committed by the peak
+	var oldHeader MMRiverVerifiableProofsHeader
+	require.NoError(t, cbor.Unmarshal(decode(old).Headers.RawUnprotected, &oldHeader))
+	oldProofs, err := oldHeader.VerifiableProofs.MultiInclusionProof.InclusionProofs()
+	require.NoError(t, err)
+	newProofs, err := header.VerifiableProofs.MultiInclusionProof.InclusionProofs()
+	require.NoError(t, err)
+	extended := len(newProofs[0].InclusionPath) - len(oldProofs[0].InclusionPath)
+	assert.Positive(t, extended)
+	oldPeak := mmr.IncludedRootIndex(oldProofs[0].Index, len(oldProofs[0].InclusionPath))
+	assert.Equal(t, extended+int(mmr.IndexHeight(oldPeak)), counting.gets)
+
+	ok, _, err := VerifySignedInclusionReceipts(ctx, receipt, candidates)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The newer seal must commit the peak proven by the old receipt
+	old, err = NewReceipt(ctx, massifHeight, tenant, mmr.MMRIndex(10), getterFor(newSeal))
+	require.NoError(t, err)
+	_, err = RefreshReceipt(decode(old), oldSeal, &mc)
+	assert.ErrorIs(t, err, ErrRefreshSealTooOld)
+
+	// The newer seal must be for a log of the same hash algorithm
+	state := newSeal.MMRState
+	state.HashAlg = HashAlgSHA3_256
+	otherAlgSeal, err := signer.SealedState(tenant, 0, state)
+	require.NoError(t, err)
+	old, err = NewReceipt(ctx, massifHeight, tenant, mmr.MMRIndex(7), getterFor(oldSeal))
+	require.NoError(t, err)
+	_, err = RefreshReceipt(decode(old), otherAlgSeal, &mc)
+	assert.ErrorIs(t, err, ErrHashAlgMismatch)
+}
+
+// countingNodeGetter counts the nodes read
+type countingNodeGetter struct {
+	NodeGetter
+	gets int
+}
+
+func (g *countingNodeGetter) Get(i uint64) ([]byte, error) {
+	g.gets++
+	return g.NodeGetter.Get(i)
+}
@@ -4,7 +4,7 @@ package mocks
 
 import (
 	context "context"
-	ecdsa "crypto/ecdsa"
+	crypto "crypto"
 
 	cose "github.com/veraison/go-cose"
 
@@ -73,23 +73,23 @@ func (_m *IdentifiableCoseSigner) KeyLocation() string {
 }
 
 // LatestPublicKey provides a mock function with no fields
-func (_m *IdentifiableCoseSigner) LatestPublicKey() (*ecdsa.PublicKey, error) {
+func (_m *IdentifiableCoseSigner) LatestPublicKey() (crypto.PublicKey, error) {
 	ret := _m.Called()
 
 	if len(ret) == 0 {
 		panic("no return value specified for LatestPublicKey")
 	}
 
-	var r0 *ecdsa.PublicKey
+	var r0 crypto.PublicKey
 	var r1 error
-	if rf, ok := ret.Get(0).(func() (*ecdsa.PublicKey, error)); ok {
+	if rf, ok := ret.Get(0).(func() (crypto.PublicKey, error)); ok {
 		return rf()
 	}
-	if rf, ok := ret.Get(0).(func() *ecdsa.PublicKey); ok {
+	if rf, ok := ret.Get(0).(func() crypto.PublicKey); ok {
 		r0 = rf()
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*ecdsa.PublicKey)
+			r0 = ret.Get(0).(crypto.PublicKey)
 		}
 	}
 
@@ -103,23 +103,23 @@ func (_m *IdentifiableCoseSigner) LatestPublicKey() (*ecdsa.PublicKey, error) {
 }
 
 // PublicKey provides a mock function with given fields: ctx, kid
-func (_m *IdentifiableCoseSigner) PublicKey(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
+func (_m *IdentifiableCoseSigner) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
 	ret := _m.Called(ctx, kid)
 
 	if len(ret) == 0 {
 		panic("no return value specified for PublicKey")
 	}
 
-	var r0 *ecdsa.PublicKey
+	var r0 crypto.PublicKey
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (*ecdsa.PublicKey, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) (crypto.PublicKey, error)); ok {
 		return rf(ctx, kid)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) *ecdsa.PublicKey); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) crypto.PublicKey); ok {
 		r0 = rf(ctx, kid)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*ecdsa.PublicKey)
+			r0 = ret.Get(0).(crypto.PublicKey)
 		}
 	}
 
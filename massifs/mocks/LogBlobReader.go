@@ -5,7 +5,7 @@ package mocks
 import (
 	context "context"
 
-	azblob "github.com/datatrails/go-datatrails-common/azblob"
+	massifs "github.com/datatrails/go-datatrails-merklelog/massifs"
 
 	mock "github.com/stretchr/testify/mock"
 )
@@ -16,7 +16,7 @@ type LogBlobReader struct {
 }
 
 // FilteredList provides a mock function with given fields: ctx, tagsFilter, opts
-func (_m *LogBlobReader) FilteredList(ctx context.Context, tagsFilter string, opts ...azblob.Option) (*azblob.FilterResponse, error) {
+func (_m *LogBlobReader) FilteredList(ctx context.Context, tagsFilter string, opts ...massifs.ObjectOption) (*massifs.ObjectListResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -30,20 +30,20 @@ func (_m *LogBlobReader) FilteredList(ctx context.Context, tagsFilter string, op
 		panic("no return value specified for FilteredList")
 	}
 
-	var r0 *azblob.FilterResponse
+	var r0 *massifs.ObjectListResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, ...azblob.Option) (*azblob.FilterResponse, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...massifs.ObjectOption) (*massifs.ObjectListResponse, error)); ok {
 		return rf(ctx, tagsFilter, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, ...azblob.Option) *azblob.FilterResponse); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...massifs.ObjectOption) *massifs.ObjectListResponse); ok {
 		r0 = rf(ctx, tagsFilter, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*azblob.FilterResponse)
+			r0 = ret.Get(0).(*massifs.ObjectListResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, ...azblob.Option) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...massifs.ObjectOption) error); ok {
 		r1 = rf(ctx, tagsFilter, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -52,36 +52,36 @@ func (_m *LogBlobReader) FilteredList(ctx context.Context, tagsFilter string, op
 	return r0, r1
 }
 
-// List provides a mock function with given fields: ctx, opts
-func (_m *LogBlobReader) List(ctx context.Context, opts ...azblob.Option) (*azblob.ListerResponse, error) {
+// Get provides a mock function with given fields: ctx, path, opts
+func (_m *LogBlobReader) Get(ctx context.Context, path string, opts ...massifs.ObjectOption) (*massifs.ObjectReadResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
 	}
 	var _ca []interface{}
-	_ca = append(_ca, ctx)
+	_ca = append(_ca, ctx, path)
 	_ca = append(_ca, _va...)
 	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
-		panic("no return value specified for List")
+		panic("no return value specified for Get")
 	}
 
-	var r0 *azblob.ListerResponse
+	var r0 *massifs.ObjectReadResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, ...azblob.Option) (*azblob.ListerResponse, error)); ok {
-		return rf(ctx, opts...)
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...massifs.ObjectOption) (*massifs.ObjectReadResponse, error)); ok {
+		return rf(ctx, path, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, ...azblob.Option) *azblob.ListerResponse); ok {
-		r0 = rf(ctx, opts...)
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...massifs.ObjectOption) *massifs.ObjectReadResponse); ok {
+		r0 = rf(ctx, path, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*azblob.ListerResponse)
+			r0 = ret.Get(0).(*massifs.ObjectReadResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, ...azblob.Option) error); ok {
-		r1 = rf(ctx, opts...)
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...massifs.ObjectOption) error); ok {
+		r1 = rf(ctx, path, opts...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -89,36 +89,36 @@ func (_m *LogBlobReader) List(ctx context.Context, opts ...azblob.Option) (*azbl
 	return r0, r1
 }
 
-// Reader provides a mock function with given fields: ctx, identity, opts
-func (_m *LogBlobReader) Reader(ctx context.Context, identity string, opts ...azblob.Option) (*azblob.ReaderResponse, error) {
+// List provides a mock function with given fields: ctx, opts
+func (_m *LogBlobReader) List(ctx context.Context, opts ...massifs.ObjectOption) (*massifs.ObjectListResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
 	}
 	var _ca []interface{}
-	_ca = append(_ca, ctx, identity)
+	_ca = append(_ca, ctx)
 	_ca = append(_ca, _va...)
 	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
-		panic("no return value specified for Reader")
+		panic("no return value specified for List")
 	}
 
-	var r0 *azblob.ReaderResponse
+	var r0 *massifs.ObjectListResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, ...azblob.Option) (*azblob.ReaderResponse, error)); ok {
-		return rf(ctx, identity, opts...)
+	if rf, ok := ret.Get(0).(func(context.Context, ...massifs.ObjectOption) (*massifs.ObjectListResponse, error)); ok {
+		return rf(ctx, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, ...azblob.Option) *azblob.ReaderResponse); ok {
-		r0 = rf(ctx, identity, opts...)
+	if rf, ok := ret.Get(0).(func(context.Context, ...massifs.ObjectOption) *massifs.ObjectListResponse); ok {
+		r0 = rf(ctx, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*azblob.ReaderResponse)
+			r0 = ret.Get(0).(*massifs.ObjectListResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, ...azblob.Option) error); ok {
-		r1 = rf(ctx, identity, opts...)
+	if rf, ok := ret.Get(1).(func(context.Context, ...massifs.ObjectOption) error); ok {
+		r1 = rf(ctx, opts...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -5,8 +5,6 @@ package mocks
 import (
 	context "context"
 
-	azblob "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
-
 	massifs "github.com/datatrails/go-datatrails-merklelog/massifs"
 
 	mock "github.com/stretchr/testify/mock"
@@ -18,7 +16,7 @@ type VisitFilterResponse struct {
 }
 
 // Execute provides a mock function with given fields: ctx, store, it
-func (_m *VisitFilterResponse) Execute(ctx context.Context, store massifs.LogBlobReader, it *azblob.FilterBlobItem) (bool, error) {
+func (_m *VisitFilterResponse) Execute(ctx context.Context, store massifs.LogBlobReader, it massifs.ObjectInfo) (bool, error) {
 	ret := _m.Called(ctx, store, it)
 
 	if len(ret) == 0 {
@@ -27,16 +25,16 @@ func (_m *VisitFilterResponse) Execute(ctx context.Context, store massifs.LogBlo
 
 	var r0 bool
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, massifs.LogBlobReader, *azblob.FilterBlobItem) (bool, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, massifs.LogBlobReader, massifs.ObjectInfo) (bool, error)); ok {
 		return rf(ctx, store, it)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, massifs.LogBlobReader, *azblob.FilterBlobItem) bool); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, massifs.LogBlobReader, massifs.ObjectInfo) bool); ok {
 		r0 = rf(ctx, store, it)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, massifs.LogBlobReader, *azblob.FilterBlobItem) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, massifs.LogBlobReader, massifs.ObjectInfo) error); ok {
 		r1 = rf(ctx, store, it)
 	} else {
 		r1 = ret.Error(1)
@@ -12,13 +12,13 @@ import (
 	mock "github.com/stretchr/testify/mock"
 )
 
-// MassifStore is an autogenerated mock type for the massifStore type
-type MassifStore struct {
+// AzblobStorer is an autogenerated mock type for the azblobStorer type
+type AzblobStorer struct {
 	mock.Mock
 }
 
 // FilteredList provides a mock function with given fields: ctx, tagsFilter, opts
-func (_m *MassifStore) FilteredList(ctx context.Context, tagsFilter string, opts ...azblob.Option) (*azblob.FilterResponse, error) {
+func (_m *AzblobStorer) FilteredList(ctx context.Context, tagsFilter string, opts ...azblob.Option) (*azblob.FilterResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -55,7 +55,7 @@ func (_m *MassifStore) FilteredList(ctx context.Context, tagsFilter string, opts
 }
 
 // List provides a mock function with given fields: ctx, opts
-func (_m *MassifStore) List(ctx context.Context, opts ...azblob.Option) (*azblob.ListerResponse, error) {
+func (_m *AzblobStorer) List(ctx context.Context, opts ...azblob.Option) (*azblob.ListerResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -92,7 +92,7 @@ func (_m *MassifStore) List(ctx context.Context, opts ...azblob.Option) (*azblob
 }
 
 // Put provides a mock function with given fields: ctx, identity, source, opts
-func (_m *MassifStore) Put(ctx context.Context, identity string, source io.ReadSeekCloser, opts ...azblob.Option) (*azblob.WriteResponse, error) {
+func (_m *AzblobStorer) Put(ctx context.Context, identity string, source io.ReadSeekCloser, opts ...azblob.Option) (*azblob.WriteResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -129,7 +129,7 @@ func (_m *MassifStore) Put(ctx context.Context, identity string, source io.ReadS
 }
 
 // Reader provides a mock function with given fields: ctx, identity, opts
-func (_m *MassifStore) Reader(ctx context.Context, identity string, opts ...azblob.Option) (*azblob.ReaderResponse, error) {
+func (_m *AzblobStorer) Reader(ctx context.Context, identity string, opts ...azblob.Option) (*azblob.ReaderResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -165,13 +165,13 @@ func (_m *MassifStore) Reader(ctx context.Context, identity string, opts ...azbl
 	return r0, r1
 }
 
-// NewMassifStore creates a new instance of MassifStore. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// NewAzblobStorer creates a new instance of AzblobStorer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
-func NewMassifStore(t interface {
+func NewAzblobStorer(t interface {
 	mock.TestingT
 	Cleanup(func())
-}) *MassifStore {
-	mock := &MassifStore{}
+}) *AzblobStorer {
+	mock := &AzblobStorer{}
 	mock.Mock.Test(t)
 
 	t.Cleanup(func() { mock.AssertExpectations(t) })
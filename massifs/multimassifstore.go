@@ -0,0 +1,129 @@
+package massifs
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+)
+
+const (
+	DefaultMultiMassifCacheSize = 8
+)
+
+// MassifGetter is satisfied by MassifReader and LocalReader
+type MassifGetter interface {
+	GetMassif(
+		ctx context.Context, tenantIdentity string, massifIndex uint64,
+		opts ...ReaderOption,
+	) (MassifContext, error)
+}
+
+// MultiMassifStore provides Get access to any node in a tenant's log.
+//
+// A MassifContext can only resolve the nodes in its own massif and the
+// ancestor peaks carried in its peak stack. That is sufficient for proofs
+// against the state sealed for that massif, but not for proofs against a
+// later tree size. MultiMassifStore loads the massif containing each requested
+// node on demand and retains the most recently used massifs, so it can be
+// passed directly to mmr.InclusionProof (and the other mmr functions which
+// accept a node store) for any tree size in the log.
+//
+// The context provided on construction is used for all reads, as the mmr
+// store interface does not accept one. A MultiMassifStore is not safe for
+// concurrent use.
+type MultiMassifStore struct {
+	ctx            context.Context
+	getter         MassifGetter
+	tenantIdentity string
+	massifHeight   uint8
+	logConfig      *LogConfig
+	opts           []ReaderOption
+
+	cacheSize int
+	// lru holds *cachedMassif values, most recently used first
+	lru     *list.List
+	massifs map[uint64]*list.Element
+}
+
+// cachedMassif retains the key a massif was cached under, so that it is
+// removed by the same key when evicted.
+type cachedMassif struct {
+	key uint64
+	mc  *MassifContext
+}
+
+// NewMultiMassifStore creates a store for the tenant's log. If cacheSize is
+// zero, DefaultMultiMassifCacheSize is used. The opts are forwarded to each
+// GetMassif call. If the opts include WithLogConfig, massifHeight is ignored
+// and nodes are located using the log configuration.
+func NewMultiMassifStore(
+	ctx context.Context, getter MassifGetter,
+	tenantIdentity string, massifHeight uint8, cacheSize int,
+	opts ...ReaderOption,
+) *MultiMassifStore {
+	if cacheSize <= 0 {
+		cacheSize = DefaultMultiMassifCacheSize
+	}
+	return &MultiMassifStore{
+		ctx:            ctx,
+		getter:         getter,
+		tenantIdentity: tenantIdentity,
+		massifHeight:   massifHeight,
+		logConfig:      NewReaderOptions(ReaderOptions{}, opts...).logConfig,
+		opts:           opts,
+		cacheSize:      cacheSize,
+		lru:            list.New(),
+		massifs:        make(map[uint64]*list.Element),
+	}
+}
+
+// Get returns the value of the node at mmr index i, reading the massif which
+// contains it if it is not already cached.
+func (s *MultiMassifStore) Get(i uint64) ([]byte, error) {
+
+	// Note: this works for interior nodes as well as leaves. An interior node
+	// is always stored in the same massif as the leaf whose addition created
+	// it.
+	massifIndex := s.logConfig.massifIndexFromMMRIndex(s.massifHeight, i)
+
+	mc, err := s.GetMassif(massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	if i >= mc.RangeCount() {
+		return nil, fmt.Errorf(
+			"%w: %d is not yet in massif %d (size %d)",
+			ErrGetIndexUnavailable, i, massifIndex, mc.RangeCount())
+	}
+	return mc.Get(i)
+}
+
+// GetMassif returns the massif context for massifIndex, from the cache if
+// possible.
+func (s *MultiMassifStore) GetMassif(massifIndex uint64) (*MassifContext, error) {
+
+	if e, ok := s.massifs[massifIndex]; ok {
+		s.lru.MoveToFront(e)
+		return e.Value.(*cachedMassif).mc, nil
+	}
+
+	mc, err := s.getter.GetMassif(s.ctx, s.tenantIdentity, massifIndex, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.massifs[massifIndex] = s.lru.PushFront(&cachedMassif{key: massifIndex, mc: &mc})
+	if s.lru.Len() > s.cacheSize {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.massifs, oldest.Value.(*cachedMassif).key)
+	}
+	return &mc, nil
+}
+
+// Reset discards all cached massifs. This is necessary to observe the
+// additions to a massif which was cached before it was full.
+func (s *MultiMassifStore) Reset() {
+	s.lru.Init()
+	clear(s.massifs)
+}
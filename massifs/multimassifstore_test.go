@@ -0,0 +1,110 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingGetter records the massifs read through it
+type countingGetter struct {
+	MassifGetter
+	reads []uint64
+}
+
+func (g *countingGetter) GetMassif(
+	ctx context.Context, tenantIdentity string, massifIndex uint64, opts ...ReaderOption,
+) (MassifContext, error) {
+	g.reads = append(g.reads, massifIndex)
+	return g.MassifGetter.GetMassif(ctx, tenantIdentity, massifIndex, opts...)
+}
+
+// TestMultiMassifStore_InclusionProof checks proofs for leaves in early
+// massifs against the size of the head massif, which can not be produced from
+// the head massif alone.
+func TestMultiMassifStore_InclusionProof(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+	leafCount := uint64(37)
+	leaves := testLeafEntries(0, leafCount)
+
+	log := newTestLog(t, tenant, massifHeight, leaves)
+	reader := NewMassifReader(nil, log.store)
+	head, err := reader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	mmrSize := head.RangeCount()
+	require.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(leafCount-1)), mmrSize)
+
+	getter := &countingGetter{MassifGetter: &reader}
+	s := NewMultiMassifStore(ctx, getter, tenant, massifHeight, 0)
+
+	for iLeaf := range leafCount {
+		mmrIndex := mmr.MMRIndex(iLeaf)
+
+		proof, err := mmr.InclusionProof(s, mmrSize-1, mmrIndex)
+		require.NoError(t, err)
+
+		// The peaks are available from the head massif alone
+		ok, err := mmr.VerifyInclusion(&head, sha256.New(), mmrSize, leaves[iLeaf].Value, mmrIndex, proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	// Every massif, apart from the head which only contains the last leaf, is
+	// needed and the cache prevents reading the massif for every node.
+	for massifIndex := range uint64(head.Start.MassifIndex) {
+		assert.Contains(t, getter.reads, massifIndex)
+	}
+	assert.Less(t, len(getter.reads), int(leafCount))
+
+	_, err = s.Get(mmrSize)
+	assert.ErrorIs(t, err, ErrGetIndexUnavailable)
+}
+
+func TestMultiMassifStore_LRU(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	log := newTestLog(t, tenant, 2, testLeafEntries(0, 8))
+	reader := NewMassifReader(nil, log.store)
+	getter := &countingGetter{MassifGetter: &reader}
+	s := NewMultiMassifStore(ctx, getter, tenant, 2, 2)
+
+	// 2 leaves per massif, the first node of massif n is at MMRIndex(2n)
+	for _, massifIndex := range []uint64{0, 1, 0, 2, 0, 1} {
+		_, err := s.Get(mmr.MMRIndex(2 * massifIndex))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 1}, getter.reads)
+
+	s.Reset()
+	_, err := s.Get(0)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2, 1, 0}, getter.reads)
+}
+
+// staleIndexGetter returns massifs whose start does not record the index they
+// were requested by
+type staleIndexGetter struct{}
+
+func (staleIndexGetter) GetMassif(
+	ctx context.Context, tenantIdentity string, massifIndex uint64, opts ...ReaderOption,
+) (MassifContext, error) {
+	return MassifContext{TenantIdentity: tenantIdentity}, nil
+}
+
+// TestMultiMassifStore_EvictByKey checks evicted massifs are removed by the
+// index they were cached under, not the index in their start header.
+func TestMultiMassifStore_EvictByKey(t *testing.T) {
+	s := NewMultiMassifStore(t.Context(), staleIndexGetter{}, "tenant/1", 3, 1)
+	for massifIndex := range uint64(3) {
+		_, err := s.GetMassif(massifIndex + 1)
+		require.NoError(t, err)
+	}
+	assert.Len(t, s.massifs, 1)
+	assert.Contains(t, s.massifs, uint64(3))
+}
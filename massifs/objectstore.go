@@ -0,0 +1,215 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+)
+
+// The object store abstraction decouples the massif committer and the log
+// readers from any specific blob storage service. The semantics are modeled on
+// the subset of azure blob storage that the log depends on:
+//
+//   - conditional puts, guarded by etag match or etag none match ("*" meaning
+//     "the object must not exist")
+//   - reads which return the content, etag, last modified time and, on request,
+//     the tags
+//   - lexically ordered, paged, listing of objects by path prefix
+//   - selection of objects by a filter expression over their tags
+//
+// Implementations are provided for azure blob storage, the local filesystem, an
+// in process memory store and S3 compatible object stores.
+
+var (
+	ErrObjectConditionNotMet = errors.New("the etag condition for the object was not met")
+	ErrObjectStoreReadOnly   = errors.New("the object store does not support writes")
+)
+
+const (
+	// ETagAny is used with WithETagNoneMatch to require that the object does
+	// not exist.
+	ETagAny = "*"
+)
+
+// RateLimitError is returned by stores which are rate limiting requests.
+// IsRateLimiting recognizes it. RetryAfter is zero if the store did not
+// indicate a wait time.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited: %v", e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// LogBlobReader provides the read only methods of an ObjectStore.
+type LogBlobReader interface {
+	Get(ctx context.Context, path string, opts ...ObjectOption) (*ObjectReadResponse, error)
+	List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error)
+	FilteredList(ctx context.Context, tagsFilter string, opts ...ObjectOption) (*ObjectListResponse, error)
+}
+
+// ObjectStore is the storage interface required by the massif committer.
+//
+// Put creates or replaces the object at path. Tags provided using WithPutTags
+// replace all existing tags. If an etag condition is provided, and it is not
+// met, implementations must return an error satisfying
+// errors.Is(err, ErrObjectConditionNotMet) and the object must not be modified.
+//
+// Get returns an error satisfying IsBlobNotFound if there is no object at path.
+type ObjectStore interface {
+	LogBlobReader
+	Put(ctx context.Context, path string, data []byte, opts ...ObjectOption) (*ObjectWriteResponse, error)
+}
+
+// ObjectInfo describes a stored object. Tags are only populated if they were
+// requested.
+type ObjectInfo struct {
+	Path          string
+	ETag          string
+	LastModified  time.Time
+	ContentLength int64
+	Tags          map[string]string
+}
+
+// ObjectReadResponse is returned by Get, the caller is responsible for closing
+// the Reader.
+type ObjectReadResponse struct {
+	ObjectInfo
+	Reader io.ReadCloser
+}
+
+type ObjectWriteResponse struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectListResponse is a single page of results from List or FilteredList. If
+// Marker is not empty, there are more results and it should be provided to the
+// next call using WithListMarker.
+type ObjectListResponse struct {
+	Marker string
+	Items  []ObjectInfo
+}
+
+// ObjectOptions are the options understood by ObjectStore implementations.
+// Implementations ignore options that do not apply to the method called.
+type ObjectOptions struct {
+	// Put
+	Tags map[string]string
+
+	// Get
+	GetTags bool
+
+	// Put and Get. At most one etag condition applies, the last option wins.
+	ETagMatch     string
+	ETagNoneMatch string
+
+	// List and FilteredList
+	ListPrefix      string
+	ListMarker      string
+	ListMaxResults  int32
+	ListIncludeTags bool
+}
+
+type ObjectOption func(*ObjectOptions)
+
+// NewObjectOptions applies opts to a zero ObjectOptions
+func NewObjectOptions(opts ...ObjectOption) ObjectOptions {
+	options := ObjectOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithPutTags sets the tags written with the object
+func WithPutTags(tags map[string]string) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.Tags = maps.Clone(tags)
+	}
+}
+
+// WithGetTags requests that Get returns the object tags
+func WithGetTags() ObjectOption {
+	return func(o *ObjectOptions) {
+		o.GetTags = true
+	}
+}
+
+// WithETagMatch requires that the object exists and its etag matches the
+// provided value.  Typically used to make optimistic concurrency updates safe.
+func WithETagMatch(etag string) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ETagMatch = etag
+		o.ETagNoneMatch = ""
+	}
+}
+
+// WithETagNoneMatch requires that the object etag does not match the provided
+// value. Use ETagAny to require that the object does not exist.
+func WithETagNoneMatch(etag string) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ETagNoneMatch = etag
+		o.ETagMatch = ""
+	}
+}
+
+// WithListPrefix restricts List to objects whose path starts with prefix. For
+// FilteredList it narrows the objects considered where the implementation
+// supports it.
+func WithListPrefix(prefix string) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ListPrefix = prefix
+	}
+}
+
+// WithListMarker continues a listing from the marker returned by the previous
+// page.
+func WithListMarker(marker string) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ListMarker = marker
+	}
+}
+
+// WithListMaxResults limits the page size
+func WithListMaxResults(maxResults int32) ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ListMaxResults = maxResults
+	}
+}
+
+// WithListTags requests that listed items include their tags
+func WithListTags() ObjectOption {
+	return func(o *ObjectOptions) {
+		o.ListIncludeTags = true
+	}
+}
+
+// checkETagCondition returns ErrObjectConditionNotMet if the etag conditions in
+// options are not satisfied. exists is false if there is no current object, in
+// which case etag is ignored.
+func checkETagCondition(options ObjectOptions, exists bool, etag string) error {
+	if options.ETagMatch != "" {
+		if !exists {
+			return fmt.Errorf("%w: %w", ErrObjectConditionNotMet, ErrBlobNotFound)
+		}
+		if options.ETagMatch != ETagAny && options.ETagMatch != etag {
+			return ErrObjectConditionNotMet
+		}
+	}
+	if options.ETagNoneMatch != "" && exists {
+		if options.ETagNoneMatch == ETagAny || options.ETagNoneMatch == etag {
+			return ErrObjectConditionNotMet
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objectStoreFactories provides the stores which can be tested without any
+// external service. The S3 store is covered separately using a fake server.
+func objectStoreFactories(t *testing.T) map[string]func() ObjectStore {
+	return map[string]func() ObjectStore{
+		"mem": func() ObjectStore { return NewMemObjectStore() },
+		"fs": func() ObjectStore {
+			s, err := NewFSObjectStore(t.TempDir())
+			require.NoError(t, err)
+			return s
+		},
+	}
+}
+
+func readObject(t *testing.T, store ObjectStore, path string, opts ...ObjectOption) (*ObjectReadResponse, []byte) {
+	rr, err := store.Get(t.Context(), path, opts...)
+	require.NoError(t, err)
+	defer rr.Reader.Close()
+	data, err := io.ReadAll(rr.Reader)
+	require.NoError(t, err)
+	return rr, data
+}
+
+func TestObjectStore_ConditionalPut(t *testing.T) {
+	for name, newStore := range objectStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			store := newStore()
+			path := "v1/mmrs/tenant/1/0/massifs/0000000000000000.log"
+
+			// etag match on a missing object fails
+			_, err := store.Put(ctx, path, []byte("x"), WithETagMatch("\"nope\""))
+			assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+			assert.ErrorIs(t, err, ErrBlobNotFound)
+
+			// create
+			wr1, err := store.Put(ctx, path, []byte("first"), WithETagNoneMatch(ETagAny),
+				WithPutTags(map[string]string{TagKeyFirstIndex: "0000000000000000"}))
+			require.NoError(t, err)
+			assert.NotEmpty(t, wr1.ETag)
+
+			// create again fails and does not modify
+			_, err = store.Put(ctx, path, []byte("racy"), WithETagNoneMatch(ETagAny))
+			assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+
+			// update with a stale etag fails
+			_, err = store.Put(ctx, path, []byte("stale"), WithETagMatch("\"stale\""))
+			assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+
+			rr, data := readObject(t, store, path, WithGetTags())
+			assert.Equal(t, []byte("first"), data)
+			assert.Equal(t, wr1.ETag, rr.ETag)
+			assert.Equal(t, int64(5), rr.ContentLength)
+			assert.Equal(t, "0000000000000000", rr.Tags[TagKeyFirstIndex])
+
+			// update with the current etag succeeds and changes the etag
+			wr2, err := store.Put(ctx, path, []byte("second"), WithETagMatch(wr1.ETag))
+			require.NoError(t, err)
+			assert.NotEqual(t, wr1.ETag, wr2.ETag)
+
+			// the tags are replaced by the put
+			rr, data = readObject(t, store, path, WithGetTags())
+			assert.Equal(t, []byte("second"), data)
+			assert.Empty(t, rr.Tags)
+
+			// conditional get
+			_, err = store.Get(ctx, path, WithETagMatch(wr1.ETag))
+			assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+			rr, _ = readObject(t, store, path, WithETagMatch(wr2.ETag))
+			assert.Nil(t, rr.Tags)
+
+			_, err = store.Get(ctx, "v1/mmrs/tenant/1/0/massifs/0000000000000001.log")
+			assert.True(t, IsBlobNotFound(err))
+		})
+	}
+}
+
+func TestObjectStore_List(t *testing.T) {
+	for name, newStore := range objectStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			store := newStore()
+
+			prefix := TenantMassifPrefix("tenant/1")
+			for i := range uint32(7) {
+				_, err := store.Put(ctx, TenantMassifBlobPath("tenant/1", uint64(i)), []byte{byte(i)})
+				require.NoError(t, err)
+			}
+			_, err := store.Put(ctx, TenantMassifSignedRootPath("tenant/1", 0), []byte{0})
+			require.NoError(t, err)
+			_, err = store.Put(ctx, TenantMassifBlobPath("tenant/2", 0), []byte{0})
+			require.NoError(t, err)
+
+			var paths []string
+			var marker string
+			pages := 0
+			for {
+				r, err := store.List(ctx, WithListPrefix(prefix), WithListMaxResults(3), WithListMarker(marker))
+				require.NoError(t, err)
+				for _, it := range r.Items {
+					paths = append(paths, it.Path)
+				}
+				pages++
+				marker = r.Marker
+				if marker == "" {
+					break
+				}
+			}
+			assert.Equal(t, 3, pages)
+			require.Len(t, paths, 7)
+			for i := range paths {
+				assert.Equal(t, TenantMassifBlobPath("tenant/1", uint64(i)), paths[i])
+			}
+
+			bc, count, err := LastPrefixedBlob(ctx, store, prefix, WithListMaxResults(2))
+			require.NoError(t, err)
+			assert.Equal(t, uint64(7), count)
+			assert.Equal(t, TenantMassifBlobPath("tenant/1", 6), bc.BlobPath)
+
+			bc, err = FirstPrefixedBlob(ctx, store, prefix)
+			require.NoError(t, err)
+			assert.Equal(t, TenantMassifBlobPath("tenant/1", 0), bc.BlobPath)
+		})
+	}
+}
+
+func TestObjectStore_FilteredList(t *testing.T) {
+	for name, newStore := range objectStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			store := newStore()
+
+			for i := range 5 {
+				tenant := fmt.Sprintf("tenant/%d", i)
+				_, err := store.Put(ctx, TenantMassifBlobPath(tenant, 0), []byte{0},
+					WithPutTags(map[string]string{TagKeyLastID: fmt.Sprintf("%016x", i)}))
+				require.NoError(t, err)
+			}
+			// no tags, never matches
+			_, err := store.Put(ctx, TenantMassifBlobPath("tenant/5", 0), []byte{0})
+			require.NoError(t, err)
+
+			r, err := store.FilteredList(ctx, fmt.Sprintf("\"%s\">='%016x'", TagKeyLastID, 2))
+			require.NoError(t, err)
+			require.Len(t, r.Items, 3)
+			for i, it := range r.Items {
+				assert.Equal(t, TenantMassifBlobPath(fmt.Sprintf("tenant/%d", i+2), 0), it.Path)
+				assert.Equal(t, fmt.Sprintf("%016x", i+2), it.Tags[TagKeyLastID])
+			}
+
+			found, marker, err := FilterBlobs(ctx, store, fmt.Sprintf("%s<'%016x'", TagKeyLastID, 2),
+				func(ctx context.Context, store LogBlobReader, it ObjectInfo) (bool, error) {
+					return it.Path != TenantMassifBlobPath("tenant/0", 0), nil
+				}, "")
+			require.NoError(t, err)
+			assert.Equal(t, "", marker)
+			require.Len(t, found, 1)
+			assert.Equal(t, TenantMassifBlobPath("tenant/1", 0), found[0].Path)
+
+			_, err = store.FilteredList(ctx, "lastid>")
+			assert.ErrorIs(t, err, ErrTagFilterInvalid)
+		})
+	}
+}
+
+func TestFSObjectStore_InvalidPaths(t *testing.T) {
+	store, err := NewFSObjectStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, path := range []string{"", "../escape", "/abs", "a/../../b", FSObjectMetaDir + "/x"} {
+		_, err := store.Put(t.Context(), path, []byte{0})
+		assert.ErrorIs(t, err, ErrObjectPathInvalid, path)
+	}
+}
+
+// TestMassifCommitter_ObjectStore checks the committer works with a store
+// other than azure blob storage, including the rollover to a new massif.
+func TestMassifCommitter_ObjectStore(t *testing.T) {
+	ctx := t.Context()
+	committer := NewMassifCommitter(MassifCommitterConfig{CommitmentEpoch: 1}, nil, NewMemObjectStore())
+
+	tenant := "tenant/1"
+	var massifHeight uint8 = 2 // 2 leaves per massif
+
+	for i := range uint64(5) {
+		mc, err := committer.GetCurrentContext(ctx, tenant, massifHeight)
+		require.NoError(t, err)
+
+		_, err = mc.AddHashedLeaf(
+			sha256.New(), i+1, nil, []byte("log"), []byte("app"),
+			[]byte(fmt.Sprintf("%032d", i)))
+		require.NoError(t, err)
+
+		_, err = committer.CommitContext(ctx, mc)
+		require.NoError(t, err)
+
+		// a second commit of the same context must fail on the etag
+		_, err = committer.CommitContext(ctx, mc)
+		assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+	}
+
+	_, count, err := committer.GetLastMassif(ctx, tenant)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+}
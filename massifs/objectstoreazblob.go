@@ -0,0 +1,236 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	azStorageBlob "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/datatrails/go-datatrails-common/azblob"
+)
+
+const (
+	azblobBlobAlreadyExists = "BlobAlreadyExists"
+)
+
+// azblobStorer is the subset of *azblob.Storer required to support ObjectStore
+type azblobStorer interface {
+	azblob.Reader
+	Put(
+		ctx context.Context,
+		identity string,
+		source io.ReadSeekCloser,
+		opts ...azblob.Option,
+	) (*azblob.WriteResponse, error)
+}
+
+// AzBlobObjectStore adapts the datatrails azure blob storer (or reader) to the
+// ObjectStore interface
+type AzBlobObjectStore struct {
+	reader azblob.Reader
+	storer azblobStorer
+}
+
+// NewAzBlobObjectStore returns an ObjectStore backed by azure blob storage.
+// Typically storer is an *azblob.Storer
+func NewAzBlobObjectStore(storer azblobStorer) *AzBlobObjectStore {
+	return &AzBlobObjectStore{reader: storer, storer: storer}
+}
+
+// NewAzBlobObjectReader returns a read only ObjectStore backed by azure blob
+// storage. Put returns ErrObjectStoreReadOnly
+func NewAzBlobObjectReader(reader azblob.Reader) *AzBlobObjectStore {
+	return &AzBlobObjectStore{reader: reader}
+}
+
+func (s *AzBlobObjectStore) Put(
+	ctx context.Context, path string, data []byte, opts ...ObjectOption,
+) (*ObjectWriteResponse, error) {
+
+	if s.storer == nil {
+		return nil, ErrObjectStoreReadOnly
+	}
+
+	options := NewObjectOptions(opts...)
+	var azopts []azblob.Option
+	if options.Tags != nil {
+		azopts = append(azopts, azblob.WithTags(options.Tags))
+	}
+	azopts = append(azopts, azblobETagOptions(options)...)
+
+	wr, err := s.storer.Put(ctx, path, azblob.NewBytesReaderCloser(data), azopts...)
+	if err != nil {
+		return nil, azblobConditionErr(err)
+	}
+
+	resp := &ObjectWriteResponse{}
+	if wr.ETag != nil {
+		resp.ETag = *wr.ETag
+	}
+	if wr.LastModified != nil {
+		resp.LastModified = *wr.LastModified
+	}
+	return resp, nil
+}
+
+func (s *AzBlobObjectStore) Get(
+	ctx context.Context, path string, opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
+
+	options := NewObjectOptions(opts...)
+	azopts := azblobETagOptions(options)
+	if options.GetTags {
+		azopts = append(azopts, azblob.WithGetTags())
+	}
+
+	rr, err := s.reader.Reader(ctx, path, azopts...)
+	if err != nil {
+		return nil, azblobConditionErr(WrapBlobNotFound(err))
+	}
+
+	resp := &ObjectReadResponse{
+		ObjectInfo: ObjectInfo{
+			Path:          path,
+			ContentLength: rr.ContentLength,
+			Tags:          rr.Tags,
+		},
+		Reader: rr.Reader,
+	}
+	if rr.ETag != nil {
+		resp.ETag = *rr.ETag
+	}
+	if rr.LastModified != nil {
+		resp.LastModified = *rr.LastModified
+	}
+	return resp, nil
+}
+
+func (s *AzBlobObjectStore) List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
+
+	options := NewObjectOptions(opts...)
+	azopts := azblobListOptions(options)
+	if options.ListPrefix != "" {
+		azopts = append(azopts, azblob.WithListPrefix(options.ListPrefix))
+	}
+	if options.ListIncludeTags {
+		azopts = append(azopts, azblob.WithListTags())
+	}
+
+	r, err := s.reader.List(ctx, azopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ObjectListResponse{Marker: azblobMarker(r.Marker)}
+	for _, it := range r.Items {
+		if it == nil || it.Name == nil {
+			continue
+		}
+		info := ObjectInfo{
+			Path: *it.Name,
+			Tags: listResponseTags(it.BlobTags),
+		}
+		if it.Properties != nil {
+			if it.Properties.Etag != nil {
+				info.ETag = *it.Properties.Etag
+			}
+			if it.Properties.LastModified != nil {
+				info.LastModified = *it.Properties.LastModified
+			}
+			if it.Properties.ContentLength != nil {
+				info.ContentLength = *it.Properties.ContentLength
+			}
+		}
+		resp.Items = append(resp.Items, info)
+	}
+	return resp, nil
+}
+
+// FilteredList uses the azure find blobs by tags api. Only the path and the
+// tags of the selected blobs are available in the returned items. The prefix
+// option is not supported by the azure api and is ignored.
+func (s *AzBlobObjectStore) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...ObjectOption,
+) (*ObjectListResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	r, err := s.reader.FilteredList(ctx, tagsFilter, azblobListOptions(options)...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ObjectListResponse{Marker: azblobMarker(r.Marker)}
+	for _, it := range r.Items {
+		if it == nil || it.Name == nil {
+			continue
+		}
+		resp.Items = append(resp.Items, ObjectInfo{
+			Path: *it.Name,
+			Tags: listResponseTags(it.Tags),
+		})
+	}
+	return resp, nil
+}
+
+func azblobETagOptions(options ObjectOptions) []azblob.Option {
+	var azopts []azblob.Option
+	if options.ETagMatch != "" {
+		azopts = append(azopts, azblob.WithEtagMatch(options.ETagMatch))
+	}
+	if options.ETagNoneMatch != "" {
+		azopts = append(azopts, azblob.WithEtagNoneMatch(options.ETagNoneMatch))
+	}
+	return azopts
+}
+
+func azblobListOptions(options ObjectOptions) []azblob.Option {
+	var azopts []azblob.Option
+	if options.ListMarker != "" {
+		marker := options.ListMarker
+		azopts = append(azopts, azblob.WithListMarker(&marker))
+	}
+	if options.ListMaxResults > 0 {
+		azopts = append(azopts, azblob.WithListMaxResults(options.ListMaxResults))
+	}
+	return azopts
+}
+
+func azblobMarker(marker azblob.ListMarker) string {
+	if marker == nil {
+		return ""
+	}
+	return *marker
+}
+
+// azblobConditionErr translates the azure errors for failed etag conditions
+// to ErrObjectConditionNotMet. Other errors are returned unchanged.
+func azblobConditionErr(err error) error {
+	var code string
+	var azerr *azblob.Error
+	if errors.As(err, &azerr) {
+		code = azerr.StorageErrorCode()
+	} else if serr, ok := AsStorageError(err); ok {
+		code = string(serr.ErrorCode)
+	}
+	switch code {
+	case string(azStorageBlob.StorageErrorCodeConditionNotMet), azblobBlobAlreadyExists:
+		return fmt.Errorf("%w: %w", ErrObjectConditionNotMet, err)
+	}
+	return err
+}
+
+func listResponseTags(blobTags *azStorageBlob.BlobTags) map[string]string {
+	if blobTags == nil {
+		return nil
+	}
+	tags := map[string]string{}
+	for _, tag := range blobTags.BlobTagSet {
+		if tag.Key == nil || tag.Value == nil {
+			continue
+		}
+		tags[*tag.Key] = *tag.Value
+	}
+	return tags
+}
@@ -0,0 +1,350 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FSObjectMetaDir is the directory, under the store root, which holds the
+	// etag and tags for each object. It is excluded from listings.
+	FSObjectMetaDir = ".objmeta"
+	fsObjectMetaExt = ".json"
+)
+
+var (
+	ErrObjectPathInvalid = errors.New("the object path is not valid for the store")
+)
+
+type fsObjectMeta struct {
+	ETag string            `json:"etag"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// FSObjectStore is an ObjectStore which keeps objects as files under a root
+// directory. Object paths map directly to file paths, so a store rooted at a
+// replica directory is laid out exactly as the remote log. The etag and tags
+// for each object are kept in a json sidecar file under FSObjectMetaDir.
+//
+// Conditional puts are safe for concurrent use by a single FSObjectStore
+// instance. They are not safe against concurrent writers in other processes.
+type FSObjectStore struct {
+	mu   sync.Mutex
+	root string
+}
+
+func NewFSObjectStore(root string) (*FSObjectStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &FSObjectStore{root: root}, nil
+}
+
+// Root returns the absolute path of the store root directory
+func (s *FSObjectStore) Root() string {
+	return s.root
+}
+
+func (s *FSObjectStore) Put(
+	ctx context.Context, objectPath string, data []byte, opts ...ObjectOption,
+) (*ObjectWriteResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	filePath, metaPath, err := s.filePaths(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists := true
+	fi, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		exists = false
+	} else if err != nil {
+		return nil, err
+	}
+	var etag string
+	if exists {
+		if etag, _, err = s.readMeta(filePath, metaPath, fi); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkETagCondition(options, exists, etag); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, objectPath)
+	}
+
+	lastModified := time.Now()
+	meta := fsObjectMeta{
+		ETag: fsObjectETag(data, lastModified),
+		Tags: options.Tags,
+	}
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data is written first. If we crash before the meta data is written,
+	// the stale etag will not match the content and the etag is recovered from
+	// the content on the next read.
+	if err = writeFileAtomic(filePath, data); err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(metaPath, metaData); err != nil {
+		return nil, err
+	}
+
+	return &ObjectWriteResponse{ETag: meta.ETag, LastModified: lastModified}, nil
+}
+
+func (s *FSObjectStore) Get(
+	ctx context.Context, objectPath string, opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	filePath, metaPath, err := s.filePaths(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, objectPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	etag, tags, err := s.readMeta(filePath, metaPath, fi)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = checkETagCondition(options, true, etag); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", err, objectPath)
+	}
+
+	rr := &ObjectReadResponse{
+		ObjectInfo: ObjectInfo{
+			Path:          objectPath,
+			ETag:          etag,
+			LastModified:  fi.ModTime(),
+			ContentLength: fi.Size(),
+		},
+		Reader: f,
+	}
+	if options.GetTags {
+		rr.Tags = tags
+	}
+	return rr, nil
+}
+
+func (s *FSObjectStore) List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
+	options := NewObjectOptions(opts...)
+	return s.list(options, options.ListIncludeTags, nil)
+}
+
+func (s *FSObjectStore) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...ObjectOption,
+) (*ObjectListResponse, error) {
+
+	filter, err := ParseTagFilter(tagsFilter)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(NewObjectOptions(opts...), true, filter)
+}
+
+func (s *FSObjectStore) list(options ObjectOptions, includeTags bool, filter TagFilter) (*ObjectListResponse, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the directory containing the prefix needs to be walked
+	walkRoot := s.root
+	if dir := path.Dir(options.ListPrefix); dir != "." && dir != "/" {
+		walkRoot = filepath.Join(s.root, filepath.FromSlash(dir))
+	}
+
+	type listed struct {
+		info ObjectInfo
+		tags map[string]string
+	}
+	found := map[string]listed{}
+	var paths []string
+
+	err := filepath.WalkDir(walkRoot, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		objectPath := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if objectPath == FSObjectMetaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(filepath.Base(filePath), ".") {
+			// temporary files from interrupted writes
+			return nil
+		}
+		if !strings.HasPrefix(objectPath, options.ListPrefix) || objectPath <= options.ListMarker {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		etag, tags, err := s.readMeta(filePath, s.metaPath(objectPath), fi)
+		if err != nil {
+			return err
+		}
+		if filter != nil && !filter.Match(tags) {
+			return nil
+		}
+		found[objectPath] = listed{
+			info: ObjectInfo{
+				Path:          objectPath,
+				ETag:          etag,
+				LastModified:  fi.ModTime(),
+				ContentLength: fi.Size(),
+			},
+			tags: tags,
+		}
+		paths = append(paths, objectPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	return pageObjectPaths(paths, options, func(objectPath string) ObjectInfo {
+		l := found[objectPath]
+		if includeTags {
+			l.info.Tags = l.tags
+			if l.info.Tags == nil {
+				l.info.Tags = map[string]string{}
+			}
+		}
+		return l.info
+	}), nil
+}
+
+func (s *FSObjectStore) filePaths(objectPath string) (string, string, error) {
+	if objectPath == "" || !fs.ValidPath(objectPath) {
+		return "", "", fmt.Errorf("%w: %s", ErrObjectPathInvalid, objectPath)
+	}
+	if strings.HasPrefix(objectPath, FSObjectMetaDir+"/") || strings.HasPrefix(path.Base(objectPath), ".") {
+		return "", "", fmt.Errorf("%w: %s", ErrObjectPathInvalid, objectPath)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(objectPath)), s.metaPath(objectPath), nil
+}
+
+func (s *FSObjectStore) metaPath(objectPath string) string {
+	return filepath.Join(s.root, FSObjectMetaDir, filepath.FromSlash(objectPath)+fsObjectMetaExt)
+}
+
+// readMeta returns the etag and tags for the object. Files which were not
+// written by the store, or whose meta data was not written due to a crash, get
+// an etag derived from the content and modification time, and have no tags.
+func (s *FSObjectStore) readMeta(filePath, metaPath string, fi fs.FileInfo) (string, map[string]string, error) {
+
+	b, err := os.ReadFile(metaPath)
+	if err == nil {
+		meta := fsObjectMeta{}
+		if err = json.Unmarshal(b, &meta); err != nil {
+			return "", nil, err
+		}
+		mi, err := os.Stat(metaPath)
+		if err != nil {
+			return "", nil, err
+		}
+		// If the data was modified after the meta data, the meta data is stale
+		if !mi.ModTime().Before(fi.ModTime()) {
+			return meta.ETag, meta.Tags, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	return fsObjectETag(data, fi.ModTime()), nil, nil
+}
+
+func fsObjectETag(data []byte, lastModified time.Time) string {
+	h := sha256.New()
+	h.Write(data)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(lastModified.UnixNano()))
+	h.Write(b[:])
+	return "\"" + hex.EncodeToString(h.Sum(nil)[:16]) + "\""
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over filePath.
+func writeFileAtomic(filePath string, data []byte) error {
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer os.Remove(tmpName) // a no-op once renamed
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filePath)
+}
@@ -0,0 +1,167 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultListMaxResults is the page size used by the non azure stores when
+	// WithListMaxResults is not provided. It matches the azure default.
+	DefaultListMaxResults = 5000
+)
+
+type memObject struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	tags         map[string]string
+}
+
+// MemObjectStore is an in process ObjectStore. It is safe for concurrent use
+// and is intended for tests and for tools which stage log data in memory.
+type MemObjectStore struct {
+	mu         sync.Mutex
+	objects    map[string]*memObject
+	generation uint64
+}
+
+func NewMemObjectStore() *MemObjectStore {
+	return &MemObjectStore{objects: map[string]*memObject{}}
+}
+
+func (s *MemObjectStore) Put(
+	ctx context.Context, path string, data []byte, opts ...ObjectOption,
+) (*ObjectWriteResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, exists := s.objects[path]
+	var etag string
+	if exists {
+		etag = cur.etag
+	}
+	if err := checkETagCondition(options, exists, etag); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, path)
+	}
+
+	s.generation++
+	obj := &memObject{
+		data:         bytes.Clone(data),
+		etag:         fmt.Sprintf("\"0x%X\"", s.generation),
+		lastModified: time.Now(),
+		tags:         maps.Clone(options.Tags),
+	}
+	s.objects[path] = obj
+
+	return &ObjectWriteResponse{ETag: obj.etag, LastModified: obj.lastModified}, nil
+}
+
+func (s *MemObjectStore) Get(
+	ctx context.Context, path string, opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, exists := s.objects[path]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, path)
+	}
+	if err := checkETagCondition(options, exists, obj.etag); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, path)
+	}
+
+	rr := &ObjectReadResponse{
+		ObjectInfo: s.info(path, obj, options.GetTags),
+		// the stored data is never modified in place, so it is safe to share
+		Reader: io.NopCloser(bytes.NewReader(obj.data)),
+	}
+	return rr, nil
+}
+
+func (s *MemObjectStore) List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
+	options := NewObjectOptions(opts...)
+	return s.list(options, options.ListIncludeTags, nil), nil
+}
+
+func (s *MemObjectStore) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...ObjectOption,
+) (*ObjectListResponse, error) {
+
+	filter, err := ParseTagFilter(tagsFilter)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(NewObjectOptions(opts...), true, filter), nil
+}
+
+func (s *MemObjectStore) list(options ObjectOptions, includeTags bool, filter TagFilter) *ObjectListResponse {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	for path, obj := range s.objects {
+		if !strings.HasPrefix(path, options.ListPrefix) || path <= options.ListMarker {
+			continue
+		}
+		if filter != nil && !filter.Match(obj.tags) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	return pageObjectPaths(paths, options, func(path string) ObjectInfo {
+		return s.info(path, s.objects[path], includeTags)
+	})
+}
+
+func (s *MemObjectStore) info(path string, obj *memObject, includeTags bool) ObjectInfo {
+	info := ObjectInfo{
+		Path:          path,
+		ETag:          obj.etag,
+		LastModified:  obj.lastModified,
+		ContentLength: int64(len(obj.data)),
+	}
+	if includeTags {
+		info.Tags = maps.Clone(obj.tags)
+		if info.Tags == nil {
+			info.Tags = map[string]string{}
+		}
+	}
+	return info
+}
+
+// pageObjectPaths returns the first page of the sorted paths. paths must
+// already exclude those at or before the options marker.
+func pageObjectPaths(paths []string, options ObjectOptions, info func(path string) ObjectInfo) *ObjectListResponse {
+
+	maxResults := int(options.ListMaxResults)
+	if maxResults <= 0 {
+		maxResults = DefaultListMaxResults
+	}
+
+	resp := &ObjectListResponse{}
+	if len(paths) > maxResults {
+		paths = paths[:maxResults]
+		resp.Marker = paths[len(paths)-1]
+	}
+	for _, path := range paths {
+		resp.Items = append(resp.Items, info(path))
+	}
+	return resp
+}
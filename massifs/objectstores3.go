@@ -0,0 +1,466 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service        = "s3"
+	s3SignAlgorithm  = "AWS4-HMAC-SHA256"
+	s3AmzDateFormat  = "20060102T150405Z"
+	s3MetaPrefix     = "x-amz-meta-"
+	s3MaxErrorDetail = 1024
+)
+
+var (
+	ErrS3ConfigInvalid  = errors.New("invalid s3 object store configuration")
+	ErrS3RequestFailed  = errors.New("s3 request failed")
+	ErrS3TagKeyReserved = errors.New("tag keys must be lower case for s3 user metadata")
+)
+
+// S3ObjectStoreConfig configures an S3ObjectStore.
+//
+// Endpoint is the scheme and host of the service, for example
+// https://s3.eu-west-2.amazonaws.com or http://localhost:9000 for a local
+// minio. PathStyle addresses the bucket as the first path segment rather than
+// as a sub domain of the endpoint, most non aws services require it.
+type S3ObjectStoreConfig struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PathStyle       bool
+	HTTPClient      *http.Client
+}
+
+// S3ObjectStore is an ObjectStore for S3 compatible services. It depends only
+// on the standard library and signs requests with AWS signature version 4.
+//
+// Tags are stored as object user metadata (x-amz-meta-*), which is returned
+// with the object and is written atomically with it. S3 lower cases metadata
+// keys, so tag keys must be lower case. S3 has no tag index, so FilteredList
+// lists the objects (restricted by WithListPrefix) and evaluates the filter
+// against the metadata of each. Conditional puts require a service which
+// supports If-Match and If-None-Match on PutObject.
+type S3ObjectStore struct {
+	cfg      S3ObjectStoreConfig
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3ObjectStore(cfg S3ObjectStoreConfig) (*S3ObjectStore, error) {
+	if cfg.Bucket == "" || cfg.Region == "" || cfg.Endpoint == "" {
+		return nil, fmt.Errorf("%w: endpoint, region and bucket are required", ErrS3ConfigInvalid)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrS3ConfigInvalid, err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must include the scheme and host", ErrS3ConfigInvalid)
+	}
+	s := &S3ObjectStore{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   cfg.HTTPClient,
+		now:      time.Now,
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	return s, nil
+}
+
+func (s *S3ObjectStore) Put(
+	ctx context.Context, path string, data []byte, opts ...ObjectOption,
+) (*ObjectWriteResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	header := http.Header{}
+	for k, v := range options.Tags {
+		if k != strings.ToLower(k) {
+			return nil, fmt.Errorf("%w: %s", ErrS3TagKeyReserved, k)
+		}
+		header.Set(s3MetaPrefix+k, v)
+	}
+	s3ETagHeaders(header, options)
+
+	resp, err := s.do(ctx, http.MethodPut, path, nil, header, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err = s3ResponseErr(resp, http.MethodPut, path); err != nil {
+		return nil, err
+	}
+
+	wr := &ObjectWriteResponse{ETag: resp.Header.Get("ETag")}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		wr.LastModified = lm
+	} else {
+		wr.LastModified = s.now()
+	}
+	return wr, nil
+}
+
+func (s *S3ObjectStore) Get(
+	ctx context.Context, path string, opts ...ObjectOption,
+) (*ObjectReadResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	header := http.Header{}
+	s3ETagHeaders(header, options)
+
+	resp, err := s.do(ctx, http.MethodGet, path, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = s3ResponseErr(resp, http.MethodGet, path); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	rr := &ObjectReadResponse{
+		ObjectInfo: s3ObjectInfo(path, resp.Header, options.GetTags),
+		Reader:     resp.Body,
+	}
+	// The length is -1 if it is not known, for example for chunked
+	// responses, BlobRead then reads to the end of the body.
+	rr.ContentLength = resp.ContentLength
+	return rr, nil
+}
+
+func (s *S3ObjectStore) List(ctx context.Context, opts ...ObjectOption) (*ObjectListResponse, error) {
+
+	options := NewObjectOptions(opts...)
+
+	page, err := s.listPage(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ObjectListResponse{Marker: page.marker}
+	for _, info := range page.items {
+		if options.ListIncludeTags {
+			if info.Tags, err = s.headTags(ctx, info.Path); err != nil {
+				return nil, err
+			}
+		}
+		resp.Items = append(resp.Items, info)
+	}
+	return resp, nil
+}
+
+// FilteredList evaluates the filter against each listed object. Pages which
+// contain no matches are skipped, so a response with no items is only
+// returned when the listing is exhausted.
+func (s *S3ObjectStore) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...ObjectOption,
+) (*ObjectListResponse, error) {
+
+	filter, err := ParseTagFilter(tagsFilter)
+	if err != nil {
+		return nil, err
+	}
+	options := NewObjectOptions(opts...)
+
+	resp := &ObjectListResponse{}
+	for {
+		page, err := s.listPage(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range page.items {
+			if info.Tags, err = s.headTags(ctx, info.Path); err != nil {
+				return nil, err
+			}
+			if filter.Match(info.Tags) {
+				resp.Items = append(resp.Items, info)
+			}
+		}
+		resp.Marker = page.marker
+		if len(resp.Items) > 0 || page.marker == "" {
+			return resp, nil
+		}
+		options.ListMarker = page.marker
+	}
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+type s3ListPage struct {
+	marker string
+	items  []ObjectInfo
+}
+
+func (s *S3ObjectStore) listPage(ctx context.Context, options ObjectOptions) (s3ListPage, error) {
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	if options.ListPrefix != "" {
+		query.Set("prefix", options.ListPrefix)
+	}
+	if options.ListMarker != "" {
+		query.Set("continuation-token", options.ListMarker)
+	}
+	if options.ListMaxResults > 0 {
+		query.Set("max-keys", strconv.Itoa(int(options.ListMaxResults)))
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, "", query, http.Header{}, nil)
+	if err != nil {
+		return s3ListPage{}, err
+	}
+	defer resp.Body.Close()
+	if err = s3ResponseErr(resp, http.MethodGet, options.ListPrefix); err != nil {
+		return s3ListPage{}, err
+	}
+
+	result := s3ListBucketResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return s3ListPage{}, err
+	}
+
+	page := s3ListPage{}
+	if result.IsTruncated {
+		page.marker = result.NextContinuationToken
+	}
+	for _, c := range result.Contents {
+		page.items = append(page.items, ObjectInfo{
+			Path:          c.Key,
+			ETag:          c.ETag,
+			LastModified:  c.LastModified,
+			ContentLength: c.Size,
+		})
+	}
+	return page, nil
+}
+
+func (s *S3ObjectStore) headTags(ctx context.Context, path string) (map[string]string, error) {
+	resp, err := s.do(ctx, http.MethodHead, path, nil, http.Header{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err = s3ResponseErr(resp, http.MethodHead, path); err != nil {
+		return nil, err
+	}
+	return s3ObjectInfo(path, resp.Header, true).Tags, nil
+}
+
+func (s *S3ObjectStore) objectURL(path string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + path
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + path
+	}
+	u.RawPath = s3EncodePath(u.Path)
+	u.RawQuery = s3EncodeQuery(query)
+	return &u
+}
+
+func (s *S3ObjectStore) do(
+	ctx context.Context, method, path string, query url.Values, header http.Header, body []byte,
+) (*http.Response, error) {
+
+	u := s.objectURL(path, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, u, body)
+	return s.client.Do(req)
+}
+
+// sign adds the AWS signature version 4 authorization to the request. All the
+// headers set on the request are signed.
+func (s *S3ObjectStore) sign(req *http.Request, u *url.URL, body []byte) {
+
+	now := s.now().UTC()
+	amzDate := now.Format(s3AmzDateFormat)
+	date := amzDate[:8]
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("x-amz-date", amzDate)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.cfg.SessionToken)
+	}
+	req.Host = u.Host
+
+	names := []string{"host"}
+	values := map[string]string{"host": u.Host}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		names = append(names, name)
+		values[name] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		u.RawPath,
+		u.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.cfg.Region + "/" + s3Service + "/aws4_request"
+	stringToSign := s3SignAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := s3HMAC([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = s3HMAC(key, s.cfg.Region)
+	key = s3HMAC(key, s3Service)
+	key = s3HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgorithm, s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3ETagHeaders(header http.Header, options ObjectOptions) {
+	if options.ETagMatch != "" {
+		header.Set("If-Match", options.ETagMatch)
+	}
+	if options.ETagNoneMatch != "" {
+		header.Set("If-None-Match", options.ETagNoneMatch)
+	}
+}
+
+func s3ObjectInfo(path string, header http.Header, includeTags bool) ObjectInfo {
+	info := ObjectInfo{
+		Path: path,
+		ETag: header.Get("ETag"),
+	}
+	if lm, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		info.LastModified = lm
+	}
+	if cl, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		info.ContentLength = cl
+	}
+	if includeTags {
+		info.Tags = map[string]string{}
+		for k, v := range header {
+			name := strings.ToLower(k)
+			if strings.HasPrefix(name, s3MetaPrefix) && len(v) > 0 {
+				info.Tags[strings.TrimPrefix(name, s3MetaPrefix)] = v[0]
+			}
+		}
+	}
+	return info
+}
+
+// s3ResponseErr translates the response status to the errors defined for
+// ObjectStore. nil is returned for success.
+func s3ResponseErr(resp *http.Response, method, path string) error {
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, s3MaxErrorDetail))
+	err := fmt.Errorf("%w: %s %s: %s: %s", ErrS3RequestFailed, method, path, resp.Status, bytes.TrimSpace(detail))
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrBlobNotFound, err)
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return fmt.Errorf("%w: %w", ErrObjectConditionNotMet, err)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		rlerr := &RateLimitError{Err: err}
+		if seconds, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+			rlerr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return rlerr
+	}
+	return err
+}
+
+// s3EncodePath uri encodes each segment of the path as required for the
+// canonical request.
+func s3EncodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		segments[i] = s3URIEncode(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3EncodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3URIEncode(k)+"="+s3URIEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode encodes everything other than the unreserved characters
+func s3URIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
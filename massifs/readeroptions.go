@@ -1,9 +1,8 @@
 package massifs
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/cbor"
 )
 
@@ -15,15 +14,19 @@ type ReaderOptions struct {
 
 	massifHeight uint8
 
+	// logConfig, when set, locates the massifs and seals of logs with more than
+	// one instance. See LogConfig
+	logConfig *LogConfig
+
 	// The following options are only relevant to reader implementations that interact with the blobs api.
 
 	// options that are forwarded when issuing a read blob call
-	remoteReadOpts []azblob.Option
+	remoteReadOpts []ObjectOption
 	// options that are forwarded when issuing a list blobs call
-	remoteListOpts []azblob.Option
+	remoteListOpts []ObjectOption
 
 	// options that are forwarded when issuing a filter blobs call
-	remoteFilterOpts []azblob.Option
+	remoteFilterOpts []ObjectOption
 
 	// The following options are only relevant when the reader is configured to read seals
 
@@ -33,20 +36,25 @@ type ReaderOptions struct {
 	// Used by methods which support verifying consistency against a state from
 	// an independent trusted source.
 	trustedBaseState    *MMRState
-	trustedSealerPubKey *ecdsa.PublicKey
+	trustedSealerPubKey crypto.PublicKey
+	trustedKeyring      *SealKeyring
+
+	// Used by methods which verify seals, to require witness cosignatures.
+	requiredWitnesses int
+	witnessKeys       map[string]crypto.PublicKey
 }
 
 // ReaderOptionsCopy creates an independent of the opts
 func ReaderOptionsCopy(opts ReaderOptions) ReaderOptions {
 	cpy := opts
 
-	cpy.remoteReadOpts = make([]azblob.Option, len(opts.remoteReadOpts))
+	cpy.remoteReadOpts = make([]ObjectOption, len(opts.remoteReadOpts))
 	copy(cpy.remoteReadOpts, opts.remoteReadOpts)
 
-	cpy.remoteListOpts = make([]azblob.Option, len(opts.remoteListOpts))
+	cpy.remoteListOpts = make([]ObjectOption, len(opts.remoteListOpts))
 	copy(cpy.remoteListOpts, opts.remoteListOpts)
 
-	cpy.remoteFilterOpts = make([]azblob.Option, len(opts.remoteFilterOpts))
+	cpy.remoteFilterOpts = make([]ObjectOption, len(opts.remoteFilterOpts))
 	copy(cpy.remoteFilterOpts, opts.remoteFilterOpts)
 	return cpy
 }
@@ -78,12 +86,35 @@ func WithTrustedBaseState(state MMRState) ReaderOption {
 	}
 }
 
-func WithTrustedSealerPub(pub *ecdsa.PublicKey) ReaderOption {
+// WithTrustedSealerPub requires seals to be signed by the provided key. The
+// key may be of any type supported for sealing, see NewCNFClaim.
+func WithTrustedSealerPub(pub crypto.PublicKey) ReaderOption {
 	return func(opts *ReaderOptions) {
 		opts.trustedSealerPubKey = pub
 	}
 }
 
+// WithTrustedKeyring requires seals to be signed by the key which was valid
+// for the size of the sealed state. The keyring is obtained by verifying the
+// tenant's history of the sealing keys, see ReadSealKeyring, and only seals
+// for that tenant are accepted.
+func WithTrustedKeyring(keyring *SealKeyring) ReaderOption {
+	return func(opts *ReaderOptions) {
+		opts.trustedKeyring = keyring
+	}
+}
+
+// WithRequiredWitnesses requires seals to be countersigned by at least n
+// distinct witnesses, whose public keys are provided by key id. This protects
+// against the log operator presenting different verifiers with different
+// logs. See Witness.
+func WithRequiredWitnesses(n int, keys map[string]crypto.PublicKey) ReaderOption {
+	return func(opts *ReaderOptions) {
+		opts.requiredWitnesses = n
+		opts.witnessKeys = keys
+	}
+}
+
 // WithoutGetRootSupport disables the random access map for the peak stack.
 // This typically should only be set by log builders
 func WithoutGetRootSupport() ReaderOption {
@@ -98,19 +129,28 @@ func WithMassifHeight(massifHeight uint8) ReaderOption {
 	}
 }
 
-func WithReadBlobOption(opt azblob.Option) ReaderOption {
+// WithLogConfig provides the instance configuration of the log. It is only
+// necessary for logs whose massif height has been changed by starting a new
+// log instance.
+func WithLogConfig(cfg LogConfig) ReaderOption {
+	return func(opts *ReaderOptions) {
+		opts.logConfig = &cfg
+	}
+}
+
+func WithReadBlobOption(opt ObjectOption) ReaderOption {
 	return func(opts *ReaderOptions) {
 		opts.remoteReadOpts = append(opts.remoteReadOpts, opt)
 	}
 }
 
-func WithListBlobOption(opt azblob.Option) ReaderOption {
+func WithListBlobOption(opt ObjectOption) ReaderOption {
 	return func(opts *ReaderOptions) {
 		opts.remoteListOpts = append(opts.remoteListOpts, opt)
 	}
 }
 
-func WithFilterBlobsOption(opt azblob.Option) ReaderOption {
+func WithFilterBlobsOption(opt ObjectOption) ReaderOption {
 	return func(opts *ReaderOptions) {
 		opts.remoteFilterOpts = append(opts.remoteFilterOpts, opt)
 	}
@@ -0,0 +1,270 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+// ReplicationSource is satisfied by MassifReader
+type ReplicationSource interface {
+	MassifGetter
+	GetHeadMassif(
+		ctx context.Context, tenantIdentity string,
+		opts ...ReaderOption,
+	) (MassifContext, error)
+	VerifyContext(
+		ctx context.Context, mc MassifContext,
+		opts ...ReaderOption,
+	) (*VerifiedContext, error)
+}
+
+// Replicator maintains local replicas of tenant logs.
+//
+// Each run fetches only the massifs which are new, or have grown, since the
+// previous run. Every massif fetched is verified against its remote seal and
+// against the last state trusted locally, so the local replica can only ever
+// be extended with data consistent with what it already holds. The local
+// replica is the root of trust: if it does not verify against its own seals,
+// replication stops with an error rather than overwriting it.
+//
+// Replication is resumable. Files are replaced atomically, and the massif is
+// always written before its seal. So after an interruption, the local head
+// either verifies, or is missing its seal. In the latter case replication
+// resumes from the last massif that does verify.
+type Replicator struct {
+	log         logger.Logger
+	remote      ReplicationSource
+	local       *LocalReader
+	writeOpener WriteAppendOpener
+	opts        []ReaderOption
+}
+
+// NewReplicator creates a replicator from the remote source to the replica
+// directory of the local reader. The options are used for all remote reads,
+// and must include the remote seal getter and a CBOR codec. If writeOpener is
+// nil, AtomicFileWriteOpener is used.
+func NewReplicator(
+	log logger.Logger, remote ReplicationSource, local *LocalReader,
+	writeOpener WriteAppendOpener, opts ...ReaderOption,
+) (*Replicator, error) {
+
+	if !local.InReplicaMode() {
+		return nil, fmt.Errorf("replica dir must be configured on the local reader")
+	}
+	if writeOpener == nil {
+		writeOpener = AtomicFileWriteOpener{}
+	}
+	return &Replicator{
+		log:         log,
+		remote:      remote,
+		local:       local,
+		writeOpener: writeOpener,
+		opts:        opts,
+	}, nil
+}
+
+// Replicate replicates each of the tenant logs in turn, stopping at the first
+// error.
+func (r *Replicator) Replicate(ctx context.Context, tenantIdentities []string) error {
+	for _, tenantIdentity := range tenantIdentities {
+		if err := r.ReplicateTenant(ctx, tenantIdentity); err != nil {
+			return fmt.Errorf("%w: replicating %s", err, tenantIdentity)
+		}
+	}
+	return nil
+}
+
+// ReplicateTenant brings the local replica of the tenant log up to date with
+// the remote.
+func (r *Replicator) ReplicateTenant(ctx context.Context, tenantIdentity string) error {
+
+	if err := r.local.EnsureReplicaDirs(tenantIdentity); err != nil {
+		return err
+	}
+
+	first, trusted, local, err := r.localTrustedState(ctx, tenantIdentity)
+	if err != nil {
+		return err
+	}
+
+	head, err := r.remote.GetHeadMassif(ctx, tenantIdentity, r.opts...)
+	if err != nil {
+		return err
+	}
+
+	for massifIndex := first; massifIndex <= head.Start.MassifIndex; massifIndex++ {
+
+		mc := head
+		if massifIndex != head.Start.MassifIndex {
+			if mc, err = r.remote.GetMassif(ctx, tenantIdentity, uint64(massifIndex), r.opts...); err != nil {
+				return err
+			}
+		}
+
+		opts := r.opts
+		if trusted != nil {
+			opts = append(opts[:len(opts):len(opts)], WithTrustedBaseState(*trusted))
+		}
+		vc, err := r.remote.VerifyContext(ctx, mc, opts...)
+		if err != nil {
+			return fmt.Errorf("%w: verifying remote massif %d", err, massifIndex)
+		}
+
+		// The local head is only replaced if the massif, or its seal, have changed
+		if local == nil || local.Start.MassifIndex != massifIndex ||
+			local.RangeCount() != vc.RangeCount() || local.MMRState.MMRSize != vc.MMRState.MMRSize {
+
+			if err = r.local.ReplaceVerifiedContext(vc, r.writeOpener); err != nil {
+				return err
+			}
+			if r.log != nil {
+				r.log.Debugf("replicated %s massif %d, MMR(%d)", tenantIdentity, massifIndex, vc.RangeCount())
+			}
+		}
+
+		if trusted, err = massifEndState(vc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localTrustedState returns the index of the first massif to replicate and the
+// state it must be consistent with. For a new replica, this is massif 0 and
+// there is no trusted state. Otherwise it is the local head, which is
+// re-fetched in case it has grown, and the state at the end of the preceding
+// massif. The verified local head is also returned.
+func (r *Replicator) localTrustedState(
+	ctx context.Context, tenantIdentity string,
+) (uint32, *MMRState, *VerifiedContext, error) {
+
+	head, err := r.local.GetHeadMassif(ctx, tenantIdentity, r.opts...)
+	if errors.Is(err, ErrLogFileMassifNotFound) {
+		return 0, nil, nil, nil
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	local, err := verifiedLocalMassif(ctx, r.local, head, r.opts)
+	if err != nil || local == nil {
+		return 0, nil, nil, err
+	}
+	massifIndex := local.Start.MassifIndex
+	if massifIndex != head.Start.MassifIndex {
+		// The massif is complete, and the next is replicated from its end state
+		trusted, err := massifEndState(local)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return massifIndex + 1, trusted, nil, nil
+	}
+
+	trusted := local.MMRState
+	return massifIndex, &trusted, local, nil
+}
+
+// verifiedLocalMassif returns the most recent massif, at or before the local
+// head, which verifies against its local seal. The local seals, rather than
+// any seal getter in opts, are used. Returns nil if no massif has a seal.
+func verifiedLocalMassif(
+	ctx context.Context, local *LocalReader, head MassifContext, opts []ReaderOption,
+) (*VerifiedContext, error) {
+
+	opts = append(opts[:len(opts):len(opts)], WithSealGetter(local))
+	massifIndex := head.Start.MassifIndex
+	for {
+		vc, err := local.GetVerifiedContext(ctx, head.TenantIdentity, uint64(massifIndex), opts...)
+		if err == nil {
+			return vc, nil
+		}
+		// An interrupted replication can leave a massif without its seal
+		if !errors.Is(err, ErrLogFileSealNotFound) {
+			return nil, fmt.Errorf("%w: verifying local massif %d", err, massifIndex)
+		}
+		if massifIndex == 0 {
+			return nil, nil
+		}
+		massifIndex--
+	}
+}
+
+// massifEndState returns the state of the log at the end of the verified
+// massif data. It is trusted to the same degree as the verified context.
+func massifEndState(vc *VerifiedContext) (*MMRState, error) {
+	mmrSize := vc.RangeCount()
+	peaks, err := mmr.PeakHashes(&vc.MassifContext, mmrSize-1)
+	if err != nil {
+		return nil, err
+	}
+	return &MMRState{
+		Version: int(MMRStateVersionCurrent),
+		MMRSize: mmrSize,
+		Peaks:   peaks,
+		HashAlg: vc.Start.HashAlg,
+	}, nil
+}
+
+// AtomicFileWriteOpener is a WriteAppendOpener for local replicas which
+// replaces files atomically.
+//
+// Create writes to a temporary file which is renamed over the target when it
+// is closed, so an interrupted write never leaves a partial file. The temporary
+// file is created in the parent of the target directory, so that a file left
+// by a crash is never mistaken for a massif or a seal.
+type AtomicFileWriteOpener struct{}
+
+func (AtomicFileWriteOpener) Open(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(0644))
+}
+
+func (AtomicFileWriteOpener) Create(name string) (io.WriteCloser, error) {
+	f, err := os.CreateTemp(filepath.Dir(filepath.Dir(name)), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, name: name}, nil
+}
+
+type atomicFile struct {
+	*os.File
+	name   string
+	failed bool
+}
+
+func (f *atomicFile) Write(data []byte) (int, error) {
+	n, err := f.File.Write(data)
+	if err != nil || n != len(data) {
+		f.failed = true
+	}
+	return n, err
+}
+
+// Close completes the write, replacing the target file, or removes the
+// temporary file if the write can't be completed. A file for which a write
+// failed is never renamed over the target.
+func (f *atomicFile) Close() error {
+	if f.failed {
+		f.File.Close()
+		os.Remove(f.File.Name())
+		return fmt.Errorf("%w: %s", ErrWriteIncomplete, f.name)
+	}
+	err := f.File.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.File.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+	}
+	return err
+}
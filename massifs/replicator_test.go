@@ -0,0 +1,133 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplicator checks the replica is created, extended incrementally, and
+// resumed after an interruption, and that a tampered replica is not
+// overwritten.
+func TestReplicator(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log := newTestLog(t, tenant, massifHeight, nil)
+	codec := log.codec
+	reader := NewMassifReader(nil, log.store)
+	sealReader := log.sealReader()
+
+	// addSealed adds the leaves then seals every massif
+	addSealed := func(ctx context.Context, base, count uint64) {
+		log.addLeaves(t, testLeafEntries(base, count))
+		log.seal(t)
+	}
+
+	replicaDir := t.TempDir()
+	newReplicator := func() (*Replicator, LocalReader) {
+		cache, err := NewLogDirCache(nil, testOSOpener{},
+			WithDirCacheReplicaDir(replicaDir),
+			WithDirCacheMassifLister(testOSDirLister{}),
+			WithDirCacheSealLister(testOSDirLister{}),
+			WithReaderOption(WithCBORCodec(codec)),
+			WithReaderOption(WithMassifHeight(massifHeight)),
+		)
+		require.NoError(t, err)
+		localReader, err := NewLocalReader(nil, cache)
+		require.NoError(t, err)
+		r, err := NewReplicator(
+			nil, &reader, &localReader, nil, WithSealGetter(&sealReader), WithCBORCodec(codec))
+		require.NoError(t, err)
+		return r, localReader
+	}
+	checkReplica := func(massifCount uint32, mmrSize uint64) {
+		// A fresh reader ensures the replica is read from disc
+		_, localReader := newReplicator()
+		head, err := localReader.GetHeadMassif(ctx, tenant)
+		require.NoError(t, err)
+		assert.Equal(t, massifCount-1, head.Start.MassifIndex)
+		assert.Equal(t, mmrSize, head.RangeCount())
+		for massifIndex := range uint64(massifCount) {
+			_, err := localReader.GetVerifiedContext(ctx, tenant, massifIndex, WithSealGetter(&localReader))
+			require.NoError(t, err)
+		}
+	}
+
+	addSealed(ctx, 0, 10)
+	r, _ := newReplicator()
+	require.NoError(t, r.Replicate(ctx, []string{tenant}))
+	checkReplica(3, mmr.FirstMMRSize(mmr.MMRIndex(9)))
+
+	// Only the head, which has grown, and the new massifs are replicated
+	addSealed(ctx, 10, 5)
+	r, localReader := newReplicator()
+	massif0, err := os.Stat(localReader.GetMassifLocalPath(tenant, 0))
+	require.NoError(t, err)
+	require.NoError(t, r.ReplicateTenant(ctx, tenant))
+	checkReplica(4, mmr.FirstMMRSize(mmr.MMRIndex(14)))
+	after, err := os.Stat(localReader.GetMassifLocalPath(tenant, 0))
+	require.NoError(t, err)
+	assert.Equal(t, massif0.ModTime(), after.ModTime())
+
+	// An interruption after writing the massif, but before its seal, is resumed
+	addSealed(ctx, 15, 2)
+	_, localReader = newReplicator()
+	require.NoError(t, os.Remove(localReader.GetSealLocalPath(tenant, 3)))
+	r, _ = newReplicator()
+	require.NoError(t, r.ReplicateTenant(ctx, tenant))
+	checkReplica(5, mmr.FirstMMRSize(mmr.MMRIndex(16)))
+
+	// A tampered replica fails to verify, and is not replaced
+	massifPath := localReader.GetMassifLocalPath(tenant, 4)
+	data, err := os.ReadFile(massifPath)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(massifPath, data, 0644))
+	r, _ = newReplicator()
+	require.Error(t, r.ReplicateTenant(ctx, tenant))
+	tampered, err := os.ReadFile(massifPath)
+	require.NoError(t, err)
+	assert.Equal(t, data, tampered)
+}
+
+// failingWriter is a writer whose Close, and optionally Write, fails
+type failingWriter struct {
+	writeErr error
+	closeErr error
+}
+
+func (w failingWriter) Write(data []byte) (int, error) {
+	if w.writeErr != nil {
+		return 0, w.writeErr
+	}
+	return len(data), nil
+}
+
+func (w failingWriter) Close() error { return w.closeErr }
+
+// TestWriteAll_CloseError checks a write is not reported as successful if the
+// writer fails to complete it when closed.
+func TestWriteAll_CloseError(t *testing.T) {
+	errWrite := errors.New("write failed")
+	errClose := errors.New("close failed")
+	opener := func(w failingWriter) WriteOpener {
+		return func(string) (io.WriteCloser, error) { return w, nil }
+	}
+
+	assert.NoError(t, writeAll(opener(failingWriter{}), "file", []byte{1}))
+	assert.ErrorIs(t, writeAll(opener(failingWriter{closeErr: errClose}), "file", []byte{1}), errClose)
+
+	err := writeAll(opener(failingWriter{writeErr: errWrite, closeErr: errClose}), "file", []byte{1})
+	assert.ErrorIs(t, err, errWrite)
+	assert.ErrorIs(t, err, errClose)
+}
@@ -1,7 +1,7 @@
 package massifs
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -48,6 +48,15 @@ const (
 	// Remembering that the range is *negative* we allocate the tag by
 	// subtracting the IANA registered tag for marking COSE Receipts proof data.
 	SealPeakReceiptsLabel = COSEPrivateStart - VDSCoseReceiptProofsTag
+	// MMRiverMultiInclusionProofLabel identifies the multi-proof in the
+	// verifiable proofs map (VDSCoseReceiptProofsTag) of MMRIVER receipts. The
+	// VDS does not define a multi-proof, so the label is private. It is the
+	// tag of MMRiverVerifiableProofs.MultiInclusionProof.
+	MMRiverMultiInclusionProofLabel = int64(-65933)
+	// ReceiptHashAlgLabel identifies the hash algorithm of the log in the
+	// protected header of the pre-signed peak receipts. It is omitted for
+	// SHA-256.
+	ReceiptHashAlgLabel = COSEPrivateStart - VDSCoseReceiptsTag
 )
 
 // MMRState defines the details we include in our signed commitment to the head log state.
@@ -90,6 +99,15 @@ type MMRState struct {
 	// The current idtimestamp epoch (~17 year cadence. We use the unix epoch as
 	// our base but roll twice as fast. so we are on epoch 1 in 2024)
 	CommitmentEpoch uint32 `cbor:"6,keyasint"`
+
+	// HashAlg is the hash algorithm of the log. It is omitted for SHA-256, so
+	// that states for existing logs are unchanged.
+	HashAlg HashAlg `cbor:"9,keyasint,omitempty"`
+
+	// TrieRoot commits to the trie keys of the massif leaves in MMRSize, see
+	// MassifContext.TrieRoot. It is used to verify proofs of exclusion, and is
+	// omitted by sealers which pre-date it.
+	TrieRoot []byte `cbor:"10,keyasint,omitempty"`
 }
 
 type MMRStateReceipts struct {
@@ -102,7 +120,7 @@ type MMRStateReceipts struct {
 // RootSigner is used to produce a signature over an mmr log state.  This
 // signature commits to a log state, and should only be created and published
 // after checking the consistency between the last signed state and the new one.
-// See merklelog/mmrblobs/logconfirmer.go:LogConfirmer for expected use.
+// See Sealer for expected use.
 type RootSigner struct {
 	issuer    string
 	cborCodec commoncbor.CBORCodec
@@ -122,11 +140,12 @@ func NewRootSigner(issuer string, cborCodec commoncbor.CBORCodec) RootSigner {
 func (rs RootSigner) Sign1(
 	coseSigner cose.Signer,
 	keyIdentifier string,
-	publicKey *ecdsa.PublicKey,
+	publicKey crypto.PublicKey,
 	subject string,
 	state MMRState, external []byte) ([]byte, error) {
 
-	receipts, err := rs.signEmptyPeakReceipts(coseSigner, publicKey, keyIdentifier, rs.issuer, subject, state.Peaks)
+	receipts, err := rs.signEmptyPeakReceipts(
+		coseSigner, publicKey, keyIdentifier, rs.issuer, subject, state.HashAlg, state.Peaks)
 	if err != nil {
 		return nil, err
 	}
@@ -134,10 +153,14 @@ func (rs RootSigner) Sign1(
 		return nil, fmt.Errorf("receipt vs peak count mismatch: %d vs %d", len(receipts), len(state.Peaks))
 	}
 
+	cnfClaim, err := NewCNFClaim(rs.issuer, subject, keyIdentifier, coseSigner.Algorithm(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+
 	coseHeaders := cose.Headers{
 		Protected: cose.ProtectedHeader{
-			commoncose.HeaderLabelCWTClaims: commoncose.NewCNFClaim(
-				rs.issuer, subject, keyIdentifier, coseSigner.Algorithm(), *publicKey),
+			commoncose.HeaderLabelCWTClaims: cnfClaim,
 		},
 		// one receipt is present for each peak identified by tree-size-2 in
 		// the protected header each receipt is individualy signed
@@ -218,17 +241,18 @@ func (rs RootSigner) Sign1(
 // in doing so reveal less about their area of interest.
 func (c *RootSigner) signEmptyPeakReceipts(
 	coseSigner cose.Signer,
-	publicKey *ecdsa.PublicKey,
+	publicKey crypto.PublicKey,
 	keyIdentifier string,
 	issuer string,
 	subject string,
+	hashAlg HashAlg,
 	peaks [][]byte,
 ) ([][]byte, error) {
 
 	receipts := make([][]byte, len(peaks))
 
 	for i, peak := range peaks {
-		receipt, err := c.signEmptyPeakReceipt(coseSigner, publicKey, keyIdentifier, issuer, subject, peak)
+		receipt, err := c.signEmptyPeakReceipt(coseSigner, publicKey, keyIdentifier, issuer, subject, hashAlg, peak)
 		if err != nil {
 			return nil, err
 		}
@@ -250,31 +274,37 @@ func (c *RootSigner) signEmptyPeakReceipts(
 //	  coseSigner: The signer of the completed shared receipt
 //	  issuer: The identifier for the issuer of the receipt
 //		 subject: The identifier for the subject of the receipt
+//	  hashAlg: The hash algorithm of the log, verifiers use it to check proofs against the peak
 func (rs RootSigner) signEmptyPeakReceipt(
 	coseSigner cose.Signer,
-	publicKey *ecdsa.PublicKey,
+	publicKey crypto.PublicKey,
 	keyIdentifier string,
 	issuer string,
 	subject string,
+	hashAlg HashAlg,
 	// The bytes of a peak, which an mmr node which is a member of an accumulator for one or more tree states.
 	peak []byte,
 ) ([]byte, error) {
 
-	if len(peak) != 32 {
-		return nil, fmt.Errorf("%w: peak must be 32 bytes, got %d", ErrNodeSize, len(peak))
+	if err := checkHashAlg(hashAlg); err != nil {
+		return nil, err
+	}
+	if len(peak) != hashAlg.Size() {
+		return nil, fmt.Errorf(
+			"%w: %v peak must be %d bytes, got %d", ErrNodeSize, hashAlg, hashAlg.Size(), len(peak))
+	}
+
+	cnfClaim, err := NewCNFClaim(issuer, subject, keyIdentifier, coseSigner.Algorithm(), publicKey)
+	if err != nil {
+		return nil, err
 	}
 
 	headers := cose.Headers{
 		Protected: cose.ProtectedHeader{
-			VDSCoseReceiptsTag:        VDSMMRiver,
-			cose.HeaderLabelAlgorithm: coseSigner.Algorithm(),
-			cose.HeaderLabelKeyID:     []byte(keyIdentifier),
-			commoncose.HeaderLabelCWTClaims: commoncose.NewCNFClaim(
-				issuer,
-				subject,
-				keyIdentifier,
-				coseSigner.Algorithm(),
-				*publicKey),
+			VDSCoseReceiptsTag:              VDSMMRiver,
+			cose.HeaderLabelAlgorithm:       coseSigner.Algorithm(),
+			cose.HeaderLabelKeyID:           []byte(keyIdentifier),
+			commoncose.HeaderLabelCWTClaims: cnfClaim,
 		},
 		// The receipt producer, which MAY be the relying party in possesion of
 		// a log massif, can fill in the inclusion proof directly and
@@ -282,13 +312,16 @@ func (rs RootSigner) signEmptyPeakReceipt(
 		// service.
 		Unprotected: cose.UnprotectedHeader{},
 	}
+	if hashAlg != HashAlgSHA256 {
+		headers.Protected[ReceiptHashAlgLabel] = int64(hashAlg)
+	}
 
 	msg := cose.Sign1Message{
 		Headers: headers,
 		Payload: peak,
 	}
 
-	err := msg.Sign(rand.Reader, nil, coseSigner)
+	err = msg.Sign(rand.Reader, nil, coseSigner)
 	if err != nil {
 		return nil, err
 	}
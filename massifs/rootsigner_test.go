@@ -35,13 +35,13 @@ func TestCoseSign1_UnprotectedEncDec(t *testing.T) {
 	}
 
 	mustSignPeak := func(peak []byte) []byte {
-		b, err := rs.signEmptyPeakReceipt(coseSigner, &key.PublicKey, "test-key", "test-issuer", "test-subject", peak)
+		b, err := rs.signEmptyPeakReceipt(coseSigner, &key.PublicKey, "test-key", "test-issuer", "test-subject", HashAlgSHA256, peak)
 		require.NoError(t, err)
 		return b
 	}
 
 	mustSignPeaks := func(peaks [][]byte) [][]byte {
-		receipts, err := rs.signEmptyPeakReceipts(coseSigner, &key.PublicKey, "test-key", "test-issuer", "test-subject", peaks)
+		receipts, err := rs.signEmptyPeakReceipts(coseSigner, &key.PublicKey, "test-key", "test-issuer", "test-subject", HashAlgSHA256, peaks)
 		require.NoError(t, err)
 		return receipts
 	}
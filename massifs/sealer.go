@@ -0,0 +1,457 @@
+package massifs
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+var (
+	ErrSealerSinceRequired = errors.New("the sealer requires an epoch prefixed lastid to list changes since")
+	ErrSealerKeyNotHeld    = errors.New("the sealer does not hold the seal key valid for the MMR size")
+)
+
+// Sealer signs the state of tenant logs which have changed since they were
+// last sealed.
+//
+// Before a new state is signed, the most recent seal is read, verified against
+// the log, and the log is proven consistent with it. So each seal is only ever
+// an extension of the one before. The consistency proof is stored with the
+// seal, see TenantMassifConsistencyProofPath. The seal for the
+// head massif is written conditionally on the etag of the seal read, or on
+// there being no seal, so concurrent sealers can't replace each others seals
+// with a state that was not checked against them.
+//
+// If witnesses are configured, see SetWitnesses, each seal is countersigned
+// by them before it is written. If seal keys are configured, see SetSealKeys,
+// each state is signed with the key the tenant's key history makes valid for
+// it.
+//
+// A Sealer is not safe for concurrent use.
+type Sealer struct {
+	log        logger.Logger
+	store      ObjectStore
+	massifs    MassifReader
+	seals      SignedRootReader
+	rootSigner RootSigner
+	coseSigner IdentifiableCoseSigner
+	codec      commoncbor.CBORCodec
+	opts       []ReaderOption
+
+	witnesses     []WitnessCosigner
+	witnessQuorum int
+
+	sealKeyAnchor crypto.PublicKey
+	sealSigners   []IdentifiableCoseSigner
+}
+
+// NewSealer creates a sealer for the logs in store. The options are used for
+// all reads of the logs and their seals, the seal getter and CBOR codec are
+// provided by the sealer.
+func NewSealer(
+	log logger.Logger, store ObjectStore,
+	rootSigner RootSigner, coseSigner IdentifiableCoseSigner, codec commoncbor.CBORCodec,
+	opts ...ReaderOption,
+) *Sealer {
+	s := &Sealer{
+		log:        log,
+		store:      store,
+		massifs:    NewMassifReader(log, store),
+		seals:      NewSignedRootReader(log, store, codec),
+		rootSigner: rootSigner,
+		coseSigner: coseSigner,
+		codec:      codec,
+	}
+	s.opts = append(slices.Clone(opts), WithSealGetter(&s.seals), WithCBORCodec(codec))
+	return s
+}
+
+// SetWitnesses sets the witnesses asked to countersign each seal. A seal is
+// only written if at least quorum of them countersign it, the cosignatures of
+// all that do are attached to the seal.
+func (s *Sealer) SetWitnesses(quorum int, witnesses ...WitnessCosigner) {
+	s.witnessQuorum = quorum
+	s.witnesses = witnesses
+}
+
+// SetSealKeys requires each state to be signed with the key which is valid for
+// its size, see SealKeyring.KeyFor. The tenant's key history is read from the
+// store, see ReadSealKeyring, and verified against the anchor. The signer
+// holding the valid key is chosen from the signers and the signer the sealer
+// was created with. A state is not sealed if none of them hold it.
+func (s *Sealer) SetSealKeys(anchor crypto.PublicKey, signers ...IdentifiableCoseSigner) {
+	s.sealKeyAnchor = anchor
+	s.sealSigners = append([]IdentifiableCoseSigner{s.coseSigner}, signers...)
+}
+
+// Run seals, every interval, the tenants whose massifs have changed within the
+// horizon. It runs until the context is done, and returns the context error.
+// Rounds for which the store is rate limiting are skipped, as the horizon of
+// the next round covers them. Any other error ends the run.
+func (s *Sealer) Run(ctx context.Context, interval time.Duration, horizon time.Duration) error {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := s.FindUnsealed(ctx, IDTimeHex(time.Now().Add(-horizon)))
+		if err == nil {
+			err = s.Seal(ctx, tenants)
+		}
+		if _, ok := IsRateLimiting(err); !ok && err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// FindUnsealed returns the identities of the tenants which have a massif whose
+// lastid tag is after the lastid tag of their seals. Only the massifs and
+// seals whose lastid is at or after idSince, which is an epoch prefixed hex id
+// timestamp, see IDTimestampToHex, are considered.
+func (s *Sealer) FindUnsealed(ctx context.Context, idSince string) ([]string, error) {
+
+	if idSince == "" {
+		return nil, ErrSealerSinceRequired
+	}
+	filter := fmt.Sprintf(`"%s">='%s'`, TagKeyLastID, idSince)
+
+	massifLastIDs := map[string]string{}
+	sealLastIDs := map[string]string{}
+
+	var marker string
+	for {
+		r, err := s.store.FilteredList(ctx, filter, WithListTags(), WithListMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range r.Items {
+			lastIDs := massifLastIDs
+			if IsSealPathLike(item.Path) {
+				lastIDs = sealLastIDs
+			} else if !IsMassifPathLike(item.Path) {
+				continue
+			}
+			tenantUUID, err := ParseMassifPathTenant(item.Path)
+			if err != nil {
+				continue
+			}
+			lastID := GetLastIDHex(item.Tags)
+			if lastID > lastIDs[tenantUUID] {
+				lastIDs[tenantUUID] = lastID
+			}
+		}
+		if r.Marker == "" {
+			break
+		}
+		marker = r.Marker
+	}
+
+	// The lastid tags are epoch prefixed hex, so they sort in time order
+	var tenants []string
+	for tenantUUID, lastID := range massifLastIDs {
+		if lastID > sealLastIDs[tenantUUID] {
+			tenants = append(tenants, "tenant/"+tenantUUID)
+		}
+	}
+	slices.Sort(tenants)
+	return tenants, nil
+}
+
+// Seal seals each of the tenant logs in turn, stopping at the first error.
+// Tenants whose seal was replaced by another sealer while being sealed are
+// skipped, they will be found again by FindUnsealed if they need a new seal.
+func (s *Sealer) Seal(ctx context.Context, tenantIdentities []string) error {
+	for _, tenantIdentity := range tenantIdentities {
+		_, err := s.SealTenant(ctx, tenantIdentity)
+		if errors.Is(err, ErrObjectConditionNotMet) {
+			if s.log != nil {
+				s.log.Infof("seal for %s was replaced concurrently: %v", tenantIdentity, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: sealing %s", err, tenantIdentity)
+		}
+	}
+	return nil
+}
+
+// SealTenant signs the current state of the tenant log and writes it as the
+// seal for the head massif. The state is only signed if it is consistent with
+// the most recent seal. Any massifs after the most recently sealed massif are
+// sealed first, in order, so that every massif has a seal. Returns the state
+// signed for the head massif, or nil if the log has not changed since it was
+// last sealed.
+func (s *Sealer) SealTenant(ctx context.Context, tenantIdentity string) (*MMRState, error) {
+
+	head, err := s.massifs.GetHeadMassif(ctx, tenantIdentity, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mc, previous, etag, err := s.lastSealedMassif(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring *SealKeyring
+	if s.sealKeyAnchor != nil {
+		keyring, err = ReadSealKeyring(ctx, s.store, s.codec, tenantIdentity, s.sealKeyAnchor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The previous seal may be for an earlier massif, so the proofs are read
+	// from as many massifs as needed.
+	store := NewMultiMassifStore(ctx, &s.massifs, tenantIdentity, head.Start.MassifHeight, 0, s.opts...)
+	for {
+		state, err := s.sealMassif(ctx, store, keyring, &mc, previous, etag)
+		if err != nil {
+			return nil, err
+		}
+		if mc.Start.MassifIndex == head.Start.MassifIndex {
+			return state, nil
+		}
+		if state != nil {
+			previous = state
+		}
+
+		etag = ""
+		next := mc.Start.MassifIndex + 1
+		mc = head
+		if next != head.Start.MassifIndex {
+			mc, err = s.massifs.GetMassif(ctx, tenantIdentity, uint64(next), s.opts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// lastSealedMassif returns the most recently sealed massif, at or before the
+// head, its verified seal state, and the etag of its seal. If no massif has
+// been sealed, massif 0 is returned with a nil state and an empty etag.
+func (s *Sealer) lastSealedMassif(
+	ctx context.Context, head MassifContext,
+) (MassifContext, *MMRState, string, error) {
+
+	mc := head
+	for {
+		vc, err := s.massifs.VerifyContext(ctx, mc, s.opts...)
+		if err == nil {
+			bc, err := s.seals.GetLastReadContext()
+			if err != nil {
+				return MassifContext{}, nil, "", err
+			}
+			state := vc.MMRState
+			if state.Peaks == nil {
+				// Version 0 seals attest to the bagged root, which has been
+				// verified against the log, so the peaks can be taken from
+				// the log.
+				state.Peaks, err = mmr.PeakHashes(&mc, state.MMRSize-1)
+				if err != nil {
+					return MassifContext{}, nil, "", err
+				}
+			}
+			return mc, &state, bc.ETag, nil
+		}
+		if !errors.Is(err, ErrSealNotFound) {
+			return MassifContext{}, nil, "", err
+		}
+		if mc.Start.MassifIndex == 0 {
+			return mc, nil, "", nil
+		}
+		mc, err = s.massifs.GetMassif(ctx, mc.TenantIdentity, uint64(mc.Start.MassifIndex-1), s.opts...)
+		if err != nil {
+			return MassifContext{}, nil, "", err
+		}
+	}
+}
+
+// sealMassif signs the state of the massif data, after checking it is
+// consistent with the previous state, and writes it as the seal for the
+// massif. If etag is empty, the massif must not have a seal, otherwise its
+// seal must have the etag. If keyring is not nil, the state is signed with the
+// key it makes valid for the state. Returns nil if the massif has not grown
+// since the previous state.
+func (s *Sealer) sealMassif(
+	ctx context.Context, store *MultiMassifStore, keyring *SealKeyring,
+	mc *MassifContext, previous *MMRState, etag string,
+) (*MMRState, error) {
+
+	options := NewReaderOptions(ReaderOptions{}, s.opts...)
+	mmrSize := mc.RangeCount()
+	if previous != nil && previous.MMRSize == mmrSize {
+		return nil, nil
+	}
+
+	peaks, err := mmr.PeakHashes(mc, mmrSize-1)
+	if err != nil {
+		return nil, err
+	}
+	trieRoot, err := mc.TrieRoot(mmrSize)
+	if err != nil {
+		return nil, err
+	}
+
+	state := MMRState{
+		Version:         int(MMRStateVersionCurrent),
+		MMRSize:         mmrSize,
+		Peaks:           peaks,
+		Timestamp:       time.Now().UnixMilli(),
+		IDTimestamp:     mc.Start.LastID,
+		CommitmentEpoch: mc.Start.CommitmentEpoch,
+		HashAlg:         mc.Start.HashAlg,
+		TrieRoot:        trieRoot,
+	}
+
+	// The proof is stored with the seal, so that verifiers holding the
+	// previous state can check the new one without the massif data.
+	var cp mmr.ConsistencyProof
+	if previous != nil {
+		if cp, err = store.CheckConsistency(*previous, state); err != nil {
+			return nil, err
+		}
+	}
+
+	signer, publicKey, err := s.signerFor(keyring, mmrSize)
+	if err != nil {
+		return nil, err
+	}
+	subject := options.logConfig.massifBlobPath(mc.TenantIdentity, mc.Start.MassifIndex)
+	data, err := s.rootSigner.Sign1(signer, signer.KeyIdentifier(), publicKey, subject, state, nil)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.cosign(ctx, store, mc.TenantIdentity, data, state); err != nil {
+		return nil, err
+	}
+
+	// The lastid tag supports efficient discovery of the logs which need
+	// sealing, both here and by independent verifiers.
+	tags := map[string]string{
+		TagKeyLastID: IDTimestampToHex(state.IDTimestamp, uint8(state.CommitmentEpoch)),
+	}
+	condition := WithETagNoneMatch(ETagAny)
+	if etag != "" {
+		condition = WithETagMatch(etag)
+	}
+	blobPath := options.logConfig.sealBlobPath(mc.TenantIdentity, mc.Start.MassifIndex)
+	if _, err = s.store.Put(ctx, blobPath, data, WithPutTags(tags), condition); err != nil {
+		return nil, err
+	}
+
+	// The proof is written after the seal, readers ignore a proof which is
+	// not for the state of the seal.
+	if previous != nil {
+		data, err = EncodeConsistencyProof(s.codec, cp)
+		if err != nil {
+			return nil, err
+		}
+		blobPath = options.logConfig.consistencyProofBlobPath(mc.TenantIdentity, mc.Start.MassifIndex)
+		if _, err = s.store.Put(ctx, blobPath, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.log != nil {
+		s.log.Debugf("sealed %s massif %d, MMR(%d)", mc.TenantIdentity, mc.Start.MassifIndex, mmrSize)
+	}
+	return &state, nil
+}
+
+// signerFor returns the signer, and its public key, for the state of size
+// mmrSize. Without a keyring, it is the signer the sealer was created with.
+func (s *Sealer) signerFor(
+	keyring *SealKeyring, mmrSize uint64,
+) (IdentifiableCoseSigner, crypto.PublicKey, error) {
+
+	if keyring == nil {
+		publicKey, err := s.coseSigner.LatestPublicKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to get public key for signing key %w", err)
+		}
+		return s.coseSigner, publicKey, nil
+	}
+
+	sealKey, err := keyring.KeyFor(mmrSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, signer := range s.sealSigners {
+		publicKey, err := signer.LatestPublicKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to get public key for signing key %w", err)
+		}
+		if publicKeysEqual(sealKey.PublicKey, publicKey) {
+			return signer, publicKey, nil
+		}
+	}
+	return nil, nil, fmt.Errorf(
+		"%w: key %s is valid for MMR(%d) of tenant %s", ErrSealerKeyNotHeld,
+		sealKey.Kid, mmrSize, keyring.TenantIdentity)
+}
+
+// cosign asks each witness to countersign the seal, and returns the seal with
+// the cosignatures attached. Each witness is given a proof from the state it
+// last witnessed. Witnesses which fail are logged and skipped, provided the
+// quorum is met.
+func (s *Sealer) cosign(
+	ctx context.Context, store *MultiMassifStore, tenantIdentity string, seal []byte, state MMRState,
+) ([]byte, error) {
+
+	if len(s.witnesses) == 0 {
+		return seal, nil
+	}
+
+	var cosignatures [][]byte
+	for _, witness := range s.witnesses {
+		cosignature, err := s.cosignWith(ctx, witness, store, tenantIdentity, seal, state)
+		if err != nil {
+			if s.log != nil {
+				s.log.Infof("witness did not cosign %s MMR(%d): %v", tenantIdentity, state.MMRSize, err)
+			}
+			continue
+		}
+		cosignatures = append(cosignatures, cosignature)
+	}
+	if len(cosignatures) < s.witnessQuorum {
+		return nil, fmt.Errorf(
+			"%w: %s MMR(%d): %d of %d", ErrWitnessQuorum, tenantIdentity, state.MMRSize, len(cosignatures), s.witnessQuorum)
+	}
+	return AttachWitnessCosignatures(seal, cosignatures)
+}
+
+func (s *Sealer) cosignWith(
+	ctx context.Context, witness WitnessCosigner, store *MultiMassifStore,
+	tenantIdentity string, seal []byte, state MMRState,
+) ([]byte, error) {
+
+	req := WitnessRequest{TenantIdentity: tenantIdentity, Seal: seal, Peaks: state.Peaks}
+	witnessedSize, err := witness.WitnessedSize(ctx, tenantIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if witnessedSize != 0 && witnessedSize < state.MMRSize {
+		cp, err := store.ConsistencyProof(MMRState{MMRSize: witnessedSize}, state)
+		if err != nil {
+			return nil, err
+		}
+		req.ConsistencyProof = &cp
+	}
+	return witness.Cosign(ctx, req)
+}
@@ -0,0 +1,242 @@
+package massifs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// racingStore replaces the object at racePath before the first put to it, as
+// if another sealer got there first.
+type racingStore struct {
+	*MemObjectStore
+	racePath string
+}
+
+func (s *racingStore) Put(
+	ctx context.Context, path string, data []byte, opts ...ObjectOption,
+) (*ObjectWriteResponse, error) {
+	if path == s.racePath {
+		s.racePath = ""
+		if _, err := s.MemObjectStore.Put(ctx, path, data); err != nil {
+			return nil, err
+		}
+	}
+	return s.MemObjectStore.Put(ctx, path, data, opts...)
+}
+
+func TestSealer(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	since := IDTimestampToHex(0, 0)
+
+	store := &racingStore{MemObjectStore: NewMemObjectStore()}
+	w := NewLogWriter(NewMassifCommitter(MassifCommitterConfig{}, nil, store), tenant, 3)
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := NewTestSignerContext(t, "test.issuer")
+	sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, codec)
+
+	reader := NewMassifReader(nil, store)
+	sealReader := NewSignedRootReader(nil, store, codec)
+	verify := func(massifIndex uint64) *VerifiedContext {
+		vc, err := reader.GetVerifiedContext(
+			ctx, tenant, massifIndex, WithSealGetter(&sealReader), WithCBORCodec(codec))
+		require.NoError(t, err)
+		return vc
+	}
+
+	// The first seal, 3 of the 4 leaves in massif 0
+	_, err = w.AddLeaves(ctx, testLeafEntries(0, 3))
+	require.NoError(t, err)
+	tenants, err := sealer.FindUnsealed(ctx, since)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenant}, tenants)
+	require.NoError(t, sealer.Seal(ctx, tenants))
+	vc := verify(0)
+	assert.Equal(t, vc.RangeCount(), vc.MMRState.MMRSize)
+	assert.Equal(t, vc.Start.LastID, vc.MMRState.IDTimestamp)
+	assert.NotEmpty(t, vc.MMRState.TrieRoot)
+
+	tenants, err = sealer.FindUnsealed(ctx, since)
+	require.NoError(t, err)
+	assert.Empty(t, tenants)
+	state, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	// The log grows into massif 1. Massif 0 is sealed again, now it is
+	// complete, then massif 1, each checked against the seal before.
+	_, err = w.AddLeaves(ctx, testLeafEntries(3, 3))
+	require.NoError(t, err)
+	tenants, err = sealer.FindUnsealed(ctx, since)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenant}, tenants)
+	state, err = sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	vc = verify(0)
+	assert.Equal(t, vc.RangeCount(), vc.MMRState.MMRSize)
+	vc = verify(1)
+	assert.Equal(t, vc.RangeCount(), state.MMRSize)
+	assert.Equal(t, state.MMRSize, vc.MMRState.MMRSize)
+
+	// The seal of the head massif is replaced when the massif grows
+	_, err = w.AddLeaves(ctx, testLeafEntries(6, 1))
+	require.NoError(t, err)
+	state, err = sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, verify(1).RangeCount(), state.MMRSize)
+
+	// A seal written by another sealer while sealing is not replaced
+	_, err = w.AddLeaves(ctx, testLeafEntries(7, 1))
+	require.NoError(t, err)
+	store.racePath = TenantMassifSignedRootPath(tenant, 1)
+	_, err = sealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrObjectConditionNotMet)
+
+	// A previous seal which does not verify against the log is not extended
+	badState := *state
+	badState.Peaks = make([][]byte, len(state.Peaks))
+	for i := range badState.Peaks {
+		badState.Peaks[i] = make([]byte, ValueBytes)
+	}
+	sealed, err := signer.SealedState(tenant, 1, badState)
+	require.NoError(t, err)
+	data, err := sealed.Sign1Message.MarshalCBOR()
+	require.NoError(t, err)
+	_, err = store.Put(ctx, TenantMassifSignedRootPath(tenant, 1), data)
+	require.NoError(t, err)
+	_, err = sealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrSealVerifyFailed)
+}
+
+func TestSealer_Run(t *testing.T) {
+	logger.New("TEST")
+	tenant := "tenant/1"
+
+	// The horizon is relative to the time now, so the leaves must be too
+	id, epoch := IDTimestampFromTime(time.Now())
+	leaves := testLeafEntries(0, 5)
+	for i := range leaves {
+		leaves[i].IDTimestamp = id + uint64(i)
+	}
+	store := NewMemObjectStore()
+	w := NewLogWriter(NewMassifCommitter(
+		MassifCommitterConfig{CommitmentEpoch: uint32(epoch)}, nil, store), tenant, 3)
+	_, err := w.AddLeaves(t.Context(), leaves)
+	require.NoError(t, err)
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := NewTestSignerContext(t, "test.issuer")
+	sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, codec)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	err = sealer.Run(ctx, 10*time.Millisecond, time.Hour)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Both massifs are sealed, though neither had been before
+	reader := NewMassifReader(nil, store)
+	sealReader := NewSignedRootReader(nil, store, codec)
+	for massifIndex := range uint64(2) {
+		vc, err := reader.GetVerifiedContext(
+			t.Context(), tenant, massifIndex, WithSealGetter(&sealReader), WithCBORCodec(codec))
+		require.NoError(t, err)
+		assert.Equal(t, vc.RangeCount(), vc.MMRState.MMRSize)
+	}
+}
+
+// TestSealer_ConsistencyProofs checks the proof stored with each seal chains
+// it to the seal before, for both remote and local readers.
+func TestSealer_ConsistencyProofs(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	log := newTestLog(t, tenant, 3, testLeafEntries(0, 3))
+	store, codec, signer := log.store, log.codec, log.signer
+	sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, codec)
+
+	// Seal 3 leaves, then 6, so massif 0 is sealed twice and massif 1 once
+	first, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	_, err = store.Get(ctx, TenantMassifConsistencyProofPath(tenant, 0))
+	assert.True(t, IsBlobNotFound(err), "the first seal has no predecessor")
+
+	log.addLeaves(t, testLeafEntries(3, 3))
+	last, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+
+	reader := NewMassifReader(nil, store)
+	sealReader := log.sealReader()
+	opts := []ReaderOption{WithSealGetter(&sealReader), WithCBORCodec(codec)}
+	vc0, err := reader.GetVerifiedContext(ctx, tenant, 0, opts...)
+	require.NoError(t, err)
+	vc1, err := reader.GetVerifiedContext(ctx, tenant, 1, opts...)
+	require.NoError(t, err)
+
+	require.NotNil(t, vc0.ConsistencyProof)
+	assert.Equal(t, first.MMRSize, vc0.ConsistencyProof.MMRSizeA)
+	assert.Equal(t, vc0.MMRState.MMRSize, vc0.ConsistencyProof.MMRSizeB)
+	require.NotNil(t, vc1.ConsistencyProof)
+	assert.Equal(t, vc0.MMRState.MMRSize, vc1.ConsistencyProof.MMRSizeA)
+	assert.Equal(t, last.MMRSize, vc1.ConsistencyProof.MMRSizeB)
+
+	// The proofs chain the seals without needing the data of the earlier massifs
+	require.NoError(t, VerifyStateConsistency(*vc0.ConsistencyProof, *first, vc0.MMRState))
+	require.NoError(t, VerifyStateConsistency(*vc1.ConsistencyProof, vc0.MMRState, vc1.MMRState))
+
+	// The stored proof is used to check a trusted state from the preceding seal
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, append(opts, WithTrustedBaseState(vc0.MMRState))...)
+	require.NoError(t, err)
+	bad := vc0.MMRState
+	bad.Peaks = [][]byte{make([]byte, ValueBytes)}
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, append(opts, WithTrustedBaseState(bad))...)
+	assert.ErrorIs(t, err, ErrInconsistentState)
+
+	// A proof left from an earlier state of the seal is ignored
+	data, err := EncodeConsistencyProof(codec, *vc0.ConsistencyProof)
+	require.NoError(t, err)
+	_, err = store.Put(ctx, TenantMassifConsistencyProofPath(tenant, 1), data)
+	require.NoError(t, err)
+	vc1, err = reader.GetVerifiedContext(ctx, tenant, 1, opts...)
+	require.NoError(t, err)
+	assert.Nil(t, vc1.ConsistencyProof)
+
+	// The local reader finds the proofs alongside the seals in a replica
+	replicaDir := t.TempDir()
+	for _, blobPath := range []string{
+		TenantMassifBlobPath(tenant, 0), TenantMassifSignedRootPath(tenant, 0), TenantMassifConsistencyProofPath(tenant, 0),
+	} {
+		_, data, err := BlobRead(ctx, blobPath, store)
+		require.NoError(t, err)
+		filePath := filepath.Join(replicaDir, strings.TrimPrefix(blobPath, V1MMRPrefix+"/"))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, data, 0644))
+	}
+	cache, err := NewLogDirCache(nil, testOSOpener{},
+		WithDirCacheReplicaDir(replicaDir),
+		WithDirCacheMassifLister(testOSDirLister{}),
+		WithDirCacheSealLister(testOSDirLister{}),
+		WithReaderOption(WithCBORCodec(codec)),
+		WithReaderOption(WithMassifHeight(3)),
+	)
+	require.NoError(t, err)
+	localReader, err := NewLocalReader(nil, cache)
+	require.NoError(t, err)
+	localVC, err := localReader.GetVerifiedContext(ctx, tenant, 0, WithSealGetter(&localReader))
+	require.NoError(t, err)
+	require.NotNil(t, localVC.ConsistencyProof)
+	assert.Equal(t, *vc0.ConsistencyProof, *localVC.ConsistencyProof)
+}
@@ -0,0 +1,263 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/veraison/go-cose"
+)
+
+// Sealing keys are rotated by publishing a key history. Each record in the
+// history names a key, and the MMR size of the first state it may seal. A
+// record is signed by the key of the record before it, and commits to the
+// hash of that record, so the history can only be extended by the holder of
+// the current key. The first record is signed by its own key, which verifiers
+// must obtain from a source they trust. See VerifySealKeyHistory and
+// WithTrustedKeyring.
+//
+// Each tenant has its own history, published at TenantSealKeyHistoryPath. The
+// records are signed with the tenant identity as the external additional
+// authenticated data, so a record for one tenant can not be presented as a
+// record for another.
+
+var (
+	ErrSealKeyHistoryEmpty   = errors.New("the seal key history has no records")
+	ErrSealKeyHistoryInvalid = errors.New("the seal key history is not a valid chain of records")
+	ErrSealKeyHistoryAnchor  = errors.New("the first seal key in the history is not the trusted key")
+	ErrSealKeyNotValid       = errors.New("no seal key in the history is valid for the MMR size")
+)
+
+// SealKeyRecord is the signed payload of each record in a SealKeyHistory
+type SealKeyRecord struct {
+	Kid string `cbor:"1,keyasint"`
+	// PublicKey is the PKIX, ASN.1 DER, encoding of the key
+	PublicKey []byte `cbor:"2,keyasint"`
+	// ValidFromMMRSize is the size of the first state the key may seal. The
+	// key is valid until the size the next key is valid from.
+	ValidFromMMRSize uint64 `cbor:"3,keyasint"`
+	// PrevRecordHash is the SHA-256 of the encoded previous record, it is
+	// omitted for the first record.
+	PrevRecordHash []byte `cbor:"4,keyasint,omitempty"`
+}
+
+// SealKeyHistory is the encoded, signed, records of the sealing keys in the
+// order they became valid. It is encoded with the codec used for the seals,
+// see NewRootSignerCodec.
+type SealKeyHistory struct {
+	Records [][]byte `cbor:"1,keyasint"`
+}
+
+// SealKey is a verified record from a SealKeyHistory
+type SealKey struct {
+	Kid              string
+	PublicKey        crypto.PublicKey
+	ValidFromMMRSize uint64
+}
+
+// SealKeyring is the verified sealing keys from the SealKeyHistory of a
+// tenant, see VerifySealKeyHistory.
+type SealKeyring struct {
+	TenantIdentity string
+	Keys           []SealKey
+}
+
+// NewSealKeyHistory creates a history for the tenant whose first record is for
+// the latest key of signer, and is signed by it.
+func NewSealKeyHistory(
+	codec commoncbor.CBORCodec, tenantIdentity string, signer IdentifiableCoseSigner, validFromMMRSize uint64,
+) (SealKeyHistory, error) {
+
+	publicKey, err := signer.LatestPublicKey()
+	if err != nil {
+		return SealKeyHistory{}, err
+	}
+	var h SealKeyHistory
+	err = h.appendRecord(codec, tenantIdentity, signer, signer.KeyIdentifier(), publicKey, validFromMMRSize, nil)
+	return h, err
+}
+
+// Rotate appends a record for the next key, signed by the current key. The
+// current signer must hold the key of the last record, and the next key must
+// become valid at a larger MMR size than the current key. The tenant identity
+// must be the one the history was created for.
+func (h *SealKeyHistory) Rotate(
+	codec commoncbor.CBORCodec, tenantIdentity string, current IdentifiableCoseSigner,
+	nextKid string, nextKey crypto.PublicKey, validFromMMRSize uint64,
+) error {
+
+	if len(h.Records) == 0 {
+		return ErrSealKeyHistoryEmpty
+	}
+	last := h.Records[len(h.Records)-1]
+	_, record, err := decodeSealKeyRecord(codec, last)
+	if err != nil {
+		return err
+	}
+	lastKey, err := x509.ParsePKIXPublicKey(record.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealKeyHistoryInvalid, err)
+	}
+	currentKey, err := current.LatestPublicKey()
+	if err != nil {
+		return err
+	}
+	if !publicKeysEqual(lastKey, currentKey) {
+		return fmt.Errorf("%w: the signer does not hold the current key %s", ErrSealKeyHistoryInvalid, record.Kid)
+	}
+	if validFromMMRSize <= record.ValidFromMMRSize {
+		return fmt.Errorf(
+			"%w: the next key must be valid from after %d", ErrSealKeyHistoryInvalid, record.ValidFromMMRSize)
+	}
+	prevHash := sha256.Sum256(last)
+	return h.appendRecord(codec, tenantIdentity, current, nextKid, nextKey, validFromMMRSize, prevHash[:])
+}
+
+func (h *SealKeyHistory) appendRecord(
+	codec commoncbor.CBORCodec, tenantIdentity string, signer IdentifiableCoseSigner,
+	kid string, publicKey crypto.PublicKey, validFromMMRSize uint64, prevHash []byte,
+) error {
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealKeyTypeUnsupported, err)
+	}
+	payload, err := codec.MarshalCBOR(SealKeyRecord{
+		Kid: kid, PublicKey: der, ValidFromMMRSize: validFromMMRSize, PrevRecordHash: prevHash,
+	})
+	if err != nil {
+		return err
+	}
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{
+				cose.HeaderLabelAlgorithm: signer.Algorithm(),
+				cose.HeaderLabelKeyID:     []byte(signer.KeyIdentifier()),
+			},
+		},
+		Payload: payload,
+	}
+	if err = msg.Sign(rand.Reader, []byte(tenantIdentity), signer); err != nil {
+		return err
+	}
+	encodable, err := commoncose.NewCoseSign1Message(&msg)
+	if err != nil {
+		return err
+	}
+	data, err := encodable.MarshalCBOR()
+	if err != nil {
+		return err
+	}
+	h.Records = append(h.Records, data)
+	return nil
+}
+
+// VerifySealKeyHistory verifies each record of the tenant's history is signed
+// by the key of the record before it, and commits to it, and that the first
+// record is for, and signed by, the trusted anchor key. The verified keys are
+// returned, see WithTrustedKeyring.
+func VerifySealKeyHistory(
+	codec commoncbor.CBORCodec, tenantIdentity string, history SealKeyHistory, anchor crypto.PublicKey,
+) (*SealKeyring, error) {
+
+	if len(history.Records) == 0 {
+		return nil, ErrSealKeyHistoryEmpty
+	}
+
+	keyring := &SealKeyring{TenantIdentity: tenantIdentity}
+	for i, data := range history.Records {
+		msg, record, err := decodeSealKeyRecord(codec, data)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKIXPublicKey(record.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrSealKeyHistoryInvalid, i, err)
+		}
+
+		signingKey := key
+		if i == 0 {
+			if !publicKeysEqual(anchor, key) {
+				return nil, ErrSealKeyHistoryAnchor
+			}
+			if record.PrevRecordHash != nil {
+				return nil, fmt.Errorf("%w: the first record has a previous record", ErrSealKeyHistoryInvalid)
+			}
+		} else {
+			prev := keyring.Keys[i-1]
+			prevHash := sha256.Sum256(history.Records[i-1])
+			if !bytes.Equal(record.PrevRecordHash, prevHash[:]) {
+				return nil, fmt.Errorf("%w: record %d does not follow record %d", ErrSealKeyHistoryInvalid, i, i-1)
+			}
+			if record.ValidFromMMRSize <= prev.ValidFromMMRSize {
+				return nil, fmt.Errorf(
+					"%w: record %d is valid from %d, before %d", ErrSealKeyHistoryInvalid,
+					i, record.ValidFromMMRSize, prev.ValidFromMMRSize)
+			}
+			signingKey = prev.PublicKey
+		}
+		if err = msg.VerifyWithPublicKey(signingKey, []byte(tenantIdentity)); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrSealKeyHistoryInvalid, i, err)
+		}
+
+		keyring.Keys = append(keyring.Keys, SealKey{
+			Kid: record.Kid, PublicKey: key, ValidFromMMRSize: record.ValidFromMMRSize,
+		})
+	}
+	return keyring, nil
+}
+
+// ReadSealKeyring reads the seal key history of the tenant from the store, see
+// TenantSealKeyHistoryPath, and verifies it against the trusted anchor key.
+func ReadSealKeyring(
+	ctx context.Context, store LogBlobReader, codec commoncbor.CBORCodec,
+	tenantIdentity string, anchor crypto.PublicKey,
+) (*SealKeyring, error) {
+
+	_, data, err := BlobRead(ctx, TenantSealKeyHistoryPath(tenantIdentity), store)
+	if err != nil {
+		return nil, err
+	}
+	var history SealKeyHistory
+	if err = codec.UnmarshalInto(data, &history); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSealKeyHistoryInvalid, err)
+	}
+	return VerifySealKeyHistory(codec, tenantIdentity, history, anchor)
+}
+
+// KeyFor returns the key valid for sealing the state of size mmrSize
+func (k *SealKeyring) KeyFor(mmrSize uint64) (SealKey, error) {
+	for i := len(k.Keys) - 1; i >= 0; i-- {
+		if k.Keys[i].ValidFromMMRSize <= mmrSize {
+			return k.Keys[i], nil
+		}
+	}
+	return SealKey{}, fmt.Errorf("%w: MMR(%d)", ErrSealKeyNotValid, mmrSize)
+}
+
+func decodeSealKeyRecord(
+	codec commoncbor.CBORCodec, data []byte,
+) (*commoncose.CoseSign1Message, SealKeyRecord, error) {
+	msg, err := commoncose.NewCoseSign1MessageFromCBOR(data, newCheckpointDecOptions()...)
+	if err != nil {
+		return nil, SealKeyRecord{}, fmt.Errorf("%w: %v", ErrSealKeyHistoryInvalid, err)
+	}
+	var record SealKeyRecord
+	if err = codec.UnmarshalInto(msg.Payload, &record); err != nil {
+		return nil, SealKeyRecord{}, fmt.Errorf("%w: %v", ErrSealKeyHistoryInvalid, err)
+	}
+	return msg, record, nil
+}
+
+// publicKeysEqual compares keys of the types supported for sealing
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
@@ -0,0 +1,122 @@
+package massifs
+
+import (
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// TestSealKeyRotation checks that seals made before and after a key rotation
+// verify against the key valid for the size of their state.
+func TestSealKeyRotation(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	newSigner := func(kid string) *TestKeyCoseSigner {
+		key := TestGenerateECKey(t, elliptic.P256())
+		signer, err := NewTestKeyCoseSigner(cose.AlgorithmES256, &key, kid)
+		require.NoError(t, err)
+		return signer
+	}
+	signer1 := newSigner("key-1")
+	signer2 := newSigner("key-2")
+	rootSigner := TestNewRootSigner(t, "test.issuer")
+
+	log := newTestLog(t, tenant, 3, nil)
+	store := log.store
+	reader := NewMassifReader(nil, store)
+	sealReader := log.sealReader()
+	opts := []ReaderOption{WithSealGetter(&sealReader), WithCBORCodec(codec)}
+
+	// The sealer chooses the key the history makes valid for each state
+	anchor, err := signer1.LatestPublicKey()
+	require.NoError(t, err)
+	sealer := NewSealer(nil, store, rootSigner, signer1, codec)
+	sealer.SetSealKeys(anchor, signer2)
+	putHistory := func(history SealKeyHistory) {
+		data, err := codec.MarshalCBOR(history)
+		require.NoError(t, err)
+		_, err = store.Put(ctx, TenantSealKeyHistoryPath(tenant), data)
+		require.NoError(t, err)
+	}
+
+	// Seal 3 leaves, MMR(4), with the first key
+	history, err := NewSealKeyHistory(codec, tenant, signer1, 1)
+	require.NoError(t, err)
+	log.addLeaves(t, testLeafEntries(0, 3))
+	_, err = sealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	putHistory(history)
+	first, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	oldSeal, err := reader.GetVerifiedContext(ctx, tenant, 0, opts...)
+	require.NoError(t, err)
+
+	// Rotate to the second key for the states after it
+	pub2, err := signer2.LatestPublicKey()
+	require.NoError(t, err)
+	assert.ErrorIs(t, history.Rotate(codec, tenant, signer2, "key-2", pub2, first.MMRSize+1), ErrSealKeyHistoryInvalid)
+	assert.ErrorIs(t, history.Rotate(codec, tenant, signer1, "key-2", pub2, 1), ErrSealKeyHistoryInvalid)
+	require.NoError(t, history.Rotate(codec, tenant, signer1, "key-2", pub2, first.MMRSize+1))
+	putHistory(history)
+
+	// A sealer which does not hold the new key refuses to seal
+	log.addLeaves(t, testLeafEntries(3, 3))
+	oldSealer := NewSealer(nil, store, rootSigner, signer1, codec)
+	oldSealer.SetSealKeys(anchor)
+	_, err = oldSealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrSealerKeyNotHeld)
+	_, err = sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+
+	keyring, err := ReadSealKeyring(ctx, store, codec, tenant, anchor)
+	require.NoError(t, err)
+	require.Len(t, keyring.Keys, 2)
+	assert.Equal(t, "key-2", keyring.Keys[1].Kid)
+
+	// The new seals verify against the new key, and the old against the old
+	opts = append(opts, WithTrustedKeyring(keyring))
+	for massifIndex := range uint64(2) {
+		_, err = reader.GetVerifiedContext(ctx, tenant, massifIndex, opts...)
+		require.NoError(t, err)
+	}
+	_, err = oldSeal.VerifyContext(
+		ctx, WithSealGetter(testSealGetter{sealed: &SealedState{
+			Sign1Message: oldSeal.Sign1Message, MMRState: oldSeal.MMRState,
+		}}), WithCBORCodec(codec), WithTrustedKeyring(keyring))
+	require.NoError(t, err)
+
+	// A state sealed with the old key after the rotation is not accepted
+	log.addLeaves(t, testLeafEntries(6, 1))
+	_, err = NewSealer(nil, store, rootSigner, signer1, codec).SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, opts...)
+	assert.ErrorIs(t, err, ErrRemoteSealKeyMatchFailed)
+
+	// The history is bound to the tenant, and a keyring is only accepted for
+	// the seals of its tenant
+	_, err = VerifySealKeyHistory(codec, "tenant/2", history, anchor)
+	assert.ErrorIs(t, err, ErrSealKeyHistoryInvalid)
+	_, err = reader.GetVerifiedContext(ctx, tenant, 0, append(opts, WithTrustedKeyring(&SealKeyring{
+		TenantIdentity: "tenant/2", Keys: keyring.Keys}))...)
+	assert.ErrorIs(t, err, ErrRemoteSealKeyMatchFailed)
+
+	// The history must start at the trusted key, and be extended by the
+	// holder of the current key
+	_, err = VerifySealKeyHistory(codec, tenant, history, pub2)
+	assert.ErrorIs(t, err, ErrSealKeyHistoryAnchor)
+	forged, err := NewSealKeyHistory(codec, tenant, signer2, first.MMRSize+1)
+	require.NoError(t, err)
+	_, err = VerifySealKeyHistory(codec, tenant, SealKeyHistory{
+		Records: [][]byte{history.Records[0], forged.Records[0]}}, anchor)
+	assert.ErrorIs(t, err, ErrSealKeyHistoryInvalid)
+	_, err = keyring.KeyFor(0)
+	assert.ErrorIs(t, err, ErrSealKeyNotValid)
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/cbor"
 	"github.com/datatrails/go-datatrails-common/cose"
 	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
 )
 
 var (
@@ -22,6 +22,16 @@ type SealGetter interface {
 	) (*cose.CoseSign1Message, MMRState, error)
 }
 
+// ConsistencyProofGetter supports reading the consistency proof stored with
+// the seal of a specific massif. The proof is from the state of the seal which
+// preceded it, which may be the seal of the previous massif.
+type ConsistencyProofGetter interface {
+	GetConsistencyProof(
+		ctx context.Context, tenantIdentity string, massifIndex uint32,
+		opts ...ReaderOption,
+	) (mmr.ConsistencyProof, error)
+}
+
 type SealedState struct {
 	Sign1Message cose.CoseSign1Message
 	MMRState     MMRState
@@ -59,7 +69,7 @@ func (s *SignedRootReader) GetLastReadContext() (LogBlobContext, error) {
 
 func (s *SignedRootReader) GetLazyContext(
 	ctx context.Context, tenantIdentity string, which LogicalBlob,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (LogBlobContext, uint64, error) {
 	blobPrefixPath := TenantMassifSignedRootsPrefix(tenantIdentity)
 
@@ -85,7 +95,7 @@ func (s *SignedRootReader) GetLazyContext(
 
 func (s *SignedRootReader) ReadLogicalContext(
 	ctx context.Context, logContext LogBlobContext,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (*cose.CoseSign1Message, MMRState, error) {
 
 	err := logContext.ReadData(ctx, s.store, opts...)
@@ -109,7 +119,7 @@ func (s *SignedRootReader) ReadLogicalContext(
 // the previous root will be for the previous massif.
 func (s *SignedRootReader) GetLatestSignedRoot(
 	ctx context.Context, tenantIdentity string,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (*cose.CoseSign1Message, MMRState, uint64, error) {
 
 	blobPrefixPath := TenantMassifSignedRootsPrefix(tenantIdentity)
@@ -142,7 +152,7 @@ func (s *SignedRootReader) GetSignedRoot(
 		o(&options)
 	}
 
-	blobPath := TenantMassifSignedRootPath(tenantIdentity, massifIndex)
+	blobPath := options.logConfig.sealBlobPath(tenantIdentity, massifIndex)
 
 	logContext := LogBlobContext{
 		BlobPath: blobPath,
@@ -153,6 +163,31 @@ func (s *SignedRootReader) GetSignedRoot(
 	return signed, unverifiedState, err
 }
 
+// GetConsistencyProof gets the consistency proof stored with the seal for the
+// massif at the given massifIndex. It satisfies ConsistencyProofGetter.
+//
+// The proof is read independently of the seal, and does not replace the last
+// read context. Seals written by sealers which pre-date the proofs have no
+// proof, in which case an error satisfying IsBlobNotFound is returned.
+func (s *SignedRootReader) GetConsistencyProof(
+	ctx context.Context, tenantIdentity string, massifIndex uint32,
+	opts ...ReaderOption,
+) (mmr.ConsistencyProof, error) {
+
+	options := ReaderOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	_, data, err := BlobRead(
+		ctx, options.logConfig.consistencyProofBlobPath(tenantIdentity, massifIndex), s.store,
+		options.remoteReadOpts...)
+	if err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	return DecodeConsistencyProof(s.codec, data)
+}
+
 // Get the signed tree head (SignedRoot) for the mmr massif.
 //
 // NOTICE: TO VERIFY YOU MUST obtain the mmr root from the log using the
@@ -165,7 +200,7 @@ func (s *SignedRootReader) GetSignedRoot(
 // {@link // https://eprint.iacr.org/2015/718.pdf}
 func (s *SignedRootReader) GetLatestMassifSignedRoot(
 	ctx context.Context, tenantIdentity string, massifIndex uint32,
-	opts ...azblob.Option,
+	opts ...ObjectOption,
 ) (*cose.CoseSign1Message, MMRState, error) {
 
 	logContext := LogBlobContext{
@@ -0,0 +1,389 @@
+package massifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+/**
+ * Snapshots
+ *
+ * A snapshot is a single, portable, archive of a complete tenant log. It is a
+ * tar archive containing every massif and seal, named by their replica
+ * relative paths (see ReplicaRelativeMassifInstancePath), followed by a
+ * manifest. So simply extracting the archive produces a replica directory
+ * usable with LogDirCache, configured with the log config from the manifest
+ * if the log has more than one instance. ImportSnapshot verifies every massif
+ * before anything is written.
+ */
+
+const (
+	SnapshotManifestName    = "manifest.cbor"
+	SnapshotManifestVersion = 1
+)
+
+var (
+	ErrSnapshotFormat           = errors.New("the snapshot archive is malformed")
+	ErrSnapshotIncomplete       = errors.New("the snapshot archive is missing a massif or seal")
+	ErrSnapshotManifestMismatch = errors.New("the snapshot manifest does not match the archived log")
+	ErrSnapshotSealSubject      = errors.New("the snapshot seal is not for the archived massif")
+	ErrSnapshotReplicaConflict  = errors.New("the snapshot does not extend the local replica")
+)
+
+// SnapshotManifest describes the log in a snapshot archive
+type SnapshotManifest struct {
+	Version        int    `cbor:"1,keyasint"`
+	TenantIdentity string `cbor:"2,keyasint"`
+	// LogConfig is the log instances, and their massif heights. It has a
+	// single instance unless the log was exported using WithLogConfig.
+	LogConfig   LogConfig `cbor:"3,keyasint"`
+	MassifCount uint32    `cbor:"4,keyasint"`
+	// State is the verified state from the seal of the last massif, including
+	// its peaks.
+	State MMRState `cbor:"5,keyasint"`
+}
+
+// ExportSnapshot writes a snapshot archive of the tenant log to w. Every
+// massif is verified against its seal, and against the previous massif,
+// before it is written. The options must include a seal getter and a CBOR
+// codec, and WithLogConfig if the log has more than one instance.
+func ExportSnapshot(
+	ctx context.Context, w io.Writer, massifs AuditMassifReader, tenantIdentity string,
+	opts ...ReaderOption,
+) (*SnapshotManifest, error) {
+
+	options, err := checkedVerifiedContextOptions(ReaderOptions{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := massifs.GetHeadMassif(ctx, tenantIdentity, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &SnapshotManifest{
+		Version:        SnapshotManifestVersion,
+		TenantIdentity: tenantIdentity,
+		LogConfig:      NewLogConfig(head.Start.MassifHeight),
+		MassifCount:    head.Start.MassifIndex + 1,
+	}
+	if options.logConfig != nil {
+		manifest.LogConfig = *options.logConfig
+	}
+	cfg := &manifest.LogConfig
+
+	tw := tar.NewWriter(w)
+	var trusted *MMRState
+	for massifIndex := range manifest.MassifCount {
+
+		mc := head
+		if massifIndex != head.Start.MassifIndex {
+			if mc, err = massifs.GetMassif(ctx, tenantIdentity, uint64(massifIndex), opts...); err != nil {
+				return nil, err
+			}
+		}
+		options.trustedBaseState = trusted
+		vc, err := mc.verifyContext(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+
+		sealBytes, err := vc.Sign1Message.MarshalCBOR()
+		if err != nil {
+			return nil, err
+		}
+		if err = writeSnapshotEntry(tw, cfg.replicaMassifPath(tenantIdentity, massifIndex), vc.Data); err != nil {
+			return nil, err
+		}
+		if err = writeSnapshotEntry(tw, cfg.replicaSealPath(tenantIdentity, massifIndex), sealBytes); err != nil {
+			return nil, err
+		}
+
+		manifest.State = vc.MMRState
+		if trusted, err = massifEndState(vc); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := options.codec.MarshalCBOR(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeSnapshotEntry(tw, SnapshotManifestName, data); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportSnapshot reads a snapshot archive and, if every massif verifies,
+// writes the log to the replica directory of the local reader.
+//
+// Each massif is verified against its archived seal, and against the previous
+// massif, and the last seal must match the manifest. Each seal must name its
+// massif as the subject, and archives with duplicate entries are rejected. The
+// massifs are located using the log config from the manifest, which must match
+// the log config of the local reader.
+//
+// If the replica already holds the tenant log, the snapshot must extend it.
+// The most recent local massif which verifies against its local seal is the
+// trusted state, as for the Replicator. The snapshot must include every local
+// massif, and be consistent with the trusted state, otherwise
+// ErrSnapshotReplicaConflict is returned and the replica is not changed.
+//
+// The options must include a CBOR codec, the seal getter is provided by the
+// archive. Unless WithTrustedSealerPub is provided, the seals are only
+// required to be signed by the key in the seal, so it should be provided when
+// importing an archive from an untrusted source. The archive is read into
+// memory in full.
+func ImportSnapshot(
+	ctx context.Context, r io.Reader, local *LocalReader, writeOpener WriteAppendOpener,
+	opts ...ReaderOption,
+) (*SnapshotManifest, error) {
+
+	if !local.InReplicaMode() {
+		return nil, fmt.Errorf("replica dir must be configured on the local reader")
+	}
+
+	seals := snapshotSeals{}
+	options, err := checkedVerifiedContextOptions(ReaderOptions{}, append(slices.Clone(opts), WithSealGetter(seals))...)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, ok := entries[hdr.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate entry %s", ErrSnapshotFormat, hdr.Name)
+		}
+		if entries[hdr.Name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+		}
+	}
+
+	manifestData, ok := entries[SnapshotManifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: no manifest", ErrSnapshotFormat)
+	}
+	var manifest SnapshotManifest
+	if err = options.codec.UnmarshalInto(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	if manifest.Version != SnapshotManifestVersion || manifest.MassifCount == 0 {
+		return nil, fmt.Errorf("%w: manifest version %d, massif count %d",
+			ErrSnapshotFormat, manifest.Version, manifest.MassifCount)
+	}
+	tenantIdentity := manifest.TenantIdentity
+	// The tenant identity names the replica directories written to
+	if !isTenantIdLike(tenantIdentity) || path.Clean(tenantIdentity) != tenantIdentity {
+		return nil, fmt.Errorf("%w: tenant identity %q", ErrSnapshotFormat, tenantIdentity)
+	}
+	cfg := &manifest.LogConfig
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	// The local reader writes the massifs to the paths of its own log config
+	localCfg := NewLogConfig(cfg.Instances[0].MassifHeight)
+	if local.instanceConfig() != nil {
+		localCfg = *local.instanceConfig()
+	}
+	if !slices.Equal(localCfg.Instances, cfg.Instances) {
+		return nil, fmt.Errorf("%w: the log config does not match the local reader", ErrSnapshotManifestMismatch)
+	}
+	options.logConfig = cfg
+
+	if err = local.EnsureReplicaDirs(tenantIdentity); err != nil {
+		return nil, err
+	}
+	localState, err := localSnapshotState(ctx, local, tenantIdentity, manifest.MassifCount, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var trusted *MMRState
+	var verified []*VerifiedContext
+	for massifIndex := range manifest.MassifCount {
+
+		data, ok := entries[cfg.replicaMassifPath(tenantIdentity, massifIndex)]
+		if !ok {
+			return nil, fmt.Errorf("%w: massif %d", ErrSnapshotIncomplete, massifIndex)
+		}
+		sealBytes, ok := entries[cfg.replicaSealPath(tenantIdentity, massifIndex)]
+		if !ok {
+			return nil, fmt.Errorf("%w: seal %d", ErrSnapshotIncomplete, massifIndex)
+		}
+
+		msg, state, err := DecodeSignedRoot(*options.codec, sealBytes)
+		if err != nil {
+			return nil, err
+		}
+		blobPath := cfg.massifBlobPath(tenantIdentity, massifIndex)
+		if subject, _ := cwtSubject(msg); subject != blobPath {
+			return nil, fmt.Errorf("%w: seal %d has subject %q", ErrSnapshotSealSubject, massifIndex, subject)
+		}
+		seals[massifIndex] = &SealedState{Sign1Message: *msg, MMRState: state}
+
+		mc := MassifContext{
+			TenantIdentity: tenantIdentity,
+			LogBlobContext: LogBlobContext{
+				BlobPath: blobPath,
+				Data:     data,
+			},
+		}
+		if err = mc.Start.UnmarshalBinary(mc.Data); err != nil {
+			return nil, err
+		}
+		if mc.Start.MassifIndex != massifIndex || cfg.FixupMassifStart(&mc.Start) != nil {
+			return nil, fmt.Errorf(
+				"%w: massif %d has index %d, height %d", ErrSnapshotManifestMismatch,
+				massifIndex, mc.Start.MassifIndex, mc.Start.MassifHeight)
+		}
+		if err = mc.CreatePeakStackMap(); err != nil {
+			return nil, err
+		}
+
+		options.trustedBaseState = trusted
+		vc, err := mc.verifyContext(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		if localState != nil && localState.massifIndex == massifIndex {
+			if err = localState.check(vc); err != nil {
+				return nil, err
+			}
+		}
+		verified = append(verified, vc)
+		if trusted, err = massifEndState(vc); err != nil {
+			return nil, err
+		}
+	}
+
+	// The manifest state must be the verified state of the last seal, in
+	// full. Both are compared in their canonical encoding.
+	last := verified[len(verified)-1].MMRState
+	lastData, err := options.codec.MarshalCBOR(last)
+	if err != nil {
+		return nil, err
+	}
+	manifestStateData, err := options.codec.MarshalCBOR(manifest.State)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(lastData, manifestStateData) {
+		return nil, fmt.Errorf("%w: MMR(%d), last seal MMR(%d)",
+			ErrSnapshotManifestMismatch, manifest.State.MMRSize, last.MMRSize)
+	}
+
+	for _, vc := range verified {
+		if err = local.ReplaceVerifiedContext(vc, writeOpener); err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+// replicaTrustedState is the trusted state of a local replica which a snapshot
+// must extend
+type replicaTrustedState struct {
+	massifIndex uint32
+	state       MMRState
+}
+
+// localSnapshotState returns the trusted state of the local replica of the
+// tenant log, or nil if there is no replica. The snapshot, of massifCount
+// massifs, must include every local massif.
+func localSnapshotState(
+	ctx context.Context, local *LocalReader, tenantIdentity string, massifCount uint32, opts []ReaderOption,
+) (*replicaTrustedState, error) {
+
+	head, err := local.GetHeadMassif(ctx, tenantIdentity, opts...)
+	if errors.Is(err, ErrLogFileMassifNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if head.Start.MassifIndex >= massifCount {
+		return nil, fmt.Errorf("%w: the replica has %d massifs, the snapshot %d",
+			ErrSnapshotReplicaConflict, head.Start.MassifIndex+1, massifCount)
+	}
+	vc, err := verifiedLocalMassif(ctx, local, head, opts)
+	if err != nil || vc == nil {
+		return nil, err
+	}
+	state := vc.MMRState
+	if state.Peaks, err = mmr.PeakHashes(&vc.MassifContext, state.MMRSize-1); err != nil {
+		return nil, err
+	}
+	return &replicaTrustedState{massifIndex: vc.Start.MassifIndex, state: state}, nil
+}
+
+// check returns an error if the verified snapshot massif, of the same index as
+// the trusted local massif, is not consistent with the trusted state.
+func (l *replicaTrustedState) check(vc *VerifiedContext) error {
+
+	if vc.Start.HashAlg != l.state.HashAlg || vc.RangeCount() < l.state.MMRSize {
+		return fmt.Errorf("%w: MMR(%d) %v, the replica is MMR(%d) %v", ErrSnapshotReplicaConflict,
+			vc.RangeCount(), vc.Start.HashAlg, l.state.MMRSize, l.state.HashAlg)
+	}
+	ok, _, err := mmr.CheckConsistency(
+		&vc.MassifContext, vc.Hasher(), l.state.MMRSize, vc.RangeCount(), l.state.Peaks)
+	if err != nil || !ok {
+		return fmt.Errorf("%w: massif %d is not consistent with the replica MMR(%d): %v",
+			ErrSnapshotReplicaConflict, l.massifIndex, l.state.MMRSize, err)
+	}
+	return nil
+}
+
+func writeSnapshotEntry(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// snapshotSeals is the seal getter for the seals read from an archive
+type snapshotSeals map[uint32]*SealedState
+
+func (s snapshotSeals) GetSignedRoot(
+	ctx context.Context, tenantIdentity string, massifIndex uint32,
+	opts ...ReaderOption,
+) (*cose.CoseSign1Message, MMRState, error) {
+	sealed, ok := s[massifIndex]
+	if !ok {
+		return nil, MMRState{}, fmt.Errorf("%w: seal %d", ErrSnapshotIncomplete, massifIndex)
+	}
+	return &sealed.Sign1Message, sealed.MMRState, nil
+}
@@ -0,0 +1,228 @@
+package massifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshot checks a log exported to a snapshot can be imported to a
+// replica, and that a tampered snapshot is not imported.
+func TestSnapshot(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log, _ := newSealedTestLog(t, tenant, massifHeight, testLeafEntries(0, 10))
+	store, codec := log.store, log.codec
+	reader := NewMassifReader(nil, store)
+	sealReader := log.sealReader()
+
+	var archive bytes.Buffer
+	manifest, err := ExportSnapshot(ctx, &archive, &reader, tenant, WithSealGetter(&sealReader), WithCBORCodec(codec))
+	require.NoError(t, err)
+	assert.Equal(t, tenant, manifest.TenantIdentity)
+	assert.Equal(t, NewLogConfig(massifHeight), manifest.LogConfig)
+	assert.Equal(t, uint32(3), manifest.MassifCount)
+	assert.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(9)), manifest.State.MMRSize)
+
+	newLocalReader := func(replicaDir string) LocalReader {
+		cache, err := NewLogDirCache(nil, testOSOpener{},
+			WithDirCacheReplicaDir(replicaDir),
+			WithDirCacheMassifLister(testOSDirLister{}),
+			WithDirCacheSealLister(testOSDirLister{}),
+			WithReaderOption(WithCBORCodec(codec)),
+			WithReaderOption(WithMassifHeight(massifHeight)),
+		)
+		require.NoError(t, err)
+		localReader, err := NewLocalReader(nil, cache)
+		require.NoError(t, err)
+		return localReader
+	}
+
+	replicaDir := t.TempDir()
+	localReader := newLocalReader(replicaDir)
+	imported, err := ImportSnapshot(
+		ctx, bytes.NewReader(archive.Bytes()), &localReader, AtomicFileWriteOpener{}, WithCBORCodec(codec))
+	require.NoError(t, err)
+	assert.Equal(t, manifest.State.MMRSize, imported.State.MMRSize)
+
+	localReader = newLocalReader(replicaDir)
+	for massifIndex := range uint64(3) {
+		_, err := localReader.GetVerifiedContext(ctx, tenant, massifIndex, WithSealGetter(&localReader))
+		require.NoError(t, err)
+	}
+
+	// rewrite re-writes the archive, edit writes the entries
+	rewrite := func(edit func(tw *tar.Writer, name string, data []byte)) []byte {
+		var tampered bytes.Buffer
+		tr, tw := tar.NewReader(bytes.NewReader(archive.Bytes())), tar.NewWriter(&tampered)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			edit(tw, hdr.Name, data)
+		}
+		require.NoError(t, tw.Close())
+		return tampered.Bytes()
+	}
+	replace := func(name string, replacement []byte) []byte {
+		return rewrite(func(tw *tar.Writer, entryName string, data []byte) {
+			if entryName == name {
+				data = replacement
+			}
+			require.NoError(t, writeSnapshotEntry(tw, entryName, data))
+		})
+	}
+	// tamper re-writes the archive with the last byte of the entry flipped
+	tamper := func(name string) []byte {
+		return rewrite(func(tw *tar.Writer, entryName string, data []byte) {
+			if entryName == name {
+				data[len(data)-1] ^= 0xff
+			}
+			require.NoError(t, writeSnapshotEntry(tw, entryName, data))
+		})
+	}
+	importArchive := func(data []byte) error {
+		_, err := ImportSnapshot(
+			ctx, bytes.NewReader(data), &localReader, AtomicFileWriteOpener{}, WithCBORCodec(codec))
+		return err
+	}
+
+	replicaDir = t.TempDir()
+	localReader = newLocalReader(replicaDir)
+	_, err = ImportSnapshot(
+		ctx, bytes.NewReader(tamper(ReplicaRelativeMassifPath(tenant, 1))), &localReader,
+		AtomicFileWriteOpener{}, WithCBORCodec(codec))
+	require.Error(t, err)
+	// Nothing is written unless the whole log verifies
+	_, err = os.Stat(localReader.GetMassifLocalPath(tenant, 0))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = ImportSnapshot(
+		ctx, bytes.NewReader(tamper(SnapshotManifestName)), &localReader,
+		AtomicFileWriteOpener{}, WithCBORCodec(codec))
+	require.Error(t, err)
+
+	// An entry may only appear once
+	err = importArchive(rewrite(func(tw *tar.Writer, name string, data []byte) {
+		require.NoError(t, writeSnapshotEntry(tw, name, data))
+		if name == ReplicaRelativeMassifPath(tenant, 0) {
+			require.NoError(t, writeSnapshotEntry(tw, name, data))
+		}
+	}))
+	assert.ErrorIs(t, err, ErrSnapshotFormat)
+
+	// Every field of the manifest state must match the last seal
+	editManifest := func(edit func(m *SnapshotManifest)) []byte {
+		m := *manifest
+		edit(&m)
+		data, err := codec.MarshalCBOR(&m)
+		require.NoError(t, err)
+		return replace(SnapshotManifestName, data)
+	}
+	err = importArchive(editManifest(func(m *SnapshotManifest) { m.State.TrieRoot = make([]byte, 32) }))
+	assert.ErrorIs(t, err, ErrSnapshotManifestMismatch)
+	err = importArchive(editManifest(func(m *SnapshotManifest) { m.State.HashAlg = HashAlgSHA3_256 }))
+	assert.ErrorIs(t, err, ErrSnapshotManifestMismatch)
+
+	// The tenant identity names the directories written to
+	err = importArchive(editManifest(func(m *SnapshotManifest) { m.TenantIdentity = "tenant/.." }))
+	assert.ErrorIs(t, err, ErrSnapshotFormat)
+	err = importArchive(editManifest(func(m *SnapshotManifest) { m.TenantIdentity = "../tenant/1" }))
+	assert.ErrorIs(t, err, ErrSnapshotFormat)
+
+	// Each seal must be for its massif
+	mc, err := reader.GetMassif(ctx, tenant, 1)
+	require.NoError(t, err)
+	peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	sealed, err := log.signer.SealedState("tenant/2", 1, MMRState{
+		Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks, Timestamp: 1234})
+	require.NoError(t, err)
+	sealBytes, err := sealed.Sign1Message.MarshalCBOR()
+	require.NoError(t, err)
+	err = importArchive(replace(ReplicaRelativeSealPath(tenant, 1), sealBytes))
+	assert.ErrorIs(t, err, ErrSnapshotSealSubject)
+}
+
+// TestSnapshot_ExistingReplica checks a snapshot is only imported over an
+// existing replica if it extends it.
+func TestSnapshot_ExistingReplica(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+
+	// newLog returns a function which grows the log to the number of leaves,
+	// seals it, and exports it
+	newLog := func(base uint64) func(leafCount uint64) []byte {
+		log := newTestLog(t, tenant, massifHeight, nil)
+		reader := NewMassifReader(nil, log.store)
+		sealReader := log.sealReader()
+		var count uint64
+		return func(leafCount uint64) []byte {
+			log.addLeaves(t, testLeafEntries(base+count, leafCount-count))
+			count = leafCount
+			log.seal(t)
+			var archive bytes.Buffer
+			_, err := ExportSnapshot(ctx, &archive, &reader, tenant, WithSealGetter(&sealReader), WithCBORCodec(codec))
+			require.NoError(t, err)
+			return archive.Bytes()
+		}
+	}
+	export := newLog(0)
+	archive6, archive9, archive10 := export(6), export(9), export(10)
+	fork10 := newLog(100)(10)
+
+	cache, err := NewLogDirCache(nil, testOSOpener{},
+		WithDirCacheReplicaDir(t.TempDir()),
+		WithDirCacheMassifLister(testOSDirLister{}),
+		WithDirCacheSealLister(testOSDirLister{}),
+		WithReaderOption(WithCBORCodec(codec)),
+		WithReaderOption(WithMassifHeight(massifHeight)),
+	)
+	require.NoError(t, err)
+	localReader, err := NewLocalReader(nil, cache)
+	require.NoError(t, err)
+	importArchive := func(data []byte) error {
+		_, err := ImportSnapshot(
+			ctx, bytes.NewReader(data), &localReader, AtomicFileWriteOpener{}, WithCBORCodec(codec))
+		return err
+	}
+
+	require.NoError(t, importArchive(archive10))
+
+	// Fewer massifs, a shorter head massif, and a fork, are refused
+	assert.ErrorIs(t, importArchive(archive6), ErrSnapshotReplicaConflict)
+	assert.ErrorIs(t, importArchive(archive9), ErrSnapshotReplicaConflict)
+	assert.ErrorIs(t, importArchive(fork10), ErrSnapshotReplicaConflict)
+
+	head, err := localReader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	assert.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(9)), head.RangeCount())
+
+	// The same log, and an extension of it, are imported
+	require.NoError(t, importArchive(archive10))
+	require.NoError(t, importArchive(export(13)))
+	head, err = localReader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	assert.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(12)), head.RangeCount())
+	_, err = localReader.GetVerifiedContext(ctx, tenant, uint64(head.Start.MassifIndex), WithSealGetter(&localReader))
+	require.NoError(t, err)
+}
@@ -28,6 +28,7 @@ type IDState struct {
 	seqMask uint64
 	seqBits int
 
+	epoch                    uint8
 	epochStartWallClock      time.Time     // will *not* include the monotonic clock reading
 	generatorStart           time.Time     // Will include the monotonic clock reading
 	generatorStartWallOffset time.Duration // generatorStart - epochStart, does NOT include monotonic reading
@@ -51,6 +52,7 @@ var (
 	ErrOverloaded        = errors.New("the id generator is over loaded for its configuration")
 	ErrClockError        = errors.New("the reading from system time doesn't make any realistic sense")
 	ErrSequenceViolation = errors.New("the generator produced two consecutive values that violate either the monotonic or the uniqueness promises")
+	ErrEpochExhausted    = errors.New("the time is beyond the end of the generator commitment epoch")
 
 	// The nanosecond unix time overflows an int64 on 2262
 	// https://pkg.go.dev/time#Time.UnixNano. This is used for an error clause
@@ -95,6 +97,11 @@ func EpochTimeUTC(epoch uint8) time.Time {
 	return time.UnixMilli(startMS).UTC()
 }
 
+// EpochForTime returns the commitment epoch which contains the time
+func EpochForTime(t time.Time) uint8 {
+	return uint8(t.UnixMilli() / EpochMS(1))
+}
+
 // millisecondMonotonicNow returns a monotonic epoch time sample. It is based of
 // a reference wall clock time read when the process initialized the IDState
 func (s *IDState) millisecondMonotonicNow() uint64 {
@@ -221,6 +228,13 @@ func (s *IDState) NextID() (uint64, error) {
 			return 0, fmt.Errorf("%016x:%016x %02x:%02x %d:%d:%w", last, next, lastSeq, s.seqMask, lastTime, now, ErrSequenceViolation)
 		}
 
+		// The last millisecond of an epoch is the first of the next, see
+		// EpochMS. Once it is reached, ids can only be generated by a new
+		// generator configured for the next epoch.
+		if next>>TimeShift >= uint64(EpochMS(1)) {
+			return 0, fmt.Errorf("epoch %d: %w", s.epoch, ErrEpochExhausted)
+		}
+
 		if s.monotonic.CompareAndSwap(last, next) {
 			// We got through the above logic without being beaten to the draw
 			// by another thread so our resulting value was updated consistently
@@ -258,6 +272,11 @@ func (s *IDState) EpochStart() time.Time {
 	return s.epochStartWallClock
 }
 
+// Epoch returns the commitment epoch the generated ids are relative to
+func (s *IDState) Epoch() uint8 {
+	return s.epoch
+}
+
 func (s *IDState) initTime(epoch uint8) error {
 
 	// https://github.com/datatrails/epic-8120-scalable-proof-mechanisms/blob/6a0385bbfd0a8cbadfd18a1e51955333cbb75271/forestrie-snowflakeid.md#datatrails-commitment-epoch
@@ -281,6 +300,7 @@ func (s *IDState) initTime(epoch uint8) error {
 	}
 
 	startMS := EpochMS(epoch)
+	s.epoch = epoch
 	s.epochStartWallClock = time.UnixMilli(startMS).UTC()
 	s.generatorStartWallOffset = s.generatorStart.Sub(s.epochStartWallClock)
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Benchmark_NextIDStressTest stresses the id generator has hard as the host CPU
@@ -191,3 +192,31 @@ func TestIDState_initState(t *testing.T) {
 		})
 	}
 }
+
+// TestIDState_EpochExhausted checks ids are not generated past the end of the
+// generator epoch, where they would overflow the time bits.
+func TestIDState_EpochExhausted(t *testing.T) {
+	s, err := NewIDState(Config{CommitmentEpoch: 1, WorkerCIDR: "0.0.0.0/16", PodIP: "10.0.0.1", AllowSpins: 1})
+	if err != nil {
+		t.Fatalf("NewIDState: %v", err)
+	}
+	if s.Epoch() != 1 {
+		t.Fatalf("Epoch() = %d, want 1", s.Epoch())
+	}
+	if _, err = s.NextID(); err != nil {
+		t.Fatalf("NextID: %v", err)
+	}
+
+	// Pretend the generator started at the end of the epoch
+	s.generatorStartWallOffset = time.Duration(EpochMS(1)) * time.Millisecond
+	if _, err = s.NextID(); !errors.Is(err, ErrEpochExhausted) {
+		t.Fatalf("NextID error = %v, want %v", err, ErrEpochExhausted)
+	}
+
+	if epoch := EpochForTime(EpochTimeUTC(2)); epoch != 2 {
+		t.Fatalf("EpochForTime() = %d, want 2", epoch)
+	}
+	if epoch := EpochForTime(EpochTimeUTC(2).Add(-time.Millisecond)); epoch != 1 {
+		t.Fatalf("EpochForTime() = %d, want 1", epoch)
+	}
+}
@@ -0,0 +1,103 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+var (
+	ErrStateSizeOrder = errors.New("the size of the from state must not exceed the size of the to state")
+)
+
+// ConsistencyProof generates a proof that the log described by the from state
+// is contained in the log described by the to state.
+//
+// The states may be for any sizes present in the log, typically they are the
+// states from the seals of two different massifs. Only the massifs containing
+// the nodes on the proof paths are read.
+func (s *MultiMassifStore) ConsistencyProof(from, to MMRState) (mmr.ConsistencyProof, error) {
+
+	if from.MMRSize == 0 || from.MMRSize > to.MMRSize {
+		return mmr.ConsistencyProof{}, fmt.Errorf(
+			"%w: %d > %d", ErrStateSizeOrder, from.MMRSize, to.MMRSize)
+	}
+
+	cp, err := mmr.IndexConsistencyProof(s, from.MMRSize-1, to.MMRSize-1)
+	if err != nil {
+		return mmr.ConsistencyProof{}, fmt.Errorf(
+			"%w: tenant=%s, from=%d, to=%d: %w",
+			ErrGeneratingConsistencyProof, s.tenantIdentity, from.MMRSize, to.MMRSize, err)
+	}
+	return cp, nil
+}
+
+// CheckConsistency generates the consistency proof between the two states and
+// verifies it, see VerifyStateConsistency. The proof is returned on success.
+func (s *MultiMassifStore) CheckConsistency(from, to MMRState) (mmr.ConsistencyProof, error) {
+
+	cp, err := s.ConsistencyProof(from, to)
+	if err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	if err = VerifyStateConsistency(cp, from, to); err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	return cp, nil
+}
+
+// VerifyStateConsistency verifies that the proof shows the accumulator of the
+// from state is contained in the accumulator of the to state.
+//
+// Both states must be version 1 or later, as the peaks are required. The
+// states are typically obtained from verified seals, and the proof from an
+// untrusted source. No access to the log is required.
+func VerifyStateConsistency(cp mmr.ConsistencyProof, from, to MMRState) error {
+
+	if from.Peaks == nil || to.Peaks == nil {
+		return ErrStateRootMissing
+	}
+	if cp.MMRSizeA != from.MMRSize || cp.MMRSizeB != to.MMRSize {
+		return fmt.Errorf(
+			"%w: proof sizes %d -> %d do not match the states %d -> %d",
+			ErrConsistencyProofCheck, cp.MMRSizeA, cp.MMRSizeB, from.MMRSize, to.MMRSize)
+	}
+
+	if from.HashAlg != to.HashAlg {
+		return fmt.Errorf("%w: %v -> %v", ErrHashAlgMismatch, from.HashAlg, to.HashAlg)
+	}
+	if err := checkHashAlg(to.HashAlg); err != nil {
+		return err
+	}
+
+	ok, _, err := mmr.VerifyConsistency(to.HashAlg.New(), cp, from.Peaks, to.Peaks)
+	if errors.Is(err, mmr.ErrConsistencyCheck) {
+		return fmt.Errorf("%w: %d -> %d: %w", ErrInconsistentState, from.MMRSize, to.MMRSize, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %d -> %d: %w", ErrConsistencyProofCheck, from.MMRSize, to.MMRSize, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %d -> %d", ErrInconsistentState, from.MMRSize, to.MMRSize)
+	}
+	return nil
+}
+
+// EncodeConsistencyProof encodes the proof for storage alongside a seal, see
+// TenantMassifConsistencyProofPath. The codec should be the codec used for the
+// seals, see NewRootSignerCodec.
+func EncodeConsistencyProof(codec commoncbor.CBORCodec, cp mmr.ConsistencyProof) ([]byte, error) {
+	return codec.MarshalCBOR(cp)
+}
+
+// DecodeConsistencyProof decodes a proof encoded by EncodeConsistencyProof. The
+// proof is not verified, see VerifyStateConsistency.
+func DecodeConsistencyProof(codec commoncbor.CBORCodec, data []byte) (mmr.ConsistencyProof, error) {
+	var cp mmr.ConsistencyProof
+	if err := codec.UnmarshalInto(data, &cp); err != nil {
+		return mmr.ConsistencyProof{}, err
+	}
+	return cp, nil
+}
@@ -0,0 +1,62 @@
+package massifs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMultiMassifStore_CheckConsistency checks consistency between the states
+// of every pair of massifs in a log, which is only possible within a single
+// massif for adjacent states.
+func TestMultiMassifStore_CheckConsistency(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 41))
+	reader := NewMassifReader(nil, log.store)
+	head, err := reader.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+
+	// The state at the end of each massif, taken from the massif itself
+	var states []MMRState
+	for massifIndex := range uint64(head.Start.MassifIndex) + 1 {
+		mc, err := reader.GetMassif(ctx, tenant, massifIndex)
+		require.NoError(t, err)
+		peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		states = append(states, MMRState{Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks})
+	}
+
+	s := NewMultiMassifStore(ctx, &reader, tenant, massifHeight, 0)
+	for i := range states {
+		for j := i; j < len(states); j++ {
+			cp, err := s.CheckConsistency(states[i], states[j])
+			require.NoError(t, err, "%d -> %d", i, j)
+			assert.Equal(t, states[i].MMRSize, cp.MMRSizeA)
+			assert.Equal(t, states[j].MMRSize, cp.MMRSizeB)
+		}
+	}
+
+	from, to := states[3], states[len(states)-1]
+	cp, err := s.ConsistencyProof(from, to)
+	require.NoError(t, err)
+
+	// A from state which is not in the log
+	forked := from
+	forked.Peaks = append([][]byte{}, from.Peaks...)
+	forked.Peaks[0] = bytes.Repeat([]byte{1}, 32)
+	assert.ErrorIs(t, VerifyStateConsistency(cp, forked, to), ErrInconsistentState)
+
+	// A proof for different sizes
+	assert.ErrorIs(t, VerifyStateConsistency(cp, states[2], to), ErrConsistencyProofCheck)
+
+	assert.ErrorIs(t, VerifyStateConsistency(cp, MMRState{MMRSize: from.MMRSize}, to), ErrStateRootMissing)
+
+	_, err = s.ConsistencyProof(to, from)
+	assert.ErrorIs(t, err, ErrStateSizeOrder)
+}
@@ -0,0 +1,140 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Object stores without a native tag index evaluate the azure blob tag filter
+// syntax themselves. The supported subset is that used by the log watchers:
+//
+//	"lastid">='018e84dbbb6513a6' AND firstindex>'0000000000000000'
+//
+// Keys may be bare or double quoted, values are single quoted and predicates
+// are joined with AND. Comparisons are lexical, as they are for azure. As the
+// non azure stores are not shared by containers, @container predicates are
+// accepted and always match.
+
+var (
+	ErrTagFilterInvalid = errors.New("invalid tag filter expression")
+)
+
+const (
+	tagFilterContainerKey = "@container"
+)
+
+// TagPredicate is a single comparison from a tag filter expression
+type TagPredicate struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// TagFilter is a parsed tag filter expression, all predicates must match
+type TagFilter []TagPredicate
+
+// ParseTagFilter parses the azure blob tag filter syntax.
+func ParseTagFilter(expr string) (TagFilter, error) {
+
+	var filter TagFilter
+
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return filter, nil
+	}
+
+	for {
+		var p TagPredicate
+		var err error
+
+		if p.Key, s, err = parseTagFilterKey(s); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTagFilterInvalid, expr, err)
+		}
+		if p.Op, s, err = parseTagFilterOp(s); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTagFilterInvalid, expr, err)
+		}
+		if p.Value, s, err = parseTagFilterValue(s); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTagFilterInvalid, expr, err)
+		}
+		filter = append(filter, p)
+
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return filter, nil
+		}
+		if len(s) < 4 || !strings.EqualFold(s[:3], "and") || (s[3] != ' ' && s[3] != '\t' && s[3] != '"') {
+			return nil, fmt.Errorf("%w: %s: expected AND at '%s'", ErrTagFilterInvalid, expr, s)
+		}
+		s = strings.TrimSpace(s[3:])
+	}
+}
+
+// Match returns true if the tags satisfy all the predicates in the filter. A
+// missing tag never matches.
+func (f TagFilter) Match(tags map[string]string) bool {
+	for _, p := range f {
+		if p.Key == tagFilterContainerKey {
+			continue
+		}
+		v, ok := tags[p.Key]
+		if !ok {
+			return false
+		}
+		c := strings.Compare(v, p.Value)
+		switch p.Op {
+		case "=":
+			ok = c == 0
+		case ">":
+			ok = c > 0
+		case ">=":
+			ok = c >= 0
+		case "<":
+			ok = c < 0
+		case "<=":
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTagFilterKey(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "\"") {
+		end := strings.Index(s[1:], "\"")
+		if end < 0 {
+			return "", s, errors.New("unterminated key")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexAny(s, "=<> \t")
+	if end <= 0 {
+		return "", s, errors.New("missing key")
+	}
+	return s[:end], s[end:], nil
+}
+
+func parseTagFilterOp(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	for _, op := range []string{">=", "<=", "=", ">", "<"} {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):], nil
+		}
+	}
+	return "", s, errors.New("missing operator")
+}
+
+func parseTagFilterValue(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "'") {
+		return "", s, errors.New("value must be single quoted")
+	}
+	end := strings.Index(s[1:], "'")
+	if end < 0 {
+		return "", s, errors.New("unterminated value")
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
@@ -0,0 +1,64 @@
+package massifs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagFilter(t *testing.T) {
+	tags := map[string]string{
+		"lastid":     "018e84dbbb6513a6",
+		"firstindex": "0000000000000010",
+	}
+	tests := []struct {
+		name      string
+		expr      string
+		want      TagFilter
+		wantMatch bool
+		wantErr   bool
+	}{
+		{name: "empty", expr: "", want: nil, wantMatch: true},
+		{
+			name: "quoted key", expr: `"lastid">='018e84dbbb6513a6'`,
+			want:      TagFilter{{Key: "lastid", Op: ">=", Value: "018e84dbbb6513a6"}},
+			wantMatch: true,
+		},
+		{
+			name: "bare key", expr: `lastid > '018e84dbbb6513a6'`,
+			want:      TagFilter{{Key: "lastid", Op: ">", Value: "018e84dbbb6513a6"}},
+			wantMatch: false,
+		},
+		{
+			name: "and, container", expr: `@container='merklelogs' and firstindex<='0000000000000010' AND "lastid"<'1'`,
+			want: TagFilter{
+				{Key: "@container", Op: "=", Value: "merklelogs"},
+				{Key: "firstindex", Op: "<=", Value: "0000000000000010"},
+				{Key: "lastid", Op: "<", Value: "1"},
+			},
+			wantMatch: true,
+		},
+		{
+			name: "missing tag", expr: `other='x'`,
+			want:      TagFilter{{Key: "other", Op: "=", Value: "x"}},
+			wantMatch: false,
+		},
+		{name: "unquoted value", expr: `lastid>=018e`, wantErr: true},
+		{name: "missing op", expr: `lastid '018e'`, wantErr: true},
+		{name: "or is not supported", expr: `a='1' OR b='2'`, wantErr: true},
+		{name: "unterminated", expr: `"lastid>='1'`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTagFilter(tt.expr)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrTagFilterInvalid)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantMatch, got.Match(tags))
+		})
+	}
+}
@@ -17,8 +17,12 @@ const (
 	V1MMRSealSignedRootExt           = "sth" // Signed Tree Head
 	V1MMRConsistencyProofBlobNameFmt = "%016d.cproof"
 	V1MMRSealCPROOF                  = "cproof" // Consistency Proof
+	V1MMRTrieIndexBlobNameFmt        = "%016d.tidx"
+	V1MMRTrieIndexExt                = "tidx" // Trie key lookup index
+	V1MMRSealKeyHistoryBlobName      = "sealkeys.cbor"
 	// LogInstanceN refers to the approach for handling blob size and format changes discussed at
 	// [Changing the massifheight for a log](https://github.com/datatrails/epic-8120-scalable-proof-mechanisms/blob/1cb966cc10af03ae041fea4bca44b10979fb1eda/mmr/forestrie-mmrblobs.md#changing-the-massifheight-for-a-log)
+	// It is the initial instance of every log, see LogConfig for later instances.
 
 	LogInstanceN = 0
 )
@@ -29,11 +33,15 @@ const (
 // the provided tenant identity. It is the callers responsibility to ensure the
 // tenant identity has the correct form. 'tenant/uuid'
 func TenantMassifPrefix(tenantIdentity string) string {
+	return TenantMassifInstancePrefix(tenantIdentity, LogInstanceN)
+}
+
+// TenantMassifInstancePrefix returns the path to the location of the massif
+// blobs for the identified log instance of the tenant. See LogConfig
+func TenantMassifInstancePrefix(tenantIdentity string, instance uint32) string {
 	return fmt.Sprintf(
-		"%s/%s/%d/massifs/", V1MMRPrefix, tenantIdentity,
-		LogInstanceN,
+		"%s/%s/%d/massifs/", V1MMRPrefix, tenantIdentity, instance,
 	)
-
 }
 
 // MassifPrefixForTenantUUID return the path to the location of the massif blobs
@@ -51,9 +59,14 @@ func MassifPrefixForTenantUUID(tenantUUID string) string {
 // The signatures and proofs necessary to associate the operator with the log
 // and attest to its good operation.
 func TenantMassifSignedRootsPrefix(tenantIdentity string) string {
+	return TenantMassifSignedRootsInstancePrefix(tenantIdentity, LogInstanceN)
+}
+
+// TenantMassifSignedRootsInstancePrefix returns the path to the location of
+// the seals for the identified log instance of the tenant. See LogConfig
+func TenantMassifSignedRootsInstancePrefix(tenantIdentity string, instance uint32) string {
 	return fmt.Sprintf(
-		"%s/%s/%d/massifseals/", V1MMRPrefix, tenantIdentity,
-		LogInstanceN,
+		"%s/%s/%d/massifseals/", V1MMRPrefix, tenantIdentity, instance,
 	)
 }
 
@@ -67,8 +80,15 @@ func TenantMassifSignedRootsPrefix(tenantIdentity string) string {
 // Because azure blob names and tags sort and compare only *lexically*, The
 // number is represented in that path as a 16 digit hex string.
 func TenantMassifBlobPath(tenantIdentity string, number uint64) string {
+	return TenantMassifInstanceBlobPath(tenantIdentity, LogInstanceN, number)
+}
+
+// TenantMassifInstanceBlobPath returns the blob path for the massif in the
+// identified log instance. Massif numbers continue across instances, so the
+// number is the logical massif index.
+func TenantMassifInstanceBlobPath(tenantIdentity string, instance uint32, number uint64) string {
 	return fmt.Sprintf(
-		"%s%s", TenantMassifPrefix(tenantIdentity), fmt.Sprintf(V1MMRBlobNameFmt, number),
+		"%s%s", TenantMassifInstancePrefix(tenantIdentity, instance), fmt.Sprintf(V1MMRBlobNameFmt, number),
 	)
 }
 
@@ -86,6 +106,20 @@ func ReplicaRelativeSealPath(tenantIdentity string, number uint32) string {
 		TenantMassifSignedRootPath(tenantIdentity, number), V1MMRPrefix+"/")
 }
 
+// ReplicaRelativeMassifInstancePath returns the replica relative path for the
+// massif in the identified log instance
+func ReplicaRelativeMassifInstancePath(tenantIdentity string, instance uint32, number uint32) string {
+	return strings.TrimPrefix(
+		TenantMassifInstanceBlobPath(tenantIdentity, instance, uint64(number)), V1MMRPrefix+"/")
+}
+
+// ReplicaRelativeSealInstancePath returns the replica relative path for the
+// seal in the identified log instance
+func ReplicaRelativeSealInstancePath(tenantIdentity string, instance uint32, number uint32) string {
+	return strings.TrimPrefix(
+		TenantMassifInstanceSignedRootPath(tenantIdentity, instance, number), V1MMRPrefix+"/")
+}
+
 // TenantMassifSignedRootPath returns the appropriate blob path for the blob
 // root seal
 //
@@ -97,9 +131,68 @@ func ReplicaRelativeSealPath(tenantIdentity string, number uint32) string {
 // Because azure blob names and tags sort and compare only *lexically*, The
 // number is represented in that path as a 16 digit hex string.
 func TenantMassifSignedRootPath(tenantIdentity string, massifIndex uint32) string {
+	return TenantMassifInstanceSignedRootPath(tenantIdentity, LogInstanceN, massifIndex)
+}
+
+// TenantMassifInstanceSignedRootPath returns the blob path for the seal of the
+// massif in the identified log instance
+func TenantMassifInstanceSignedRootPath(tenantIdentity string, instance uint32, massifIndex uint32) string {
 	return fmt.Sprintf(
 		"%s%s",
-		TenantMassifSignedRootsPrefix(tenantIdentity),
+		TenantMassifSignedRootsInstancePrefix(tenantIdentity, instance),
 		fmt.Sprintf(V1MMRSignedTreeHeadBlobNameFmt, massifIndex),
 	)
 }
+
+// TenantMassifConsistencyProofPath returns the blob path for the consistency
+// proof stored with the seal of the massif. The proof shows the sealed state
+// is consistent with the state of the seal which preceded it.
+func TenantMassifConsistencyProofPath(tenantIdentity string, massifIndex uint32) string {
+	return TenantMassifInstanceConsistencyProofPath(tenantIdentity, LogInstanceN, massifIndex)
+}
+
+// TenantMassifInstanceConsistencyProofPath returns the blob path for the
+// consistency proof of the massif seal in the identified log instance
+func TenantMassifInstanceConsistencyProofPath(tenantIdentity string, instance uint32, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s",
+		TenantMassifSignedRootsInstancePrefix(tenantIdentity, instance),
+		fmt.Sprintf(V1MMRConsistencyProofBlobNameFmt, massifIndex),
+	)
+}
+
+// TenantSealKeyHistoryPath returns the blob path for the history of the keys
+// which seal the tenant log, see SealKeyHistory. The MMR sizes the keys are
+// valid from continue across log instances, so there is one history for the
+// tenant, rather than one for each instance.
+func TenantSealKeyHistoryPath(tenantIdentity string) string {
+	return fmt.Sprintf("%s/%s/%s", V1MMRPrefix, tenantIdentity, V1MMRSealKeyHistoryBlobName)
+}
+
+// TenantMassifTrieIndexPrefix returns the path to the location of the trie
+// key lookup indices for the provided tenant identity. The indices are derived
+// entirely from the massifs, so are not published by datatrails, they exist
+// only in local replicas.
+func TenantMassifTrieIndexPrefix(tenantIdentity string) string {
+	return fmt.Sprintf(
+		"%s/%s/%d/massiftrieindex/", V1MMRPrefix, tenantIdentity,
+		LogInstanceN,
+	)
+}
+
+// TenantMassifTrieIndexPath returns the path for the trie key lookup index of
+// the identified massif. See TrieIndex
+func TenantMassifTrieIndexPath(tenantIdentity string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s",
+		TenantMassifTrieIndexPrefix(tenantIdentity),
+		fmt.Sprintf(V1MMRTrieIndexBlobNameFmt, massifIndex),
+	)
+}
+
+// ReplicaRelativeTrieIndexPath returns the trie index path with the datatrails
+// specific hosting location stripped, consistent with ReplicaRelativeMassifPath
+func ReplicaRelativeTrieIndexPath(tenantIdentity string, massifIndex uint32) string {
+	return strings.TrimPrefix(
+		TenantMassifTrieIndexPath(tenantIdentity, massifIndex), V1MMRPrefix+"/")
+}
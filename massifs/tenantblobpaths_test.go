@@ -106,6 +106,27 @@ func TestTenantMassifSignedRootPath(t *testing.T) {
 	}
 }
 
+func TestTenantMassifConsistencyProofPath(t *testing.T) {
+	type args struct {
+		tenantIdentity string
+		massifIndex    uint32
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{args: args{"tenant/1234", 1}, want: "v1/mmrs/tenant/1234/0/massifseals/0000000000000001.cproof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TenantMassifConsistencyProofPath(tt.args.tenantIdentity, tt.args.massifIndex); got != tt.want {
+				t.Errorf("TenantMassifConsistencyProofPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTenantRelativeMassifPath(t *testing.T) {
 	type args struct {
 		tenantIdentity string
@@ -147,3 +168,20 @@ func TestTenantRelativeSealPath(t *testing.T) {
 		})
 	}
 }
+
+func TestTenantSealKeyHistoryPath(t *testing.T) {
+	tests := []struct {
+		name           string
+		tenantIdentity string
+		want           string
+	}{
+		{tenantIdentity: "tenant/1234", want: "v1/mmrs/tenant/1234/sealkeys.cbor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TenantSealKeyHistoryPath(tt.tenantIdentity); got != tt.want {
+				t.Errorf("TenantSealKeyHistoryPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
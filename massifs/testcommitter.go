@@ -6,12 +6,10 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"time"
 
-	"github.com/datatrails/go-datatrails-common/azblob"
 	"github.com/datatrails/go-datatrails-common/cose"
 	"github.com/datatrails/go-datatrails-common/logger"
 	"github.com/datatrails/go-datatrails-merklelog/mmr"
@@ -57,7 +55,7 @@ func NewTestMinimalCommitter(
 		tc:  tc,
 		g:   g,
 		committer: *NewMassifCommitter(
-			MassifCommitterConfig{CommitmentEpoch: cfg.CommitmentEpoch}, log, tc.GetStorer()),
+			MassifCommitterConfig{CommitmentEpoch: cfg.CommitmentEpoch}, log, NewAzBlobObjectStore(tc.GetStorer())),
 		leafGenerator: leafGenerator,
 	}
 	if !c.Cfg.SealOnCommit {
@@ -103,11 +101,12 @@ func (c *TestMinimalCommitter) ContextCommitted(ctx context.Context, tenantIdent
 		Timestamp:       time.Now().UnixMilli(),
 		CommitmentEpoch: c.Cfg.CommitmentEpoch,
 		IDTimestamp:     mc.GetLastIdTimestamp(),
+		HashAlg:         mc.Start.HashAlg,
 	}
 
 	if c.Cfg.UseV0Seals {
 		// downgrade the seal to v0
-		state.LegacySealRoot = mmr.HashPeaksRHS(sha256.New(), peaks)
+		state.LegacySealRoot = mmr.HashPeaksRHS(mc.Hasher(), peaks)
 		state.Peaks = nil
 		state.Version = int(MMRStateVersion0)
 		// everything else is the same
@@ -136,7 +135,7 @@ func (c *TestMinimalCommitter) ContextCommitted(ctx context.Context, tenantIdent
 	tags[TagKeyLastID] = lastid
 
 	// just put it hard, without the etag check
-	_, err = c.committer.Store.Put(ctx, blobPath, azblob.NewBytesReaderCloser(data), azblob.WithTags(tags))
+	_, err = c.committer.Store.Put(ctx, blobPath, data, WithPutTags(tags))
 	if err != nil {
 		return err
 	}
@@ -158,7 +157,7 @@ func (c *TestMinimalCommitter) AddLeaves(
 	require.NoError(c.tc.T, err)
 	batch := c.g.GenerateNumberedLeafBatch(tenantIdentity, base, count)
 
-	hasher := sha256.New()
+	hasher := mc.Hasher()
 
 	for _, args := range batch {
 
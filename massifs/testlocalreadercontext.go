@@ -162,6 +162,6 @@ func NewLocalMassifReaderTestContext(
 		AzuriteContext:    tc,
 		TestConfig:        cfg,
 		G:                 g,
-		AzuriteReader:     NewMassifReader(log, tc.Storer),
+		AzuriteReader:     NewMassifReader(log, NewAzBlobObjectReader(tc.Storer)),
 	}
 }
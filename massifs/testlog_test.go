@@ -0,0 +1,54 @@
+package massifs
+
+import (
+	"testing"
+
+	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
+	"github.com/stretchr/testify/require"
+)
+
+// testLog is a tenant log in a memory store, with a test signer for its seals.
+type testLog struct {
+	tenant string
+	store  *MemObjectStore
+	w      *LogWriter
+	signer *TestSignerContext
+	codec  commoncbor.CBORCodec
+}
+
+// newTestLog creates a log for the tenant and adds the leaves to it. The log is
+// not sealed.
+func newTestLog(t *testing.T, tenant string, massifHeight uint8, leaves []LeafEntry) *testLog {
+	l := &testLog{
+		tenant: tenant,
+		store:  NewMemObjectStore(),
+		signer: NewTestSignerContext(t, "test.issuer"),
+	}
+	l.codec = l.signer.RootSignerCodec
+	l.w = NewLogWriter(NewMassifCommitter(MassifCommitterConfig{}, nil, l.store), tenant, massifHeight)
+	l.addLeaves(t, leaves)
+	return l
+}
+
+// newSealedTestLog creates a log, as newTestLog does, and seals every massif.
+// The sealed massifs are returned in order.
+func newSealedTestLog(t *testing.T, tenant string, massifHeight uint8, leaves []LeafEntry) (*testLog, []MassifContext) {
+	l := newTestLog(t, tenant, massifHeight, leaves)
+	return l, l.seal(t)
+}
+
+func (l *testLog) addLeaves(t *testing.T, leaves []LeafEntry) {
+	_, err := l.w.AddLeaves(t.Context(), leaves)
+	require.NoError(t, err)
+}
+
+// seal seals the current state of every massif, see
+// TestSignerContext.SealMassifs
+func (l *testLog) seal(t *testing.T) []MassifContext {
+	return l.signer.SealMassifs(t, t.Context(), l.store, l.tenant, 1234)
+}
+
+// sealReader returns a reader for the seals of the log
+func (l *testLog) sealReader() SignedRootReader {
+	return NewSignedRootReader(nil, l.store, l.codec)
+}
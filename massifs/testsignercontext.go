@@ -1,20 +1,25 @@
 package massifs
 
 import (
+	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"fmt"
 	"testing"
 
 	"github.com/datatrails/go-datatrails-common/cbor"
-	"github.com/datatrails/go-datatrails-common/cose"
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
 )
 
 type TestSignerContext struct {
 	Key             ecdsa.PrivateKey
 	RootSigner      RootSigner
-	CoseSigner      *cose.TestCoseSigner
+	CoseSigner      IdentifiableCoseSigner
 	RootSignerCodec cbor.CBORCodec
 }
 
@@ -25,7 +30,7 @@ func NewTestSignerContext(t *testing.T, issuer string) *TestSignerContext {
 	s := &TestSignerContext{
 		Key:        key,
 		RootSigner: TestNewRootSigner(t, issuer),
-		CoseSigner: cose.NewTestCoseSigner(t, key),
+		CoseSigner: NewECDSAIdentifiableCoseSigner(commoncose.NewTestCoseSigner(t, key)),
 	}
 	s.RootSignerCodec, err = NewRootSignerCodec()
 	assert.NoError(t, err)
@@ -33,9 +38,58 @@ func NewTestSignerContext(t *testing.T, issuer string) *TestSignerContext {
 	return s
 }
 
+// NewTestSignerContextForKey creates a signer context which signs with the
+// provided key, which may be of any type supported for sealing. The Key field
+// is not set.
+func NewTestSignerContextForKey(
+	t *testing.T, issuer string, alg cose.Algorithm, key crypto.Signer,
+) *TestSignerContext {
+	signer, err := NewTestKeyCoseSigner(alg, key, "test-key")
+	require.NoError(t, err)
+	s := &TestSignerContext{
+		RootSigner: TestNewRootSigner(t, issuer),
+		CoseSigner: signer,
+	}
+	s.RootSignerCodec, err = NewRootSignerCodec()
+	require.NoError(t, err)
+	return s
+}
+
+// TestKeyCoseSigner implements IdentifiableCoseSigner for a single key of any
+// type supported by go-cose.
+type TestKeyCoseSigner struct {
+	cose.Signer
+	publicKey crypto.PublicKey
+	kid       string
+}
+
+func NewTestKeyCoseSigner(alg cose.Algorithm, key crypto.Signer, kid string) (*TestKeyCoseSigner, error) {
+	signer, err := cose.NewSigner(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	return &TestKeyCoseSigner{Signer: signer, publicKey: key.Public(), kid: kid}, nil
+}
+
+func (s *TestKeyCoseSigner) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	return s.publicKey, nil
+}
+
+func (s *TestKeyCoseSigner) LatestPublicKey() (crypto.PublicKey, error) {
+	return s.publicKey, nil
+}
+
+func (s *TestKeyCoseSigner) KeyIdentifier() string {
+	return s.kid
+}
+
+func (s *TestKeyCoseSigner) KeyLocation() string {
+	return "test"
+}
+
 func (s *TestSignerContext) SignedState(
 	tenantIdentity string, massifIndex uint64, state MMRState,
-) (*cose.CoseSign1Message, MMRState, error) {
+) (*commoncose.CoseSign1Message, MMRState, error) {
 	subject := TenantMassifBlobPath(tenantIdentity, massifIndex)
 	data, err := signState(s.RootSigner, s.CoseSigner, subject, state)
 	if err != nil {
@@ -55,6 +109,35 @@ func (s *TestSignerContext) SealedState(tenantIdentity string, massifIndex uint6
 	}, nil
 }
 
+// SealMassifs seals the current state of every massif in the tenant log, and
+// puts the seals in the store. The sealed massifs are returned in order.
+func (s *TestSignerContext) SealMassifs(
+	t *testing.T, ctx context.Context, store ObjectStore, tenantIdentity string, timestamp int64,
+) []MassifContext {
+
+	reader := NewMassifReader(nil, store)
+	head, err := reader.GetHeadMassif(ctx, tenantIdentity)
+	require.NoError(t, err)
+
+	var massifs []MassifContext
+	for massifIndex := range head.Start.MassifIndex + 1 {
+		mc, err := reader.GetMassif(ctx, tenantIdentity, uint64(massifIndex))
+		require.NoError(t, err)
+		massifs = append(massifs, mc)
+
+		peaks, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		sealed, err := s.SealedState(tenantIdentity, uint64(massifIndex), MMRState{
+			Version: int(MMRStateVersion2), MMRSize: mc.RangeCount(), Peaks: peaks, Timestamp: timestamp})
+		require.NoError(t, err)
+		data, err := sealed.Sign1Message.MarshalCBOR()
+		require.NoError(t, err)
+		_, err = store.Put(ctx, TenantMassifSignedRootPath(tenantIdentity, massifIndex), data)
+		require.NoError(t, err)
+	}
+	return massifs
+}
+
 func signState(
 	rootSigner RootSigner,
 	coseSigner IdentifiableCoseSigner,
@@ -20,6 +20,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"hash"
 )
 
 const (
@@ -197,13 +198,21 @@ func SetTrieEntry(trieData []byte, indexStart uint64, trieIndex uint64,
 func NewTrieKey(
 	domain KeyType, logId []byte, appId []byte,
 ) []byte {
-	h := sha256.New()
+	return NewTrieKeyWithHasher(sha256.New(), domain, logId, appId)
+}
+
+// NewTrieKeyWithHasher creates the trie key value using the provided hasher,
+// which should be for the hash algorithm of the log. See NewTrieKey
+func NewTrieKeyWithHasher(
+	h hash.Hash, domain KeyType, logId []byte, appId []byte,
+) []byte {
+	h.Reset()
 
 	h.Write([]byte{uint8(domain)})
 
 	h.Write(logId)
 
-	// sha256.Write does not error
+	// hash.Write does not error
 	_, _ = h.Write(appId)
 
 	return h.Sum(nil)
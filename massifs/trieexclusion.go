@@ -0,0 +1,323 @@
+package massifs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/bits"
+	"slices"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+/**
+ * Proofs of exclusion
+ *
+ * The trie keys of a massif are committed to by the trie root. The distinct
+ * trie keys are sorted and form the leaves of a binary merkle tree, hashed
+ * as described in RFC 9162 (certificate transparency v2) section 2.1.1. The
+ * trie root binds the merkle tree root to the number of distinct keys:
+ *
+ *	H(0x02 || uint64be(count) || MTH(sorted keys))
+ *
+ * The trie root is written to the trie header of the massif once it is
+ * complete and, when present in a seal, is covered by the seal signature. Because the keys are
+ * sorted, a key can be shown to be absent from the massif by proving the
+ * inclusion of its neighbours at adjacent positions in the tree. A key which
+ * would sort before the first, or after the last, needs only a single
+ * neighbour. The proofs for all massifs together show an event was never
+ * added to a log.
+ */
+
+const (
+	trieLeafPrefix = 0x00
+	trieNodePrefix = 0x01
+	trieRootPrefix = 0x02
+)
+
+var (
+	ErrTrieKeyPresent        = errors.New("the trie key is present in the massif")
+	ErrTrieRootMismatch      = errors.New("the trie root does not match the massif trie keys")
+	ErrTrieRootNotSealed     = errors.New("the sealed state does not include a trie root")
+	ErrTrieExclusionMismatch = errors.New("the trie exclusion proof does not prove the absence of the key")
+	ErrTrieInclusionInvalid  = errors.New("the trie inclusion path is malformed")
+)
+
+// TrieKeyInclusion proves the inclusion of a trie key at a position in the
+// sorted trie key tree.
+type TrieKeyInclusion struct {
+	Index   uint64   `cbor:"1,keyasint"`
+	TrieKey []byte   `cbor:"2,keyasint"`
+	Path    [][]byte `cbor:"3,keyasint"`
+}
+
+// TrieExclusionProof proves that a trie key is not present in a massif, up to
+// the MMR size the trie root was computed for.
+type TrieExclusionProof struct {
+	// KeyCount is the number of distinct trie keys committed by the trie root
+	KeyCount uint64 `cbor:"1,keyasint"`
+	// Left is the greatest key less than the excluded key, absent if there is none
+	Left *TrieKeyInclusion `cbor:"2,keyasint,omitempty"`
+	// Right is the least key greater than the excluded key, absent if there is none
+	Right *TrieKeyInclusion `cbor:"3,keyasint,omitempty"`
+}
+
+// TrieKeys returns the sorted, distinct, trie keys of the massif leaves in
+// MMR(mmrSize). Only leaves in this massif are included.
+func (mc MassifContext) TrieKeys(mmrSize uint64) ([][]byte, error) {
+
+	if mmrSize < mc.Start.FirstIndex || mmrSize > mc.RangeCount() {
+		return nil, fmt.Errorf(
+			"%w: MMR(%d) is not in massif %d", ErrStateSizeExceedsData, mmrSize, mc.Start.MassifIndex)
+	}
+	leafCount := mmr.LeafCount(mmrSize) - mmr.LeafCount(mc.Start.FirstIndex)
+
+	keys := make([][]byte, 0, leafCount)
+	for i := range leafCount {
+		keys = append(keys, GetTrieKey(mc.Data, mc.IndexStart(), i))
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	return slices.CompactFunc(keys, bytes.Equal), nil
+}
+
+// TrieRoot returns the trie root for the massif leaves in MMR(mmrSize).
+func (mc MassifContext) TrieRoot(mmrSize uint64) ([]byte, error) {
+	keys, err := mc.TrieKeys(mmrSize)
+	if err != nil {
+		return nil, err
+	}
+	hasher := mc.Hasher()
+	treeRoot := trieTreeHash(hasher, trieLeafHashes(hasher, keys))
+	return trieRoot(hasher, uint64(len(keys)), treeRoot), nil
+}
+
+// GetTrieHeader returns the trie root written to the trie header. It is all
+// zeros for massifs which are not yet complete, and for massifs written before
+// trie roots were introduced.
+func (mc MassifContext) GetTrieHeader() []byte {
+	return mc.Data[TrieHeaderStart():TrieHeaderEnd()]
+}
+
+// SetTrieHeader writes the trie root for all the leaves currently in the
+// massif to the trie header.
+func (mc *MassifContext) SetTrieHeader() error {
+	root, err := mc.TrieRoot(mc.RangeCount())
+	if err != nil {
+		return err
+	}
+	copy(mc.Data[TrieHeaderStart():TrieHeaderEnd()], root)
+	return nil
+}
+
+// setCompleteTrieHeader writes the trie header if the massif is complete.
+// Computing the root sorts all the trie keys of the massif, so it is not
+// maintained for partial massifs. Seals carry the root for the sealed state.
+func (mc *MassifContext) setCompleteTrieHeader() error {
+	if mc.RangeCount() <= mc.LastLeafMMRIndex() {
+		return nil
+	}
+	return mc.SetTrieHeader()
+}
+
+// NewTrieExclusionProof proves that trieKey is not among the trie keys of the
+// massif leaves in MMR(mmrSize). ErrTrieKeyPresent is returned if it is.
+func NewTrieExclusionProof(mc *MassifContext, mmrSize uint64, trieKey []byte) (*TrieExclusionProof, error) {
+
+	keys, err := mc.TrieKeys(mmrSize)
+	if err != nil {
+		return nil, err
+	}
+	i, found := slices.BinarySearchFunc(keys, trieKey, bytes.Compare)
+	if found {
+		return nil, fmt.Errorf("%w: massif %d, MMR(%d)", ErrTrieKeyPresent, mc.Start.MassifIndex, mmrSize)
+	}
+
+	hasher := mc.Hasher()
+	leaves := trieLeafHashes(hasher, keys)
+	proof := &TrieExclusionProof{KeyCount: uint64(len(keys))}
+
+	// keys[i] is the first key greater than trieKey
+	if i > 0 {
+		proof.Left = &TrieKeyInclusion{
+			Index: uint64(i - 1), TrieKey: keys[i-1], Path: trieInclusionPath(hasher, i-1, leaves),
+		}
+	}
+	if i < len(keys) {
+		proof.Right = &TrieKeyInclusion{
+			Index: uint64(i), TrieKey: keys[i], Path: trieInclusionPath(hasher, i, leaves),
+		}
+	}
+	return proof, nil
+}
+
+// VerifyTrieExclusionProof verifies that the proof shows trieKey is absent
+// from the trie keys committed by the trie root.
+func VerifyTrieExclusionProof(hashAlg HashAlg, root []byte, trieKey []byte, proof *TrieExclusionProof) error {
+
+	if err := checkHashAlg(hashAlg); err != nil {
+		return err
+	}
+	hasher := hashAlg.New()
+	left, right := proof.Left, proof.Right
+
+	// The neighbours must bracket the key, and be adjacent
+	switch {
+	case left == nil && right == nil:
+		if proof.KeyCount != 0 {
+			return fmt.Errorf("%w: no neighbours for %d keys", ErrTrieExclusionMismatch, proof.KeyCount)
+		}
+		if !bytes.Equal(trieRoot(hasher, 0, trieTreeHash(hasher, nil)), root) {
+			return ErrTrieRootMismatch
+		}
+		return nil
+	case left == nil:
+		if right.Index != 0 {
+			return fmt.Errorf("%w: right neighbour %d is not the first key", ErrTrieExclusionMismatch, right.Index)
+		}
+	case right == nil:
+		if left.Index+1 != proof.KeyCount {
+			return fmt.Errorf("%w: left neighbour %d is not the last key", ErrTrieExclusionMismatch, left.Index)
+		}
+	default:
+		if left.Index+1 != right.Index {
+			return fmt.Errorf(
+				"%w: neighbours %d and %d are not adjacent", ErrTrieExclusionMismatch, left.Index, right.Index)
+		}
+	}
+	if left != nil && bytes.Compare(left.TrieKey, trieKey) >= 0 {
+		return fmt.Errorf("%w: left neighbour does not sort before the key", ErrTrieExclusionMismatch)
+	}
+	if right != nil && bytes.Compare(right.TrieKey, trieKey) <= 0 {
+		return fmt.Errorf("%w: right neighbour does not sort after the key", ErrTrieExclusionMismatch)
+	}
+
+	// Both neighbours must be included under the same tree root, which is
+	// bound to the key count by the trie root.
+	var treeRoot []byte
+	for _, neighbour := range []*TrieKeyInclusion{left, right} {
+		if neighbour == nil {
+			continue
+		}
+		r, err := trieInclusionRoot(
+			hasher, neighbour.Index, proof.KeyCount, trieLeafHash(hasher, neighbour.TrieKey), neighbour.Path)
+		if err != nil {
+			return err
+		}
+		if treeRoot != nil && !bytes.Equal(treeRoot, r) {
+			return ErrTrieRootMismatch
+		}
+		treeRoot = r
+	}
+	if !bytes.Equal(trieRoot(hasher, proof.KeyCount, treeRoot), root) {
+		return ErrTrieRootMismatch
+	}
+	return nil
+}
+
+// VerifySealedTrieExclusion verifies the exclusion proof against the trie root
+// attested to by a sealed state. The state must have been verified, for
+// example by obtaining it from a VerifiedContext.
+func VerifySealedTrieExclusion(state MMRState, trieKey []byte, proof *TrieExclusionProof) error {
+	if len(state.TrieRoot) == 0 {
+		return ErrTrieRootNotSealed
+	}
+	return VerifyTrieExclusionProof(state.HashAlg, state.TrieRoot, trieKey, proof)
+}
+
+func trieRoot(hasher hash.Hash, keyCount uint64, treeRoot []byte) []byte {
+	hasher.Reset()
+	hasher.Write([]byte{trieRootPrefix})
+	hasher.Write(binary.BigEndian.AppendUint64(nil, keyCount))
+	hasher.Write(treeRoot)
+	return hasher.Sum(nil)
+}
+
+func trieLeafHash(hasher hash.Hash, key []byte) []byte {
+	hasher.Reset()
+	hasher.Write([]byte{trieLeafPrefix})
+	hasher.Write(key)
+	return hasher.Sum(nil)
+}
+
+func trieLeafHashes(hasher hash.Hash, keys [][]byte) [][]byte {
+	leaves := make([][]byte, len(keys))
+	for i, key := range keys {
+		leaves[i] = trieLeafHash(hasher, key)
+	}
+	return leaves
+}
+
+func trieNodeHash(hasher hash.Hash, left, right []byte) []byte {
+	hasher.Reset()
+	hasher.Write([]byte{trieNodePrefix})
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
+// trieSplit returns the largest power of two smaller than n, n > 1
+func trieSplit(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// trieTreeHash returns the merkle tree hash of the leaf hashes (RFC 9162 MTH)
+func trieTreeHash(hasher hash.Hash, leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		hasher.Reset()
+		return hasher.Sum(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := trieSplit(len(leaves))
+	left := trieTreeHash(hasher, leaves[:k])
+	right := trieTreeHash(hasher, leaves[k:])
+	return trieNodeHash(hasher, left, right)
+}
+
+// trieInclusionPath returns the inclusion path for leaf m (RFC 9162 PATH),
+// ordered from the leaf to the root.
+func trieInclusionPath(hasher hash.Hash, m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := trieSplit(len(leaves))
+	if m < k {
+		return append(trieInclusionPath(hasher, m, leaves[:k]), trieTreeHash(hasher, leaves[k:]))
+	}
+	return append(trieInclusionPath(hasher, m-k, leaves[k:]), trieTreeHash(hasher, leaves[:k]))
+}
+
+// trieInclusionRoot returns the root implied by the inclusion path for the
+// leaf at index in a tree of size leaves (RFC 9162 section 2.1.3.2).
+func trieInclusionRoot(hasher hash.Hash, index, size uint64, leafHash []byte, path [][]byte) ([]byte, error) {
+
+	if index >= size {
+		return nil, fmt.Errorf("%w: index %d, size %d", ErrTrieInclusionInvalid, index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return nil, fmt.Errorf("%w: path too long", ErrTrieInclusionInvalid)
+		}
+		if fn&1 == 1 || fn == sn {
+			r = trieNodeHash(hasher, p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = trieNodeHash(hasher, r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, fmt.Errorf("%w: path too short", ErrTrieInclusionInvalid)
+	}
+	return r, nil
+}
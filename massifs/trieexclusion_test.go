@@ -0,0 +1,142 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrieInclusionPath(t *testing.T) {
+	hasher := sha256.New()
+	for n := 1; n <= 17; n++ {
+		var leaves [][]byte
+		for i := range n {
+			leaves = append(leaves, trieLeafHash(hasher, []byte{byte(i)}))
+		}
+		root := trieTreeHash(hasher, leaves)
+		for i := range n {
+			path := trieInclusionPath(hasher, i, leaves)
+			r, err := trieInclusionRoot(hasher, uint64(i), uint64(n), leaves[i], path)
+			require.NoError(t, err)
+			assert.Equal(t, root, r, "leaf %d of %d", i, n)
+
+			_, err = trieInclusionRoot(hasher, uint64(i), uint64(n), leaves[i], append(path, root))
+			assert.ErrorIs(t, err, ErrTrieInclusionInvalid)
+		}
+	}
+}
+
+func TestTrieExclusionProof(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 6))
+	reader := NewMassifReader(nil, log.store)
+	mc, err := reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+
+	// The committed trie header is the root for the complete massif
+	root, err := mc.TrieRoot(mc.RangeCount())
+	require.NoError(t, err)
+	assert.Equal(t, root, mc.GetTrieHeader())
+
+	// It is not written until the massif is complete
+	head, err := reader.GetMassif(ctx, tenant, 1)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, TrieHeaderEnd()-TrieHeaderStart()), head.GetTrieHeader())
+
+	keys, err := mc.TrieKeys(mc.RangeCount())
+	require.NoError(t, err)
+	require.Len(t, keys, 4)
+
+	// The keys beyond the massif, before, between and after its keys
+	absent := [][]byte{
+		NewTrieKey(KeyTypeApplicationContent, []byte("log"), []byte("app-5")),
+		bytes.Repeat([]byte{0x00}, TrieKeyBytes),
+		append(bytes.Clone(keys[1][:TrieKeyBytes-1]), keys[1][TrieKeyBytes-1]+1),
+		bytes.Repeat([]byte{0xff}, TrieKeyBytes),
+	}
+	for _, key := range absent {
+		proof, err := NewTrieExclusionProof(&mc, mc.RangeCount(), key)
+		require.NoError(t, err)
+		require.NoError(t, VerifyTrieExclusionProof(HashAlgSHA256, root, key, proof))
+
+		// The proof is specific to the key and the root
+		assert.Error(t, VerifyTrieExclusionProof(HashAlgSHA256, root, keys[0], proof))
+		assert.ErrorIs(t, VerifyTrieExclusionProof(HashAlgSHA256, keys[0], key, proof), ErrTrieRootMismatch)
+	}
+
+	for _, key := range keys {
+		_, err = NewTrieExclusionProof(&mc, mc.RangeCount(), key)
+		assert.ErrorIs(t, err, ErrTrieKeyPresent)
+	}
+
+	// Neighbours which are not adjacent do not prove exclusion
+	proof, err := NewTrieExclusionProof(&mc, mc.RangeCount(), absent[2])
+	require.NoError(t, err)
+	skipped, err := NewTrieExclusionProof(&mc, mc.RangeCount(), absent[3])
+	require.NoError(t, err)
+	proof.Left = skipped.Left
+	assert.ErrorIs(t,
+		VerifyTrieExclusionProof(HashAlgSHA256, root, absent[2], proof), ErrTrieExclusionMismatch)
+
+	// An empty massif excludes everything
+	emptyRoot, err := mc.TrieRoot(mc.Start.FirstIndex)
+	require.NoError(t, err)
+	proof, err = NewTrieExclusionProof(&mc, mc.Start.FirstIndex, keys[0])
+	require.NoError(t, err)
+	require.NoError(t, VerifyTrieExclusionProof(HashAlgSHA256, emptyRoot, keys[0], proof))
+}
+
+// TestTrieRootSealed checks the trie root attested to by a seal is verified
+// against the massif, and can be used to verify exclusion proofs.
+func TestTrieRootSealed(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 3))
+	reader := NewMassifReader(nil, log.store)
+	mc, err := reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+
+	codec, signer := log.codec, log.signer
+
+	// The seal covers only the first two leaves
+	mmrSize := mmr.FirstMMRSize(1)
+	peaks, err := mmr.PeakHashes(&mc, mmrSize-1)
+	require.NoError(t, err)
+	trieRoot, err := mc.TrieRoot(mmrSize)
+	require.NoError(t, err)
+	state := MMRState{
+		Version: int(MMRStateVersion2), MMRSize: mmrSize, Peaks: peaks, Timestamp: 1234, TrieRoot: trieRoot,
+	}
+	sealed, err := signer.SealedState(tenant, 0, state)
+	require.NoError(t, err)
+
+	verified, err := mc.VerifyContext(ctx, WithSealGetter(testSealGetter{sealed: sealed}), WithCBORCodec(codec))
+	require.NoError(t, err)
+
+	// The third leaf was not in the log when it was sealed
+	leaf := testLeafEntries(2, 1)[0]
+	key := NewTrieKey(KeyTypeApplicationContent, leaf.LogID, leaf.AppID)
+	proof, err := NewTrieExclusionProof(&mc, mmrSize, key)
+	require.NoError(t, err)
+	require.NoError(t, VerifySealedTrieExclusion(verified.MMRState, key, proof))
+
+	state.TrieRoot = nil
+	assert.ErrorIs(t, VerifySealedTrieExclusion(state, key, proof), ErrTrieRootNotSealed)
+
+	// A seal whose trie root does not match the massif fails verification
+	state.TrieRoot, err = mc.TrieRoot(mc.RangeCount())
+	require.NoError(t, err)
+	sealed, err = signer.SealedState(tenant, 0, state)
+	require.NoError(t, err)
+	_, err = mc.VerifyContext(ctx, WithSealGetter(testSealGetter{sealed: sealed}), WithCBORCodec(codec))
+	assert.ErrorIs(t, err, ErrTrieRootMismatch)
+}
@@ -0,0 +1,317 @@
+package massifs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+)
+
+/**
+ * A Trie Index is a lookup index, from trie key to leaf, for a single massif.
+ *
+ * The trie entries in a massif are stored in leaf order, so finding the entry
+ * for an application id otherwise requires a scan of every entry. The index is
+ * derived entirely from the massif data, so it can always be re-created, and it
+ * is never shared or attested to. It is typically persisted along side the
+ * massifs in a local replica.
+ *
+ * Its binary format is:
+ *
+ * |--------|-----------------------------------------|
+ * | header | indexEntry0 ---> indexEntryLeafCount-1  |
+ * |--------|-----------------------------------------|
+ *
+ * Where the header is
+ *
+ * |-----------------|-----------|--------------|---------|----------|
+ * | first leaf index| leaf count| massif index | hashalg | reserved |
+ * |-----------------|-----------|--------------|---------|----------|
+ * |      0 .. 7     |  8 .. 15  |   16 .. 19   |   20    | 21 .. 31 |
+ * |-----------------|-----------|--------------|---------|----------|
+ *
+ * And each index entry is
+ *
+ * |----------|-------------------|--------------|
+ * | Trie Key | Massif Leaf Index | ID Timestamp |
+ * |----------|-------------------|--------------|
+ * | 32 bytes |      8 bytes      |    8 bytes   |
+ * |----------|-------------------|--------------|
+ *
+ * The entries are sorted by trie key, and then by leaf index.
+ */
+
+const (
+	TrieIndexHeaderBytes = 32
+	TrieIndexEntryBytes  = TrieKeyBytes + 8 + 8
+
+	TrieIndexFirstLeafFirstByte   = 0
+	TrieIndexLeafCountFirstByte   = 8
+	TrieIndexMassifIndexFirstByte = 16
+	TrieIndexHashAlgFirstByte     = 20
+
+	trieIndexEntryLeafStart = TrieKeyBytes
+	trieIndexEntryIDStart   = TrieKeyBytes + 8
+)
+
+var (
+	ErrTrieKeyNotFound   = errors.New("no leaf with the trie key was found in the log")
+	ErrTrieIndexFormat   = errors.New("the trie index data is malformed")
+	ErrTrieIndexMismatch = errors.New("the trie index does not belong to the massif")
+)
+
+type trieIndexEntry struct {
+	trieKey [TrieKeyBytes]byte
+	// leafIndex is relative to the first leaf of the massif
+	leafIndex   uint64
+	idTimestamp uint64
+}
+
+// TrieIndex maps the trie keys of a single massif to their leaves.
+type TrieIndex struct {
+	MassifIndex    uint32
+	FirstLeafIndex uint64
+	// LeafCount is the number of leaves, from the start of the massif, covered by the index
+	LeafCount uint64
+	HashAlg   HashAlg
+
+	entries []trieIndexEntry
+	// lastTrieKey is the trie key of the last leaf covered by the index. It
+	// is compared with the massif to check the index was built from it.
+	lastTrieKey [TrieKeyBytes]byte
+}
+
+// NewTrieIndex builds the trie index for all the leaves currently in the massif
+func NewTrieIndex(mc *MassifContext) (*TrieIndex, error) {
+	ti := &TrieIndex{
+		MassifIndex:    mc.Start.MassifIndex,
+		FirstLeafIndex: mmr.LeafCount(mc.Start.FirstIndex),
+		HashAlg:        mc.Start.HashAlg,
+	}
+	if err := ti.Update(mc); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+// Update adds the leaves added to the massif since the index was last updated.
+// Only the new trie entries are read.
+func (ti *TrieIndex) Update(mc *MassifContext) error {
+
+	if err := ti.check(mc); err != nil {
+		return err
+	}
+	leafCount := mc.MassifLeafCount()
+	if leafCount == ti.LeafCount {
+		return nil
+	}
+
+	indexStart := mc.IndexStart()
+	for i := ti.LeafCount; i < leafCount; i++ {
+		e := trieIndexEntry{
+			leafIndex:   i,
+			idTimestamp: binary.BigEndian.Uint64(GetIdtimestamp(mc.Data, indexStart, i)),
+		}
+		copy(e.trieKey[:], GetTrieKey(mc.Data, indexStart, i))
+		ti.entries = append(ti.entries, e)
+		ti.lastTrieKey = e.trieKey
+	}
+	slices.SortFunc(ti.entries, compareTrieIndexEntries)
+	ti.LeafCount = leafCount
+	return nil
+}
+
+// check returns ErrTrieIndexMismatch if the index was not built from the
+// massif, or a previous version of it.
+func (ti *TrieIndex) check(mc *MassifContext) error {
+
+	if err := ti.checkStart(mc.Start); err != nil {
+		return err
+	}
+	leafCount := mc.MassifLeafCount()
+	if leafCount < ti.LeafCount {
+		return fmt.Errorf(
+			"%w: the index has %d leaves, massif %d has %d",
+			ErrTrieIndexMismatch, ti.LeafCount, mc.Start.MassifIndex, leafCount)
+	}
+	if ti.LeafCount != 0 && !ti.matchesLastTrieKey(GetTrieKey(mc.Data, mc.IndexStart(), ti.LeafCount-1)) {
+		return fmt.Errorf(
+			"%w: massif %d has a different trie key for leaf %d",
+			ErrTrieIndexMismatch, mc.Start.MassifIndex, ti.LeafCount-1)
+	}
+	return nil
+}
+
+// checkStart returns ErrTrieIndexMismatch if the index is for a different
+// massif
+func (ti *TrieIndex) checkStart(start MassifStart) error {
+	if ti.MassifIndex != start.MassifIndex ||
+		ti.FirstLeafIndex != mmr.LeafCount(start.FirstIndex) ||
+		ti.HashAlg != start.HashAlg {
+		return fmt.Errorf("%w: massif %d", ErrTrieIndexMismatch, start.MassifIndex)
+	}
+	return nil
+}
+
+func (ti *TrieIndex) matchesLastTrieKey(trieKey []byte) bool {
+	return bytes.Equal(ti.lastTrieKey[:], trieKey)
+}
+
+// Find returns the mmr index and idtimestamp of the first leaf in the massif
+// with the provided trie key.
+func (ti *TrieIndex) Find(trieKey []byte) (uint64, uint64, bool) {
+
+	i, found := slices.BinarySearchFunc(ti.entries, trieKey, func(e trieIndexEntry, key []byte) int {
+		return bytes.Compare(e.trieKey[:], key)
+	})
+	if !found {
+		return 0, 0, false
+	}
+	e := ti.entries[i]
+	return mmr.MMRIndex(ti.FirstLeafIndex + e.leafIndex), e.idTimestamp, true
+}
+
+// FindAppID returns the mmr index and idtimestamp of the first leaf in the
+// massif added for the provided log and application id.
+func (ti *TrieIndex) FindAppID(logId []byte, appId []byte) (uint64, uint64, bool) {
+	return ti.Find(NewTrieKeyWithHasher(ti.HashAlg.New(), KeyTypeApplicationContent, logId, appId))
+}
+
+// MarshalBinary encodes the index in the format described above
+func (ti *TrieIndex) MarshalBinary() ([]byte, error) {
+
+	data := make([]byte, TrieIndexHeaderBytes+len(ti.entries)*TrieIndexEntryBytes)
+	binary.BigEndian.PutUint64(data[TrieIndexFirstLeafFirstByte:], ti.FirstLeafIndex)
+	binary.BigEndian.PutUint64(data[TrieIndexLeafCountFirstByte:], ti.LeafCount)
+	binary.BigEndian.PutUint32(data[TrieIndexMassifIndexFirstByte:], ti.MassifIndex)
+	data[TrieIndexHashAlgFirstByte] = byte(ti.HashAlg)
+
+	for i, e := range ti.entries {
+		entry := data[TrieIndexHeaderBytes+i*TrieIndexEntryBytes:]
+		copy(entry, e.trieKey[:])
+		binary.BigEndian.PutUint64(entry[trieIndexEntryLeafStart:], e.leafIndex)
+		binary.BigEndian.PutUint64(entry[trieIndexEntryIDStart:], e.idTimestamp)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes an index encoded by MarshalBinary
+func (ti *TrieIndex) UnmarshalBinary(data []byte) error {
+
+	if len(data) < TrieIndexHeaderBytes || (len(data)-TrieIndexHeaderBytes)%TrieIndexEntryBytes != 0 {
+		return fmt.Errorf("%w: %d bytes", ErrTrieIndexFormat, len(data))
+	}
+
+	decoded := TrieIndex{
+		FirstLeafIndex: binary.BigEndian.Uint64(data[TrieIndexFirstLeafFirstByte:]),
+		LeafCount:      binary.BigEndian.Uint64(data[TrieIndexLeafCountFirstByte:]),
+		MassifIndex:    binary.BigEndian.Uint32(data[TrieIndexMassifIndexFirstByte:]),
+		HashAlg:        HashAlg(data[TrieIndexHashAlgFirstByte]),
+	}
+	if err := checkHashAlg(decoded.HashAlg); err != nil {
+		return err
+	}
+
+	count := uint64(len(data)-TrieIndexHeaderBytes) / TrieIndexEntryBytes
+	if count != decoded.LeafCount {
+		return fmt.Errorf(
+			"%w: %d entries for %d leaves", ErrTrieIndexFormat, count, decoded.LeafCount)
+	}
+
+	decoded.entries = make([]trieIndexEntry, count)
+	for i := range decoded.entries {
+		entry := data[TrieIndexHeaderBytes+i*TrieIndexEntryBytes:]
+		e := &decoded.entries[i]
+		copy(e.trieKey[:], entry[:TrieKeyBytes])
+		e.leafIndex = binary.BigEndian.Uint64(entry[trieIndexEntryLeafStart:])
+		e.idTimestamp = binary.BigEndian.Uint64(entry[trieIndexEntryIDStart:])
+		if e.leafIndex >= decoded.LeafCount {
+			return fmt.Errorf("%w: leaf %d out of range", ErrTrieIndexFormat, e.leafIndex)
+		}
+		if e.leafIndex == decoded.LeafCount-1 {
+			decoded.lastTrieKey = e.trieKey
+		}
+	}
+	if !slices.IsSortedFunc(decoded.entries, compareTrieIndexEntries) {
+		return fmt.Errorf("%w: entries are not sorted", ErrTrieIndexFormat)
+	}
+
+	*ti = decoded
+	return nil
+}
+
+func (ti *TrieIndex) clone() *TrieIndex {
+	c := *ti
+	c.entries = slices.Clone(ti.entries)
+	return &c
+}
+
+func compareTrieIndexEntries(a, b trieIndexEntry) int {
+	if c := bytes.Compare(a.trieKey[:], b.trieKey[:]); c != 0 {
+		return c
+	}
+	if a.leafIndex < b.leafIndex {
+		return -1
+	}
+	if a.leafIndex > b.leafIndex {
+		return 1
+	}
+	return 0
+}
+
+// trieIndexCache retains the trie indices built by a reader so that repeated
+// lookups only need to index the leaves added since the previous lookup.
+// Cached indices are never modified, updates replace them.
+type trieIndexCache struct {
+	mu      sync.Mutex
+	indices map[string]*TrieIndex
+}
+
+func newTrieIndexCache() *trieIndexCache {
+	return &trieIndexCache{indices: make(map[string]*TrieIndex)}
+}
+
+func (c *trieIndexCache) get(key string) *TrieIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indices[key]
+}
+
+func (c *trieIndexCache) put(key string, ti *TrieIndex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indices[key] = ti
+}
+
+// update returns the cached index for the massif, bringing it up to date with
+// the massif first if necessary. A cached index which was not built from the
+// massif, for example a stale persisted index, is replaced.
+func (c *trieIndexCache) update(key string, mc *MassifContext) (*TrieIndex, error) {
+
+	var err error
+	ti := c.get(key)
+	if ti != nil {
+		err = ti.check(mc)
+	}
+	switch {
+	case ti == nil || errors.Is(err, ErrTrieIndexMismatch):
+		// The massif was replaced, the index is simply re-created
+		ti, err = NewTrieIndex(mc)
+	case err != nil:
+		return nil, err
+	case ti.LeafCount != mc.MassifLeafCount():
+		ti = ti.clone()
+		err = ti.Update(mc)
+	default:
+		return ti, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, ti)
+	return ti, nil
+}
@@ -0,0 +1,160 @@
+package massifs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOSWriteOpener struct{}
+
+func (testOSWriteOpener) Open(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func (testOSWriteOpener) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func TestTrieIndex(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 4 // 8 leaves per massif
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 5))
+	reader := NewMassifReader(nil, log.store)
+	mc, err := reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+	ti, err := NewTrieIndex(&mc)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), ti.LeafCount)
+
+	// A duplicate application id in a later batch is indexed after the original
+	duplicate := testLeafEntries(2, 1)
+	duplicate[0].IDTimestamp = 100 << 24
+	log.addLeaves(t, append(testLeafEntries(5, 1), duplicate...))
+	mc, err = reader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+	require.NoError(t, ti.Update(&mc))
+	assert.Equal(t, uint64(7), ti.LeafCount)
+
+	for i, leaf := range testLeafEntries(0, 6) {
+		mmrIndex, idTimestamp, ok := ti.FindAppID(leaf.LogID, leaf.AppID)
+		require.True(t, ok)
+		assert.Equal(t, mmr.MMRIndex(uint64(i)), mmrIndex)
+		assert.Equal(t, leaf.IDTimestamp, idTimestamp)
+	}
+	_, _, ok := ti.FindAppID([]byte("log"), []byte("app-unknown"))
+	assert.False(t, ok)
+
+	data, err := ti.MarshalBinary()
+	require.NoError(t, err)
+	var decoded TrieIndex
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, ti, &decoded)
+
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data[:len(data)-1]), ErrTrieIndexFormat)
+	data[TrieIndexHeaderBytes], data[TrieIndexHeaderBytes+TrieIndexEntryBytes] = 0xff, 0
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data), ErrTrieIndexFormat)
+
+	mc.Start.MassifIndex = 1
+	assert.ErrorIs(t, ti.Update(&mc), ErrTrieIndexMismatch)
+}
+
+// TestFindLeafByAppID checks leaves are found across massifs by both the
+// remote and local readers, including leaves added after the first lookup.
+func TestFindLeafByAppID(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+	var massifHeight uint8 = 3 // 4 leaves per massif
+
+	log := newTestLog(t, tenant, massifHeight, testLeafEntries(0, 10))
+	reader := NewMassifReader(nil, log.store)
+	check := func(find func(logId, appId []byte) (uint64, uint64, error), leafCount uint64) {
+		for i, leaf := range testLeafEntries(0, leafCount) {
+			mmrIndex, idTimestamp, err := find(leaf.LogID, leaf.AppID)
+			require.NoError(t, err)
+			assert.Equal(t, mmr.MMRIndex(uint64(i)), mmrIndex)
+			assert.Equal(t, leaf.IDTimestamp, idTimestamp)
+		}
+		_, _, err := find([]byte("log"), []byte("app-unknown"))
+		assert.ErrorIs(t, err, ErrTrieKeyNotFound)
+		// The trie key includes the log id
+		_, _, err = find([]byte("other"), []byte("app-0"))
+		assert.ErrorIs(t, err, ErrTrieKeyNotFound)
+	}
+
+	findRemote := func(logId, appId []byte) (uint64, uint64, error) {
+		return reader.FindLeafByAppID(ctx, tenant, logId, appId)
+	}
+	check(findRemote, 10)
+
+	log.addLeaves(t, testLeafEntries(10, 3))
+	check(findRemote, 13)
+
+	// Replicate the log, and write the trie indices along side it
+	replicaDir := t.TempDir()
+	newLocalReader := func() LocalReader {
+		cache, err := NewLogDirCache(nil, testOSOpener{},
+			WithDirCacheReplicaDir(replicaDir),
+			WithDirCacheMassifLister(testOSDirLister{}),
+			WithDirCacheSealLister(testOSDirLister{}),
+			WithReaderOption(WithMassifHeight(massifHeight)),
+		)
+		require.NoError(t, err)
+		localReader, err := NewLocalReader(nil, cache)
+		require.NoError(t, err)
+		return localReader
+	}
+	localReader := newLocalReader()
+	require.NoError(t, localReader.EnsureReplicaDirs(tenant))
+	for massifIndex := range uint32(4) {
+		mc, err := reader.GetMassif(ctx, tenant, uint64(massifIndex))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(
+			filepath.Join(replicaDir, ReplicaRelativeMassifPath(tenant, massifIndex)), mc.Data, 0644))
+	}
+	for massifIndex := range uint32(4) {
+		require.NoError(t, localReader.WriteTrieIndex(ctx, tenant, massifIndex, testOSWriteOpener{}))
+	}
+
+	data, err := os.ReadFile(localReader.GetTrieIndexLocalPath(tenant, 3))
+	require.NoError(t, err)
+	var ti TrieIndex
+	require.NoError(t, ti.UnmarshalBinary(data))
+	assert.Equal(t, uint32(3), ti.MassifIndex)
+	assert.Equal(t, uint64(1), ti.LeafCount)
+
+	// A fresh reader uses the persisted indices, and only reads the massifs
+	// which have grown since the indices were written
+	localReader = newLocalReader()
+	findLocal := func(logId, appId []byte) (uint64, uint64, error) {
+		return localReader.FindLeafByAppID(ctx, tenant, logId, appId)
+	}
+	leaf := testLeafEntries(0, 1)[0]
+	_, _, err = findLocal(leaf.LogID, leaf.AppID)
+	require.NoError(t, err)
+	dirEntry, err := localReader.resolveMassifDirEntry(tenant)
+	require.NoError(t, err)
+	assert.Empty(t, dirEntry.(*LogDirCacheEntry).Massifs)
+	check(findLocal, 13)
+
+	// A persisted index which was not built from the massif is replaced
+	other := newTestLog(t, tenant, massifHeight, testLeafEntries(100, 4))
+	otherReader := NewMassifReader(nil, other.store)
+	otherMC, err := otherReader.GetMassif(ctx, tenant, 0)
+	require.NoError(t, err)
+	stale, err := NewTrieIndex(&otherMC)
+	require.NoError(t, err)
+	data, err = stale.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(localReader.GetTrieIndexLocalPath(tenant, 0), data, 0644))
+
+	localReader = newLocalReader()
+	check(findLocal, 13)
+}
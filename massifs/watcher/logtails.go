@@ -4,7 +4,6 @@ import (
 	"math/rand"
 	"slices"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/datatrails/go-datatrails-merklelog/massifs"
 )
 
@@ -148,28 +147,14 @@ func (c LogTailCollator) SortedSealedTenants() []string {
 	return sortMapOfLogTails(c.Seals)
 }
 
-func collectTags(aztags *azblob.BlobTags) map[string]string {
-	if aztags == nil || len(aztags.BlobTagSet) == 0 {
-		return map[string]string{}
-	}
-	tags := map[string]string{}
-	for _, azTag := range aztags.BlobTagSet {
-		if azTag.Key == nil || azTag.Value == nil {
-			continue
-		}
-		tags[*azTag.Key] = *azTag.Value
-	}
-	return tags
-}
-
 // collectPageItem is typically used to handle the first item in a page prior to processing the remainder in a loop
-func (c *LogTailCollator) collectPageItem(it *azblob.FilterBlobItem) error {
-	lt, err := NewLogTail(*it.Name)
+func (c *LogTailCollator) collectPageItem(it massifs.ObjectInfo) error {
+	lt, err := NewLogTail(it.Path)
 	if err != nil {
 		return err
 	}
 	// if it is missing, it will be the empty string that is set
-	lastid := massifs.GetLastIDHex(collectTags(it.Tags))
+	lastid := massifs.GetLastIDHex(it.Tags)
 
 	if lt.Ext == massifs.V1MMRMassifExt {
 		cur, ok := c.Massifs[lt.Tenant]
@@ -200,9 +185,9 @@ func (c *LogTailCollator) collectPageItem(it *azblob.FilterBlobItem) error {
 	return nil
 }
 
-// CollatePage process a single page of azure blob filter results and collates
+// CollatePage process a single page of blob filter results and collates
 // the most recent LogTail's for each tenant represented in the page.
-func (c *LogTailCollator) CollatePage(page []*azblob.FilterBlobItem) error {
+func (c *LogTailCollator) CollatePage(page []massifs.ObjectInfo) error {
 	if len(page) == 0 {
 		return nil
 	}
@@ -6,7 +6,7 @@ import (
 	"slices"
 	"testing"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/datatrails/go-datatrails-merklelog/massifs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,16 +17,11 @@ func Test_LogTailColatePage(t *testing.T) {
 	mkcollator := func(paths []string) LogTailCollator {
 		lc := NewLogTailCollator()
 
-		var page []*azblob.FilterBlobItem
-		page = make([]*azblob.FilterBlobItem, 0, len(paths))
+		var page []massifs.ObjectInfo
+		page = make([]massifs.ObjectInfo, 0, len(paths))
 
 		for _, path := range paths {
-
-			it := &azblob.FilterBlobItem{
-				Name: new(string),
-			}
-			*it.Name = path
-			page = append(page, it)
+			page = append(page, massifs.ObjectInfo{Path: path})
 		}
 		err := lc.CollatePage(page)
 		require.NoError(t, err)
@@ -200,14 +195,11 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 		seals   map[string]LogTail
 	}
 	type args struct {
-		page []*azblob.FilterBlobItem
+		page []massifs.ObjectInfo
 	}
 
-	newItem := func(name string) *azblob.FilterBlobItem {
-		it := &azblob.FilterBlobItem{}
-		it.Name = new(string)
-		*it.Name = name
-		return it
+	newItem := func(name string) massifs.ObjectInfo {
+		return massifs.ObjectInfo{Path: name}
 	}
 	tests := []struct {
 		name        string
@@ -224,7 +216,7 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 				make(map[string]LogTail),
 			},
 			args: args{
-				[]*azblob.FilterBlobItem{newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log")},
+				[]massifs.ObjectInfo{newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log")},
 			},
 			wantMassifs: []LogTail{{Tenant: "84e0e9e9-d479-4d4e-9e8c-afc19a8fc185", Number: 2}},
 			wantSeals:   nil,
@@ -237,7 +229,7 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 				make(map[string]LogTail),
 			},
 			args: args{
-				[]*azblob.FilterBlobItem{
+				[]massifs.ObjectInfo{
 					newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000001.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log"),
 				},
@@ -253,7 +245,7 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 				make(map[string]LogTail),
 			},
 			args: args{
-				[]*azblob.FilterBlobItem{
+				[]massifs.ObjectInfo{
 					newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-d479-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000001.log"),
 				},
@@ -270,7 +262,7 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 				make(map[string]LogTail),
 			},
 			args: args{
-				[]*azblob.FilterBlobItem{
+				[]massifs.ObjectInfo{
 					newItem("v1/mmrs/tenant/84e0e9e9-aaaa-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-bbbb-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000003.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-aaaa-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000001.log"),
@@ -291,7 +283,7 @@ func TestLogTailCollator_CollatePage(t *testing.T) {
 				make(map[string]LogTail),
 			},
 			args: args{
-				[]*azblob.FilterBlobItem{
+				[]massifs.ObjectInfo{
 					newItem("v1/mmrs/tenant/84e0e9e9-aaaa-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000002.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-bbbb-4d4e-9e8c-afc19a8fc185/0/massifs/0000000000000003.log"),
 					newItem("v1/mmrs/tenant/84e0e9e9-bbbb-4d4e-9e8c-afc19a8fc185/0/massifseals/0000000000000002.sth"),
@@ -0,0 +1,166 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datatrails/go-datatrails-common/cbor"
+	"github.com/datatrails/go-datatrails-merklelog/massifs"
+)
+
+// FilteredLister is the store method required by Watcher.Run. It is satisfied
+// by the massifs object stores and by ReplicaLister.
+type FilteredLister interface {
+	FilteredList(ctx context.Context, tagsFilter string, opts ...massifs.ObjectOption) (*massifs.ObjectListResponse, error)
+}
+
+// ReplicaLister lists the massifs and seals of a local replica directory, as
+// laid out by massifs.TenantMassifReplicaDir, as though they were in the
+// remote store. This allows Watcher.Run, and the same handler code, to watch a
+// replica rather than the live store.
+//
+// Local files have no tags. Instead, the lastid tag is read from the massif
+// start header, or from the seal state. Each FilteredList call scans the
+// replica, but a file is only read if its modification time or size has
+// changed since the previous scan. The listed paths are the remote blob paths,
+// so that NewLogTail parses them in the same way.
+type ReplicaLister struct {
+	replicaDir string
+	codec      cbor.CBORCodec
+
+	mu      sync.Mutex
+	scanned map[string]replicaFile
+}
+
+type replicaFile struct {
+	modTime time.Time
+	size    int64
+	lastID  string
+}
+
+// NewReplicaLister creates a lister for the replica directory. The codec is
+// required to read the seal states, see massifs.NewRootSignerCodec.
+func NewReplicaLister(replicaDir string, codec cbor.CBORCodec) *ReplicaLister {
+	return &ReplicaLister{
+		replicaDir: replicaDir,
+		codec:      codec,
+		scanned:    map[string]replicaFile{},
+	}
+}
+
+// FilteredList returns a single page containing every massif and seal in the
+// replica whose lastid satisfies the filter. Files whose lastid can't be read
+// are assumed to be incomplete, and are not listed. Only the list marker
+// option is supported.
+func (l *ReplicaLister) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...massifs.ObjectOption,
+) (*massifs.ObjectListResponse, error) {
+
+	filter, err := massifs.ParseTagFilter(tagsFilter)
+	if err != nil {
+		return nil, err
+	}
+	options := massifs.NewObjectOptions(opts...)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Files which have been removed are dropped from the scan results
+	scanned := make(map[string]replicaFile, len(l.scanned))
+	var items []massifs.ObjectInfo
+
+	err = filepath.WalkDir(l.replicaDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.replicaDir, filePath)
+		if err != nil {
+			return err
+		}
+		blobPath := massifs.V1MMRPrefix + "/" + filepath.ToSlash(rel)
+		if _, _, err = massifs.ParseMassifPathNumberExt(blobPath); err != nil {
+			// not a massif or a seal
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, ok := l.scanned[filePath]
+		if !ok || !f.modTime.Equal(fi.ModTime()) || f.size != fi.Size() {
+			f = replicaFile{modTime: fi.ModTime(), size: fi.Size(), lastID: l.readLastID(blobPath, filePath)}
+		}
+		scanned[filePath] = f
+
+		if f.lastID == "" || blobPath <= options.ListMarker {
+			return nil
+		}
+		tags := map[string]string{massifs.TagKeyLastID: f.lastID}
+		if filter != nil && !filter.Match(tags) {
+			return nil
+		}
+		items = append(items, massifs.ObjectInfo{
+			Path:          blobPath,
+			LastModified:  fi.ModTime(),
+			ContentLength: fi.Size(),
+			Tags:          tags,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.scanned = scanned
+
+	slices.SortFunc(items, func(a, b massifs.ObjectInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return &massifs.ObjectListResponse{Items: items}, nil
+}
+
+// readLastID returns the lastid hex for the massif or seal file, or the empty
+// string if it can't be read.
+func (l *ReplicaLister) readLastID(blobPath string, filePath string) string {
+
+	if massifs.IsMassifPathLike(blobPath) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		header := make([]byte, massifs.StartHeaderSize)
+		if _, err = io.ReadFull(f, header); err != nil {
+			return ""
+		}
+		var ms massifs.MassifStart
+		if err = massifs.DecodeMassifStart(&ms, header); err != nil {
+			return ""
+		}
+		return massifs.IDTimestampToHex(ms.LastID, uint8(ms.CommitmentEpoch))
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	_, state, err := massifs.DecodeSignedRoot(l.codec, data)
+	if err != nil {
+		return ""
+	}
+	return massifs.IDTimestampToHex(state.IDTimestamp, uint8(state.CommitmentEpoch))
+}
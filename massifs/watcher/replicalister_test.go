@@ -0,0 +1,121 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/datatrails/go-datatrails-merklelog/massifs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplicaLister checks the watcher finds the same log tails in a local
+// replica as it would in the remote store.
+func TestReplicaLister(t *testing.T) {
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	store := massifs.NewMemObjectStore()
+	w := massifs.NewLogWriter(massifs.NewMassifCommitter(massifs.MassifCommitterConfig{}, nil, store), tenant, 2)
+	addLeaves := func(base, count uint64) {
+		leaves := make([]massifs.LeafEntry, count)
+		for i := range count {
+			value := sha256.Sum256(binary.BigEndian.AppendUint64(nil, base+i))
+			leaves[i] = massifs.LeafEntry{
+				IDTimestamp: (base + i + 1) << 24,
+				LogID:       []byte("log"),
+				AppID:       []byte(fmt.Sprintf("app-%d", base+i)),
+				Value:       value[:],
+			}
+		}
+		_, err := w.AddLeaves(ctx, leaves)
+		require.NoError(t, err)
+	}
+
+	codec, err := massifs.NewRootSignerCodec()
+	require.NoError(t, err)
+	signer := massifs.NewTestSignerContext(t, "test.issuer")
+	reader := massifs.NewMassifReader(nil, store)
+
+	// replicate copies the massifs to the replica, and seals the head
+	replicaDir := t.TempDir()
+	replicate := func() massifs.MassifContext {
+		head, err := reader.GetHeadMassif(ctx, tenant)
+		require.NoError(t, err)
+		for massifIndex := range head.Start.MassifIndex + 1 {
+			mc, err := reader.GetMassif(ctx, tenant, uint64(massifIndex))
+			require.NoError(t, err)
+			filePath := filepath.Join(replicaDir, massifs.ReplicaRelativeMassifPath(tenant, massifIndex))
+			require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+			require.NoError(t, os.WriteFile(filePath, mc.Data, 0644))
+		}
+		sealed, err := signer.SealedState(tenant, uint64(head.Start.MassifIndex), massifs.MMRState{
+			Version:         int(massifs.MMRStateVersion2),
+			MMRSize:         head.RangeCount(),
+			IDTimestamp:     head.GetLastIdTimestamp(),
+			CommitmentEpoch: head.Start.CommitmentEpoch,
+		})
+		require.NoError(t, err)
+		data, err := sealed.Sign1Message.MarshalCBOR()
+		require.NoError(t, err)
+		filePath := filepath.Join(replicaDir, massifs.ReplicaRelativeSealPath(tenant, head.Start.MassifIndex))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, data, 0644))
+		return head
+	}
+
+	watch := func() []LogTail {
+		watcher := Watcher{Cfg: WatchConfig{
+			IDSince:       massifs.IDTimestampToHex(0, 0),
+			Interval:      time.Millisecond,
+			IntervalCount: 1,
+		}}
+		var tails []LogTail
+		err := watcher.Run(ctx, NewReplicaLister(replicaDir, codec), func(ctx context.Context, tail LogTail) error {
+			tails = append(tails, tail)
+			return nil
+		})
+		require.NoError(t, err)
+		return tails
+	}
+
+	addLeaves(0, 3) // 2 leaves per massif
+	head := replicate()
+	require.Equal(t, uint32(1), head.Start.MassifIndex)
+	// Incomplete files are ignored
+	incomplete := filepath.Join(replicaDir, massifs.ReplicaRelativeMassifPath("tenant/2", 0))
+	require.NoError(t, os.MkdirAll(filepath.Dir(incomplete), 0755))
+	require.NoError(t, os.WriteFile(incomplete, []byte{0}, 0644))
+
+	lastID := massifs.IDTimestampToHex(head.GetLastIdTimestamp(), uint8(head.Start.CommitmentEpoch))
+	tails := watch()
+	require.Len(t, tails, 2)
+	for _, tail := range tails {
+		assert.Equal(t, "1", tail.Tenant)
+		assert.Equal(t, uint32(1), tail.Number)
+		assert.Equal(t, lastID, tail.LastID)
+	}
+
+	// The filter is applied to the lastid read from the replica
+	lister := NewReplicaLister(replicaDir, codec)
+	r, err := lister.FilteredList(ctx, fmt.Sprintf(`"lastid">'%s'`, lastID))
+	require.NoError(t, err)
+	assert.Empty(t, r.Items)
+
+	addLeaves(3, 1)
+	head = replicate()
+	r, err = lister.FilteredList(ctx, fmt.Sprintf(`"lastid">'%s'`, lastID))
+	require.NoError(t, err)
+	require.Len(t, r.Items, 2)
+	assert.Equal(t, massifs.TenantMassifBlobPath(tenant, 1), r.Items[0].Path)
+	assert.Equal(t, massifs.TenantMassifSignedRootPath(tenant, 1), r.Items[1].Path)
+	assert.Equal(t,
+		massifs.IDTimestampToHex(head.GetLastIdTimestamp(), uint8(head.Start.CommitmentEpoch)),
+		r.Items[0].Tags[massifs.TagKeyLastID])
+}
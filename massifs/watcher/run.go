@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/datatrails/go-datatrails-merklelog/massifs"
+)
+
+const (
+	// DefaultRateLimitBackoff is the wait applied when the store is rate
+	// limiting and does not indicate how long to wait
+	DefaultRateLimitBackoff = time.Second * 5
+)
+
+// TailHandler is called with each new log tail found by Watcher.Run. The tail
+// Ext distinguishes massifs (massifs.V1MMRMassifExt) from seals
+// (massifs.V1MMRSealSignedRootExt).
+type TailHandler func(ctx context.Context, tail LogTail) error
+
+// Run polls the store for changed logs every Cfg.Interval and calls handler
+// for each massif and seal tail which has not been seen before.
+//
+// A tail is new if it is for a higher numbered massif, or has a higher lastid,
+// than the tail previously handled for the same tenant. As the filter horizon
+// overlaps successive polls, the same tail is typically found repeatedly, it is
+// only handled once. If Cfg.IntervalCount is not zero, Run returns after that
+// many polls. Otherwise it runs until the context is done, in which case the
+// context error is returned. Rate limited polls are retried after the wait
+// indicated by the store, and do not count towards the interval count. Any
+// other error from the store, or from the handler, ends the run.
+func (w *Watcher) Run(ctx context.Context, store FilteredLister, handler TailHandler) error {
+
+	seen := map[string]LogTail{}
+	filter := w.FirstFilter()
+
+	for count := 0; w.Cfg.IntervalCount == 0 || count < w.Cfg.IntervalCount; {
+
+		collator := NewLogTailCollator()
+		err := collatePages(ctx, store, filter, &collator)
+		if retryAfter, ok := massifs.IsRateLimiting(err); ok {
+			if retryAfter == 0 {
+				retryAfter = DefaultRateLimitBackoff
+			}
+			if err = sleepContext(ctx, retryAfter); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, tails := range []map[string]LogTail{collator.Massifs, collator.Seals} {
+			for _, tenant := range shuffleMapOfLogTails(tails) {
+				tail := tails[tenant]
+				key := tail.Ext + ":" + tenant
+				if prev, ok := seen[key]; ok && !tailIsNewer(prev, tail) {
+					continue
+				}
+				if err = handler(ctx, tail); err != nil {
+					return err
+				}
+				seen[key] = tail
+			}
+		}
+
+		count++
+		if w.Cfg.IntervalCount != 0 && count >= w.Cfg.IntervalCount {
+			break
+		}
+		if err = sleepContext(ctx, w.Cfg.Interval); err != nil {
+			return err
+		}
+		filter = w.NextFilter()
+	}
+	return nil
+}
+
+// collatePages collates every page of the filtered listing
+func collatePages(
+	ctx context.Context, store FilteredLister, filter string, collator *LogTailCollator,
+) error {
+	var marker string
+	for {
+		r, err := store.FilteredList(ctx, filter, massifs.WithListMarker(marker), massifs.WithListTags())
+		if err != nil {
+			return err
+		}
+		if err = collator.CollatePage(r.Items); err != nil {
+			return err
+		}
+		if r.Marker == "" {
+			return nil
+		}
+		marker = r.Marker
+	}
+}
+
+// tailIsNewer returns true if tail is for a later massif than prev, or the
+// same massif with a later lastid. The lastid hex strings are fixed width so
+// they compare lexically.
+func tailIsNewer(prev, tail LogTail) bool {
+	if tail.Number != prev.Number {
+		return tail.Number > prev.Number
+	}
+	return tail.LastID > prev.LastID
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/datatrails/go-datatrails-merklelog/massifs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pollingStore calls onPoll before each FilteredList, and rate limits the
+// polls listed in rateLimit
+type pollingStore struct {
+	*massifs.MemObjectStore
+	polls     int
+	rateLimit map[int]bool
+	onPoll    func(poll int)
+}
+
+func (s *pollingStore) FilteredList(
+	ctx context.Context, tagsFilter string, opts ...massifs.ObjectOption,
+) (*massifs.ObjectListResponse, error) {
+	poll := s.polls
+	s.polls++
+	if s.rateLimit[poll] {
+		return nil, &massifs.RateLimitError{RetryAfter: time.Millisecond}
+	}
+	if s.onPoll != nil {
+		s.onPoll(poll)
+	}
+	return s.MemObjectStore.FilteredList(ctx, tagsFilter, opts...)
+}
+
+func TestWatcherRun(t *testing.T) {
+	ctx := t.Context()
+
+	store := &pollingStore{MemObjectStore: massifs.NewMemObjectStore(), rateLimit: map[int]bool{1: true}}
+	put := func(path string, lastID uint64) {
+		_, err := store.Put(ctx, path, []byte{0}, massifs.WithPutTags(map[string]string{
+			massifs.TagKeyLastID: massifs.IDTimestampToHex(lastID, 1),
+		}))
+		require.NoError(t, err)
+	}
+	put(massifs.TenantMassifBlobPath("tenant/a", 0), 1)
+	put(massifs.TenantMassifBlobPath("tenant/a", 1), 2)
+	put(massifs.TenantMassifSignedRootPath("tenant/a", 0), 1)
+	put(massifs.TenantMassifBlobPath("tenant/b", 0), 3)
+
+	store.onPoll = func(poll int) {
+		switch poll {
+		case 2:
+			// tenant/a grows, tenant/b is seen again unchanged
+			put(massifs.TenantMassifBlobPath("tenant/a", 1), 4)
+		case 3:
+			put(massifs.TenantMassifSignedRootPath("tenant/b", 0), 3)
+		}
+	}
+
+	w := Watcher{Cfg: WatchConfig{
+		IDSince:       massifs.IDTimestampToHex(0, 1),
+		Interval:      time.Millisecond,
+		IntervalCount: 3,
+	}}
+
+	var handled []LogTail
+	err := w.Run(ctx, store, func(ctx context.Context, tail LogTail) error {
+		handled = append(handled, tail)
+		return nil
+	})
+	require.NoError(t, err)
+	// The rate limited poll is retried, and not counted
+	assert.Equal(t, 4, store.polls)
+
+	type seenTail struct {
+		tenant string
+		number uint32
+		ext    string
+		lastID string
+	}
+	var got []seenTail
+	for _, tail := range handled {
+		got = append(got, seenTail{tail.Tenant, tail.Number, tail.Ext, tail.LastID})
+	}
+	hex := func(id uint64) string { return massifs.IDTimestampToHex(id, 1) }
+	assert.ElementsMatch(t, []seenTail{
+		{"a", 1, massifs.V1MMRMassifExt, hex(2)},
+		{"a", 0, massifs.V1MMRSealSignedRootExt, hex(1)},
+		{"b", 0, massifs.V1MMRMassifExt, hex(3)},
+		{"a", 1, massifs.V1MMRMassifExt, hex(4)},
+		{"b", 0, massifs.V1MMRSealSignedRootExt, hex(3)},
+	}, got)
+
+	// A cancelled run returns the context error
+	ctx, cancel := context.WithCancel(ctx)
+	w.Cfg.IntervalCount = 0
+	err = w.Run(ctx, store, func(ctx context.Context, tail LogTail) error {
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -13,8 +13,12 @@ import (
 	// "github.com/datatrails/go-datatrails-common/azblob"
 )
 
+// The lastid tags are prefixed with the commitment epoch, see
+// massifs.IDTimestampToHex, so the filters below remain correct when the
+// horizon spans the start of a new epoch, and logs which cross into a new
+// epoch are still found.
+
 const (
-	currentEpoch    = uint8(1) // good until the end of the first unix epoch
 	DefaultInterval = time.Second * 1
 	// Azure promises tag index consistency within "seconds"
 	DefaultHorizon = time.Minute
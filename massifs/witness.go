@@ -0,0 +1,324 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	commoncbor "github.com/datatrails/go-datatrails-common/cbor"
+	commoncose "github.com/datatrails/go-datatrails-common/cose"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+// Witnesses protect verifiers against split views of a log. A log operator
+// could otherwise show different verifiers different, individually
+// consistent, logs. Each witness keeps the last state it witnessed for each
+// tenant log, and only countersigns a new state if it is consistent with that.
+// A verifier which requires the cosignatures of enough independent witnesses,
+// see WithRequiredWitnesses, can only be shown the log the witnesses saw.
+//
+// The cosignatures are COSE_Sign1 messages over the state of the seal,
+// including the peaks, with the tenant identity as the external data. Like the
+// seal, the payload is detached. The cosignatures are attached to the
+// unprotected header of the seal, see AttachWitnessCosignatures, as they are
+// produced after the seal is signed.
+
+const (
+	// SealWitnessCosignaturesLabel identifies the witness cosignatures in the
+	// unprotected header of a seal. It is allocated from the private range
+	// next to SealPeakReceiptsLabel.
+	SealWitnessCosignaturesLabel = SealPeakReceiptsLabel - 1
+)
+
+var (
+	ErrWitnessStateRegressed       = errors.New("the state is before the state last witnessed for the log")
+	ErrWitnessConsistencyRequired  = errors.New("a consistency proof from the state last witnessed is required")
+	ErrWitnessQuorum               = errors.New("the seal does not have enough verified witness cosignatures")
+	ErrWitnessCosignaturesInvalid  = errors.New("the seal witness cosignatures header is not a list of encoded messages")
+	ErrWitnessStateVersionRequired = errors.New("witnessing requires a state with peaks, version 1 or later")
+	ErrWitnessSealSubject          = errors.New("the seal is not for a massif of the tenant log")
+)
+
+// WitnessRequest is the state a sealer asks a witness to countersign.
+type WitnessRequest struct {
+	TenantIdentity string
+	// Seal is the encoded seal, signed by the log operator.
+	Seal []byte
+	// Peaks are the peaks of the sealed state, which are detached from the
+	// seal.
+	Peaks [][]byte
+	// ConsistencyProof is from the state last witnessed for the log, see
+	// WitnessCosigner.WitnessedSize. It is nil if the witness has not seen
+	// the log, or the size is unchanged.
+	ConsistencyProof *mmr.ConsistencyProof
+}
+
+// WitnessCosigner is implemented by Witness, and by clients of remote
+// witnesses.
+type WitnessCosigner interface {
+	// WitnessedSize returns the size of the state last witnessed for the
+	// log, or 0 if the log has not been witnessed.
+	WitnessedSize(ctx context.Context, tenantIdentity string) (uint64, error)
+	// Cosign verifies the requested state and returns the encoded
+	// cosignature.
+	Cosign(ctx context.Context, req WitnessRequest) ([]byte, error)
+}
+
+// Witness countersigns seals which are consistent with the states it has
+// previously witnessed. The first state seen for a log is trusted, callers
+// which persist the witnessed states should restore them with
+// SetWitnessedState.
+//
+// A Witness is safe for concurrent use.
+type Witness struct {
+	signer     IdentifiableCoseSigner
+	codec      commoncbor.CBORCodec
+	sealerKey  crypto.PublicKey
+	mu         sync.Mutex
+	lastStates map[string]MMRState
+}
+
+// NewWitness creates a witness which countersigns with signer. If sealerKey
+// is not nil, only seals signed with that key are countersigned. Otherwise the
+// key on the seal is used.
+func NewWitness(signer IdentifiableCoseSigner, codec commoncbor.CBORCodec, sealerKey crypto.PublicKey) *Witness {
+	return &Witness{
+		signer:     signer,
+		codec:      codec,
+		sealerKey:  sealerKey,
+		lastStates: map[string]MMRState{},
+	}
+}
+
+// WitnessedSize satisfies WitnessCosigner
+func (w *Witness) WitnessedSize(ctx context.Context, tenantIdentity string) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastStates[tenantIdentity].MMRSize, nil
+}
+
+// WitnessedState returns the state last witnessed for the log, and false if
+// the log has not been witnessed.
+func (w *Witness) WitnessedState(tenantIdentity string) (MMRState, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	state, ok := w.lastStates[tenantIdentity]
+	return state, ok
+}
+
+// SetWitnessedState sets the state which subsequent states for the log must
+// be consistent with.
+func (w *Witness) SetWitnessedState(tenantIdentity string, state MMRState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastStates[tenantIdentity] = state
+}
+
+// Cosign verifies the seal in the request, and that its state is consistent
+// with the state last witnessed for the log, and then returns the encoded
+// cosignature. The witnessed state is updated to the state of the seal.
+//
+// The seal must be for a massif of the tenant in the request. A state the same
+// size as the witnessed state must have the same peaks. A smaller state is
+// never countersigned.
+func (w *Witness) Cosign(ctx context.Context, req WitnessRequest) ([]byte, error) {
+
+	msg, state, err := DecodeSignedRoot(w.codec, req.Seal)
+	if err != nil {
+		return nil, err
+	}
+	if state.Version < int(MMRStateVersion1) || len(req.Peaks) == 0 {
+		return nil, ErrWitnessStateVersionRequired
+	}
+	state.Peaks = req.Peaks
+
+	// The cosignature is bound to the tenant, so the seal must be for it
+	if subject, _ := cwtSubject(msg); !isTenantMassifBlobPath(subject, req.TenantIdentity) {
+		return nil, fmt.Errorf("%w: tenant %s, subject %q", ErrWitnessSealSubject, req.TenantIdentity, subject)
+	}
+
+	pubKeyProvider, err := sealPublicKeyProvider(msg, w.sealerKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = VerifySignedCheckPoint(w.codec, pubKeyProvider, msg, state, nil); err != nil {
+		return nil, fmt.Errorf("%w: tenant %s: %v", ErrSealVerifyFailed, req.TenantIdentity, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if last, ok := w.lastStates[req.TenantIdentity]; ok {
+		if err = checkWitnessConsistency(req, last, state); err != nil {
+			return nil, err
+		}
+	}
+
+	cosignature, err := w.sign(req.TenantIdentity, state)
+	if err != nil {
+		return nil, err
+	}
+	w.lastStates[req.TenantIdentity] = state
+	return cosignature, nil
+}
+
+// isTenantMassifBlobPath returns true if the path is the blob path of a massif
+// of the tenant log, in any log instance.
+func isTenantMassifBlobPath(blobPath string, tenantIdentity string) bool {
+	rest, ok := strings.CutPrefix(blobPath, fmt.Sprintf("%s/%s/", V1MMRPrefix, tenantIdentity))
+	if !ok {
+		return false
+	}
+	var instance uint32
+	var number uint64
+	if _, err := fmt.Sscanf(rest, "%d/massifs/"+V1MMRBlobNameFmt, &instance, &number); err != nil {
+		return false
+	}
+	return TenantMassifInstanceBlobPath(tenantIdentity, instance, number) == blobPath
+}
+
+// checkWitnessConsistency checks the state is the same as, or an extension of,
+// the last witnessed state.
+func checkWitnessConsistency(req WitnessRequest, last, state MMRState) error {
+	if state.MMRSize < last.MMRSize {
+		return fmt.Errorf(
+			"%w: tenant %s: %d < %d", ErrWitnessStateRegressed, req.TenantIdentity, state.MMRSize, last.MMRSize)
+	}
+	if state.MMRSize == last.MMRSize {
+		if !slices.EqualFunc(state.Peaks, last.Peaks, bytes.Equal) {
+			return fmt.Errorf(
+				"%w: tenant %s: the peaks differ for MMR(%d)", ErrInconsistentState, req.TenantIdentity, state.MMRSize)
+		}
+		return nil
+	}
+	if req.ConsistencyProof == nil {
+		return fmt.Errorf(
+			"%w: tenant %s: %d -> %d", ErrWitnessConsistencyRequired, req.TenantIdentity, last.MMRSize, state.MMRSize)
+	}
+	return VerifyStateConsistency(*req.ConsistencyProof, last, state)
+}
+
+func (w *Witness) sign(tenantIdentity string, state MMRState) ([]byte, error) {
+
+	payload, err := w.codec.MarshalCBOR(state)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{
+				cose.HeaderLabelAlgorithm: w.signer.Algorithm(),
+				cose.HeaderLabelKeyID:     []byte(w.signer.KeyIdentifier()),
+			},
+		},
+		Payload: payload,
+	}
+	if err = msg.Sign(rand.Reader, []byte(tenantIdentity), w.signer); err != nil {
+		return nil, err
+	}
+
+	// As for the seal, verifiers must obtain the peaks from the log.
+	msg.Payload = nil
+	encodable, err := commoncose.NewCoseSign1Message(&msg)
+	if err != nil {
+		return nil, err
+	}
+	return encodable.MarshalCBOR()
+}
+
+// AttachWitnessCosignatures adds the cosignatures to the unprotected header of
+// the encoded seal, and returns the encoded result. The operator signature is
+// not affected.
+func AttachWitnessCosignatures(seal []byte, cosignatures [][]byte) ([]byte, error) {
+	msg, err := commoncose.NewCoseSign1MessageFromCBOR(seal, newCheckpointDecOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Headers.Unprotected == nil {
+		msg.Headers.Unprotected = cose.UnprotectedHeader{}
+	}
+	existing, err := WitnessCosignatures(msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Headers.Unprotected[SealWitnessCosignaturesLabel] = append(existing, cosignatures...)
+	// The raw header retained from decoding takes precedence when encoding
+	msg.Headers.RawUnprotected = nil
+	return msg.MarshalCBOR()
+}
+
+// WitnessCosignatures returns the encoded cosignatures attached to the seal.
+func WitnessCosignatures(msg *commoncose.CoseSign1Message) ([][]byte, error) {
+	value, ok := msg.Headers.Unprotected[SealWitnessCosignaturesLabel]
+	if !ok {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case [][]byte:
+		return v, nil
+	case []any:
+		cosignatures := make([][]byte, len(v))
+		for i, item := range v {
+			if cosignatures[i], ok = item.([]byte); !ok {
+				return nil, ErrWitnessCosignaturesInvalid
+			}
+		}
+		return cosignatures, nil
+	}
+	return nil, ErrWitnessCosignaturesInvalid
+}
+
+// VerifyWitnessCosignatures checks the seal has verified cosignatures from at
+// least required distinct witnesses. The witnesses are identified by the key
+// ids of their cosignatures, cosignatures from unknown witnesses, or which do
+// not verify, are not counted. The state must include the peaks, which are
+// obtained from the log, as for VerifySignedCheckPoint.
+func VerifyWitnessCosignatures(
+	codec commoncbor.CBORCodec, msg *commoncose.CoseSign1Message, tenantIdentity string, state MMRState,
+	required int, witnessKeys map[string]crypto.PublicKey,
+) error {
+
+	cosignatures, err := WitnessCosignatures(msg)
+	if err != nil {
+		return err
+	}
+	payload, err := codec.MarshalCBOR(state)
+	if err != nil {
+		return err
+	}
+
+	// Each witness is counted once, by its key, so a key listed under more
+	// than one kid does not count more than once.
+	var witnessed []crypto.PublicKey
+	for _, data := range cosignatures {
+		cosigned, err := commoncose.NewCoseSign1MessageFromCBOR(data, newCheckpointDecOptions()...)
+		if err != nil {
+			continue
+		}
+		kid, err := cosigned.KidFromProtectedHeader()
+		if err != nil {
+			continue
+		}
+		key, ok := witnessKeys[kid]
+		if !ok || slices.ContainsFunc(witnessed, func(k crypto.PublicKey) bool { return publicKeysEqual(k, key) }) {
+			continue
+		}
+		cosigned.Payload = payload
+		if cosigned.VerifyWithPublicKey(key, []byte(tenantIdentity)) != nil {
+			continue
+		}
+		witnessed = append(witnessed, key)
+	}
+	if len(witnessed) < required {
+		return fmt.Errorf(
+			"%w: tenant %s MMR(%d): %d of %d", ErrWitnessQuorum, tenantIdentity, state.MMRSize, len(witnessed), required)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package massifs
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/datatrails/go-datatrails-common/cbor"
+	"github.com/datatrails/go-datatrails-common/logger"
+	"github.com/datatrails/go-datatrails-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func newTestWitness(t *testing.T, kid string, codec cbor.CBORCodec) (*Witness, crypto.PublicKey) {
+	key := TestGenerateECKey(t, elliptic.P256())
+	signer, err := NewTestKeyCoseSigner(cose.AlgorithmES256, &key, kid)
+	require.NoError(t, err)
+	return NewWitness(signer, codec, nil), &key.PublicKey
+}
+
+func TestWitness(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	log := newTestLog(t, tenant, 3, testLeafEntries(0, 3))
+	store, codec, signer := log.store, log.codec, log.signer
+
+	witnessA, keyA := newTestWitness(t, "witness-a", codec)
+	witnessB, keyB := newTestWitness(t, "witness-b", codec)
+	keys := map[string]crypto.PublicKey{"witness-a": keyA, "witness-b": keyB}
+
+	sealer := NewSealer(nil, store, signer.RootSigner, signer.CoseSigner, codec)
+	sealer.SetWitnesses(2, witnessA, witnessB)
+
+	reader := NewMassifReader(nil, store)
+	sealReader := log.sealReader()
+	opts := []ReaderOption{WithSealGetter(&sealReader), WithCBORCodec(codec)}
+
+	// Seal 3 leaves, then grow into massif 1, so the witnesses are given
+	// proofs from the states they witnessed
+	_, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	log.addLeaves(t, testLeafEntries(3, 3))
+	state, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	witnessed, ok := witnessA.WitnessedState(tenant)
+	require.True(t, ok)
+	assert.Equal(t, state.MMRSize, witnessed.MMRSize)
+
+	for massifIndex := range uint64(2) {
+		_, err = reader.GetVerifiedContext(
+			ctx, tenant, massifIndex, append(opts, WithRequiredWitnesses(2, keys))...)
+		require.NoError(t, err)
+	}
+
+	// Cosignatures from unknown witnesses don't count
+	_, err = reader.GetVerifiedContext(
+		ctx, tenant, 1, append(opts, WithRequiredWitnesses(2, map[string]crypto.PublicKey{"witness-a": keyA}))...)
+	assert.ErrorIs(t, err, ErrWitnessQuorum)
+	_, err = reader.GetVerifiedContext(
+		ctx, tenant, 1, append(opts, WithRequiredWitnesses(2, map[string]crypto.PublicKey{
+			"witness-a": keyB, "witness-b": keyA}))...)
+	assert.ErrorIs(t, err, ErrWitnessQuorum)
+
+	// A seal without cosignatures is not accepted when witnesses are required
+	sealed, err := signer.SealedState(tenant, 1, *state)
+	require.NoError(t, err)
+	data, err := sealed.Sign1Message.MarshalCBOR()
+	require.NoError(t, err)
+	_, err = store.Put(ctx, TenantMassifSignedRootPath(tenant, 1), data)
+	require.NoError(t, err)
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, opts...)
+	require.NoError(t, err)
+	_, err = reader.GetVerifiedContext(ctx, tenant, 1, append(opts, WithRequiredWitnesses(1, keys))...)
+	assert.ErrorIs(t, err, ErrWitnessQuorum)
+
+	// The cosignatures are bound to the tenant
+	cosignature, err := witnessA.Cosign(ctx, WitnessRequest{TenantIdentity: tenant, Seal: data, Peaks: state.Peaks})
+	require.NoError(t, err)
+	data, err = AttachWitnessCosignatures(data, [][]byte{cosignature})
+	require.NoError(t, err)
+	msg, _, err := DecodeSignedRoot(codec, data)
+	require.NoError(t, err)
+	require.NoError(t, VerifyWitnessCosignatures(codec, msg, tenant, *state, 1, keys))
+	assert.ErrorIs(t, VerifyWitnessCosignatures(codec, msg, "tenant/2", *state, 1, keys), ErrWitnessQuorum)
+
+	// A witness will not cosign the seal of one tenant for another
+	_, err = witnessB.Cosign(ctx, WitnessRequest{TenantIdentity: "tenant/2", Seal: data, Peaks: state.Peaks})
+	assert.ErrorIs(t, err, ErrWitnessSealSubject)
+
+	// A witness key listed under more than one kid counts once
+	key := TestGenerateECKey(t, elliptic.P256())
+	var cosignatures [][]byte
+	for _, kid := range []string{"witness-c", "witness-d"} {
+		keySigner, err := NewTestKeyCoseSigner(cose.AlgorithmES256, &key, kid)
+		require.NoError(t, err)
+		cosignature, err := NewWitness(keySigner, codec, nil).Cosign(
+			ctx, WitnessRequest{TenantIdentity: tenant, Seal: data, Peaks: state.Peaks})
+		require.NoError(t, err)
+		cosignatures = append(cosignatures, cosignature)
+	}
+	data, err = AttachWitnessCosignatures(data, cosignatures)
+	require.NoError(t, err)
+	msg, _, err = DecodeSignedRoot(codec, data)
+	require.NoError(t, err)
+	sameKey := map[string]crypto.PublicKey{"witness-c": &key.PublicKey, "witness-d": &key.PublicKey}
+	require.NoError(t, VerifyWitnessCosignatures(codec, msg, tenant, *state, 1, sameKey))
+	assert.ErrorIs(t, VerifyWitnessCosignatures(codec, msg, tenant, *state, 2, sameKey), ErrWitnessQuorum)
+	sameKey["witness-a"] = keyA
+	require.NoError(t, VerifyWitnessCosignatures(codec, msg, tenant, *state, 2, sameKey))
+}
+
+func TestIsTenantMassifBlobPath(t *testing.T) {
+	tenant := "tenant/1"
+	assert.True(t, isTenantMassifBlobPath(TenantMassifBlobPath(tenant, 3), tenant))
+	assert.True(t, isTenantMassifBlobPath(TenantMassifInstanceBlobPath(tenant, 2, 17), tenant))
+	assert.False(t, isTenantMassifBlobPath(TenantMassifBlobPath("tenant/2", 3), tenant))
+	assert.False(t, isTenantMassifBlobPath(TenantMassifBlobPath("tenant/1/x", 3), tenant))
+	assert.False(t, isTenantMassifBlobPath(TenantMassifSignedRootPath(tenant, 3), tenant))
+	assert.False(t, isTenantMassifBlobPath(TenantMassifBlobPath(tenant, 3)+".x", tenant))
+	assert.False(t, isTenantMassifBlobPath("", tenant))
+}
+
+// TestWitness_SplitView checks a witness will not countersign a different log
+// for a tenant it has already witnessed.
+func TestWitness_SplitView(t *testing.T) {
+	logger.New("TEST")
+	ctx := t.Context()
+	tenant := "tenant/1"
+
+	codec, err := NewRootSignerCodec()
+	require.NoError(t, err)
+	witness, _ := newTestWitness(t, "witness-a", codec)
+
+	newLog := func(base uint64) (*testLog, *Sealer) {
+		log := newTestLog(t, tenant, 3, testLeafEntries(base, 2))
+		sealer := NewSealer(nil, log.store, log.signer.RootSigner, log.signer.CoseSigner, codec)
+		sealer.SetWitnesses(1, witness)
+		return log, sealer
+	}
+	log, sealer := newLog(0)
+	fork, forkSealer := newLog(100)
+
+	_, err = sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+
+	// The same size, but different peaks
+	_, err = forkSealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrWitnessQuorum)
+
+	// A larger log which does not extend the witnessed log
+	fork.addLeaves(t, testLeafEntries(102, 1))
+	_, err = forkSealer.SealTenant(ctx, tenant)
+	assert.ErrorIs(t, err, ErrWitnessQuorum)
+
+	// The witnessed log can still be extended
+	log.addLeaves(t, testLeafEntries(2, 1))
+	state, err := sealer.SealTenant(ctx, tenant)
+	require.NoError(t, err)
+	witnessed, _ := witness.WitnessedState(tenant)
+	assert.Equal(t, state.MMRSize, witnessed.MMRSize)
+
+	// Directly, the reasons for refusing the fork are reported
+	forkMC, err := forkSealer.massifs.GetHeadMassif(ctx, tenant)
+	require.NoError(t, err)
+	forkState := *state
+	forkState.Peaks, err = mmr.PeakHashes(&forkMC, state.MMRSize-1)
+	require.NoError(t, err)
+	sealed, err := log.signer.SealedState(tenant, 0, forkState)
+	require.NoError(t, err)
+	data, err := sealed.Sign1Message.MarshalCBOR()
+	require.NoError(t, err)
+	_, err = witness.Cosign(ctx, WitnessRequest{TenantIdentity: tenant, Seal: data, Peaks: forkState.Peaks})
+	assert.ErrorIs(t, err, ErrInconsistentState)
+
+	smaller := *state
+	smaller.MMRSize = 1
+	smaller.Peaks = forkState.Peaks[:1]
+	sealed, err = log.signer.SealedState(tenant, 0, smaller)
+	require.NoError(t, err)
+	data, err = sealed.Sign1Message.MarshalCBOR()
+	require.NoError(t, err)
+	_, err = witness.Cosign(ctx, WitnessRequest{TenantIdentity: tenant, Seal: data, Peaks: smaller.Peaks})
+	assert.ErrorIs(t, err, ErrWitnessStateRegressed)
+}
@@ -80,3 +80,71 @@ func AddHashedLeaf(store NodeAppender, hasher hash.Hash, hashedLeaf []byte) (uin
 	}
 	return i, nil
 }
+
+// AddHashedLeaves adds each of the leaves, in order, to the mmr and back fills
+// the interior nodes in a single pass.
+//
+// The result is identical to calling AddHashedLeaf for each leaf. The
+// difference is that the interior nodes created by the batch are retained on a
+// stack, so the left sibling of a new interior node is only read from the
+// store if it was present before the batch was added. The store is accessed
+// in the same order as AddHashedLeaf would access it for the ancestors of the
+// last leaf.
+//
+// Returns the mmr index of each leaf and the size of the mmr after addition of
+// the last leaf. On error the store should be considered corrupt.
+func AddHashedLeaves(store NodeAppender, hasher hash.Hash, hashedLeaves [][]byte) ([]uint64, uint64, error) {
+
+	type node struct {
+		i     uint64
+		value []byte
+	}
+
+	var err error
+	var i uint64
+
+	// spine holds the nodes created by this batch which are currently peaks.
+	var spine []node
+	leafIndices := make([]uint64, 0, len(hashedLeaves))
+
+	for _, hashedLeaf := range hashedLeaves {
+
+		if i, err = store.Append(hashedLeaf); err != nil {
+			return nil, 0, err
+		}
+		leafIndices = append(leafIndices, i-1)
+		spine = append(spine, node{i - 1, hashedLeaf})
+
+		// See AddHashedLeaf for the explanation of the back fill
+		height := uint64(0)
+		for IndexHeight(i) > height {
+
+			iLeft := i - (2 << height)
+
+			// The right child is always the node just added
+			right := spine[len(spine)-1]
+			spine = spine[:len(spine)-1]
+
+			var left []byte
+			if len(spine) > 0 && spine[len(spine)-1].i == iLeft {
+				left = spine[len(spine)-1].value
+				spine = spine[:len(spine)-1]
+			} else if left, err = store.Get(iLeft); err != nil {
+				return nil, 0, err
+			}
+
+			hasher.Reset()
+			HashWriteUint64(hasher, i+1)
+			hasher.Write(left)
+			hasher.Write(right.value)
+			value := hasher.Sum(nil)
+
+			if i, err = store.Append(value); err != nil {
+				return nil, 0, err
+			}
+			spine = append(spine, node{i - 1, value})
+			height += 1
+		}
+	}
+	return leafIndices, i, nil
+}
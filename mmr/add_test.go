@@ -1,8 +1,10 @@
 package mmr
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"hash"
+	"slices"
 	"testing"
 )
 
@@ -76,3 +78,48 @@ func TestAddHashedLeaf(t *testing.T) {
 		})
 	}
 }
+
+// TestAddHashedLeaves checks the batch addition produces exactly the same mmr
+// as adding the leaves one at a time, regardless of how the leaves are batched.
+func TestAddHashedLeaves(t *testing.T) {
+
+	leafCount := 39
+	var leaves [][]byte
+	for i := range leafCount {
+		leaves = append(leaves, hashNum(uint64(i)))
+	}
+
+	want := NewTestDb(t)
+	var wantIndices []uint64
+	for _, leaf := range leaves {
+		if _, err := AddHashedLeaf(want, sha256.New(), leaf); err != nil {
+			t.Fatalf("AddHashedLeaf() err: %v", err)
+		}
+		wantIndices = append(wantIndices, MMRIndex(uint64(len(wantIndices))))
+	}
+
+	for _, batchSize := range []int{1, 2, 3, 7, 16, leafCount} {
+		db := NewTestDb(t)
+		var gotIndices []uint64
+		var size uint64
+		for start := 0; start < leafCount; start += batchSize {
+			indices, gotSize, err := AddHashedLeaves(db, sha256.New(), leaves[start:min(start+batchSize, leafCount)])
+			if err != nil {
+				t.Fatalf("AddHashedLeaves() err: %v", err)
+			}
+			gotIndices = append(gotIndices, indices...)
+			size = gotSize
+		}
+		if size != want.Next() {
+			t.Errorf("AddHashedLeaves(batch %d) size = %d, want %d", batchSize, size, want.Next())
+		}
+		for i := range size {
+			if !bytes.Equal(db.mustGet(i), want.mustGet(i)) {
+				t.Fatalf("AddHashedLeaves(batch %d) node %d differs", batchSize, i)
+			}
+		}
+		if !slices.Equal(gotIndices, wantIndices) {
+			t.Errorf("AddHashedLeaves(batch %d) indices = %v, want %v", batchSize, gotIndices, wantIndices)
+		}
+	}
+}
@@ -47,3 +47,21 @@ func IncludedRoot(hasher hash.Hash, i uint64, nodeHash []byte, proof [][]byte) [
 
 	return root
 }
+
+// IncludedRootIndex returns the index of the node produced by IncludedRoot for
+// a proof of length proofLen for the node at i. When the proof is complete,
+// this is the index of the accumulator peak committing i.
+func IncludedRootIndex(i uint64, proofLen int) uint64 {
+
+	g := IndexHeight(i)
+
+	for range proofLen {
+		if IndexHeight(i+1) > g {
+			i = i + 1
+		} else {
+			i = i + (2 << g)
+		}
+		g = g + 1
+	}
+	return i
+}
@@ -0,0 +1,49 @@
+package mmr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncludedRootIndex(t *testing.T) {
+
+	//	3              14
+	//	             /    \
+	//	            /      \
+	//	           /        \
+	//	          /          \
+	//	2        6            13           21
+	//	       /   \        /    \
+	//	1     2     5      9     12     17     20     24
+	//	     / \   / \    / \   /  \   /  \
+	//	0   0   1 3   4  7   8 10  11 15  16 18  19 22  23   25
+	tests := []struct {
+		i        uint64
+		proofLen int
+		want     uint64
+	}{
+		{0, 0, 0},
+		{0, 1, 2},
+		{0, 3, 14},
+		{4, 1, 5},
+		{4, 2, 6},
+		{12, 1, 13},
+		{15, 2, 21},
+		{19, 1, 20},
+		{13, 1, 14},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IncludedRootIndex(tt.i, tt.proofLen), "i=%d, len=%d", tt.i, tt.proofLen)
+	}
+
+	// For a complete proof, the index is the peak committing i
+	db := NewGeneratedTestDB(t, 26)
+	for i := range uint64(26) {
+		proof, err := InclusionProof(db, 25, i)
+		require.NoError(t, err)
+		root := IncludedRootIndex(i, len(proof))
+		assert.Contains(t, Peaks(25), root, "i=%d", i)
+	}
+}